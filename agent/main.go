@@ -6,14 +6,19 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -23,6 +28,8 @@ import (
 
 	gkmv1alpha1 "github.com/redhat-et/GKM/api/v1alpha1"
 	gkmAgent "github.com/redhat-et/GKM/internal/controller/gkm-agent"
+	"github.com/redhat-et/GKM/mcv/pkg/registries"
+	"github.com/redhat-et/GKM/pkg/extract"
 	"github.com/redhat-et/GKM/pkg/utils"
 )
 
@@ -68,6 +75,200 @@ func main() {
 	}
 	setupLog.Info("KUBE_NODE_NAME processing", "Node", nodeName)
 
+	// Maximum number of extractions running at once on this Node, for both Job and in-agent
+	// extraction. Extractions beyond this wait in the ExtractQueue, ordered by priority.
+	//
+	// MCV keeps the state of an extraction in package level variables, so a process runs one
+	// extraction at a time, see extract.ExtractCache. In-agent extraction defaults to one
+	// worker, and more are rejected, since they would only wait for each other.
+	extractWorkers := utils.ExtractWorkersDefault
+	if os.Getenv("EXTRACT_MODE") == utils.ExtractModeAgent {
+		extractWorkers = 1
+	}
+	if tmpWorkers := os.Getenv("EXTRACT_WORKERS"); tmpWorkers != "" {
+		workers, err := strconv.Atoi(tmpWorkers)
+		if err != nil || workers < 1 {
+			setupLog.Info("Invalid EXTRACT_WORKERS, using default", "EXTRACT_WORKERS", tmpWorkers)
+		} else if workers > 1 && os.Getenv("EXTRACT_MODE") == utils.ExtractModeAgent {
+			setupLog.Error(fmt.Errorf("EXTRACT_WORKERS %d not supported with EXTRACT_MODE %s", workers, utils.ExtractModeAgent),
+				"In-agent extraction runs one extraction at a time, set gkm.extract.workers to 1")
+			os.Exit(1)
+		} else {
+			extractWorkers = workers
+		}
+	}
+	extractQueue := gkmAgent.NewExtractQueue(extractWorkers)
+	setupLog.Info("EXTRACT_WORKERS processing", "workers", extractWorkers)
+
+	// Maximum number of registry pulls running at once across the cluster. 0 is no limit.
+	maxRegistryPulls := utils.ExtractMaxPullsDefault
+	if tmpPulls := os.Getenv("EXTRACT_MAX_REGISTRY_PULLS"); tmpPulls != "" {
+		pulls, err := strconv.Atoi(tmpPulls)
+		if err != nil || pulls < 0 {
+			setupLog.Info("Invalid EXTRACT_MAX_REGISTRY_PULLS, using default", "EXTRACT_MAX_REGISTRY_PULLS", tmpPulls)
+		} else {
+			maxRegistryPulls = pulls
+		}
+	}
+	setupLog.Info("EXTRACT_MAX_REGISTRY_PULLS processing", "maxRegistryPulls", maxRegistryPulls)
+
+	// In-agent extraction: extract in this process instead of launching a Job per extraction.
+	var extractor *gkmAgent.Extractor
+	if os.Getenv("EXTRACT_MODE") == utils.ExtractModeAgent {
+		extractor = gkmAgent.NewExtractor(
+			utils.AgentCacheDir,
+			extractWorkers,
+			noGpu,
+			ctrl.Log.WithName("extractor"),
+		)
+		setupLog.Info("Extract Mode set to agent", "workers", extractWorkers)
+	}
+
+	// Cache of the image layers pulled by in-agent extraction, in the host cache directory, so
+	// an image is not pulled again when it is extracted again. "0" disables the cache.
+	layerCacheSize := resource.MustParse(utils.LayerCacheSizeDefault)
+	if tmpSize := os.Getenv("LAYER_CACHE_SIZE"); tmpSize != "" {
+		size, err := resource.ParseQuantity(tmpSize)
+		if err != nil || size.Sign() < 0 {
+			setupLog.Info("Invalid LAYER_CACHE_SIZE, using default", "LAYER_CACHE_SIZE", tmpSize)
+		} else {
+			layerCacheSize = size
+		}
+	}
+	if extractor != nil {
+		if layerCacheSize.IsZero() {
+			extract.SetLayerCache("", -1)
+		} else {
+			extract.SetLayerCache(filepath.Join(utils.AgentCacheDir, extract.LayerCacheDirName), layerCacheSize.Value())
+		}
+	}
+	setupLog.Info("LAYER_CACHE_SIZE processing",
+		"layerCacheSize", layerCacheSize.String(), "enabled", extractor != nil && !layerCacheSize.IsZero())
+
+	// Layer server, serving the layer cache to the extractions on the other Nodes, which fetch
+	// layers from the Agents that extracted the same digest before pulling from the registry.
+	// Only Agents with a layer cache serve layers, but extraction Jobs fetch from peers as well.
+	layerPeerPort := utils.LayerPeerPortDefault
+	if tmpPort := os.Getenv("LAYER_PEER_PORT"); tmpPort != "" {
+		port, err := strconv.Atoi(tmpPort)
+		if err != nil || port < 0 || port > 65535 {
+			setupLog.Info("Invalid LAYER_PEER_PORT, using default", "LAYER_PEER_PORT", tmpPort)
+		} else {
+			layerPeerPort = port
+		}
+	}
+	podIP := os.Getenv("POD_IP")
+	layerPeers := layerPeerPort > 0
+	var layerServer *gkmAgent.LayerServer
+	if layerPeers && extractor != nil && !layerCacheSize.IsZero() {
+		if podIP == "" {
+			setupLog.Info("POD_IP not set, layer server disabled")
+		} else {
+			layerServer = gkmAgent.NewLayerServer(
+				filepath.Join(utils.AgentCacheDir, extract.LayerCacheDirName),
+				layerPeerPort,
+				podIP,
+				ctrl.Log.WithName("layerserver"),
+			)
+		}
+	}
+	setupLog.Info("LAYER_PEER_PORT processing",
+		"layerPeerPort", layerPeerPort, "podIP", podIP, "layerPeers", layerPeers, "layerServer", layerServer != nil)
+
+	// Registries configuration of the cluster, from the optional gkm-registries ConfigMap. It
+	// is read on each pull, so changes apply without restarting the Agent. Extraction Jobs
+	// receive it in their environment.
+	if extractor != nil {
+		extract.SetRegistries(registries.FromDir(utils.RegistriesConfigDir))
+	}
+	_, confErr := os.Stat(filepath.Join(utils.RegistriesConfigDir, registries.ConfFileName))
+	_, caErr := os.Stat(filepath.Join(utils.RegistriesConfigDir, registries.CABundleFileName))
+	setupLog.Info("Registries configuration", "dir", utils.RegistriesConfigDir,
+		"registriesConf", confErr == nil, "caBundle", caErr == nil)
+
+	// The caches are only on the filesystem of the Node, in the host cache directory, when they
+	// back the hostPath PVs the Agent creates, in a KIND Cluster or with in-agent extraction.
+	// Otherwise, extraction Jobs write them to PVCs provisioned by the StorageClass, which the
+	// Agent does not mount, so they cannot be scrubbed or measured by the Agent.
+	hostCaches := kindCluster || extractor != nil
+	if !hostCaches {
+		setupLog.Info("Caches are extracted by Jobs to PVCs provisioned by the StorageClass, " +
+			"scrubbing and disk usage reporting are disabled")
+	}
+
+	// Periodic scrubbing of the extracted caches in the host cache directory.
+	scrubInterval := utils.ScrubIntervalDefault
+	if tmpInterval := os.Getenv("SCRUB_INTERVAL"); tmpInterval != "" {
+		interval, err := time.ParseDuration(tmpInterval)
+		if err != nil || interval < 0 {
+			setupLog.Info("Invalid SCRUB_INTERVAL, using default", "SCRUB_INTERVAL", tmpInterval)
+		} else {
+			scrubInterval = interval
+		}
+	}
+	var scrubber *gkmAgent.Scrubber
+	if scrubInterval > 0 && hostCaches {
+		scrubber = gkmAgent.NewScrubber(
+			utils.AgentCacheDir,
+			scrubInterval,
+			ctrl.Log.WithName("scrubber"),
+		)
+	}
+	setupLog.Info("SCRUB_INTERVAL processing", "scrubInterval", scrubInterval, "enabled", scrubber != nil)
+
+	// Eviction of unused caches from the host cache directory, when they use more than the cache
+	// budget or the Node reports DiskPressure. A budget of 0 is no budget.
+	cacheBudget := resource.MustParse(utils.CacheBudgetDefault)
+	if tmpBudget := os.Getenv("CACHE_BUDGET"); tmpBudget != "" {
+		budget, err := resource.ParseQuantity(tmpBudget)
+		if err != nil || budget.Sign() < 0 {
+			setupLog.Info("Invalid CACHE_BUDGET, using default", "CACHE_BUDGET", tmpBudget)
+		} else {
+			cacheBudget = budget
+		}
+	}
+	evictInterval := utils.EvictIntervalDefault
+	if tmpInterval := os.Getenv("EVICT_INTERVAL"); tmpInterval != "" {
+		interval, err := time.ParseDuration(tmpInterval)
+		if err != nil || interval < 0 {
+			setupLog.Info("Invalid EVICT_INTERVAL, using default", "EVICT_INTERVAL", tmpInterval)
+		} else {
+			evictInterval = interval
+		}
+	}
+	evictEnabled := evictInterval > 0
+	setupLog.Info("CACHE_BUDGET and EVICT_INTERVAL processing",
+		"cacheBudget", cacheBudget.String(), "evictInterval", evictInterval, "enabled", evictEnabled)
+
+	// Reporting of the disk usage of the caches in the host cache directory.
+	diskUsageInterval := utils.DiskUsageIntervalDefault
+	if tmpInterval := os.Getenv("DISK_USAGE_INTERVAL"); tmpInterval != "" {
+		interval, err := time.ParseDuration(tmpInterval)
+		if err != nil || interval < 0 {
+			setupLog.Info("Invalid DISK_USAGE_INTERVAL, using default", "DISK_USAGE_INTERVAL", tmpInterval)
+		} else {
+			diskUsageInterval = interval
+		}
+	}
+	cacheDedup := os.Getenv("CACHE_DEDUP") != "false"
+	var diskMonitor *gkmAgent.DiskMonitor
+	if diskUsageInterval > 0 && hostCaches {
+		diskMonitor = gkmAgent.NewDiskMonitor(
+			utils.AgentCacheDir,
+			diskUsageInterval,
+			cacheDedup,
+			ctrl.Log.WithName("diskmonitor"),
+		)
+	}
+	setupLog.Info("DISK_USAGE_INTERVAL and CACHE_DEDUP processing",
+		"diskUsageInterval", diskUsageInterval, "cacheDedup", cacheDedup, "enabled", diskMonitor != nil)
+
+	// The Agent reads the images the container runtime of the Node has already pulled through
+	// its socket, when it is configured and mounted in the Agent.
+	criSocket := os.Getenv("CRI_SOCKET")
+	extract.SetCRISocket(criSocket)
+	setupLog.Info("CRI_SOCKET processing", "criSocket", criSocket)
+
 	extractImage := utils.JobExtractImage
 	tmpExtractImage := os.Getenv("EXTRACT_IMAGE")
 	if tmpExtractImage != "" {
@@ -161,6 +362,38 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Client-go Clientset is used to read the log of failed Job Pods, which the
+	// controller-runtime Client does not support.
+	kubeClient, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create Kubernetes clientset")
+		os.Exit(1)
+	}
+
+	// Without caches on the Node, the Evictor deletes the PVCs the extraction Jobs wrote to.
+	evictCacheDir := ""
+	if hostCaches {
+		evictCacheDir = utils.AgentCacheDir
+	}
+	var evictor *gkmAgent.Evictor
+	if evictEnabled {
+		evictor = gkmAgent.NewEvictor(
+			mgr.GetClient(),
+			mgr.GetAPIReader(),
+			nodeName,
+			evictCacheDir,
+			cacheBudget.Value(),
+			evictInterval,
+			ctrl.Log.WithName("evictor"),
+		)
+	}
+
+	// The ExtractQueue renews the registry pull slots while the extractions run, not only when
+	// the Cache is reconciled.
+	if maxRegistryPulls > 0 {
+		extractQueue.EnablePullLeases(mgr.GetClient(), maxRegistryPulls, ctrl.Log.WithName("extractqueue"))
+	}
+
 	// Index Pods by spec.nodeName
 	ctx := context.Background()
 	if err := mgr.GetFieldIndexer().IndexField(
@@ -185,16 +418,27 @@ func main() {
 		gkmv1alpha1.GKMCacheNode,
 		gkmv1alpha1.GKMCacheNodeList,
 	]{
-		Client:          mgr.GetClient(),
-		Scheme:          mgr.GetScheme(),
-		Recorder:        mgr.GetEventRecorderFor("GKM-Agent-NS"),
-		NodeName:        nodeName,
-		NoGpu:           noGpu,
-		KindCluster:     kindCluster,
-		ExtractLogLevel: extractLogLevel,
-		ExtractImage:    extractImage,
-		CrdCacheStr:     utils.CrdGKMCache,
-		CrdCacheNodeStr: utils.CrdGKMCacheNode,
+		Client:           mgr.GetClient(),
+		Scheme:           mgr.GetScheme(),
+		Recorder:         mgr.GetEventRecorderFor("GKM-Agent-NS"),
+		KubeClient:       kubeClient,
+		SecretReader:     mgr.GetAPIReader(),
+		NodeName:         nodeName,
+		NoGpu:            noGpu,
+		KindCluster:      kindCluster,
+		CacheDir:         utils.AgentCacheDir,
+		ExtractLogLevel:  extractLogLevel,
+		ExtractImage:     extractImage,
+		Extractor:        extractor,
+		Scrubber:         scrubber,
+		Evictor:          evictor,
+		DiskMonitor:      diskMonitor,
+		LayerServer:      layerServer,
+		LayerPeers:       layerPeers,
+		ExtractQueue:     extractQueue,
+		MaxRegistryPulls: maxRegistryPulls,
+		CrdCacheStr:      utils.CrdGKMCache,
+		CrdCacheNodeStr:  utils.CrdGKMCacheNode,
 	}
 	if err = (&gkmAgent.GKMCacheAgentReconciler{
 		ReconcilerCommonAgent: commonNs,
@@ -209,16 +453,27 @@ func main() {
 		gkmv1alpha1.ClusterGKMCacheNode,
 		gkmv1alpha1.ClusterGKMCacheNodeList,
 	]{
-		Client:          mgr.GetClient(),
-		Scheme:          mgr.GetScheme(),
-		Recorder:        mgr.GetEventRecorderFor("GKM-Agent-CL"),
-		NodeName:        nodeName,
-		NoGpu:           noGpu,
-		KindCluster:     kindCluster,
-		ExtractLogLevel: extractLogLevel,
-		ExtractImage:    extractImage,
-		CrdCacheStr:     utils.CrdClusterGKMCache,
-		CrdCacheNodeStr: utils.CrdClusterGKMCacheNode,
+		Client:           mgr.GetClient(),
+		Scheme:           mgr.GetScheme(),
+		Recorder:         mgr.GetEventRecorderFor("GKM-Agent-CL"),
+		KubeClient:       kubeClient,
+		SecretReader:     mgr.GetAPIReader(),
+		NodeName:         nodeName,
+		NoGpu:            noGpu,
+		KindCluster:      kindCluster,
+		CacheDir:         utils.AgentCacheDir,
+		ExtractLogLevel:  extractLogLevel,
+		ExtractImage:     extractImage,
+		Extractor:        extractor,
+		Scrubber:         scrubber,
+		Evictor:          evictor,
+		DiskMonitor:      diskMonitor,
+		LayerServer:      layerServer,
+		LayerPeers:       layerPeers,
+		ExtractQueue:     extractQueue,
+		MaxRegistryPulls: maxRegistryPulls,
+		CrdCacheStr:      utils.CrdClusterGKMCache,
+		CrdCacheNodeStr:  utils.CrdClusterGKMCacheNode,
 	}
 	if err = (&gkmAgent.ClusterGKMCacheAgentReconciler{
 		ReconcilerCommonAgent: commonCl,
@@ -229,6 +484,65 @@ func main() {
 
 	// +kubebuilder:scaffold:builder
 
+	// The registry pull slots of the running extractions are renewed for both reconcilers.
+	if maxRegistryPulls > 0 {
+		if err := mgr.Add(extractQueue); err != nil {
+			setupLog.Error(err, "unable to set up registry pull slot renewal")
+			os.Exit(1)
+		}
+	}
+
+	// The Extractor workers are shared by both reconcilers and run with the manager.
+	if extractor != nil {
+		if err := mgr.Add(extractor); err != nil {
+			setupLog.Error(err, "unable to set up in-agent extraction")
+			os.Exit(1)
+		}
+	}
+	if scrubber != nil {
+		if err := mgr.Add(scrubber); err != nil {
+			setupLog.Error(err, "unable to set up cache scrubbing")
+			os.Exit(1)
+		}
+	}
+	if evictor != nil {
+		if err := mgr.Add(evictor); err != nil {
+			setupLog.Error(err, "unable to set up cache eviction")
+			os.Exit(1)
+		}
+	}
+	if diskMonitor != nil {
+		if err := mgr.Add(diskMonitor); err != nil {
+			setupLog.Error(err, "unable to set up disk usage reporting")
+			os.Exit(1)
+		}
+	}
+	if layerServer != nil {
+		if err := mgr.Add(layerServer); err != nil {
+			setupLog.Error(err, "unable to set up the layer server")
+			os.Exit(1)
+		}
+	}
+	if layerPeers && extractor != nil {
+		// In-agent extraction looks up the peers when the extraction starts, from the cached
+		// GKMCacheNodes and ClusterGKMCacheNodes.
+		peerClient := mgr.GetClient()
+		extract.SetLayerPeers(func(digest string) []string {
+			peers, err := gkmAgent.FindLayerPeers(context.Background(), peerClient, nodeName, digest)
+			if err != nil {
+				setupLog.Info("unable to find layer peers", "digest", digest, "err", err)
+				return nil
+			}
+			return peers
+		})
+	}
+
+	if extractor != nil {
+		// In-agent extraction pulls with the credentials in the image pull Secrets the
+		// extraction was submitted with.
+		extract.SetRegistryAuth(extractor.RegistryAuth)
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -101,6 +101,28 @@ func (cache ClusterGKMCache) GetAccessMode() []corev1.PersistentVolumeAccessMode
 	return cache.Spec.AccessModes
 }
 
+func (cache ClusterGKMCache) GetMountMode() MountMode {
+	if cache.Spec.MountMode == "" {
+		return MountModePVC
+	}
+	return cache.Spec.MountMode
+}
+
+func (cache ClusterGKMCache) GetPriority() int32 {
+	return cache.Spec.Priority
+}
+
+func (cache ClusterGKMCache) GetTTLSecondsAfterUnused() *int64 {
+	return cache.Spec.TTLSecondsAfterUnused
+}
+
+func (cache ClusterGKMCache) GetTTLAction() TTLAction {
+	if cache.Spec.TTLAction == "" {
+		return TTLActionDelete
+	}
+	return cache.Spec.TTLAction
+}
+
 func (cache ClusterGKMCache) GetWorkloadNamespaces() []string {
 	return cache.Spec.WorkloadNamespaces
 }
@@ -121,6 +143,16 @@ func (cache ClusterGKMCache) GetImage() string {
 	return cache.Spec.Image
 }
 
+// GetImagePullSecrets returns the namespace and names of the Secrets holding the
+// credentials to pull the image.
+func (cache ClusterGKMCache) GetImagePullSecrets() (string, []string) {
+	names := make([]string, 0, len(cache.Spec.ImagePullSecrets))
+	for _, secret := range cache.Spec.ImagePullSecrets {
+		names = append(names, secret.Name)
+	}
+	return cache.Spec.ImagePullSecretsNamespace, names
+}
+
 func (cache ClusterGKMCache) GetStatus() *GKMCacheStatus {
 	return cache.Status.DeepCopy()
 }
@@ -37,6 +37,7 @@ type ClusterGKMCacheWebhook struct{}
 
 // SetupWebhookWithManager registers the webhook with the controller manager.
 func (w *ClusterGKMCache) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	secretReader = mgr.GetAPIReader()
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(&ClusterGKMCache{}).
 		WithDefaulter(w, admission.DefaulterRemoveUnknownOrOmitableFields).
@@ -72,13 +73,23 @@ func (w *ClusterGKMCache) Default(ctx context.Context, obj runtime.Object) error
 		return nil
 	}
 
+	if len(cache.Spec.ImagePullSecrets) != 0 && cache.Spec.ImagePullSecretsNamespace == "" {
+		return apierrors.NewBadRequest("spec.imagePullSecretsNamespace must be set with spec.imagePullSecrets")
+	}
+
 	// Resolve & verify image -> digest
 	// Note: v3 bundle verification can take 15-20 seconds
 	cctx, cancel := context.WithTimeout(context.Background(), ImageVerificationTimeout)
 	defer cancel()
 
+	keychain, err := imageKeychain(cctx, cache)
+	if err != nil {
+		clustergkmcacheLog.Error(err, "failed to read image pull secrets")
+		return apierrors.NewBadRequest(err.Error())
+	}
+
 	clustergkmcacheLog.V(1).Info("Verifying image signature", "image", cache.Spec.Image)
-	digest, err := cosign.VerifyImageSignature(cctx, cache.Spec.Image)
+	digest, err := cosign.VerifyImageSignature(cctx, cache.Spec.Image, registriesConfig(), keychain)
 	if err != nil {
 		clustergkmcacheLog.Error(err, "failed to verify image or resolve digest")
 		return apierrors.NewBadRequest(fmt.Sprintf(
@@ -94,7 +105,7 @@ func (w *ClusterGKMCache) Default(ctx context.Context, obj runtime.Object) error
 		}
 	}
 
-	size := extractSizeFromImage(cache.Spec.Image)
+	size := extractSizeFromImage(cache.Spec.Image, keychain)
 	gkmcacheLog.Info("Extracted size captured", "bytes", size, "MB", float64(size)/(1024*1024))
 
 	cache.Annotations[utils.GKMCacheAnnotationResolvedDigest] = digest
@@ -167,6 +178,12 @@ func (w *ClusterGKMCache) ValidateUpdate(_ context.Context, oldObj, newObj runti
 		return nil, apierrors.NewBadRequest("type assertion to ClusterGKMCache failed")
 	}
 
+	// The mount mode decides whether the cache is in a PVC or in an Image Volume, and the
+	// Operator and Agents do not move a cache from one to the other.
+	if oldCache.GetMountMode() != newCache.GetMountMode() {
+		return nil, fmt.Errorf("spec.mountMode is immutable")
+	}
+
 	oldImg := oldCache.Spec.Image
 	newImg := newCache.Spec.Image
 
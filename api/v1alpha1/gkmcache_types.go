@@ -98,6 +98,28 @@ func (cache GKMCache) GetAccessMode() []corev1.PersistentVolumeAccessMode {
 	return cache.Spec.AccessModes
 }
 
+func (cache GKMCache) GetMountMode() MountMode {
+	if cache.Spec.MountMode == "" {
+		return MountModePVC
+	}
+	return cache.Spec.MountMode
+}
+
+func (cache GKMCache) GetPriority() int32 {
+	return cache.Spec.Priority
+}
+
+func (cache GKMCache) GetTTLSecondsAfterUnused() *int64 {
+	return cache.Spec.TTLSecondsAfterUnused
+}
+
+func (cache GKMCache) GetTTLAction() TTLAction {
+	if cache.Spec.TTLAction == "" {
+		return TTLActionDelete
+	}
+	return cache.Spec.TTLAction
+}
+
 func (cache GKMCache) GetWorkloadNamespaces() []string {
 	return []string{cache.Namespace}
 }
@@ -118,6 +140,16 @@ func (cache GKMCache) GetImage() string {
 	return cache.Spec.Image
 }
 
+// GetImagePullSecrets returns the namespace and names of the Secrets holding the
+// credentials to pull the image.
+func (cache GKMCache) GetImagePullSecrets() (string, []string) {
+	names := make([]string, 0, len(cache.Spec.ImagePullSecrets))
+	for _, secret := range cache.Spec.ImagePullSecrets {
+		names = append(names, secret.Name)
+	}
+	return cache.Namespace, names
+}
+
 func (cache GKMCache) GetStatus() *GKMCacheStatus {
 	return cache.Status.DeepCopy()
 }
@@ -12,15 +12,16 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
-	"github.com/google/go-containerregistry/pkg/v1/remote"
 	gcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
 
+	"github.com/redhat-et/GKM/mcv/pkg/registries"
 	"github.com/redhat-et/GKM/pkg/utils"
 )
 
@@ -32,8 +33,13 @@ var (
 
 type GKMCacheWebhook struct{}
 
+// secretReader reads the image pull Secrets of the GKMCache and ClusterGKMCache instances.
+// The API Reader is used so the Operator does not cache every Secret of the cluster.
+var secretReader client.Reader
+
 // SetupWebhookWithManager sets up the webhook with the controller-runtime manager
 func (w *GKMCache) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	secretReader = mgr.GetAPIReader()
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(&GKMCache{}).
 		WithDefaulter(w, admission.DefaulterRemoveUnknownOrOmitableFields).
@@ -65,13 +71,22 @@ func (w *GKMCache) Default(ctx context.Context, obj runtime.Object) error {
 		return nil
 	}
 
+	if cache.Spec.ImagePullSecretsNamespace != "" && cache.Spec.ImagePullSecretsNamespace != cache.Namespace {
+		return apierrors.NewBadRequest("spec.imagePullSecretsNamespace must be empty or the namespace of the GKMCache")
+	}
+
 	// Resolve & verify image -> digest
 	cctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	keychain, err := imageKeychain(cctx, cache)
+	if err != nil {
+		gkmcacheLog.Error(err, "failed to read image pull secrets")
+		return apierrors.NewBadRequest(err.Error())
+	}
+
 	kyvernoEnabled := isKyvernoVerificationEnabled()
 	var digest string
-	var err error
 	if kyvernoEnabled {
 		// First check if the image already contains a digest (e.g., from Kyverno mutation)
 		if extractedDigest := extractDigestFromImage(cache.Spec.Image); extractedDigest != "" {
@@ -93,7 +108,7 @@ func (w *GKMCache) Default(ctx context.Context, obj runtime.Object) error {
 		}
 	} else {
 		gkmcacheLog.V(1).Info("Resolving image digest (Kyverno verification disabled)", "image", cache.Spec.Image)
-		digest, err = resolveImageDigest(cctx, cache.Spec.Image)
+		digest, err = resolveImageDigest(cctx, cache.Spec.Image, keychain)
 		if err != nil {
 			gkmcacheLog.Error(err, "failed to resolve image digest")
 			return apierrors.NewBadRequest(fmt.Sprintf(
@@ -103,7 +118,7 @@ func (w *GKMCache) Default(ctx context.Context, obj runtime.Object) error {
 		}
 	}
 
-	size := extractSizeFromImage(cache.Spec.Image)
+	size := extractSizeFromImage(cache.Spec.Image, keychain)
 	gkmcacheLog.Info("Extracted size captured", "bytes", size, "MB", float64(size)/(1024*1024))
 
 	cache.Annotations[utils.GKMCacheAnnotationResolvedDigest] = digest
@@ -155,6 +170,12 @@ func (w *GKMCache) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Ob
 		return nil, apierrors.NewBadRequest("type assertion to GKMCache failed")
 	}
 
+	// The mount mode decides whether the cache is in a PVC or in an Image Volume, and the
+	// Operator and Agents do not move a cache from one to the other.
+	if oldCache.GetMountMode() != newCache.GetMountMode() {
+		return nil, fmt.Errorf("spec.mountMode is immutable")
+	}
+
 	oldImg := oldCache.Spec.Image
 	newImg := newCache.Spec.Image
 
@@ -226,10 +247,32 @@ func extractDigestFromImage(imageRef string) string {
 	return ""
 }
 
+// registriesConfig returns the registries configuration of the cluster, with the registry
+// mirrors, insecure and blocked registries, and CA certificates images are pulled with.
+func registriesConfig() registries.Config {
+	return registries.FromDir(utils.RegistriesConfigDir)
+}
+
+// imageKeychain returns the keychain the image of cache is pulled with, holding the
+// credentials in its image pull Secrets.
+func imageKeychain(ctx context.Context, cache interface {
+	GetImagePullSecrets() (string, []string)
+}) (authn.Keychain, error) {
+	namespace, names := cache.GetImagePullSecrets()
+	if len(names) == 0 || secretReader == nil {
+		return registries.Keychain(""), nil
+	}
+	auth, err := utils.RegistryAuth(ctx, secretReader, namespace, names)
+	if err != nil {
+		return nil, err
+	}
+	return registries.KeychainFromConfig(auth)
+}
+
 // extractSizeFromImage walks the layers in the image and adds the sizes
 // of all the layers.
 // Returns 0 if unable to calculate the size.
-func extractSizeFromImage(imageRef string) int64 {
+func extractSizeFromImage(imageRef string, keychain authn.Keychain) int64 {
 	var totalUncompressedSize int64 = 0
 
 	ref, err := name.ParseReference(imageRef)
@@ -238,7 +281,8 @@ func extractSizeFromImage(imageRef string) int64 {
 		return totalUncompressedSize
 	}
 
-	img, err := remote.Image(ref)
+	remoteOpts := []gcrremote.Option{gcrremote.WithAuthFromKeychain(keychain)}
+	img, _, _, err := registries.Try(registriesConfig(), ref, remoteOpts, gcrremote.Image)
 	if err != nil {
 		gkmcacheLog.Error(err, "Image call failed")
 		return totalUncompressedSize
@@ -322,21 +366,22 @@ func isKyvernoVerificationEnabled() bool {
 // resolveImageDigest resolves an image reference to its digest without verifying signatures.
 // This is used when Kyverno verification is disabled (development/testing mode).
 // It returns the image digest string (sha256:...) if successful.
-func resolveImageDigest(ctx context.Context, imageRef string) (string, error) {
+func resolveImageDigest(ctx context.Context, imageRef string, keychain authn.Keychain) (string, error) {
 	// Parse the image reference (tag or digest).
 	ref, err := name.ParseReference(imageRef)
 	if err != nil {
 		return "", fmt.Errorf("parse image reference: %w", err)
 	}
 
-	// Registry access options (authn.DefaultKeychain covers most cases).
+	// Registry access options, with the credentials of the image pull Secrets.
 	remoteOpts := []gcrremote.Option{
-		gcrremote.WithAuthFromKeychain(authn.DefaultKeychain),
+		gcrremote.WithAuthFromKeychain(keychain),
 		gcrremote.WithContext(ctx),
 	}
 
-	// Get the image descriptor to retrieve the digest
-	descriptor, err := gcrremote.Get(ref, remoteOpts...)
+	// Get the image descriptor to retrieve the digest, from a mirror of the registry if one
+	// is configured.
+	descriptor, _, _, err := registries.Try(registriesConfig(), ref, remoteOpts, gcrremote.Get)
 	if err != nil {
 		return "", fmt.Errorf("fetch image descriptor: %w", err)
 	}
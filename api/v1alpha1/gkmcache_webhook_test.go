@@ -0,0 +1,79 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+const (
+	testWebhookImage  = "quay.io/example/cache:latest"
+	testWebhookDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+)
+
+func TestValidateUpdateMountMode(t *testing.T) {
+	ctx := context.Background()
+	annotations := map[string]string{utils.GKMCacheAnnotationResolvedDigest: testWebhookDigest}
+
+	newGKMCache := func(mountMode MountMode) *GKMCache {
+		return &GKMCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "cache", Namespace: "ns", Annotations: annotations},
+			Spec:       GKMCacheSpec{Image: testWebhookImage, MountMode: mountMode},
+		}
+	}
+	newClusterGKMCache := func(mountMode MountMode) *ClusterGKMCache {
+		return &ClusterGKMCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "cache", Annotations: annotations},
+			Spec:       GKMCacheSpec{Image: testWebhookImage, MountMode: mountMode},
+		}
+	}
+
+	t.Run("Test GKMCache mountMode change is rejected", func(t *testing.T) {
+		t.Logf("TEST: Changing spec.mountMode from PVC to ImageVolume is rejected")
+		_, err := (&GKMCache{}).ValidateUpdate(ctx, newGKMCache(MountModePVC), newGKMCache(MountModeImageVolume))
+		require.ErrorContains(t, err, "spec.mountMode is immutable")
+
+		t.Logf("TEST: Changing spec.mountMode from ImageVolume to the default is rejected")
+		_, err = (&GKMCache{}).ValidateUpdate(ctx, newGKMCache(MountModeImageVolume), newGKMCache(""))
+		require.ErrorContains(t, err, "spec.mountMode is immutable")
+	})
+
+	t.Run("Test GKMCache unchanged mountMode is accepted", func(t *testing.T) {
+		t.Logf("TEST: Setting spec.mountMode to the default it already had is accepted")
+		_, err := (&GKMCache{}).ValidateUpdate(ctx, newGKMCache(""), newGKMCache(MountModePVC))
+		require.NoError(t, err)
+
+		_, err = (&GKMCache{}).ValidateUpdate(ctx, newGKMCache(MountModeImageVolume), newGKMCache(MountModeImageVolume))
+		require.NoError(t, err)
+	})
+
+	t.Run("Test ClusterGKMCache mountMode change is rejected", func(t *testing.T) {
+		t.Logf("TEST: Changing spec.mountMode of a ClusterGKMCache is rejected")
+		_, err := (&ClusterGKMCache{}).ValidateUpdate(ctx, newClusterGKMCache(""), newClusterGKMCache(MountModeImageVolume))
+		require.ErrorContains(t, err, "spec.mountMode is immutable")
+
+		t.Logf("TEST: Setting spec.mountMode of a ClusterGKMCache to the default it already had is accepted")
+		_, err = (&ClusterGKMCache{}).ValidateUpdate(ctx, newClusterGKMCache(""), newClusterGKMCache(MountModePVC))
+		require.NoError(t, err)
+	})
+}
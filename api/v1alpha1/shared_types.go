@@ -70,6 +70,24 @@ type GKMCacheSpec struct {
 	// +kubebuilder:validation:Pattern=`[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}`
 	Image string `json:"image"`
 
+	// imagePullSecrets is an optional list of Secrets, of type
+	// kubernetes.io/dockerconfigjson or kubernetes.io/dockercfg, holding the
+	// credentials to pull the image from a private registry. GKM uses them to
+	// resolve the digest of the image in the webhook, to check the image against
+	// the GPUs of each node and to extract it. For a GKMCache, the Secrets are in
+	// the namespace of the GKMCache. For a ClusterGKMCache, they are in
+	// imagePullSecretsNamespace. For registries the Secrets hold no credentials
+	// for, the credentials of the GKM components and the cloud workload identity
+	// of the node are used.
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// imagePullSecretsNamespace is the namespace of the imagePullSecrets of a
+	// ClusterGKMCache, and is required when imagePullSecrets is set. For a
+	// GKMCache, it must be empty or the namespace of the GKMCache.
+	// +optional
+	ImagePullSecretsNamespace string `json:"imagePullSecretsNamespace,omitempty"`
+
 	// podTemplate is an optional field that allows customizing the Pod used in the
 	// Job that GKM launches to extract the GPU Kernel Cache to a PVC. This field
 	// is used to apply any Tolerations, NodeSelectors, custom Labels or Affinity
@@ -101,6 +119,45 @@ type GKMCacheSpec struct {
 	// the PVC the is mounted in the pods will be in the same namespace. GKM
 	// creates this PVC and needs to know what namespace to create it in.
 	WorkloadNamespaces []string `json:"workloadNamespaces,omitempty"`
+
+	// mountMode is an optional field that selects how the GPU Kernel Cache is
+	// made available to the workload. If not provided, it will default to "PVC",
+	// where GKM extracts the OCI Image into a PersistentVolumeClaim using a Job.
+	// If set to "ImageVolume", GKM does not create any PV, PVC or Job. Instead,
+	// the workload mounts the OCI Image directly using a Kubernetes "image"
+	// volume that references the resolved digest (status.resolvedDigest). GKM
+	// still tracks GPU compatibility and pod usage on each node. This mode
+	// requires a Kubernetes version with the ImageVolume feature enabled.
+	// +kubebuilder:default:=PVC
+	MountMode MountMode `json:"mountMode,omitempty"`
+
+	// priority is an optional field that orders the extraction of the GPU Kernel
+	// Cache on each node. When more GPU Kernel Caches need to be extracted on a
+	// node than the configured maximum number of concurrent extractions, the
+	// caches with a higher priority are extracted first. Caches with the same
+	// priority are extracted in the order they were created. If not provided,
+	// it will default to 0.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+
+	// ttlSecondsAfterUnused is an optional field that limits how long the GPU
+	// Kernel Cache is kept once no Pod on any node uses it. When no Pod has used
+	// the cache for this many seconds, GKM expires the cache as described by
+	// ttlAction. A Warning Event is recorded on the instance before it expires.
+	// If not provided, the cache never expires.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	TTLSecondsAfterUnused *int64 `json:"ttlSecondsAfterUnused,omitempty"`
+
+	// ttlAction is an optional field that selects what GKM does when the GPU
+	// Kernel Cache expires, see ttlSecondsAfterUnused. If set to "Delete", the
+	// instance is deleted. If set to "RemoveFromNodes", the instance is kept, but
+	// the PVCs, PVs and extracted cache are removed from every node. They are
+	// created again when a Pod references the cache. If not provided, it will
+	// default to "Delete".
+	// +kubebuilder:default:=Delete
+	// +optional
+	TTLAction TTLAction `json:"ttlAction,omitempty"`
 }
 
 type GKMCacheStatus struct {
@@ -127,11 +184,67 @@ type GKMCacheStatus struct {
 	// the Kubernetes nodes in the cluster.
 	Counts CacheCounts `json:"counts"`
 
+	// storage summarizes the disk usage of the GPU Kernel Cache across all the
+	// Kubernetes nodes in the cluster, as reported in the GKMCacheNode or
+	// ClusterGKMCacheNode of each node.
+	// +optional
+	Storage *CacheStorage `json:"storage,omitempty"`
+
+	// failureReasons counts, for each failure reason, the Kubernetes nodes where
+	// extracting or verifying the GPU Kernel Cache failed.
+	// +optional
+	FailureReasons map[string]int `json:"failureReasons,omitempty"`
+
+	// failures lists the Kubernetes nodes where extracting or verifying the GPU
+	// Kernel Cache failed, most retried first, then most recent first. The list
+	// is limited to the first 5 nodes. See the GKMCacheNode or ClusterGKMCacheNode
+	// of the node for the full message, including the tail of the Job log.
+	// +optional
+	Failures []NodeFailure `json:"failures,omitempty"`
+
+	// unusedSince is the last time a Pod on any Kubernetes node used the GPU
+	// Kernel Cache, or the time GKM started tracking it if no Pod has used it
+	// yet. It is only set when spec.ttlSecondsAfterUnused is set and no Pod is
+	// using the cache.
+	// +optional
+	UnusedSince *metav1.Time `json:"unusedSince,omitempty"`
+
+	// expiryTime is the time the GPU Kernel Cache expires if no Pod uses it
+	// before then. It is set when the Warning Event announcing the expiry is
+	// recorded.
+	// +optional
+	ExpiryTime *metav1.Time `json:"expiryTime,omitempty"`
+
 	// lastUpdated contains the timestamp of the last time the status field for
 	// this instance was updated.
 	LastUpdated metav1.Time `json:"lastUpdated,omitempty"`
 }
 
+// NodeFailure summarizes why extracting or verifying a GPU Kernel Cache failed
+// on a Kubernetes node.
+type NodeFailure struct {
+	// nodeName is the Kubernetes node where the failure occurred.
+	NodeName string `json:"nodeName"`
+
+	// namespace is the namespace of the PVC the GPU Kernel Cache was extracted to.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// reason is the class of the failure, for example NetworkError or AuthFailed.
+	Reason string `json:"reason"`
+
+	// message is the first line of the Error condition message.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// retryCount is the number of times the extraction has been retried on the node.
+	// +optional
+	RetryCount int32 `json:"retryCount,omitempty"`
+
+	// lastTransitionTime is when the failure was reported.
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+}
+
 type PodTemplate struct {
 	// metadata defines the optional fields usually contained by a metadata
 	// structure, like labels and annotations, that may need to allow the GKM
@@ -234,9 +347,41 @@ type CacheStatus struct {
 	// the PVC is created .
 	PvcStatus map[string]PvcStatus `json:"pvcStatus,omitempty"`
 
+	// mountMode is the mode, PVC or ImageVolume, that was used to make this
+	// GPU Kernel Cache available on the node. It allows the cache to be cleaned
+	// up properly after the GKMCache or ClusterGKMCache has been deleted.
+	MountMode MountMode `json:"mountMode,omitempty"`
+
 	// volumeSize is the size of the extracted GPU Kernel Cache in bytes.
 	VolumeSize int64 `json:"volumeSize,omitempty"`
 
+	// fileCount is the number of files in the extracted GPU Kernel Cache.
+	// +optional
+	FileCount int64 `json:"fileCount,omitempty"`
+
+	// bytesReused is the number of bytes of the extracted GPU Kernel Cache that
+	// were unchanged from the cache of an earlier digest of the same image on the
+	// node, and were hard linked from it instead of being written again.
+	// +optional
+	BytesReused int64 `json:"bytesReused,omitempty"`
+
+	// diskUsage is the number of bytes the extracted GPU Kernel Cache uses on
+	// the disk of the node, as measured by the GKM Agent in the host cache
+	// directory. It is only set for caches extracted into the host cache
+	// directory, in a KIND Cluster or with in-agent extraction.
+	// +optional
+	DiskUsage int64 `json:"diskUsage,omitempty"`
+
+	// extractDuration is how long the extraction of the GPU Kernel Cache took.
+	// +optional
+	ExtractDuration *metav1.Duration `json:"extractDuration,omitempty"`
+
+	// queuePosition is the position, starting at 1, of the GPU Kernel Cache in
+	// the extraction queue on the node. It is only set while the extraction is
+	// waiting for other extractions on the node to complete, or for a cluster
+	// wide registry pull slot to become available.
+	QueuePosition int32 `json:"queuePosition,omitempty"`
+
 	// pods is the list of pods the GPU Kernel Cache that is actively Volume
 	// Mounted.
 	Pods []PodData `json:"pods,omitempty"`
@@ -255,6 +400,33 @@ type PvcStatus struct {
 	// extraction GPU Kernel Cache.
 	JobName string `json:"jobName,omitempty"`
 
+	// retryCount is the number of times the extraction of the GPU Kernel Cache
+	// has been retried after failing with a transient error, like a network
+	// error. It is reset when the extraction succeeds.
+	// +optional
+	RetryCount int32 `json:"retryCount,omitempty"`
+
+	// nextRetryTime is when the failed extraction of the GPU Kernel Cache will be
+	// retried. It is only set while waiting to retry. Failures that will not be
+	// retried, like an image that does not exist, leave it unset.
+	// +optional
+	NextRetryTime *metav1.Time `json:"nextRetryTime,omitempty"`
+
+	// lastUsedTime is when a pod on the node last started or stopped using the
+	// extracted GPU Kernel Cache. When the node cache budget is exceeded, or the
+	// node reports DiskPressure, the least recently used caches are evicted
+	// first.
+	// +optional
+	LastUsedTime *metav1.Time `json:"lastUsedTime,omitempty"`
+
+	// volumeSnapshotName contains the name of the VolumeSnapshot associated with
+	// the PVC. This is only used by a ClusterGKMCache with multiple workload
+	// namespaces and a StorageClass that supports snapshots. For the seed PVC,
+	// which the GPU Kernel Cache is extracted into, it is the VolumeSnapshot taken
+	// after the extraction. For the PVCs in the remaining namespaces, it is the
+	// VolumeSnapshot the PVC was populated from.
+	VolumeSnapshotName string `json:"volumeSnapshotName,omitempty"`
+
 	// pvcOwner is an indication of which process, Agent or Operator, manages the
 	// PVC used to store the extracted GPU Kernel Cache. Value of Agent indicates
 	// Agent manages the PVC, value of Operator indicates Operator manages the PVC.
@@ -266,6 +438,52 @@ type PvcStatus struct {
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+// NodeStorage reports the disk usage of the host cache directory on a Kubernetes node.
+type NodeStorage struct {
+	// usedBytes is the number of bytes used on disk by all the files under the
+	// host cache directory, including caches of other GKMCaches and
+	// ClusterGKMCaches.
+	UsedBytes int64 `json:"usedBytes"`
+
+	// availableBytes is the number of bytes still available on the filesystem
+	// holding the host cache directory.
+	AvailableBytes int64 `json:"availableBytes"`
+
+	// capacityBytes is the size of the filesystem holding the host cache
+	// directory.
+	CapacityBytes int64 `json:"capacityBytes"`
+
+	// savedBytes is the number of bytes the caches on the node would use on
+	// top of usedBytes if identical files of different caches were not shared
+	// through deduplication.
+	// +optional
+	SavedBytes int64 `json:"savedBytes,omitempty"`
+
+	// lastUpdated is the time the disk usage was measured.
+	LastUpdated metav1.Time `json:"lastUpdated"`
+}
+
+// CacheStorage summarizes the disk usage of a GPU Kernel Cache across the Kubernetes nodes.
+type CacheStorage struct {
+	// usedBytes is the total number of bytes the extracted GPU Kernel Cache
+	// uses across all the nodes that reported a size.
+	UsedBytes int64 `json:"usedBytes"`
+
+	// nodeCnt is the number of nodes that reported the size of the extracted
+	// GPU Kernel Cache.
+	NodeCnt int `json:"nodeCnt"`
+
+	// maxNodeBytes is the largest size of the extracted GPU Kernel Cache
+	// reported by a single node.
+	MaxNodeBytes int64 `json:"maxNodeBytes"`
+
+	// minAvailableBytes is the least space available in the host cache
+	// directory of the nodes holding the GPU Kernel Cache. It is only set if at
+	// least one of those nodes reports its storage.
+	// +optional
+	MinAvailableBytes *int64 `json:"minAvailableBytes,omitempty"`
+}
+
 type GKMCacheNodeStatus struct {
 	// nodeName is the name of the Kubernetes Node this instance is created.
 	NodeName string `json:"nodeName"`
@@ -278,6 +496,17 @@ type GKMCacheNodeStatus struct {
 	// about each GPU.
 	GpuStatuses []GpuStatus `json:"gpus,omitempty"`
 
+	// storage reports the disk usage of the host cache directory on the
+	// Kubernetes Node, as measured periodically by the GKM Agent.
+	// +optional
+	Storage *NodeStorage `json:"storage,omitempty"`
+
+	// layerServer is the base URL of the GKM Agent on the Kubernetes Node
+	// serving the image layers it pulled to the extractions on other Nodes,
+	// which fetch layers from it before pulling them from the registry.
+	// +optional
+	LayerServer string `json:"layerServer,omitempty"`
+
 	// caches is the list of GKMCache or ClusterGKMCache instances that this
 	// GKMCacheNode or ClusterGKMCacheNode is keeping status for along with state
 	// for each.
@@ -299,6 +528,31 @@ const (
 	PvcOwnerOperator PvcOwner = "Operator"
 )
 
+// TTLAction describes what GKM does when a GPU Kernel Cache expires.
+// +kubebuilder:validation:Enum=Delete;RemoveFromNodes
+type TTLAction string
+
+const (
+	// TTLActionDelete means that the GKMCache or ClusterGKMCache is deleted when it expires.
+	TTLActionDelete TTLAction = "Delete"
+	// TTLActionRemoveFromNodes means that the GKMCache or ClusterGKMCache is kept when it
+	// expires, but the PVCs, PVs and extracted Cache are removed from every Node.
+	TTLActionRemoveFromNodes TTLAction = "RemoveFromNodes"
+)
+
+// MountMode describes how the GPU Kernel Cache is made available to the workload.
+// +kubebuilder:validation:Enum=PVC;ImageVolume
+type MountMode string
+
+const (
+	// MountModePVC means that the GPU Kernel Cache is extracted by a Job into a PVC,
+	// which is then volume mounted in the workload.
+	MountModePVC MountMode = "PVC"
+	// MountModeImageVolume means that the OCI Image is mounted directly in the workload
+	// using a Kubernetes image volume. No PV, PVC or Job is created.
+	MountModeImageVolume MountMode = "ImageVolume"
+)
+
 // GkmConditionType is a condition and used to indicate the status of a GKM Cache
 // or GKM Cache on a given node.
 type GkmConditionType string
@@ -312,6 +566,11 @@ const (
 	// Cache, but the extraction not yet completed.
 	GkmCondDownloading GkmConditionType = "Downloading"
 
+	// GkmCondVerifying indicates that the GKM Cache has been extracted to a
+	// ReadOnlyMany PVC by the Operator and a Job has been started to verify the
+	// extracted Cache can be read on the given node.
+	GkmCondVerifying GkmConditionType = "Verifying"
+
 	// GkmCondExtracted indicates that the GKM Cache has been
 	// successfully extracted as requested on the given node.
 	GkmCondExtracted GkmConditionType = "Extracted"
@@ -333,6 +592,21 @@ const (
 	// node while attempting to apply the configuration described in the CRD.
 	GkmCondError GkmConditionType = "Error"
 
+	// GkmCondCorrupted indicates that the extracted GKM Cache on the given node no
+	// longer matches the integrity manifest of the OCI Image, and will be extracted
+	// again.
+	GkmCondCorrupted GkmConditionType = "Corrupted"
+
+	// GkmCondEvicted indicates that the extracted GKM Cache was removed from the
+	// given node to free disk space because it was not in use. It is extracted
+	// again when a Pod on the node uses it.
+	GkmCondEvicted GkmConditionType = "Evicted"
+
+	// GkmCondExpired indicates that no Pod used the GKM Cache for longer than
+	// spec.ttlSecondsAfterUnused, so it was removed from every node. It is
+	// restored when a Pod references it.
+	GkmCondExpired GkmConditionType = "Expired"
+
 	// GkmCondNoNamespace indicates that Namespace the workload will run in
 	// and PVC needs to be created in does not exist.
 	GkmCondNoNamespace GkmConditionType = "NoNamespace"
@@ -365,6 +639,14 @@ func (b GkmConditionType) Condition() metav1.Condition {
 			Reason:  "Downloading",
 			Message: "Job to extract Kernel Cache in progress",
 		}
+	case GkmCondVerifying:
+		condType := string(GkmCondVerifying)
+		cond = metav1.Condition{
+			Type:    condType,
+			Status:  metav1.ConditionTrue,
+			Reason:  "Verifying",
+			Message: "Job to verify the Kernel Cache is readable on the node in progress",
+		}
 	case GkmCondExtracted:
 		condType := string(GkmCondExtracted)
 		cond = metav1.Condition{
@@ -405,6 +687,30 @@ func (b GkmConditionType) Condition() metav1.Condition {
 			Reason:  "Error",
 			Message: "An error occurred trying to extract the Kernel Cache",
 		}
+	case GkmCondCorrupted:
+		condType := string(GkmCondCorrupted)
+		cond = metav1.Condition{
+			Type:    condType,
+			Status:  metav1.ConditionTrue,
+			Reason:  "Corrupted",
+			Message: "The extracted Kernel Cache does not match the OCI Image and will be extracted again",
+		}
+	case GkmCondEvicted:
+		condType := string(GkmCondEvicted)
+		cond = metav1.Condition{
+			Type:    condType,
+			Status:  metav1.ConditionTrue,
+			Reason:  "Evicted",
+			Message: "The Kernel Cache was removed from the node to free disk space and will be extracted again when used",
+		}
+	case GkmCondExpired:
+		condType := string(GkmCondExpired)
+		cond = metav1.Condition{
+			Type:    condType,
+			Status:  metav1.ConditionTrue,
+			Reason:  "Expired",
+			Message: "The Kernel Cache was not used within its TTL and was removed from the nodes",
+		}
 	case GkmCondNoNamespace:
 		condType := string(GkmCondNoNamespace)
 		cond = metav1.Condition{
@@ -485,4 +791,34 @@ const (
 	// GkmCacheNodeEventReasonDeleting indicates that a GKMCacheNode or ClusterGKMCacheNode is being deleted
 	// but the Cache is being used by one or more workload pods.
 	GkmCacheNodeEventReasonDeleting GkmCacheNodeEventReason = "Deleting"
+
+	// GkmCacheNodeEventReasonExtractFailed indicates that extracting or verifying the Cache on the
+	// node failed.
+	GkmCacheNodeEventReasonExtractFailed GkmCacheNodeEventReason = "ExtractFailed"
+
+	// GkmCacheNodeEventReasonCorrupted indicates that scrubbing the extracted Cache on the node found
+	// files that do not match the integrity manifest of the OCI Image.
+	GkmCacheNodeEventReasonCorrupted GkmCacheNodeEventReason = "Corrupted"
+
+	// GkmCacheNodeEventReasonEvicted indicates that the extracted Cache was removed from the node to
+	// free disk space.
+	GkmCacheNodeEventReasonEvicted GkmCacheNodeEventReason = "Evicted"
+)
+
+// GkmCacheEventReason is an event reason and used to track the major events of a GKMCache or
+// ClusterGKMCache.
+type GkmCacheEventReason string
+
+const (
+	// GkmCacheEventReasonExpiring indicates that a GKMCache or ClusterGKMCache has not been used by
+	// any Pod and will expire soon.
+	GkmCacheEventReasonExpiring GkmCacheEventReason = "Expiring"
+
+	// GkmCacheEventReasonExpired indicates that a GKMCache or ClusterGKMCache was not used within
+	// its TTL and was deleted or removed from the nodes.
+	GkmCacheEventReasonExpired GkmCacheEventReason = "Expired"
+
+	// GkmCacheEventReasonRestored indicates that an expired GKMCache or ClusterGKMCache is
+	// referenced by a Pod again, so it is restored on the nodes.
+	GkmCacheEventReasonRestored GkmCacheEventReason = "Restored"
 )
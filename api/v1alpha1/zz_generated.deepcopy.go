@@ -62,6 +62,11 @@ func (in *CacheStatus) DeepCopyInto(out *CacheStatus) {
 			(*out)[key] = *val.DeepCopy()
 		}
 	}
+	if in.ExtractDuration != nil {
+		in, out := &in.ExtractDuration, &out.ExtractDuration
+		*out = new(metav1.Duration)
+		**out = **in
+	}
 	if in.Pods != nil {
 		in, out := &in.Pods, &out.Pods
 		*out = make([]PodData, len(*in))
@@ -79,6 +84,26 @@ func (in *CacheStatus) DeepCopy() *CacheStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CacheStorage) DeepCopyInto(out *CacheStorage) {
+	*out = *in
+	if in.MinAvailableBytes != nil {
+		in, out := &in.MinAvailableBytes, &out.MinAvailableBytes
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CacheStorage.
+func (in *CacheStorage) DeepCopy() *CacheStorage {
+	if in == nil {
+		return nil
+	}
+	out := new(CacheStorage)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterGKMCache) DeepCopyInto(out *ClusterGKMCache) {
 	*out = *in
@@ -339,6 +364,11 @@ func (in *GKMCacheNodeStatus) DeepCopyInto(out *GKMCacheNodeStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = new(NodeStorage)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.CacheStatuses != nil {
 		in, out := &in.CacheStatuses, &out.CacheStatuses
 		*out = make(map[string]map[string]CacheStatus, len(*in))
@@ -372,6 +402,11 @@ func (in *GKMCacheNodeStatus) DeepCopy() *GKMCacheNodeStatus {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GKMCacheSpec) DeepCopyInto(out *GKMCacheSpec) {
 	*out = *in
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]v1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
 	if in.PodTemplate != nil {
 		in, out := &in.PodTemplate, &out.PodTemplate
 		*out = new(PodTemplate)
@@ -387,6 +422,11 @@ func (in *GKMCacheSpec) DeepCopyInto(out *GKMCacheSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.TTLSecondsAfterUnused != nil {
+		in, out := &in.TTLSecondsAfterUnused, &out.TTLSecondsAfterUnused
+		*out = new(int64)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GKMCacheSpec.
@@ -417,6 +457,33 @@ func (in *GKMCacheStatus) DeepCopyInto(out *GKMCacheStatus) {
 		}
 	}
 	out.Counts = in.Counts
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = new(CacheStorage)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.FailureReasons != nil {
+		in, out := &in.FailureReasons, &out.FailureReasons
+		*out = make(map[string]int, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Failures != nil {
+		in, out := &in.Failures, &out.Failures
+		*out = make([]NodeFailure, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.UnusedSince != nil {
+		in, out := &in.UnusedSince, &out.UnusedSince
+		*out = (*in).DeepCopy()
+	}
+	if in.ExpiryTime != nil {
+		in, out := &in.ExpiryTime, &out.ExpiryTime
+		*out = (*in).DeepCopy()
+	}
 	in.LastUpdated.DeepCopyInto(&out.LastUpdated)
 }
 
@@ -465,6 +532,38 @@ func (in *GpuStatus) DeepCopy() *GpuStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeFailure) DeepCopyInto(out *NodeFailure) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeFailure.
+func (in *NodeFailure) DeepCopy() *NodeFailure {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeFailure)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeStorage) DeepCopyInto(out *NodeStorage) {
+	*out = *in
+	in.LastUpdated.DeepCopyInto(&out.LastUpdated)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeStorage.
+func (in *NodeStorage) DeepCopy() *NodeStorage {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeStorage)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodData) DeepCopyInto(out *PodData) {
 	*out = *in
@@ -542,6 +641,14 @@ func (in *PodTemplateSpec) DeepCopy() *PodTemplateSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PvcStatus) DeepCopyInto(out *PvcStatus) {
 	*out = *in
+	if in.NextRetryTime != nil {
+		in, out := &in.NextRetryTime, &out.NextRetryTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastUsedTime != nil {
+		in, out := &in.LastUsedTime, &out.LastUsedTime
+		*out = (*in).DeepCopy()
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]metav1.Condition, len(*in))
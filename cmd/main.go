@@ -29,6 +29,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -81,6 +82,12 @@ func main() {
 		setupLog.Info("KIND Cluster set to true")
 	}
 
+	extractInAgent := false
+	if os.Getenv("EXTRACT_MODE") == utils.ExtractModeAgent {
+		extractInAgent = true
+		setupLog.Info("Extract Mode set to agent")
+	}
+
 	extractImage := utils.JobExtractImage
 	tmpExtractImage := os.Getenv("EXTRACT_IMAGE")
 	if tmpExtractImage != "" {
@@ -176,6 +183,14 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Client-go Clientset is used to read the log of failed Job Pods, which the
+	// controller-runtime Client does not support.
+	kubeClient, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create Kubernetes clientset")
+		os.Exit(1)
+	}
+
 	// Index Pods by spec.nodeName
 	ctx := context.Background()
 	if err := mgr.GetFieldIndexer().IndexField(
@@ -210,8 +225,12 @@ func main() {
 	]{
 		Client:          mgr.GetClient(),
 		Scheme:          mgr.GetScheme(),
+		Recorder:        mgr.GetEventRecorderFor("GKM-Operator-NS"),
+		KubeClient:      kubeClient,
+		SecretReader:    mgr.GetAPIReader(),
 		NoGpu:           noGpu,
 		KindCluster:     kindCluster,
+		ExtractInAgent:  extractInAgent,
 		ExtractLogLevel: extractLogLevel,
 		ExtractImage:    extractImage,
 		CrdCacheStr:     utils.CrdGKMCache,
@@ -232,8 +251,12 @@ func main() {
 	]{
 		Client:          mgr.GetClient(),
 		Scheme:          mgr.GetScheme(),
+		Recorder:        mgr.GetEventRecorderFor("GKM-Operator-CL"),
+		KubeClient:      kubeClient,
+		SecretReader:    mgr.GetAPIReader(),
 		NoGpu:           noGpu,
 		KindCluster:     kindCluster,
+		ExtractInAgent:  extractInAgent,
 		ExtractImage:    extractImage,
 		CrdCacheStr:     utils.CrdClusterGKMCache,
 		CrdCacheNodeStr: utils.CrdClusterGKMCacheNode,
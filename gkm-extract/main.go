@@ -1,16 +1,15 @@
 package main
 
 import (
-	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/go-logr/logr"
-	mcvClient "github.com/redhat-et/GKM/mcv/pkg/client"
 
+	"github.com/redhat-et/GKM/mcv/pkg/registries"
+	"github.com/redhat-et/GKM/pkg/extract"
 	"github.com/redhat-et/GKM/pkg/utils"
 )
 
@@ -40,146 +39,111 @@ func main() {
 		noGpu = true
 	}
 
-	if err := ExtractCache(cacheDir, imageURL, noGpu, log); err != nil {
-		os.Exit(1)
+	// Layer servers of the GKM Agents on other Nodes, tried before the registry for the layers
+	// of the image.
+	var layerPeers []string
+	for _, peer := range strings.Split(os.Getenv("GKM_LAYER_PEERS"), ",") {
+		if peer = strings.TrimSpace(peer); peer != "" {
+			layerPeers = append(layerPeers, peer)
+		}
 	}
-
-	os.Exit(0)
-}
-
-func ExtractCache(cacheDir, imageURL string, noGpu bool, log logr.Logger) (err error) {
-	log.Info("extracting cache", "imageURL", imageURL, "cacheDir", cacheDir, "noGpu", noGpu)
-
-	// Create the directory and its parents with standard permissions
-	if err := os.MkdirAll(cacheDir, os.ModePerm); err != nil {
-		log.Error(err, "unable to make cache directory", "cacheDir", cacheDir)
-		return err
+	if len(layerPeers) != 0 {
+		log.Info("Layer peers", "peers", layerPeers)
+		extract.SetLayerPeers(func(string) []string { return layerPeers })
 	}
 
-	if err := os.Chown(cacheDir, 1000, 1000); err != nil {
-		log.Info("unable to chown", "err", err)
+	// Socket of the container runtime of the Node, if mounted in the Job, to read the image from
+	// if the Node has already pulled it.
+	if socket := strings.TrimSpace(os.Getenv("GKM_CRI_SOCKET")); socket != "" {
+		log.Info("CRI socket", "socket", socket)
+		extract.SetCRISocket(socket)
 	}
 
-	/*
-		if err := os.Chmod(cacheDir, 0755); err != nil {
-			log.Info("unable to chmod", "err", err)
+	// Registries configuration of the cluster, passed by the Agent or Operator that launched
+	// the Job. Without it, the registries.conf of the image is used.
+	if conf, caBundle := os.Getenv("GKM_REGISTRIES_CONF"), os.Getenv("GKM_REGISTRY_CA_BUNDLE"); conf != "" || caBundle != "" {
+		dir, err := writeRegistriesConfig(conf, caBundle)
+		if err != nil {
+			log.Error(err, "unable to write registries configuration")
+			os.Exit(1)
 		}
-	*/
-
-	// Acquire an exclusive file lock for this cacheDir to prevent concurrent
-	// extractions from multiple controller instances launching parallel Jobs.
-	// flock releases automatically when the file descriptor is closed.
-	lockPath := filepath.Join(cacheDir, ".extract.lock")
-	lf, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0600)
-	if err != nil {
-		log.Error(err, "unable to open extract lock", "lockPath", lockPath)
-		return err
-	}
-	defer func() { _ = lf.Close() }()
-	if err := syscall.Flock(int(lf.Fd()), syscall.LOCK_EX); err != nil {
-		log.Error(err, "unable to acquire extract lock", "lockPath", lockPath)
-		return err
+		log.Info("Registries configuration", "registriesConf", conf != "", "caBundle", caBundle != "")
+		extract.SetRegistries(registries.FromDir(dir))
 	}
 
-	// Only one initialization should occur per image URL.
-	// The init file stores the image URL used for extraction so that a different
-	// image triggers re-extraction rather than silently reusing stale cache.
-	// The file is written atomically (via a temp file renamed on success) so that
-	// a crash mid-extraction does not leave a stale .initialized sentinel.
-	initFile := filepath.Join(cacheDir, ".initialized")
-	initFileTmp := initFile + ".tmp"
-	if data, err := os.ReadFile(initFile); err == nil {
-		if strings.TrimSpace(string(data)) == imageURL {
-			log.Info("init file already exists", "imageURL", imageURL, "cacheDir", cacheDir, "noGpu", noGpu)
-			return nil
-		}
-		log.Info("image URL changed, clearing cache directory and re-extracting",
-			"existing", strings.TrimSpace(string(data)), "new", imageURL)
-		if err := clearDirectory(cacheDir); err != nil {
-			log.Error(err, "unable to clear cache directory", "cacheDir", cacheDir)
-			return err
+	// Registry credentials from the image pull Secrets of the GKMCache or ClusterGKMCache,
+	// mounted from the Secret created with the Job.
+	if authFile := os.Getenv("GKM_REGISTRY_AUTH_FILE"); authFile != "" {
+		registryAuth, err := os.ReadFile(authFile)
+		if err != nil {
+			log.Error(err, "unable to read registry credentials")
+			os.Exit(1)
 		}
-	}
-	if err := os.WriteFile(initFileTmp, []byte(imageURL+"\n"), 0644); err != nil {
-		log.Error(err, "unable to create init temp file", "initFileTmp", initFileTmp)
-		return err
+		log.Info("Registry credentials", "authFile", authFile)
+		extract.SetRegistryAuth(func(string) []byte { return registryAuth })
 	}
 
-	// For testing, like in a KIND Cluster, a real GPU may not be available.
-	enableGPU := !noGpu
-	matchedIds, unmatchedIds, err := mcvClient.ExtractCache(mcvClient.Options{
-		ImageName: imageURL,
-		CacheDir:  cacheDir,
-		EnableGPU: &enableGPU,
-		LogLevel:  "info",
-	})
-	if err != nil {
-		log.Error(err, "unable to extract cache", "imageURL", imageURL, "cacheDir", cacheDir, "enableGPU", enableGPU)
+	start := time.Now()
 
-		if err := deleteFile(initFileTmp); err != nil {
-			log.Info("unable to delete init temp file", "err", err)
-		} else {
-			log.Info("deleted init temp file because of extract error")
+	// When the Operator has extracted the Cache into a ReadOnlyMany PVC, the Agent on each
+	// Node launches this Job in verify mode to make sure the PVC can be read on that Node.
+	if os.Getenv("GKM_VERIFY_ONLY") == "true" {
+		if err := extract.VerifyCache(cacheDir, imageURL, log); err != nil {
+			exitWithFailure(extract.FailureResult(imageURL, err, time.Since(start)), log)
 		}
-		// Release the lock before back-off sleep so other Jobs on the same
-		// cacheDir are not blocked for 5 minutes on a transient failure.
-		_ = syscall.Flock(int(lf.Fd()), syscall.LOCK_UN)
-		time.Sleep(300 * time.Second)
-
-		return err
-	}
-	// Atomically promote the temp init file only after successful extraction.
-	if err := os.Rename(initFileTmp, initFile); err != nil {
-		log.Error(err, "unable to finalize init file", "initFileTmp", initFileTmp, "initFile", initFile)
-		return err
+		os.Exit(0)
 	}
-	log.Info("init file created")
 
-	log.Info("Cache Extracted", "matchedIds", matchedIds, "unmatchedIds", unmatchedIds)
-
-	log.Info("Walking Extracted Directory")
-	_ = filepath.WalkDir(cacheDir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if !d.IsDir() {
-			log.Info("  File", "f", d.Name())
-		} else {
-			log.Info("  Directory", "d", d.Name())
-		}
-		return nil
-	})
+	// The Job can not tell if pods use the cache. The Agent only launches it to replace an
+	// extraction once the cache is no longer in use.
+	result, err := extract.ExtractCache(cacheDir, imageURL, noGpu, nil, log)
+	if err != nil {
+		exitWithFailure(extract.FailureResult(imageURL, err, time.Since(start)), log)
+	}
 
-	return nil
+	writeTerminationMessage(result, log)
+	os.Exit(0)
 }
 
-// clearDirectory removes all entries inside dir without removing dir itself.
-// It preserves .extract.lock so the held flock inode is not replaced by a new
-// file that another Job could independently lock and run concurrently.
-// .initialized.tmp is also preserved so a concurrent writer does not race.
-func clearDirectory(dir string) error {
-	entries, err := os.ReadDir(dir)
+// writeRegistriesConfig writes the registries.conf and CA bundle to a new registries
+// configuration directory and returns it. Empty contents are not written.
+func writeRegistriesConfig(conf, caBundle string) (string, error) {
+	dir, err := os.MkdirTemp("", "gkm-registries-")
 	if err != nil {
-		return err
+		return "", err
 	}
-	for _, entry := range entries {
-		if entry.Name() == ".extract.lock" || entry.Name() == ".initialized.tmp" {
+	for file, content := range map[string]string{
+		registries.ConfFileName:     conf,
+		registries.CABundleFileName: caBundle,
+	} {
+		if content == "" {
 			continue
 		}
-		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
-			return err
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+			return "", err
 		}
 	}
-	return nil
+	return dir, nil
 }
 
-func deleteFile(name string) error {
-	// os.O_CREATE: create the file if it does not exist
-	// 0644: file permissions (read/write for owner, read for others)
-	err := os.Remove(name)
+// exitWithFailure writes the failed Result to the termination message so the Agent can
+// report it, and exits with the exit code of the failure class. The Agent decides if and
+// when the extraction is retried, so exit right away.
+func exitWithFailure(result *extract.Result, log logr.Logger) {
+	writeTerminationMessage(result, log)
+
+	log.Info("Extraction failed", "reason", result.Reason, "exitCode", result.Reason.ExitCode())
+	os.Exit(result.Reason.ExitCode())
+}
+
+// writeTerminationMessage writes the Result as JSON to the termination message of the
+// container, where the Agent reads it from the Pod status.
+func writeTerminationMessage(result *extract.Result, log logr.Logger) {
+	data, err := result.Marshal(utils.JobTerminationMessageMaxLength)
+	if err == nil {
+		err = os.WriteFile(utils.JobTerminationMessagePath, data, 0644)
+	}
 	if err != nil {
-		return err
+		log.Info("unable to write termination message", "err", err)
 	}
-	return nil
 }
@@ -18,21 +18,31 @@ package gkmAgent
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	mcvDevices "github.com/redhat-et/GKM/mcv/pkg/accelerator/devices"
+	mcvCache "github.com/redhat-et/GKM/mcv/pkg/cache"
 	mcvClient "github.com/redhat-et/GKM/mcv/pkg/client"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	gkmv1alpha1 "github.com/redhat-et/GKM/api/v1alpha1"
 	"github.com/redhat-et/GKM/pkg/common"
+	"github.com/redhat-et/GKM/pkg/extract"
 	"github.com/redhat-et/GKM/pkg/utils"
 )
 
@@ -45,7 +55,10 @@ type GKMInstance interface {
 	GetPodTemplate() *gkmv1alpha1.PodTemplate
 	GetStorageClassName() string
 	GetAccessMode() []corev1.PersistentVolumeAccessMode
+	GetMountMode() gkmv1alpha1.MountMode
+	GetPriority() int32
 	GetWorkloadNamespaces() []string
+	GetImagePullSecrets() (string, []string)
 	GetPvcOwner() gkmv1alpha1.PvcOwner
 	GetAnnotations() map[string]string
 	GetLabels() map[string]string
@@ -85,16 +98,27 @@ type GKMNodeInstanceList[N any] interface {
 
 type ReconcilerCommonAgent[C GKMInstance, CL GKMInstanceList[C], N GKMNodeInstance, NL GKMNodeInstanceList[N]] struct {
 	client.Client
-	Scheme          *runtime.Scheme
-	Logger          logr.Logger
-	Recorder        record.EventRecorder
-	NodeName        string
-	NoGpu           bool
-	KindCluster     bool
-	ExtractLogLevel string
-	ExtractImage    string
-	CrdCacheStr     string // For logging/errors: GKMCache or ClusterGKMCache
-	CrdCacheNodeStr string // For logging/errors: GKMCacheNode or ClusterGKMCacheNode
+	Scheme           *runtime.Scheme
+	Logger           logr.Logger
+	Recorder         record.EventRecorder
+	KubeClient       kubernetes.Interface // For reading the log of failed Job Pods, may be nil
+	SecretReader     client.Reader        // For reading the copies of image pull Secrets, uncached, defaults to the Client
+	NodeName         string
+	NoGpu            bool
+	KindCluster      bool
+	CacheDir         string // Host cache directory as mounted in the Agent, backs the hostPath PVs
+	ExtractLogLevel  string
+	ExtractImage     string
+	Extractor        *Extractor    // If set, extract in the Agent instead of launching a Job
+	Scrubber         *Scrubber     // If set, extracted caches are periodically verified
+	Evictor          *Evictor      // If set, unused caches are evicted to stay within the Node budget
+	DiskMonitor      *DiskMonitor  // If set, the disk usage of the caches is reported in the Node Status
+	LayerServer      *LayerServer  // If set, the layers pulled on the Node are served to the other Nodes
+	LayerPeers       bool          // If set, extraction Jobs fetch layers from the other Nodes first
+	ExtractQueue     *ExtractQueue // Limits the extractions running at once on the Node
+	MaxRegistryPulls int           // Limits the registry pulls running at once in the cluster, 0 is no limit
+	CrdCacheStr      string        // For logging/errors: GKMCache or ClusterGKMCache
+	CrdCacheNodeStr  string        // For logging/errors: GKMCacheNode or ClusterGKMCacheNode
 }
 
 // AgentReconciler is an interface that defines the methods needed to reconcile
@@ -185,7 +209,10 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) reconcileCommonAgent(
 				"StorageClass", gkmCache.GetStorageClassName(),
 				"PvcOwner", gkmCache.GetPvcOwner())
 
-			cacheDeleting := reconciler.isBeingDeleted(&gkmCache)
+			// An expired Cache (see spec.ttlSecondsAfterUnused) is removed from the Node like a
+			// deleted Cache. It is added back once the Operator restores it.
+			cacheDeleting := reconciler.isBeingDeleted(&gkmCache) ||
+				gkmv1alpha1.GkmCondExpired.IsConditionSet(gkmCache.GetStatus().Conditions)
 
 			// Call KubeAPI to Retrieve GKMCacheNode for this GKMCache
 			gkmCacheNode, err := reconciler.getCacheNode(ctx, gkmCache.GetNamespace(), gkmCache.GetName())
@@ -344,6 +371,15 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) reconcileCommonAgent(
 						// (Finalizer was added) and the PVC Owner is set, now the Agent can continue processing
 						// this GKMCache or ClusterGKMCache. Go ahead and allocate the memory need.
 						if !cacheStatusExisted {
+							// The Finalizer was removed if the Cache expired and was restored since.
+							if cacheNodeUpdated, err := r.addCacheFinalizerToCacheNode(ctx, reconciler, &gkmCache, gkmCacheNode); err != nil {
+								errorHit = true
+								continue
+							} else if cacheNodeUpdated {
+								r.Logger.V(1).Info("Return after Finalizer Added")
+								return ctrl.Result{Requeue: false}, nil
+							}
+
 							r.Logger.Info("CacheStatus does NOT exist, and Finalizer was already added, so initialize CacheStatus now.")
 
 							// Build up GKMCacheNode.Status
@@ -440,6 +476,11 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) reconcileCommonAgent(
 									continue
 								}
 
+								// Drop any in-agent extraction that has not completed.
+								if r.Extractor != nil {
+									r.Extractor.Forget(pvcStatus.PvcName)
+								}
+
 								nodeName := r.NodeName
 								// If there are more than one namespace associated with this Digest,
 								// use blank NodeName. When the delete looks to see if any Pods are using
@@ -449,9 +490,29 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) reconcileCommonAgent(
 									nodeName = ""
 								}
 
+								// If Image Volume, there is no Job, PVC or PV, just determine if still in use.
 								// If Owner is Agent, then attempt to delete Job, PVC and PV. Otherwise,
 								// there is nothing to do here.
-								if gkmCache.GetPvcOwner() == gkmv1alpha1.PvcOwnerAgent {
+								if cacheStatus.MountMode == gkmv1alpha1.MountModeImageVolume {
+									podUseCnt := common.GetImageVolumeUsedByList(
+										ctx,
+										r.Client,
+										r.NodeName,
+										pvcNamespace,
+										resolvedDigest,
+										r.Logger,
+									)
+									if podUseCnt != 0 {
+										pvcInUse = true
+										cacheInUse = true
+										stillInUse = true
+										if !gkmv1alpha1.GkmCondDeleting.IsConditionSet(pvcStatus.Conditions) {
+											gkmv1alpha1.SetPvcStatusConditions(&pvcStatus, gkmv1alpha1.GkmCondDeleting.Condition())
+											updated = true
+											updateReason = "Update Condition to Deleting"
+										}
+									}
+								} else if gkmCache.GetPvcOwner() == gkmv1alpha1.PvcOwnerAgent {
 									if updated, updateReason, pvcInUse, pvcDeleting, err = common.ManagePvcStatusDelete(
 										ctx,
 										r.Client,
@@ -517,6 +578,8 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) reconcileCommonAgent(
 									&cnts,
 									pvcNamespace,
 									&pvcStatus,
+									cacheStatus.MountMode,
+									resolvedDigest,
 								)
 								if cntPending {
 									stillInUse = true
@@ -535,7 +598,18 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) reconcileCommonAgent(
 						// Update with the collected counts
 						if !updated {
 							nodeStatus.Counts = cnts
-							if !reflect.DeepEqual((*gkmCacheNode).GetStatus(), nodeStatus) {
+							if r.DiskMonitor != nil {
+								nodeStatus.Storage = r.DiskMonitor.NodeStorage()
+								if size, found := r.DiskMonitor.CacheUsage(resolvedDigest); found && size != cacheStatus.DiskUsage {
+									cacheStatus.DiskUsage = size
+									updated = true
+									updateReason = "Update Disk Usage"
+								}
+							}
+							if r.LayerServer != nil {
+								nodeStatus.LayerServer = r.LayerServer.Address()
+							}
+							if !updated && !reflect.DeepEqual((*gkmCacheNode).GetStatus(), nodeStatus) {
 								updated = true
 								updateReason = "Update Counts"
 							}
@@ -756,6 +830,13 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) managePvcStatusModify(
 	pending := false
 	var err error
 
+	// In ImageVolume mode, Kubelet mounts the OCI Image directly in the workload, so there is
+	// no PV, PVC or Job to manage.
+	if (*gkmCache).GetMountMode() == gkmv1alpha1.MountModeImageVolume {
+		updated, updateReason = r.manageImageVolume(ctx, gkmCache, cacheStatus, pvcStatus, resolvedDigest)
+		return updated, updateReason, pending, nil
+	}
+
 	// Manage PV and PVC
 	// If updated is already true, still manage PV and PVCs, because up to this
 	// point, it's just been initialization and allocation of structures, no
@@ -773,6 +854,81 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) managePvcStatusModify(
 		return updated, updateReason, pending, err
 	}
 
+	// An evicted Cache is only extracted again once a Pod uses it, see addCounts().
+	if gkmv1alpha1.GkmCondEvicted.IsConditionSet(pvcStatus.Conditions) {
+		return updated, updateReason, pending, nil
+	}
+
+	// When the Agent owns the PVC, wait for a free extraction slot on the Node before
+	// extracting the Cache. Once admitted, the slot is held until the extraction completes.
+	if r.ExtractQueue != nil && (*gkmCache).GetPvcOwner() == gkmv1alpha1.PvcOwnerAgent {
+		var admitted bool
+		if admitted, updated, updateReason, pending, err = r.manageExtractQueue(
+			ctx,
+			gkmCache,
+			cacheStatus,
+			pvcStatus,
+			pvcNamespace,
+			resolvedDigest,
+		); err != nil || updated || !admitted {
+			return updated, updateReason, pending, err
+		}
+	}
+
+	// When the Agent owns the PVC and the extraction failed with a transient error, retry it
+	// once the backoff delay has passed.
+	if (*gkmCache).GetPvcOwner() == gkmv1alpha1.PvcOwnerAgent {
+		if retryPending, _ := common.ExtractRetryPending(pvcStatus); retryPending {
+			return r.manageExtractRetry(ctx, gkmCache, pvcStatus, pvcNamespace, resolvedDigest)
+		}
+	}
+
+	// When the Agent owns the PVC and scrubbing found the extracted Cache corrupted, flag it and
+	// extract it again.
+	if r.Scrubber != nil && (*gkmCache).GetPvcOwner() == gkmv1alpha1.PvcOwnerAgent {
+		if updated, updateReason, pending, err = r.manageScrub(
+			ctx,
+			gkmCache,
+			gkmCacheNode,
+			pvcStatus,
+			pvcNamespace,
+			resolvedDigest,
+		); err != nil || updated || pending {
+			return updated, updateReason, pending, err
+		}
+	}
+
+	// When the Agent owns the PVC and the Cache was selected for eviction, remove it from the
+	// host cache directory to free disk space.
+	if r.Evictor != nil && (*gkmCache).GetPvcOwner() == gkmv1alpha1.PvcOwnerAgent {
+		if updated, updateReason, pending, err = r.manageEvict(
+			ctx,
+			gkmCache,
+			gkmCacheNode,
+			pvcStatus,
+			pvcNamespace,
+			resolvedDigest,
+		); err != nil || updated || pending {
+			return updated, updateReason, pending, err
+		}
+	}
+
+	// When the Agent owns the PVC and in-agent extraction is enabled, extract the Cache in the
+	// Agent instead of launching a Job.
+	if r.Extractor != nil && (*gkmCache).GetPvcOwner() == gkmv1alpha1.PvcOwnerAgent {
+		updated, updateReason, pending = r.manageAgentExtract(
+			ctx,
+			gkmCache,
+			gkmCacheNode,
+			cacheStatus,
+			pvcStatus,
+			pvcNamespace,
+			resolvedDigest,
+			capacity,
+		)
+		return updated, updateReason, pending, nil
+	}
+
 	// Launch Job to Extract Cache
 	if updated, updateReason, pending, err = r.manageJob(
 		ctx,
@@ -789,6 +945,50 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) managePvcStatusModify(
 	return updated, updateReason, pending, err
 }
 
+// manageImageVolume handles Create and Update calls when the GPU Kernel Cache is mounted as an
+// Image Volume. Nothing is extracted on the host, so once the compatibility of the OCI Image with
+// the GPUs on the node has been determined, the cache is marked as Extracted. From there, usage is
+// tracked the same as a PVC.
+func (r *ReconcilerCommonAgent[C, CL, N, NL]) manageImageVolume(
+	ctx context.Context,
+	gkmCache *C,
+	cacheStatus *gkmv1alpha1.CacheStatus,
+	pvcStatus *gkmv1alpha1.PvcStatus,
+	resolvedDigest string,
+) (bool, string) {
+	updated := false
+	updateReason := ""
+
+	if cacheStatus.MountMode != gkmv1alpha1.MountModeImageVolume {
+		cacheStatus.MountMode = gkmv1alpha1.MountModeImageVolume
+		updated = true
+		updateReason = "Set Mount Mode"
+	}
+
+	if gkmv1alpha1.GkmCondPending.IsConditionSet(pvcStatus.Conditions) {
+		r.Logger.Info("Image Volume mode, checking GPU compatibility",
+			"Namespace", (*gkmCache).GetNamespace(),
+			"Name", (*gkmCache).GetName(),
+			"Digest", resolvedDigest)
+
+		if err := r.getImageToGpuList(ctx, gkmCache, resolvedDigest, cacheStatus); err != nil {
+			gkmv1alpha1.SetPvcStatusConditions(pvcStatus, gkmv1alpha1.GkmCondError.Condition())
+			updated = true
+			updateReason = "Update Condition to Error"
+		} else {
+			gkmv1alpha1.SetPvcStatusConditions(pvcStatus, gkmv1alpha1.GkmCondExtracted.Condition())
+			updated = true
+			updateReason = "Update Condition to Extracted"
+		}
+	} else if gkmv1alpha1.GkmCondDeleting.IsConditionSet(pvcStatus.Conditions) {
+		gkmv1alpha1.SetPvcStatusConditions(pvcStatus, gkmv1alpha1.GkmCondRunning.Condition())
+		updated = true
+		updateReason = "Update Condition to Running"
+	}
+
+	return updated, updateReason
+}
+
 // managePVandPVC manages the PV and PVC that the GPU Kernel Cache is extracted to. If PVC does not exist, then
 // this function calls KubeAPI to create the PVC. It MAY need to create the PV first. If both are created, this
 // function determines if the PVC is in a valid state to receive the extracted GPU Kernel Cache.
@@ -812,8 +1012,9 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) managePVandPVC(
 		if (*gkmCache).GetPvcOwner() == gkmv1alpha1.PvcOwnerAgent {
 			// The preferred method for creating a PV is to create the PVC and Kubelet auto-creates the PV.
 			// In a KIND cluster, there is not a true CSI driver for storage management, so the PV must be
-			// manually created.
-			if r.KindCluster {
+			// manually created. When extracting in the Agent, the Cache is written to the host cache
+			// directory, so the PV must be a hostPath PV referencing that directory.
+			if r.KindCluster || r.Extractor != nil {
 				_, found, updatedName, err := common.PvExists(
 					ctx,
 					r.Client,
@@ -856,6 +1057,9 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) managePVandPVC(
 						(*gkmCache).GetStorageClassName(),
 						capacity,
 						resolvedDigest,
+						// The directory only exists once the Cache is extracted in it, so Pods
+						// that mount the PV before then, or after it is evicted, wait.
+						corev1.HostPathDirectory,
 						r.Logger,
 					)
 
@@ -918,6 +1122,7 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) managePVandPVC(
 						(*gkmCache).GetStorageClassName(),
 						capacity,
 						resolvedDigest,
+						"", // snapshotName
 						r.Logger,
 					)
 
@@ -936,6 +1141,637 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) managePVandPVC(
 	return updated, updateReason, nil
 }
 
+// manageExtractQueue limits the number of GPU Kernel Cache extractions running at once on the Node,
+// and optionally the number of registry pulls running at once across the cluster. Returns true if
+// the extraction may be launched or is already running. While waiting, the position in the queue is
+// reported in the Cache Status and in the message on the Pending condition. The registry pull slot
+// is renewed by the ExtractQueue while the extraction runs. If it is lost, the extraction is stopped
+// and queued again.
+func (r *ReconcilerCommonAgent[C, CL, N, NL]) manageExtractQueue(
+	ctx context.Context,
+	gkmCache *C,
+	cacheStatus *gkmv1alpha1.CacheStatus,
+	pvcStatus *gkmv1alpha1.PvcStatus,
+	jobNamespace string,
+	resolvedDigest string,
+) (bool, bool, string, bool, error) {
+	admitted := false
+	updated := false
+	updateReason := ""
+	stillPending := false
+
+	// The PVC Name is unique per Node per Namespace, so use it to track the extraction.
+	key := pvcStatus.PvcName
+	cacheKey := (*gkmCache).GetNamespace() + "/" + (*gkmCache).GetName() + "@" + resolvedDigest
+	holder := r.NodeName + "/" + key
+
+	switch {
+	case gkmv1alpha1.IsConditionDownloadSet(pvcStatus.Conditions) ||
+		gkmv1alpha1.GkmCondError.IsConditionSet(pvcStatus.Conditions) ||
+		gkmv1alpha1.GkmCondCorrupted.IsConditionSet(pvcStatus.Conditions):
+		// Extraction is done, so free the slots.
+		if r.ExtractQueue.Release(key) && r.MaxRegistryPulls > 0 {
+			if err := common.ReleasePullLease(
+				ctx, r.Client, utils.GKMDefaultNamespace, r.MaxRegistryPulls, holder, r.Logger,
+			); err != nil {
+				r.Logger.Error(err, "unable to release registry pull slot", "holder", holder)
+			}
+		}
+		admitted = true
+	case gkmv1alpha1.GkmCondPending.IsConditionSet(pvcStatus.Conditions) && key != "":
+		created := (*gkmCache).GetClientObject().GetCreationTimestamp().Time
+		var position int
+		admitted, position = r.ExtractQueue.Admit(key, cacheKey, (*gkmCache).GetPriority(), created)
+		message := fmt.Sprintf("Waiting for extraction slot on Node, position %d", position)
+
+		if admitted && r.MaxRegistryPulls > 0 {
+			acquired, err := common.AcquirePullLease(
+				ctx, r.Client, utils.GKMDefaultNamespace, r.MaxRegistryPulls, holder, r.Logger,
+			)
+			if err != nil || !acquired {
+				// Give the Node slot to the next extraction in the queue and try again later.
+				r.ExtractQueue.Requeue(key, (*gkmCache).GetPriority(), created)
+				if err != nil {
+					return false, updated, updateReason, stillPending, err
+				}
+				admitted = false
+				message = fmt.Sprintf("Waiting for registry pull slot, %d pulls in progress", r.MaxRegistryPulls)
+			} else {
+				r.ExtractQueue.HoldPull(key, holder)
+			}
+		}
+
+		if !admitted {
+			condition := gkmv1alpha1.GkmCondPending.Condition()
+			condition.Message = message
+			current := meta.FindStatusCondition(pvcStatus.Conditions, condition.Type)
+			if current == nil || current.Message != condition.Message {
+				r.Logger.Info("Extraction queued",
+					"Namespace", (*gkmCache).GetNamespace(),
+					"Name", (*gkmCache).GetName(),
+					"PVC Name", pvcStatus.PvcName,
+					"digest", resolvedDigest,
+					"message", message)
+				gkmv1alpha1.SetPvcStatusConditions(pvcStatus, condition)
+				updated = true
+				updateReason = "Update Queue Position"
+			} else {
+				stillPending = true
+			}
+		}
+	default:
+		// Extraction is in progress. After an Agent restart the queue is empty, so make sure
+		// the running extraction is counted, and keep the registry pull slot.
+		r.ExtractQueue.MarkRunning(key, cacheKey)
+		if r.MaxRegistryPulls > 0 {
+			held := !r.ExtractQueue.PullLost(key)
+			if held {
+				acquired, err := common.AcquirePullLease(
+					ctx, r.Client, utils.GKMDefaultNamespace, r.MaxRegistryPulls, holder, r.Logger,
+				)
+				if err != nil {
+					r.Logger.Error(err, "unable to renew registry pull slot", "holder", holder)
+				} else if acquired {
+					r.ExtractQueue.HoldPull(key, holder)
+				} else {
+					held = false
+				}
+			}
+			if !held {
+				// Another Agent may be pulling in its place, so stop the extraction and wait
+				// for a registry pull slot again.
+				updated, updateReason, err := r.requeueExtraction(ctx, gkmCache, pvcStatus, jobNamespace, resolvedDigest)
+				return false, updated, updateReason, stillPending, err
+			}
+		}
+		admitted = true
+	}
+
+	// Multiple Namespaces may be waiting on the same Cache, so report the best position.
+	position := int32(r.ExtractQueue.Position(cacheKey))
+	if cacheStatus.QueuePosition != position {
+		cacheStatus.QueuePosition = position
+		if !updated {
+			updated = true
+			updateReason = "Update Queue Position"
+		}
+	}
+
+	return admitted, updated, updateReason, stillPending, nil
+}
+
+// requeueExtraction stops the running extraction of the GPU Kernel Cache, by deleting its Job, and
+// moves it back to the extraction queue with the PVC Status back to Pending. In-agent extraction
+// cannot be interrupted, so it runs to completion but its result is discarded.
+func (r *ReconcilerCommonAgent[C, CL, N, NL]) requeueExtraction(
+	ctx context.Context,
+	gkmCache *C,
+	pvcStatus *gkmv1alpha1.PvcStatus,
+	jobNamespace string,
+	resolvedDigest string,
+) (bool, string, error) {
+	key := pvcStatus.PvcName
+	r.Logger.Info("Registry pull slot lost, queuing extraction again",
+		"Namespace", (*gkmCache).GetNamespace(),
+		"Name", (*gkmCache).GetName(),
+		"PVC Name", pvcStatus.PvcName,
+		"digest", resolvedDigest)
+
+	if r.Extractor != nil {
+		r.Extractor.Forget(key)
+	} else {
+		updated, updateReason, err := common.DeleteJob(
+			ctx,
+			r.Client,
+			jobNamespace,
+			r.NodeName,
+			resolvedDigest,
+			pvcStatus,
+			gkmv1alpha1.PvcOwnerAgent,
+			r.Logger,
+		)
+		if err != nil {
+			return updated, updateReason, err
+		}
+	}
+
+	created := (*gkmCache).GetClientObject().GetCreationTimestamp().Time
+	r.ExtractQueue.Requeue(key, (*gkmCache).GetPriority(), created)
+	condition := gkmv1alpha1.GkmCondPending.Condition()
+	condition.Message = fmt.Sprintf("Registry pull slot lost, waiting for registry pull slot, %d pulls in progress",
+		r.MaxRegistryPulls)
+	gkmv1alpha1.SetPvcStatusConditions(pvcStatus, condition)
+	return true, "Requeue Extraction", nil
+}
+
+// manageExtractRetry handles an extraction that failed with a transient error. Once the backoff
+// delay has passed, the failed Job, if any, is deleted and the PVC Status is moved back to Pending
+// so the extraction goes back through the extraction queue and is launched again.
+func (r *ReconcilerCommonAgent[C, CL, N, NL]) manageExtractRetry(
+	ctx context.Context,
+	gkmCache *C,
+	pvcStatus *gkmv1alpha1.PvcStatus,
+	jobNamespace string,
+	resolvedDigest string,
+) (bool, string, bool, error) {
+	if _, remaining := common.ExtractRetryPending(pvcStatus); remaining > 0 {
+		r.Logger.V(1).Info("Waiting to retry extraction",
+			"Namespace", (*gkmCache).GetNamespace(),
+			"Name", (*gkmCache).GetName(),
+			"PVC Name", pvcStatus.PvcName,
+			"remaining", remaining)
+		return false, "", true, nil
+	}
+
+	// A new Job is not launched while the failed Job exists.
+	if r.Extractor == nil {
+		updated, updateReason, err := common.DeleteJob(
+			ctx,
+			r.Client,
+			jobNamespace,
+			r.NodeName,
+			resolvedDigest,
+			pvcStatus,
+			gkmv1alpha1.PvcOwnerAgent,
+			r.Logger,
+		)
+		if err != nil {
+			return updated, updateReason, false, err
+		}
+	}
+
+	r.Logger.Info("Retrying extraction",
+		"Namespace", (*gkmCache).GetNamespace(),
+		"Name", (*gkmCache).GetName(),
+		"PVC Name", pvcStatus.PvcName,
+		"digest", resolvedDigest,
+		"attempt", pvcStatus.RetryCount+1)
+	common.RetryExtract(pvcStatus)
+	return true, "Retry Extraction", false, nil
+}
+
+// manageScrub handles a GPU Kernel Cache that scrubbing found corrupted. The PVC Status is first
+// moved to Corrupted, with the files that do not match the integrity manifest in the message.
+// On the next pass, the extraction is invalidated, the Job that extracted it, if any, is deleted,
+// and the PVC Status is moved back to Pending so the Cache goes back through the extraction queue
+// and is extracted again. When extracted by a Job, that waits until no Pod uses the Cache.
+func (r *ReconcilerCommonAgent[C, CL, N, NL]) manageScrub(
+	ctx context.Context,
+	gkmCache *C,
+	gkmCacheNode *N,
+	pvcStatus *gkmv1alpha1.PvcStatus,
+	jobNamespace string,
+	resolvedDigest string,
+) (bool, string, bool, error) {
+	imageURL := utils.ReplaceUrlTag((*gkmCache).GetImage(), resolvedDigest)
+
+	if gkmv1alpha1.GkmCondCorrupted.IsConditionSet(pvcStatus.Conditions) {
+		// The Job mounts the PVC, so it replaces the extracted files one at a time and cannot
+		// tell if Pods use them. Wait until no Pod uses the Cache before extracting it again.
+		if r.Extractor == nil && r.digestInUse(ctx, jobNamespace, (*gkmCache).GetName(), resolvedDigest) {
+			r.Logger.Info("Corrupted cache in use, waiting for the Pods to stop to extract it again",
+				"Namespace", (*gkmCache).GetNamespace(),
+				"Name", (*gkmCache).GetName(),
+				"PVC Name", pvcStatus.PvcName,
+				"digest", resolvedDigest)
+			return false, "", true, nil
+		}
+
+		cacheDir := filepath.Join(r.Scrubber.CacheDir(), utils.CacheDirName(resolvedDigest))
+		if err := extract.InvalidateCache(cacheDir, imageURL, r.Logger); err != nil {
+			if errors.Is(err, extract.ErrExtractInProgress) {
+				return false, "", true, nil
+			}
+			return false, "", false, err
+		}
+
+		// A new Job is not launched while the Job that extracted the Cache exists.
+		if r.Extractor == nil {
+			updated, updateReason, err := common.DeleteJob(
+				ctx,
+				r.Client,
+				jobNamespace,
+				r.NodeName,
+				resolvedDigest,
+				pvcStatus,
+				gkmv1alpha1.PvcOwnerAgent,
+				r.Logger,
+			)
+			if err != nil {
+				return updated, updateReason, false, err
+			}
+		}
+		r.Scrubber.Clear(imageURL)
+
+		r.Logger.Info("Extracting corrupted cache again",
+			"Namespace", (*gkmCache).GetNamespace(),
+			"Name", (*gkmCache).GetName(),
+			"PVC Name", pvcStatus.PvcName,
+			"digest", resolvedDigest)
+		condition := gkmv1alpha1.GkmCondPending.Condition()
+		condition.Message = "Extracting again, the extracted Kernel Cache was corrupted"
+		pvcStatus.RetryCount = 0
+		gkmv1alpha1.SetPvcStatusConditions(pvcStatus, condition)
+		return true, "Re-extract Corrupted Cache", false, nil
+	}
+
+	// Only a Cache that is extracted and not being deleted is extracted again.
+	if !gkmv1alpha1.GkmCondExtracted.IsConditionSet(pvcStatus.Conditions) &&
+		!gkmv1alpha1.GkmCondRunning.IsConditionSet(pvcStatus.Conditions) {
+		return false, "", false, nil
+	}
+	issues, corrupted := r.Scrubber.Corrupted(imageURL)
+	if !corrupted {
+		return false, "", false, nil
+	}
+
+	message := mcvCache.IntegrityIssuesMessage(issues)
+	r.Logger.Info("Extracted cache is corrupted",
+		"Namespace", (*gkmCache).GetNamespace(),
+		"Name", (*gkmCache).GetName(),
+		"PVC Name", pvcStatus.PvcName,
+		"digest", resolvedDigest,
+		"message", message)
+	condition := gkmv1alpha1.GkmCondCorrupted.Condition()
+	condition.Message = message
+	gkmv1alpha1.SetPvcStatusConditions(pvcStatus, condition)
+	if r.Recorder != nil {
+		r.Recorder.Event((*gkmCacheNode).GetClientObject(),
+			corev1.EventTypeWarning,
+			string(gkmv1alpha1.GkmCacheNodeEventReasonCorrupted),
+			fmt.Sprintf("%s %q is corrupted in %s, extracting again: %s",
+				r.CrdCacheStr, (*gkmCache).GetName(), pvcStatus.PvcName, message))
+	}
+	return true, "Update Condition to Corrupted", false, nil
+}
+
+// manageEvict removes a GPU Kernel Cache that the Evictor selected for eviction from the host
+// cache directory, and moves the PVC Status to Evicted. Only a Cache that is Extracted and not
+// used by any Pod is evicted. The directory is shared by every Cache with the same digest, so
+// the Pods of all the PVs on the Node backed by it are checked, before and again after the
+// directory is fenced, see extract.EvictCache. The Job that extracted the Cache, if any, is
+// deleted so a new Job can be launched when the Cache is used again. Without a host cache
+// directory, the PVC the Job extracted the Cache to is deleted instead of the directory.
+func (r *ReconcilerCommonAgent[C, CL, N, NL]) manageEvict(
+	ctx context.Context,
+	gkmCache *C,
+	gkmCacheNode *N,
+	pvcStatus *gkmv1alpha1.PvcStatus,
+	pvcNamespace string,
+	resolvedDigest string,
+) (bool, string, bool, error) {
+	if !gkmv1alpha1.GkmCondExtracted.IsConditionSet(pvcStatus.Conditions) {
+		return false, "", false, nil
+	}
+	message, evict := r.Evictor.Evicting(resolvedDigest)
+	if !evict {
+		return false, "", false, nil
+	}
+
+	// A Pod may have started using the Cache since the Evictor selected it.
+	inUse := func() bool { return r.digestInUse(ctx, pvcNamespace, (*gkmCache).GetName(), resolvedDigest) }
+	if inUse() {
+		return false, "", false, nil
+	}
+
+	var freed int64
+	if r.Evictor.CacheDir() != "" {
+		imageURL := utils.ReplaceUrlTag((*gkmCache).GetImage(), resolvedDigest)
+		cacheDir := filepath.Join(r.Evictor.CacheDir(), utils.CacheDirName(resolvedDigest))
+		var err error
+		freed, err = extract.EvictCache(cacheDir, imageURL, inUse, r.Logger)
+		if err != nil {
+			if errors.Is(err, extract.ErrExtractInProgress) {
+				return false, "", true, nil
+			} else if errors.Is(err, extract.ErrCacheInUse) {
+				return false, "", false, nil
+			}
+			return false, "", false, err
+		}
+	}
+
+	// A new Job is not launched while the Job that extracted the Cache exists.
+	if r.Extractor == nil {
+		updated, updateReason, err := common.DeleteJob(
+			ctx,
+			r.Client,
+			pvcNamespace,
+			r.NodeName,
+			resolvedDigest,
+			pvcStatus,
+			gkmv1alpha1.PvcOwnerAgent,
+			r.Logger,
+		)
+		if err != nil {
+			return updated, updateReason, false, err
+		}
+	}
+
+	// Without a host cache directory, the Job extracted the Cache to a PVC provisioned by the
+	// StorageClass. Deleting the PVC frees its volume, and a new PVC is created when the Cache
+	// is extracted again.
+	if r.Evictor.CacheDir() == "" {
+		updated, updateReason, pvcInUse, pvcDeleting, err := common.DeletePvc(
+			ctx,
+			r.Client,
+			(*gkmCache).GetName(),
+			r.NodeName,
+			pvcNamespace,
+			resolvedDigest,
+			pvcStatus,
+			gkmv1alpha1.PvcOwnerAgent,
+			r.Logger,
+		)
+		if err != nil || pvcInUse {
+			return updated, updateReason, false, err
+		} else if pvcDeleting || pvcStatus.PvcName != "" {
+			return updated, updateReason, true, nil
+		}
+		pvcStatus.PvName = ""
+	}
+
+	r.Logger.Info("Evicted cache",
+		"Namespace", (*gkmCache).GetNamespace(),
+		"Name", (*gkmCache).GetName(),
+		"PVC Name", pvcStatus.PvcName,
+		"digest", resolvedDigest,
+		"bytes", freed,
+		"message", message)
+	condition := gkmv1alpha1.GkmCondEvicted.Condition()
+	condition.Message = message
+	pvcStatus.RetryCount = 0
+	gkmv1alpha1.SetPvcStatusConditions(pvcStatus, condition)
+	if r.Recorder != nil {
+		r.Recorder.Event((*gkmCacheNode).GetClientObject(),
+			corev1.EventTypeNormal,
+			string(gkmv1alpha1.GkmCacheNodeEventReasonEvicted),
+			fmt.Sprintf("%s %q was evicted from %s: %s",
+				r.CrdCacheStr, (*gkmCache).GetName(), pvcStatus.PvcName, message))
+	}
+	return true, "Update Condition to Evicted", false, nil
+}
+
+// digestInUse returns true if a Pod on the Node uses the Cache named cacheName in pvcNamespace,
+// or any of the PVs backed by the host cache directory of resolvedDigest, whatever GKMCache or
+// ClusterGKMCache created them. If the PVs cannot be listed, the directory is reported in use.
+func (r *ReconcilerCommonAgent[C, CL, N, NL]) digestInUse(
+	ctx context.Context,
+	pvcNamespace string,
+	cacheName string,
+	resolvedDigest string,
+) bool {
+	if common.GetPvcUsedByList(
+		ctx,
+		r.Client,
+		r.NodeName,
+		pvcNamespace,
+		cacheName, /* PvcName: Serving PVC has same name as Cache */
+		r.Logger,
+	) != 0 {
+		return true
+	}
+
+	trimDigest := strings.TrimPrefix(resolvedDigest, utils.DigestPrefix)
+	pvList := &corev1.PersistentVolumeList{}
+	if err := r.List(ctx, pvList, client.MatchingLabels{
+		utils.PvLabelNode:   r.NodeName,
+		utils.PvLabelDigest: trimDigest[:utils.MaxLabelValueLength],
+	}); err != nil {
+		r.Logger.Info("Unable to list PVs to check cache usage", "digest", resolvedDigest, "err", err)
+		return true
+	}
+
+	for _, pv := range pvList.Items {
+		if common.GetPvcUsedByList(
+			ctx,
+			r.Client,
+			r.NodeName,
+			pv.Labels[utils.PvLabelPvcNamespace],
+			pv.Labels[utils.PvLabelCache], /* PvcName: Serving PVC has same name as Cache */
+			r.Logger,
+		) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// makeCacheDir creates the directory of resolvedDigest in the host cache directory, for a Job
+// to extract the Cache into. The hostPath PV of the Cache requires it, so Pods that mount the
+// PV while the Job runs can see a partial Cache. Nothing is done if the PV is not a hostPath PV.
+func (r *ReconcilerCommonAgent[C, CL, N, NL]) makeCacheDir(resolvedDigest string) error {
+	if !r.KindCluster || r.CacheDir == "" {
+		return nil
+	}
+	return os.MkdirAll(filepath.Join(r.CacheDir, utils.CacheDirName(resolvedDigest)), os.ModePerm)
+}
+
+// registryAuth returns the registry credentials in the image pull Secrets of gkmCache, as a
+// Docker config.json, or nil if it has none. They are read from the copy the Operator makes in
+// the GKM Namespace, the only Namespace the Agent can read Secrets in.
+func (r *ReconcilerCommonAgent[C, CL, N, NL]) registryAuth(ctx context.Context, gkmCache *C) ([]byte, error) {
+	if _, names := (*gkmCache).GetImagePullSecrets(); len(names) == 0 {
+		return nil, nil
+	}
+	reader := r.SecretReader
+	if reader == nil {
+		reader = r.Client
+	}
+	registryAuth, err := utils.CopiedRegistryAuth(ctx, reader, (*gkmCache).GetClientObject().GetUID())
+	if err != nil {
+		r.Logger.Error(err, "unable to read registry credentials",
+			"namespace", (*gkmCache).GetNamespace(),
+			"name", (*gkmCache).GetName())
+		return nil, err
+	}
+	return registryAuth, nil
+}
+
+// registryAuthSecret returns the name of the Secret an extraction Job of gkmCache mounts the
+// registry credentials from, the copy of its image pull Secrets the Operator makes in the Job
+// Namespace, or "" if gkmCache has none.
+func registryAuthSecret[C GKMInstance](gkmCache *C) string {
+	if _, names := (*gkmCache).GetImagePullSecrets(); len(names) == 0 {
+		return ""
+	}
+	return utils.RegistryAuthSecretName((*gkmCache).GetClientObject().GetUID())
+}
+
+// layerPeers returns the LayerServers of the other Nodes an extraction Job fetches the layers
+// of resolvedDigest from before the registry, if any.
+func (r *ReconcilerCommonAgent[C, CL, N, NL]) layerPeers(ctx context.Context, resolvedDigest string) []string {
+	if !r.LayerPeers {
+		return nil
+	}
+	peers, err := FindLayerPeers(ctx, r.Client, r.NodeName, resolvedDigest)
+	if err != nil {
+		// The Job pulls every layer from the registry instead.
+		r.Logger.Info("unable to find layer peers", "digest", resolvedDigest, "err", err)
+		return nil
+	}
+	return peers
+}
+
+// manageAgentExtract is the in-agent equivalent of manageJob. Instead of launching a Job, the
+// extraction is submitted to the Extractor, which extracts the GPU Kernel Cache into the host
+// cache directory backing the Download PVC. The PVC Status conditions follow the same flow as
+// the Job, with the condition message on Downloading reporting the progress. An extraction that
+// replaced one still used by Pods leaves it beside the directory, and it is removed here once
+// the Pods are gone.
+func (r *ReconcilerCommonAgent[C, CL, N, NL]) manageAgentExtract(
+	ctx context.Context,
+	gkmCache *C,
+	gkmCacheNode *N,
+	cacheStatus *gkmv1alpha1.CacheStatus,
+	pvcStatus *gkmv1alpha1.PvcStatus,
+	pvcNamespace string,
+	resolvedDigest string,
+	capacity string,
+) (bool, string, bool) {
+	updated := false
+	updateReason := ""
+	stillPending := false
+
+	inUse := func(ctx context.Context) bool {
+		return r.digestInUse(ctx, pvcNamespace, (*gkmCache).GetName(), resolvedDigest)
+	}
+
+	// Check Conditions to determine if Cache already successfully downloaded (there are
+	// multiple states that indicate cache downloaded)
+	if gkmv1alpha1.IsConditionDownloadSet(pvcStatus.Conditions) {
+		if r.CacheDir != "" {
+			cacheDir := filepath.Join(r.CacheDir, utils.CacheDirName(resolvedDigest))
+			if err := extract.RemoveReplaced(cacheDir, func() bool { return inUse(ctx) }, r.Logger); err != nil {
+				r.Logger.Info("unable to remove replaced cache", "cacheDir", cacheDir, "err", err)
+			}
+		}
+		if gkmv1alpha1.GkmCondDeleting.IsConditionSet(pvcStatus.Conditions) {
+			gkmv1alpha1.SetPvcStatusConditions(pvcStatus, gkmv1alpha1.GkmCondRunning.Condition())
+			updated = true
+			updateReason = "Update Condition to Running"
+		}
+		return updated, updateReason, stillPending
+	} else if gkmv1alpha1.GkmCondError.IsConditionSet(pvcStatus.Conditions) {
+		return updated, updateReason, stillPending
+	}
+
+	// The PVC Name is unique per Node per Namespace, so use it to track the extraction.
+	key := pvcStatus.PvcName
+	status, found := r.Extractor.Status(key)
+	if !found {
+		// Either the extraction has not been submitted yet, or the Agent restarted while the
+		// extraction was in progress. Extraction is idempotent, so submit it again.
+		updatedImage := utils.ReplaceUrlTag((*gkmCache).GetImage(), resolvedDigest)
+		if updatedImage == "" {
+			r.Logger.Info("invalid image or digest, unable to extract",
+				"image", (*gkmCache).GetImage(), "digest", resolvedDigest)
+			gkmv1alpha1.SetPvcStatusConditions(pvcStatus, gkmv1alpha1.GkmCondError.Condition())
+			return true, "Update Condition to Error", stillPending
+		}
+
+		var expectedBytes int64
+		if quantity, err := resource.ParseQuantity(capacity); err == nil {
+			expectedBytes = quantity.Value()
+		}
+
+		r.Logger.Info("Cache NOT Extracted, extract in Agent now",
+			"Namespace", (*gkmCache).GetNamespace(),
+			"Name", (*gkmCache).GetName(),
+			"PVC Name", pvcStatus.PvcName,
+			"digest", resolvedDigest,
+			"NoGpu", r.NoGpu)
+
+		registryAuth, err := r.registryAuth(ctx, gkmCache)
+		if err != nil {
+			message := fmt.Sprintf("%s: %v", extract.FailureAuth, err)
+			common.SetExtractFailure(pvcStatus, extract.FailureAuth, message)
+			r.recordExtractFailure(gkmCache, gkmCacheNode, key, message)
+			return true, "Update Condition to Error", stillPending
+		}
+
+		r.Extractor.Submit(key, updatedImage, resolvedDigest, expectedBytes, registryAuth, inUse)
+		status, _ = r.Extractor.Status(key)
+	}
+
+	switch status.State {
+	case ExtractStateSucceeded:
+		r.Extractor.Forget(key)
+		if err := r.setExtractResult(ctx, gkmCache, resolvedDigest, cacheStatus, status.Result); err != nil {
+			r.setGpuListFailure(gkmCache, gkmCacheNode, pvcStatus, key, err)
+			updated = true
+			updateReason = "Update Condition to Error"
+		} else {
+			pvcStatus.RetryCount = 0
+			gkmv1alpha1.SetPvcStatusConditions(pvcStatus, gkmv1alpha1.GkmCondExtracted.Condition())
+			updated = true
+			updateReason = "Update Condition to Extracted"
+		}
+	case ExtractStateFailed:
+		r.Extractor.Forget(key)
+		reason := extract.ClassifyError(status.Err)
+		message := fmt.Sprintf("%s: %v", reason, status.Err)
+		common.SetExtractFailure(pvcStatus, reason, message)
+		r.recordExtractFailure(gkmCache, gkmCacheNode, key, message)
+		updated = true
+		updateReason = "Update Condition to Error"
+	default:
+		// Queued or Running, so report the progress in the Downloading condition. Only write
+		// the status when the progress changes.
+		condition := gkmv1alpha1.GkmCondDownloading.Condition()
+		condition.Message = status.Progress()
+		current := meta.FindStatusCondition(pvcStatus.Conditions, condition.Type)
+		if current == nil || current.Message != condition.Message {
+			gkmv1alpha1.SetPvcStatusConditions(pvcStatus, condition)
+			updated = true
+			updateReason = "Update Extraction Progress"
+		} else {
+			stillPending = true
+		}
+	}
+
+	return updated, updateReason, stillPending
+}
+
 // manageJob determines if the GPU Kernel Cache has been extracted. If not, checks the condition and either
 // Launches a Job to extract it, or calls KubeAPI Server to retrieve the list of Jobs that match the labels
 // for a given Cache and Digest and determines the state.
@@ -973,24 +1809,30 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) manageJob(
 				"NoGpu", r.NoGpu,
 				"KIND", r.KindCluster)
 
-			err = common.LaunchJob(
-				ctx,
-				r.Client,
-				r.Scheme,
-				(*gkmCacheNode).GetClientObject(),
-				jobNamespace,
-				jobName,
-				r.NodeName,
-				(*gkmCache).GetImage(),
-				resolvedDigest,
-				r.NoGpu,
-				r.KindCluster,
-				r.ExtractImage,
-				pvcStatus,
-				(*gkmCache).GetPodTemplate(),
-				r.Logger,
-				r.ExtractLogLevel,
-			)
+			err = r.makeCacheDir(resolvedDigest)
+			if err == nil {
+				err = common.LaunchJob(
+					ctx,
+					r.Client,
+					r.Scheme,
+					(*gkmCacheNode).GetClientObject(),
+					jobNamespace,
+					jobName,
+					r.NodeName,
+					(*gkmCache).GetImage(),
+					resolvedDigest,
+					r.NoGpu,
+					r.KindCluster,
+					r.ExtractImage,
+					false, // verifyOnly
+					r.layerPeers(ctx, resolvedDigest),
+					registryAuthSecret(gkmCache),
+					pvcStatus,
+					(*gkmCache).GetPodTemplate(),
+					r.Logger,
+					r.ExtractLogLevel,
+				)
+			}
 
 			if err != nil {
 				// Error returned launching Job to extract the Cache.
@@ -1074,16 +1916,33 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) manageJob(
 
 			switch {
 			case latestJob.Status.Succeeded > 0:
-				if !gkmv1alpha1.IsConditionDownloadSet(pvcStatus.Conditions) {
-					gkmv1alpha1.SetPvcStatusConditions(pvcStatus, gkmv1alpha1.GkmCondExtracted.Condition())
-					updated = true
-					updateReason = "Update Condition to Extracted"
-
-					r.getImageToGpuList(gkmCache, resolvedDigest, cacheStatus)
+				// Error is set on a succeeded Job when the GPU compatibility could not be
+				// determined, which is retried like a failed Job.
+				if !gkmv1alpha1.IsConditionDownloadSet(pvcStatus.Conditions) &&
+					!gkmv1alpha1.GkmCondError.IsConditionSet(pvcStatus.Conditions) {
+					result, _ := common.GetJobResult(ctx, r.Client, latestJob, r.Logger)
+					if err := r.setExtractResult(ctx, gkmCache, resolvedDigest, cacheStatus, result); err != nil {
+						r.setGpuListFailure(gkmCache, gkmCacheNode, pvcStatus, latestJob.Name, err)
+						updated = true
+						updateReason = "Update Condition to Error"
+					} else {
+						pvcStatus.RetryCount = 0
+						gkmv1alpha1.SetPvcStatusConditions(pvcStatus, gkmv1alpha1.GkmCondExtracted.Condition())
+						updated = true
+						updateReason = "Update Condition to Extracted"
+					}
 				}
 			case latestJob.Status.Failed > 0:
 				if !gkmv1alpha1.GkmCondError.IsConditionSet(pvcStatus.Conditions) {
-					gkmv1alpha1.SetPvcStatusConditions(pvcStatus, gkmv1alpha1.GkmCondError.Condition())
+					reason, message := common.GetJobFailureReason(ctx, r.Client, r.KubeClient, latestJob, r.Logger)
+					r.Logger.Info("Extract Job failed",
+						"Namespace", (*gkmCache).GetNamespace(),
+						"Name", (*gkmCache).GetName(),
+						"Job Name", latestJob.Name,
+						"reason", reason,
+						"retryCount", pvcStatus.RetryCount)
+					common.SetExtractFailure(pvcStatus, reason, message)
+					r.recordExtractFailure(gkmCache, gkmCacheNode, latestJob.Name, message)
 					updated = true
 					updateReason = "Update Condition to Error"
 				}
@@ -1103,7 +1962,8 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) manageJob(
 		// Else the Operator is managing the PVC, track state through the GKMCache or ClusterGKMCache.
 		// Check to see if this Cache Status has been updated with the PVC name from the
 		// GKMCache yet. the PV may or may not be created by Operator, may be Kubelet, so
-		// only need to check for PVC Name.
+		// only need to check for PVC Name. The Operator extracts the Cache once, so before
+		// reporting Extracted, launch a Job on this Node to verify the PVC can be read here.
 		if pvcStatus.PvcName == "" {
 			// Look through the GKMCache or ClusterGKMCache PVC Status for this namespace to get the
 			// current value.
@@ -1117,11 +1977,108 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) manageJob(
 					pvcStatus.PvcName = gkmCachePvcStatus.PvcName
 					updated = true
 					updateReason = "Set PVC Name"
+				}
+			}
+		} else if gkmv1alpha1.GkmCondPending.IsConditionSet(pvcStatus.Conditions) {
+			// Call KubeAPI to create the Job. The Job mounts the Operator managed PVC read-only
+			// and is pinned to this Node.
+			jobName := pvcStatus.PvcName + "-job-verify-"
+
+			r.Logger.Info("Cache Extracted by Operator, verify now",
+				"Namespace", (*gkmCache).GetNamespace(),
+				"Job Namespace", jobNamespace,
+				"Job Name", jobName,
+				"Name", (*gkmCache).GetName(),
+				"digest", resolvedDigest)
+
+			err = common.LaunchJob(
+				ctx,
+				r.Client,
+				r.Scheme,
+				(*gkmCacheNode).GetClientObject(),
+				jobNamespace,
+				jobName,
+				r.NodeName,
+				(*gkmCache).GetImage(),
+				resolvedDigest,
+				r.NoGpu,
+				r.KindCluster,
+				r.ExtractImage,
+				true, // verifyOnly
+				nil,  // layerPeers
+				"",   // registryAuthSecret, the image is not pulled
+				pvcStatus,
+				(*gkmCache).GetPodTemplate(),
+				r.Logger,
+				r.ExtractLogLevel,
+			)
 
-					gkmv1alpha1.SetPvcStatusConditions(
-						pvcStatus,
-						gkmv1alpha1.GetLatestConditionType(gkmCachePvcStatus.Conditions))
+			if err != nil {
+				// Error returned launching Job to verify the Cache.
+				r.Logger.Error(err, "unable to verify cache",
+					"Namespace", (*gkmCache).GetNamespace(),
+					"Job Namespace", jobNamespace,
+					"Job Name", jobName,
+					"Name", (*gkmCache).GetName(),
+					"Digest", resolvedDigest)
+			} else {
+				gkmv1alpha1.SetPvcStatusConditions(pvcStatus, gkmv1alpha1.GkmCondVerifying.Condition())
+				updated = true
+				updateReason = "Update Condition to Verifying"
+			}
+		} else if gkmv1alpha1.GkmCondVerifying.IsConditionSet(pvcStatus.Conditions) {
+			latestJob, err := common.GetLatestJob(
+				ctx,
+				r.Client,
+				jobNamespace,
+				pvcStatus.PvcName,
+				resolvedDigest,
+				r.NodeName,
+				r.Logger,
+			)
+			if err != nil || latestJob == nil {
+				r.Logger.Info("Unable to get Latest Verify Job",
+					"Namespace", (*gkmCache).GetNamespace(),
+					"Name", (*gkmCache).GetName(),
+					"PVC Name", pvcStatus.PvcName,
+					"Job Namespace", jobNamespace,
+					"err", err,
+				)
+				if latestJob == nil {
+					stillPending = true
 				}
+				return updated, updateReason, stillPending, err
+			}
+
+			if pvcStatus.JobName != latestJob.Name {
+				pvcStatus.JobName = latestJob.Name
+				updated = true
+				updateReason = "Set Job Name"
+			}
+
+			switch {
+			case latestJob.Status.Succeeded > 0:
+				if err := r.getImageToGpuList(ctx, gkmCache, resolvedDigest, cacheStatus); err != nil {
+					r.setGpuListFailure(gkmCache, gkmCacheNode, pvcStatus, latestJob.Name, err)
+					updated = true
+					updateReason = "Update Condition to Error"
+				} else {
+					gkmv1alpha1.SetPvcStatusConditions(pvcStatus, gkmv1alpha1.GkmCondExtracted.Condition())
+					updated = true
+					updateReason = "Update Condition to Extracted"
+				}
+			case latestJob.Status.Failed > 0:
+				// The Operator owns the extraction, so a failed verification is not retried here.
+				reason, message := common.GetJobFailureReason(ctx, r.Client, r.KubeClient, latestJob, r.Logger)
+				condition := gkmv1alpha1.GkmCondError.Condition()
+				condition.Reason = string(reason)
+				condition.Message = message
+				gkmv1alpha1.SetPvcStatusConditions(pvcStatus, condition)
+				r.recordExtractFailure(gkmCache, gkmCacheNode, latestJob.Name, message)
+				updated = true
+				updateReason = "Update Condition to Error"
+			default:
+				stillPending = true
 			}
 		}
 	}
@@ -1129,6 +2086,52 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) manageJob(
 	return updated, updateReason, stillPending, err
 }
 
+// recordExtractFailure records a Warning Event on the GKMCacheNode or ClusterGKMCacheNode when
+// extracting or verifying a Cache fails, so the failure shows in "kubectl describe" and the
+// cluster Events. source is the Job, or the PVC for in-agent extraction, that failed.
+func (r *ReconcilerCommonAgent[C, CL, N, NL]) recordExtractFailure(
+	gkmCache *C,
+	gkmCacheNode *N,
+	source string,
+	message string,
+) {
+	if r.Recorder == nil {
+		return
+	}
+	eventMessage := fmt.Sprintf("%s %q extraction failed in %s: %s",
+		r.CrdCacheStr, (*gkmCache).GetName(), source, message)
+	if len(eventMessage) > utils.EventMessageMaxLength {
+		eventMessage = eventMessage[:utils.EventMessageMaxLength-len("...")] + "..."
+	}
+	r.Recorder.Event((*gkmCacheNode).GetClientObject(),
+		corev1.EventTypeWarning,
+		string(gkmv1alpha1.GkmCacheNodeEventReasonExtractFailed),
+		eventMessage)
+}
+
+// setGpuListFailure moves the PVC Status to Error when the GPU compatibility of the extracted GPU
+// Kernel Cache could not be determined. When the Agent owns the PVC, a transient failure is
+// retried like a failed extraction. source is the Job, or the PVC for in-agent extraction.
+func (r *ReconcilerCommonAgent[C, CL, N, NL]) setGpuListFailure(
+	gkmCache *C,
+	gkmCacheNode *N,
+	pvcStatus *gkmv1alpha1.PvcStatus,
+	source string,
+	err error,
+) {
+	reason := extract.ClassifyError(err)
+	message := fmt.Sprintf("%s: unable to determine GPU compatibility: %v", reason, err)
+	if (*gkmCache).GetPvcOwner() == gkmv1alpha1.PvcOwnerAgent {
+		common.SetExtractFailure(pvcStatus, reason, message)
+	} else {
+		condition := gkmv1alpha1.GkmCondError.Condition()
+		condition.Reason = string(reason)
+		condition.Message = message
+		gkmv1alpha1.SetPvcStatusConditions(pvcStatus, condition)
+	}
+	r.recordExtractFailure(gkmCache, gkmCacheNode, source, message)
+}
+
 // removeCacheFromCacheNode removes a GKMCache status from the GKMCacheNode.Status.CacheStatuses field.
 // This function returns:
 //   - bool: inUse implies the Cache is still mounted in a pod.
@@ -1313,21 +2316,36 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) manageStrandedPvcs(
 										"PVC", pvcStatus.PvcName,
 										"PV", pvcStatus.PvName,
 									)
-									pvcUpdated, pvcUpdateReason, pvcInUse, pvcDeleting, err := common.ManagePvcStatusDelete(
-										ctx,
-										r.Client,
-										namespace,
-										cacheName,
-										nodeName,
-										&pvcStatus,
-										gkmv1alpha1.PvcOwnerAgent,
-										namespace,
-										digest,
-										r.Logger,
-									)
-									if err != nil {
-										errorHit = true
-										continue
+									var pvcUpdated, pvcInUse, pvcDeleting bool
+									var pvcUpdateReason string
+									if cacheStatus.MountMode == gkmv1alpha1.MountModeImageVolume {
+										// No Job, PVC or PV with an Image Volume, just wait for the Pods to stop.
+										pvcInUse = common.GetImageVolumeUsedByList(
+											ctx,
+											r.Client,
+											r.NodeName,
+											namespace,
+											digest,
+											r.Logger,
+										) != 0
+										pvcDeleting = pvcInUse
+									} else {
+										pvcUpdated, pvcUpdateReason, pvcInUse, pvcDeleting, err = common.ManagePvcStatusDelete(
+											ctx,
+											r.Client,
+											namespace,
+											cacheName,
+											nodeName,
+											&pvcStatus,
+											gkmv1alpha1.PvcOwnerAgent,
+											namespace,
+											digest,
+											r.Logger,
+										)
+										if err != nil {
+											errorHit = true
+											continue
+										}
 									}
 									if pvcUpdated {
 										cacheStatus.PvcStatus[namespace] = pvcStatus
@@ -1355,6 +2373,8 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) manageStrandedPvcs(
 									&cnts,
 									namespace,
 									&pvcStatus,
+									cacheStatus.MountMode,
+									digest,
 								)
 								if cntUpdated && !updated {
 									updated = true
@@ -1438,6 +2458,8 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) addCounts(
 	cnts *gkmv1alpha1.CacheCounts,
 	pvcNamespace string,
 	pvcStatus *gkmv1alpha1.PvcStatus,
+	mountMode gkmv1alpha1.MountMode,
+	resolvedDigest string,
 ) (bool, string, bool) {
 	updated := false
 	updateReason := ""
@@ -1447,7 +2469,18 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) addCounts(
 	//podCnt := 0
 	podUseCnt := 0
 
-	if pvcStatus.PvcName != "" {
+	if mountMode == gkmv1alpha1.MountModeImageVolume {
+		podUseCnt = common.GetImageVolumeUsedByList(
+			ctx,
+			r.Client,
+			r.NodeName,
+			pvcNamespace,
+			resolvedDigest,
+			r.Logger,
+		)
+	} else if pvcStatus.PvcName != "" || gkmv1alpha1.GkmCondEvicted.IsConditionSet(pvcStatus.Conditions) {
+		// A Cache evicted from a PVC provisioned by the StorageClass has no PVC name, but
+		// Pods still use the Serving PVC.
 		podUseCnt = common.GetPvcUsedByList(
 			ctx,
 			r.Client,
@@ -1459,13 +2492,15 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) addCounts(
 	}
 
 	switch gkmv1alpha1.GetLatestConditionType(pvcStatus.Conditions).Type {
-	case string(gkmv1alpha1.GkmCondPending):
+	case string(gkmv1alpha1.GkmCondPending), string(gkmv1alpha1.GkmCondVerifying),
+		string(gkmv1alpha1.GkmCondCorrupted):
 		// Temp state, ignore
 	case string(gkmv1alpha1.GkmCondExtracted):
 		if podUseCnt != 0 {
 			updated = true
 			updateReason = "Update Condition to Running"
 			gkmv1alpha1.SetPvcStatusConditions(pvcStatus, gkmv1alpha1.GkmCondRunning.Condition())
+			pvcStatus.LastUsedTime = &metav1.Time{Time: time.Now()}
 		} else {
 			if cnts.NodeInUseCnt == 0 {
 				cnts.NodeNotInUseCnt = 1
@@ -1476,6 +2511,7 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) addCounts(
 			updated = true
 			updateReason = "Update Condition to Extracted"
 			gkmv1alpha1.SetPvcStatusConditions(pvcStatus, gkmv1alpha1.GkmCondExtracted.Condition())
+			pvcStatus.LastUsedTime = &metav1.Time{Time: time.Now()}
 		} else {
 			cnts.NodeInUseCnt = 1
 			cnts.NodeNotInUseCnt = 0
@@ -1494,12 +2530,79 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) addCounts(
 		cnts.NodeErrorCnt++
 	case string(gkmv1alpha1.GkmCondOutdated):
 		// PodOutdatedCnt is collected in the Garbage Collection portion of the Reconcile loop.
+	case string(gkmv1alpha1.GkmCondEvicted):
+		// The Cache was removed from the Node to free disk space, so extract it again when used.
+		if podUseCnt != 0 {
+			r.Logger.Info("Evicted cache is in use, extracting again",
+				"Name", cacheName,
+				"PVC Namespace", pvcNamespace,
+				"PVC Name", pvcStatus.PvcName,
+				"digest", resolvedDigest)
+			condition := gkmv1alpha1.GkmCondPending.Condition()
+			condition.Message = "Extracting again, the evicted Kernel Cache is in use"
+			gkmv1alpha1.SetPvcStatusConditions(pvcStatus, condition)
+			updated = true
+			updateReason = "Re-extract Evicted Cache"
+		}
 	}
 
 	return updated, updateReason, pending
 }
 
+// setExtractResult fills the GPU compatibility and size of the extracted GPU Kernel Cache in the
+// Cache Status from the Result reported by the extraction. An error is returned if there is no
+// Result and the GPU compatibility could not be determined from the image.
+func (r *ReconcilerCommonAgent[C, CL, N, NL]) setExtractResult(
+	ctx context.Context,
+	gkmCache *C,
+	resolvedDigest string,
+	cacheStatus *gkmv1alpha1.CacheStatus,
+	result *extract.Result,
+) error {
+	// Without a Result, for example if the Job Pod was already removed, fall back to
+	// pulling the image to determine the GPU compatibility.
+	if result == nil {
+		return r.getImageToGpuList(ctx, gkmCache, resolvedDigest, cacheStatus)
+	}
+
+	if result.ImageDigest != "" && result.ImageDigest != resolvedDigest {
+		r.Logger.Info("Extracted digest does not match resolved digest",
+			"namespace", (*gkmCache).GetNamespace(),
+			"name", (*gkmCache).GetName(),
+			"resolvedDigest", resolvedDigest,
+			"extractedDigest", result.ImageDigest)
+	}
+
+	// Stub out the GPU Ids when in TestMode (No GPUs), same as getImageToGpuList().
+	if r.NoGpu {
+		cacheStatus.CompGpuList = []int{0}
+		cacheStatus.IncompGpuList = []int{1, 2}
+	} else {
+		cacheStatus.CompGpuList = result.MatchedIds
+		cacheStatus.IncompGpuList = result.UnmatchedIds
+	}
+	cacheStatus.VolumeSize = result.BytesExtracted
+	cacheStatus.FileCount = result.FileCount
+	cacheStatus.BytesReused = result.BytesReused
+	if result.DurationMs > 0 {
+		cacheStatus.ExtractDuration = &metav1.Duration{Duration: result.Duration()}
+	}
+
+	r.Logger.Info("Extract Result",
+		"namespace", (*gkmCache).GetNamespace(),
+		"name", (*gkmCache).GetName(),
+		"matchedIds", cacheStatus.CompGpuList,
+		"unmatchedIds", cacheStatus.IncompGpuList,
+		"bytes", result.BytesExtracted,
+		"files", result.FileCount,
+		"bytesReused", result.BytesReused,
+		"duration", result.Duration())
+
+	return nil
+}
+
 func (r *ReconcilerCommonAgent[C, CL, N, NL]) getImageToGpuList(
+	ctx context.Context,
 	gkmCache *C,
 	resolvedDigest string,
 	cacheStatus *gkmv1alpha1.CacheStatus,
@@ -1520,7 +2623,11 @@ func (r *ReconcilerCommonAgent[C, CL, N, NL]) getImageToGpuList(
 			return err
 		}
 
-		matchedIds, unmatchedIds, err := mcvClient.PreflightCheck(updatedImage)
+		registryAuth, err := r.registryAuth(ctx, gkmCache)
+		if err != nil {
+			return err
+		}
+		matchedIds, unmatchedIds, err = extract.PreflightCheck(updatedImage, registryAuth)
 		if err != nil {
 			r.Logger.Error(err, "unable to image to GPU list",
 				"namespace", (*gkmCache).GetNamespace(), "name",
@@ -1,5 +1,25 @@
 package gkmAgent
 
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	gkmv1alpha1 "github.com/redhat-et/GKM/api/v1alpha1"
+	"github.com/redhat-et/GKM/pkg/common"
+	"github.com/redhat-et/GKM/pkg/extract"
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
 const (
 	// TestCacheRootDir is the temporary directory for storing files used during testing.
 	TestCommonCacheRootDir = "/tmp/gkm-common"
@@ -8,3 +28,304 @@ const (
 	// images.
 	TestCommonCacheDir = "/tmp/gkm-common/caches"
 )
+
+// testImageVolumePod returns a Pod on nodeName mounting the digest as an Image Volume.
+func testImageVolumePod(name, nodeName, digest string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns1"},
+		Spec: corev1.PodSpec{
+			NodeName: nodeName,
+			Volumes: []corev1.Volume{{
+				Name: "cache",
+				VolumeSource: corev1.VolumeSource{
+					Image: &corev1.ImageVolumeSource{Reference: "quay.io/example/vector-add@" + digest},
+				},
+			}},
+		},
+	}
+}
+
+func TestManageImageVolume(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, gkmv1alpha1.AddToScheme(scheme))
+
+	objClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithIndex(&corev1.Pod{}, "spec.nodeName", func(obj client.Object) []string {
+			return []string{obj.(*corev1.Pod).Spec.NodeName}
+		}).
+		Build()
+	r := &ReconcilerCommonAgent[
+		gkmv1alpha1.GKMCache,
+		gkmv1alpha1.GKMCacheList,
+		gkmv1alpha1.GKMCacheNode,
+		gkmv1alpha1.GKMCacheNodeList,
+	]{
+		Client:      objClient,
+		Logger:      logr.Discard(),
+		NodeName:    "node-a",
+		NoGpu:       true,
+		CrdCacheStr: utils.CrdGKMCache,
+	}
+	gkmCache := gkmv1alpha1.GKMCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "vector-add", Namespace: "ns1"},
+		Spec: gkmv1alpha1.GKMCacheSpec{
+			Image:     "quay.io/example/vector-add:latest",
+			MountMode: gkmv1alpha1.MountModeImageVolume,
+		},
+	}
+
+	t.Run("Test Image Volume is Extracted once the GPUs are checked", func(t *testing.T) {
+		cacheStatus := gkmv1alpha1.CacheStatus{}
+		pvcStatus := gkmv1alpha1.PvcStatus{}
+		gkmv1alpha1.SetPvcStatusConditions(&pvcStatus, gkmv1alpha1.GkmCondPending.Condition())
+
+		t.Logf("TEST: manageImageVolume() of a Pending cache - Should move the PVC Status to Extracted")
+		updated, updateReason := r.manageImageVolume(t.Context(), &gkmCache, &cacheStatus, &pvcStatus, testScrubDigest)
+		require.True(t, updated)
+		require.Equal(t, "Update Condition to Extracted", updateReason)
+		require.True(t, gkmv1alpha1.GkmCondExtracted.IsConditionSet(pvcStatus.Conditions))
+		require.Equal(t, gkmv1alpha1.MountModeImageVolume, cacheStatus.MountMode)
+		require.Equal(t, []int{0}, cacheStatus.CompGpuList)
+		require.Empty(t, pvcStatus.PvcName)
+
+		t.Logf("TEST: manageImageVolume() of an Extracted cache - Should do nothing")
+		updated, _ = r.manageImageVolume(t.Context(), &gkmCache, &cacheStatus, &pvcStatus, testScrubDigest)
+		require.False(t, updated)
+		require.True(t, gkmv1alpha1.GkmCondExtracted.IsConditionSet(pvcStatus.Conditions))
+	})
+
+	t.Run("Test Image Volume GPU check failure", func(t *testing.T) {
+		r.NoGpu = false
+		defer func() { r.NoGpu = true }()
+		badCache := gkmCache
+		badCache.Spec.Image = ""
+		cacheStatus := gkmv1alpha1.CacheStatus{}
+		pvcStatus := gkmv1alpha1.PvcStatus{}
+		gkmv1alpha1.SetPvcStatusConditions(&pvcStatus, gkmv1alpha1.GkmCondPending.Condition())
+
+		t.Logf("TEST: manageImageVolume() with an invalid image - Should move the PVC Status to Error")
+		updated, updateReason := r.manageImageVolume(t.Context(), &badCache, &cacheStatus, &pvcStatus, testScrubDigest)
+		require.True(t, updated)
+		require.Equal(t, "Update Condition to Error", updateReason)
+		require.True(t, gkmv1alpha1.GkmCondError.IsConditionSet(pvcStatus.Conditions))
+	})
+
+	t.Run("Test Image Volume in-use tracking", func(t *testing.T) {
+		pvcStatus := gkmv1alpha1.PvcStatus{}
+		gkmv1alpha1.SetPvcStatusConditions(&pvcStatus, gkmv1alpha1.GkmCondExtracted.Condition())
+		gkmCacheNode := gkmv1alpha1.GKMCacheNode{}
+
+		// Pods that must not be counted: on another Node, using another digest, and completed.
+		otherNode := testImageVolumePod("other-node", "node-b", testScrubDigest)
+		otherDigest := testImageVolumePod("other-digest", "node-a", testEvictDigest2)
+		completed := testImageVolumePod("completed", "node-a", testScrubDigest)
+		completed.Status.Phase = corev1.PodSucceeded
+		for _, pod := range []*corev1.Pod{otherNode, otherDigest, completed} {
+			require.NoError(t, objClient.Create(t.Context(), pod))
+		}
+
+		t.Logf("TEST: GetImageVolumeUsedByList() without a running Pod on the Node - Should return 0")
+		require.Zero(t, common.GetImageVolumeUsedByList(t.Context(), objClient, "node-a", "ns1", testScrubDigest, logr.Discard()))
+
+		t.Logf("TEST: addCounts() of an unused Image Volume - Should leave the PVC Status Extracted")
+		cnts := gkmv1alpha1.CacheCounts{}
+		updated, _, _ := r.addCounts(t.Context(), nil, "vector-add", &gkmCacheNode, &cnts, "ns1",
+			&pvcStatus, gkmv1alpha1.MountModeImageVolume, testScrubDigest)
+		require.False(t, updated)
+		require.Equal(t, 1, cnts.NodeNotInUseCnt)
+
+		t.Logf("TEST: addCounts() of an Image Volume used by a Pod - Should move the PVC Status to Running")
+		pod := testImageVolumePod("app", "node-a", testScrubDigest)
+		require.NoError(t, objClient.Create(t.Context(), pod))
+		require.Equal(t, 1, common.GetImageVolumeUsedByList(t.Context(), objClient, "node-a", "ns1", testScrubDigest, logr.Discard()))
+		cnts = gkmv1alpha1.CacheCounts{}
+		updated, updateReason, _ := r.addCounts(t.Context(), nil, "vector-add", &gkmCacheNode, &cnts, "ns1",
+			&pvcStatus, gkmv1alpha1.MountModeImageVolume, testScrubDigest)
+		require.True(t, updated)
+		require.Equal(t, "Update Condition to Running", updateReason)
+		require.True(t, gkmv1alpha1.GkmCondRunning.IsConditionSet(pvcStatus.Conditions))
+		require.NotNil(t, pvcStatus.LastUsedTime)
+
+		t.Logf("TEST: addCounts() of a running Image Volume - Should count the Pod")
+		cnts = gkmv1alpha1.CacheCounts{}
+		updated, _, _ = r.addCounts(t.Context(), nil, "vector-add", &gkmCacheNode, &cnts, "ns1",
+			&pvcStatus, gkmv1alpha1.MountModeImageVolume, testScrubDigest)
+		require.False(t, updated)
+		require.Equal(t, 1, cnts.NodeInUseCnt)
+		require.Equal(t, 1, cnts.PodRunningCnt)
+
+		t.Logf("TEST: addCounts() once the Pod is gone - Should move the PVC Status back to Extracted")
+		require.NoError(t, objClient.Delete(t.Context(), pod))
+		cnts = gkmv1alpha1.CacheCounts{}
+		updated, updateReason, _ = r.addCounts(t.Context(), nil, "vector-add", &gkmCacheNode, &cnts, "ns1",
+			&pvcStatus, gkmv1alpha1.MountModeImageVolume, testScrubDigest)
+		require.True(t, updated)
+		require.Equal(t, "Update Condition to Extracted", updateReason)
+		require.True(t, gkmv1alpha1.GkmCondExtracted.IsConditionSet(pvcStatus.Conditions))
+	})
+}
+
+func TestManageJobVerify(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, gkmv1alpha1.AddToScheme(scheme))
+
+	objClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+	r := &ReconcilerCommonAgent[
+		gkmv1alpha1.GKMCache,
+		gkmv1alpha1.GKMCacheList,
+		gkmv1alpha1.GKMCacheNode,
+		gkmv1alpha1.GKMCacheNodeList,
+	]{
+		Client:       objClient,
+		Scheme:       scheme,
+		Logger:       logr.Discard(),
+		NodeName:     "node-a",
+		NoGpu:        true,
+		ExtractImage: "quay.io/gkm/gkm-extract:latest",
+		CrdCacheStr:  utils.CrdGKMCache,
+	}
+	gkmCache := gkmv1alpha1.GKMCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "vector-add", Namespace: "ns1"},
+		Spec:       gkmv1alpha1.GKMCacheSpec{Image: "quay.io/example/vector-add:latest"},
+		Status:     gkmv1alpha1.GKMCacheStatus{PvcOwner: gkmv1alpha1.PvcOwnerOperator},
+	}
+	gkmCacheNode := gkmv1alpha1.GKMCacheNode{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a", Namespace: "ns1", UID: "node-a-uid"},
+	}
+
+	// launchVerify moves a Pending PVC Status to Verifying and returns the verify Job.
+	launchVerify := func(t *testing.T, pvcStatus *gkmv1alpha1.PvcStatus, digest string) *batchv1.Job {
+		cacheStatus := gkmv1alpha1.CacheStatus{}
+		updated, updateReason, _, err := r.manageJob(t.Context(), &gkmCache, &gkmCacheNode, &cacheStatus,
+			pvcStatus, "ns1", digest)
+		require.NoError(t, err)
+		require.True(t, updated)
+		require.Equal(t, "Update Condition to Verifying", updateReason)
+		require.True(t, gkmv1alpha1.GkmCondVerifying.IsConditionSet(pvcStatus.Conditions))
+
+		job, err := common.GetLatestJob(t.Context(), objClient, "ns1", pvcStatus.PvcName, digest, "node-a", logr.Discard())
+		require.NoError(t, err)
+		require.NotNil(t, job)
+		return job
+	}
+	newPvcStatus := func(pvcName string) *gkmv1alpha1.PvcStatus {
+		pvcStatus := &gkmv1alpha1.PvcStatus{PvcName: pvcName, PvcOwner: gkmv1alpha1.PvcOwnerOperator}
+		gkmv1alpha1.SetPvcStatusConditions(pvcStatus, gkmv1alpha1.GkmCondPending.Condition())
+		return pvcStatus
+	}
+
+	t.Run("Test verify Job success", func(t *testing.T) {
+		pvcStatus := newPvcStatus("pvc-success")
+		t.Logf("TEST: manageJob() of a Pending Operator owned PVC - Should launch a verify Job")
+		job := launchVerify(t, pvcStatus, testScrubDigest)
+
+		t.Logf("TEST: manageJob() while the verify Job runs - Should stay Verifying")
+		cacheStatus := gkmv1alpha1.CacheStatus{}
+		_, _, stillPending, err := r.manageJob(t.Context(), &gkmCache, &gkmCacheNode, &cacheStatus,
+			pvcStatus, "ns1", testScrubDigest)
+		require.NoError(t, err)
+		require.True(t, stillPending)
+		require.True(t, gkmv1alpha1.GkmCondVerifying.IsConditionSet(pvcStatus.Conditions))
+		require.Equal(t, job.Name, pvcStatus.JobName)
+
+		t.Logf("TEST: manageJob() once the verify Job succeeded - Should move the PVC Status to Extracted")
+		job.Status.Succeeded = 1
+		require.NoError(t, objClient.Status().Update(t.Context(), job))
+		updated, updateReason, _, err := r.manageJob(t.Context(), &gkmCache, &gkmCacheNode, &cacheStatus,
+			pvcStatus, "ns1", testScrubDigest)
+		require.NoError(t, err)
+		require.True(t, updated)
+		require.Equal(t, "Update Condition to Extracted", updateReason)
+		require.True(t, gkmv1alpha1.GkmCondExtracted.IsConditionSet(pvcStatus.Conditions))
+		require.Equal(t, []int{0}, cacheStatus.CompGpuList)
+	})
+
+	t.Run("Test verify Job success with GPU check failure", func(t *testing.T) {
+		pvcStatus := newPvcStatus("pvc-gpu-check")
+		job := launchVerify(t, pvcStatus, testScrubDigest)
+		job.Status.Succeeded = 1
+		require.NoError(t, objClient.Status().Update(t.Context(), job))
+
+		r.NoGpu = false
+		defer func() { r.NoGpu = true }()
+		badCache := gkmCache
+		badCache.Spec.Image = ""
+
+		t.Logf("TEST: manageJob() when the GPU compatibility cannot be determined - Should move the PVC Status to Error")
+		cacheStatus := gkmv1alpha1.CacheStatus{}
+		updated, updateReason, _, err := r.manageJob(t.Context(), &badCache, &gkmCacheNode, &cacheStatus,
+			pvcStatus, "ns1", testScrubDigest)
+		require.NoError(t, err)
+		require.True(t, updated)
+		require.Equal(t, "Update Condition to Error", updateReason)
+		require.True(t, gkmv1alpha1.GkmCondError.IsConditionSet(pvcStatus.Conditions))
+		require.Nil(t, pvcStatus.NextRetryTime)
+		require.Empty(t, cacheStatus.CompGpuList)
+	})
+
+	t.Run("Test verify Job integrity mismatch", func(t *testing.T) {
+		pvcStatus := newPvcStatus("pvc-mismatch")
+		job := launchVerify(t, pvcStatus, testScrubDigest)
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      job.Name + "-pod",
+				Namespace: "ns1",
+				Labels:    map[string]string{batchv1.JobNameLabel: job.Name},
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name: utils.JobExtractName,
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+						ExitCode: int32(extract.FailureIntegrity.ExitCode()),
+					}},
+				}},
+			},
+		}
+		require.NoError(t, objClient.Create(t.Context(), pod))
+		job.Status.Failed = 1
+		require.NoError(t, objClient.Status().Update(t.Context(), job))
+
+		t.Logf("TEST: manageJob() once the verify Job failed the integrity check - Should move the PVC Status to Error")
+		cacheStatus := gkmv1alpha1.CacheStatus{}
+		updated, updateReason, _, err := r.manageJob(t.Context(), &gkmCache, &gkmCacheNode, &cacheStatus,
+			pvcStatus, "ns1", testScrubDigest)
+		require.NoError(t, err)
+		require.True(t, updated)
+		require.Equal(t, "Update Condition to Error", updateReason)
+		require.True(t, gkmv1alpha1.GkmCondError.IsConditionSet(pvcStatus.Conditions))
+		condition := meta.FindStatusCondition(pvcStatus.Conditions, gkmv1alpha1.GkmCondError.Condition().Type)
+		require.NotNil(t, condition)
+		require.Equal(t, string(extract.FailureIntegrity), condition.Reason)
+	})
+
+	t.Run("Test verify again once re-extracted", func(t *testing.T) {
+		pvcStatus := newPvcStatus("pvc-reextract")
+		job := launchVerify(t, pvcStatus, testScrubDigest)
+		job.Status.Succeeded = 1
+		require.NoError(t, objClient.Status().Update(t.Context(), job))
+		cacheStatus := gkmv1alpha1.CacheStatus{}
+		_, _, _, err := r.manageJob(t.Context(), &gkmCache, &gkmCacheNode, &cacheStatus,
+			pvcStatus, "ns1", testScrubDigest)
+		require.NoError(t, err)
+		require.True(t, gkmv1alpha1.GkmCondExtracted.IsConditionSet(pvcStatus.Conditions))
+
+		t.Logf("TEST: manageJob() once the Operator extracted a new digest - Should launch a new verify Job")
+		gkmv1alpha1.SetPvcStatusConditions(pvcStatus, gkmv1alpha1.GkmCondPending.Condition())
+		newJob := launchVerify(t, pvcStatus, testEvictDigest2)
+		require.NotEqual(t, job.Name, newJob.Name)
+
+		t.Logf("TEST: manageJob() once the new verify Job succeeded - Should move the PVC Status to Extracted")
+		newJob.Status.Succeeded = 1
+		require.NoError(t, objClient.Status().Update(t.Context(), newJob))
+		updated, updateReason, _, err := r.manageJob(t.Context(), &gkmCache, &gkmCacheNode, &cacheStatus,
+			pvcStatus, "ns1", testEvictDigest2)
+		require.NoError(t, err)
+		require.True(t, updated)
+		require.Equal(t, "Update Condition to Extracted", updateReason)
+		require.Equal(t, newJob.Name, pvcStatus.JobName)
+	})
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gkmAgent
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	gkmv1alpha1 "github.com/redhat-et/GKM/api/v1alpha1"
+	"github.com/redhat-et/GKM/pkg/extract"
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+// DiskMonitor periodically measures the disk usage of the host cache directory, and of the GPU
+// Kernel Cache extracted for each digest in it, so the reconcilers can report them in the
+// GKMCacheNode and ClusterGKMCacheNode status. Measuring walks every file, so it is done in the
+// background instead of on each Reconcile. DiskMonitor implements manager.Runnable so it is
+// started and stopped with the controller manager.
+//
+// When deduplication is enabled, each pass first hard links the identical files of the extracted
+// caches to a content store in the host cache directory, and removes the files of the store no
+// cache uses anymore, so the bytes saved are measured along with the disk usage.
+type DiskMonitor struct {
+	cacheDir string
+	interval time.Duration
+	dedup    bool
+	logger   logr.Logger
+
+	// Overwritten in unit tests.
+	usageFn      func(dir string) (int64, error)
+	filesystemFn func(path string) (int64, int64, error)
+
+	mu          sync.Mutex
+	storage     *gkmv1alpha1.NodeStorage
+	caches      map[string]int64 // Disk usage, indexed by cache directory name
+	subscribers []chan event.GenericEvent
+}
+
+// NewDiskMonitor creates a DiskMonitor that measures the disk usage of cacheDir, which is the
+// host cache directory mounted in the GKM Agent, every interval. If dedup is true, identical
+// files of the caches in cacheDir are also deduplicated.
+func NewDiskMonitor(cacheDir string, interval time.Duration, dedup bool, logger logr.Logger) *DiskMonitor {
+	return &DiskMonitor{
+		cacheDir:     cacheDir,
+		interval:     interval,
+		dedup:        dedup,
+		logger:       logger,
+		usageFn:      extract.DiskUsage,
+		filesystemFn: extract.FilesystemUsage,
+	}
+}
+
+// Subscribe returns a channel that receives an event each time the measured disk usage
+// changes. Each reconciler watches its own channel. Must be called before Start.
+func (m *DiskMonitor) Subscribe() <-chan event.GenericEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ch := make(chan event.GenericEvent, 1)
+	m.subscribers = append(m.subscribers, ch)
+	return ch
+}
+
+// Start measures the disk usage right away and then every interval until ctx is cancelled.
+func (m *DiskMonitor) Start(ctx context.Context) error {
+	m.logger.Info("Starting disk usage reporting", "interval", m.interval, "cacheDir", m.cacheDir, "dedup", m.dedup)
+
+	m.Measure()
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			m.Measure()
+		}
+	}
+}
+
+// Measure measures the disk usage once, and notifies the subscribers if it changed.
+func (m *DiskMonitor) Measure() {
+	var savedBytes int64
+	if m.dedup {
+		savedBytes = m.deduplicate()
+	}
+
+	capacity, available, err := m.filesystemFn(m.cacheDir)
+	if err != nil {
+		m.logger.Error(err, "unable to read filesystem usage", "cacheDir", m.cacheDir)
+		return
+	}
+	used, err := m.usageFn(m.cacheDir)
+	if err != nil {
+		m.logger.Error(err, "unable to measure disk usage", "cacheDir", m.cacheDir)
+		return
+	}
+
+	caches := make(map[string]int64)
+	entries, err := os.ReadDir(m.cacheDir)
+	if err != nil {
+		m.logger.Error(err, "unable to read cache directory", "cacheDir", m.cacheDir)
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		size, err := m.usageFn(filepath.Join(m.cacheDir, entry.Name()))
+		if err != nil {
+			// Removed while walking, for example by an eviction.
+			m.logger.V(1).Info("unable to measure cache disk usage", "dir", entry.Name(), "err", err)
+			continue
+		}
+		caches[entry.Name()] = size
+	}
+
+	storage := &gkmv1alpha1.NodeStorage{
+		UsedBytes:      used,
+		AvailableBytes: available,
+		CapacityBytes:  capacity,
+		SavedBytes:     savedBytes,
+	}
+
+	m.mu.Lock()
+	changed := m.storage == nil ||
+		m.storage.UsedBytes != storage.UsedBytes ||
+		m.storage.AvailableBytes != storage.AvailableBytes ||
+		m.storage.CapacityBytes != storage.CapacityBytes ||
+		m.storage.SavedBytes != storage.SavedBytes ||
+		!maps.Equal(m.caches, caches)
+	if changed {
+		// The time only moves when the usage changes, so an idle Node does not rewrite its
+		// status on every measurement.
+		storage.LastUpdated = metav1.Now()
+		m.storage = storage
+		m.caches = caches
+	}
+	subscribers := m.subscribers
+	m.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	m.logger.V(1).Info("Disk usage changed",
+		"used", used, "available", available, "capacity", capacity, "saved", savedBytes)
+	for _, ch := range subscribers {
+		// Reconcile covers every Cache, so one pending event per reconciler is enough.
+		select {
+		case ch <- event.GenericEvent{Object: &metav1.PartialObjectMetadata{
+			ObjectMeta: metav1.ObjectMeta{Name: "gkm-disk-usage"},
+		}}:
+		default:
+		}
+	}
+}
+
+// deduplicate links the identical files of the caches in the host cache directory to the content
+// store, prunes the store, and returns the bytes saved by sharing files.
+func (m *DiskMonitor) deduplicate() int64 {
+	storeDir := filepath.Join(m.cacheDir, extract.StoreDirName)
+	entries, err := os.ReadDir(m.cacheDir)
+	if err != nil {
+		m.logger.Error(err, "unable to read cache directory", "cacheDir", m.cacheDir)
+		return 0
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		_, err := extract.DedupCache(filepath.Join(m.cacheDir, entry.Name()), storeDir, m.logger)
+		if err != nil &&
+			!errors.Is(err, extract.ErrExtractInProgress) &&
+			!errors.Is(err, extract.ErrNotExtracted) &&
+			!errors.Is(err, extract.ErrNoIntegrityManifest) {
+			m.logger.Error(err, "unable to deduplicate cache", "dir", entry.Name())
+		}
+	}
+
+	stats, err := extract.PruneStore(storeDir, m.logger)
+	if err != nil {
+		m.logger.Error(err, "unable to prune content store", "storeDir", storeDir)
+		return 0
+	}
+	return stats.SavedBytes
+}
+
+// NodeStorage returns the last measured disk usage of the host cache directory, or nil if it
+// was not measured yet.
+func (m *DiskMonitor) NodeStorage() *gkmv1alpha1.NodeStorage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.storage == nil {
+		return nil
+	}
+	return m.storage.DeepCopy()
+}
+
+// CacheUsage returns the last measured disk usage of the GPU Kernel Cache extracted for
+// resolvedDigest, and false if there is no directory for it in the host cache directory.
+func (m *DiskMonitor) CacheUsage(resolvedDigest string) (int64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	size, found := m.caches[utils.CacheDirName(resolvedDigest)]
+	return size, found
+}
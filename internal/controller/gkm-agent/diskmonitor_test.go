@@ -0,0 +1,108 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gkmAgent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redhat-et/GKM/pkg/extract"
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+func TestDiskMonitor(t *testing.T) {
+	t.Run("Test disk usage of the host cache directory", func(t *testing.T) {
+		hostDir := t.TempDir()
+		cacheDir := filepath.Join(hostDir, utils.CacheDirName(testScrubDigest))
+		m := NewDiskMonitor(hostDir, time.Hour, false, logr.Discard())
+		m.filesystemFn = func(string) (int64, int64, error) { return 100 << 30, 60 << 30, nil }
+		events := m.Subscribe()
+
+		t.Logf("TEST: NodeStorage() before Measure() - Should not report storage")
+		require.Nil(t, m.NodeStorage())
+
+		t.Logf("TEST: Measure() of an empty directory - Should report the filesystem and notify")
+		m.Measure()
+		storage := m.NodeStorage()
+		require.NotNil(t, storage)
+		require.Equal(t, int64(100<<30), storage.CapacityBytes)
+		require.Equal(t, int64(60<<30), storage.AvailableBytes)
+		require.False(t, storage.LastUpdated.IsZero())
+		_, found := m.CacheUsage(testScrubDigest)
+		require.False(t, found)
+		require.Len(t, events, 1)
+		<-events
+
+		t.Logf("TEST: Measure() with an extracted cache - Should report the cache disk usage")
+		require.NoError(t, os.MkdirAll(filepath.Join(cacheDir, "abc"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(cacheDir, "abc", "kernel.hsaco"), make([]byte, 64<<10), 0644))
+		require.NoError(t, os.MkdirAll(filepath.Join(hostDir, ".staging"), 0755))
+		m.Measure()
+		size, found := m.CacheUsage(testScrubDigest)
+		require.True(t, found)
+		require.GreaterOrEqual(t, size, int64(64<<10))
+		require.GreaterOrEqual(t, m.NodeStorage().UsedBytes, size)
+		require.Len(t, events, 1)
+		<-events
+
+		t.Logf("TEST: Measure() without changes - Should not notify or move lastUpdated")
+		lastUpdated := m.NodeStorage().LastUpdated
+		m.Measure()
+		require.Empty(t, events)
+		require.Equal(t, lastUpdated, m.NodeStorage().LastUpdated)
+
+		t.Logf("TEST: Measure() after the cache is removed - Should drop the cache disk usage")
+		require.NoError(t, os.RemoveAll(cacheDir))
+		m.Measure()
+		_, found = m.CacheUsage(testScrubDigest)
+		require.False(t, found)
+		require.Len(t, events, 1)
+	})
+
+	t.Run("Test deduplication of the caches in the host cache directory", func(t *testing.T) {
+		hostDir := t.TempDir()
+		writeTestExtraction(t, filepath.Join(hostDir, utils.CacheDirName(testScrubDigest)), "quay.io/gkm/cache@"+testScrubDigest)
+		otherDigest := "sha256:0e2ac2d4b6a1a1e5bb0e5e2b6d2bb38e4cc1b1f9e4bb6f4d1a4b1d1e0c2a7f3d"
+		writeTestExtraction(t, filepath.Join(hostDir, utils.CacheDirName(otherDigest)), "quay.io/gkm/cache@"+otherDigest)
+		m := NewDiskMonitor(hostDir, time.Hour, true, logr.Discard())
+		m.filesystemFn = func(string) (int64, int64, error) { return 100 << 30, 60 << 30, nil }
+
+		t.Logf("TEST: Measure() with two caches holding the same file - Should report the bytes saved")
+		m.Measure()
+		require.Equal(t, int64(len("{}")), m.NodeStorage().SavedBytes)
+		_, err := os.Stat(filepath.Join(hostDir, extract.StoreDirName))
+		require.NoError(t, err)
+
+		t.Logf("TEST: Measure() after a cache is removed - Should no longer report bytes saved")
+		require.NoError(t, os.RemoveAll(filepath.Join(hostDir, utils.CacheDirName(otherDigest))))
+		m.Measure()
+		require.Zero(t, m.NodeStorage().SavedBytes)
+	})
+
+	t.Run("Test disk usage of a missing host cache directory", func(t *testing.T) {
+		m := NewDiskMonitor(filepath.Join(t.TempDir(), "missing"), time.Hour, true, logr.Discard())
+
+		t.Logf("TEST: Measure() of a missing directory - Should not report storage")
+		m.Measure()
+		require.Nil(t, m.NodeStorage())
+	})
+}
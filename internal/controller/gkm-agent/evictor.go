@@ -0,0 +1,350 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gkmAgent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	gkmv1alpha1 "github.com/redhat-et/GKM/api/v1alpha1"
+	"github.com/redhat-et/GKM/pkg/extract"
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+// cacheUsage is the disk usage of the GPU Kernel Cache extracted for one digest on the Node.
+// Several Caches and Namespaces using the same digest share the same directory.
+type cacheUsage struct {
+	digest   string
+	bytes    int64
+	lastUsed time.Time
+
+	// extracted is set if the Cache is extracted for at least one PVC Status.
+	extracted bool
+	// pvcCount is the number of PVC Statuses the Cache is extracted for. Without a host cache
+	// directory, each of them has its own PVC.
+	pvcCount int
+	// evictable is set if every PVC Status of the digest is Extracted, so no Pod uses it and
+	// no extraction is running, or Evicted.
+	evictable bool
+	// removed is set if the directory no longer holds an extraction, for example because the
+	// Cache was already evicted for another PVC Status of the digest.
+	removed bool
+}
+
+// Evictor keeps the GPU Kernel Caches extracted in the host cache directory within a disk
+// budget. Every interval, it adds up the size of the extracted Caches on the Node and, when they
+// use more than the budget or the Node reports DiskPressure, selects the least recently used
+// Caches that are Extracted but not Running. The reconcilers then remove the selected Caches and
+// move their PVC Status to Evicted. Evictor implements manager.Runnable so it is started and
+// stopped with the controller manager.
+type Evictor struct {
+	client    client.Reader // Lists the GKMCacheNodes and ClusterGKMCacheNodes of the Node
+	apiReader client.Reader // Reads the Node, which is not cached by the manager
+	nodeName  string
+	cacheDir  string
+	budget    int64
+	interval  time.Duration
+	logger    logr.Logger
+
+	// Overwritten in unit tests.
+	sizeFn func(dir string) (int64, error)
+
+	mu          sync.Mutex
+	victims     map[string]string // Message for the Evicted condition, indexed by digest
+	subscribers []chan event.GenericEvent
+}
+
+// NewEvictor creates an Evictor that keeps the Caches extracted in cacheDir, which is the host
+// cache directory mounted in the GKM Agent, within budget bytes, checking every interval. A
+// budget of 0 is no budget, so Caches are only evicted when the Node reports DiskPressure.
+// An empty cacheDir is for Caches extracted by Jobs to PVCs provisioned by the StorageClass,
+// which are sized from the volumeSize reported by the extraction and evicted by deleting the PVC.
+func NewEvictor(
+	client client.Reader,
+	apiReader client.Reader,
+	nodeName string,
+	cacheDir string,
+	budget int64,
+	interval time.Duration,
+	logger logr.Logger,
+) *Evictor {
+	return &Evictor{
+		client:    client,
+		apiReader: apiReader,
+		nodeName:  nodeName,
+		cacheDir:  cacheDir,
+		budget:    budget,
+		interval:  interval,
+		logger:    logger,
+		sizeFn:    extract.DirectorySize,
+	}
+}
+
+// CacheDir returns the directory the Evictor keeps within budget, or an empty string if the
+// Caches are on PVCs provisioned by the StorageClass.
+func (e *Evictor) CacheDir() string {
+	return e.cacheDir
+}
+
+// Subscribe returns a channel that receives an event each time Caches are selected for
+// eviction. Each reconciler watches its own channel. Must be called before Start.
+func (e *Evictor) Subscribe() <-chan event.GenericEvent {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ch := make(chan event.GenericEvent, 1)
+	e.subscribers = append(e.subscribers, ch)
+	return ch
+}
+
+// Start checks the disk usage every interval until ctx is cancelled.
+func (e *Evictor) Start(ctx context.Context) error {
+	e.logger.Info("Starting cache eviction", "interval", e.interval, "budget", e.budget, "cacheDir", e.cacheDir)
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			e.Check(ctx)
+		}
+	}
+}
+
+// Check selects the Caches to evict once, and notifies the subscribers if there are any.
+func (e *Evictor) Check(ctx context.Context) {
+	statuses, err := e.listCacheNodeStatuses(ctx)
+	if err != nil {
+		e.logger.Error(err, "unable to list Caches on Node", "node", e.nodeName)
+		return
+	}
+	usages := e.cacheUsage(statuses)
+	diskPressure := e.diskPressure(ctx)
+	victims := selectVictims(usages, e.budget, diskPressure)
+
+	for digest, message := range victims {
+		e.logger.Info("Evicting cache", "digest", digest, "reason", message)
+	}
+
+	e.mu.Lock()
+	e.victims = victims
+	subscribers := e.subscribers
+	e.mu.Unlock()
+
+	if len(victims) == 0 {
+		return
+	}
+	for _, ch := range subscribers {
+		// Reconcile covers every Cache, so one pending event per reconciler is enough.
+		select {
+		case ch <- event.GenericEvent{Object: &metav1.PartialObjectMetadata{
+			ObjectMeta: metav1.ObjectMeta{Name: "gkm-evict"},
+		}}:
+		default:
+		}
+	}
+}
+
+// Evicting returns true if the Cache extracted for resolvedDigest was selected for eviction the
+// last time the disk usage was checked, along with the message for the Evicted condition.
+func (e *Evictor) Evicting(resolvedDigest string) (string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	message, found := e.victims[resolvedDigest]
+	return message, found
+}
+
+// listCacheNodeStatuses returns the Status of every GKMCacheNode and ClusterGKMCacheNode of the
+// Node, since both share the host cache directory.
+func (e *Evictor) listCacheNodeStatuses(ctx context.Context) ([]gkmv1alpha1.GKMCacheNodeStatus, error) {
+	var statuses []gkmv1alpha1.GKMCacheNodeStatus
+	labelSelector := client.MatchingLabels{utils.GKMCacheLabelHostname: e.nodeName}
+
+	cacheNodeList := &gkmv1alpha1.GKMCacheNodeList{}
+	if err := e.client.List(ctx, cacheNodeList, labelSelector); err != nil {
+		return nil, err
+	}
+	for _, cacheNode := range cacheNodeList.Items {
+		statuses = append(statuses, cacheNode.Status)
+	}
+
+	clusterCacheNodeList := &gkmv1alpha1.ClusterGKMCacheNodeList{}
+	if err := e.client.List(ctx, clusterCacheNodeList, labelSelector); err != nil {
+		return nil, err
+	}
+	for _, cacheNode := range clusterCacheNodeList.Items {
+		statuses = append(statuses, cacheNode.Status)
+	}
+	return statuses, nil
+}
+
+// cacheUsage returns the disk usage of each digest extracted in the host cache directory, or on
+// the PVCs of the Agent. Caches mounted as an Image Volume, or on a PVC managed by the Operator,
+// are not evicted.
+func (e *Evictor) cacheUsage(statuses []gkmv1alpha1.GKMCacheNodeStatus) []*cacheUsage {
+	byDigest := make(map[string]*cacheUsage)
+	for _, nodeStatus := range statuses {
+		for _, digests := range nodeStatus.CacheStatuses {
+			for digest, cacheStatus := range digests {
+				if cacheStatus.MountMode == gkmv1alpha1.MountModeImageVolume {
+					continue
+				}
+				usage, found := byDigest[digest]
+				if !found {
+					usage = &cacheUsage{digest: digest, evictable: true}
+					byDigest[digest] = usage
+				}
+				usage.bytes = max(usage.bytes, cacheStatus.VolumeSize)
+
+				for _, pvcStatus := range cacheStatus.PvcStatus {
+					if pvcStatus.PvcOwner != gkmv1alpha1.PvcOwnerAgent {
+						usage.evictable = false
+						continue
+					}
+					condition := gkmv1alpha1.GetLatestConditionType(pvcStatus.Conditions)
+					switch condition.Type {
+					case string(gkmv1alpha1.GkmCondEvicted):
+						// Not on the Node for this PVC Status, so it does not hold the others.
+					case string(gkmv1alpha1.GkmCondExtracted):
+						usage.extracted = true
+						usage.pvcCount++
+						lastUsed := condition.LastTransitionTime.Time
+						if pvcStatus.LastUsedTime != nil && pvcStatus.LastUsedTime.After(lastUsed) {
+							lastUsed = pvcStatus.LastUsedTime.Time
+						}
+						if lastUsed.After(usage.lastUsed) {
+							usage.lastUsed = lastUsed
+						}
+					default:
+						usage.evictable = false
+						if gkmv1alpha1.IsConditionDownloadSet(pvcStatus.Conditions) {
+							usage.extracted = true
+							usage.pvcCount++
+						}
+					}
+				}
+			}
+		}
+	}
+
+	var usages []*cacheUsage
+	for digest, usage := range byDigest {
+		if !usage.extracted {
+			continue
+		}
+		if e.cacheDir == "" {
+			usage.bytes *= int64(usage.pvcCount)
+			usages = append(usages, usage)
+			continue
+		}
+		// Caches extracted before each digest had its own directory are left alone.
+		dir := filepath.Join(e.cacheDir, utils.CacheDirName(digest))
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, extract.InitFileName)); errors.Is(err, fs.ErrNotExist) {
+			usage.removed = true
+			usage.bytes = 0
+		} else if usage.bytes == 0 {
+			usage.bytes, _ = e.sizeFn(dir)
+		}
+		usages = append(usages, usage)
+	}
+	return usages
+}
+
+// diskPressure returns true if the Node reports the DiskPressure condition.
+func (e *Evictor) diskPressure(ctx context.Context) bool {
+	if e.apiReader == nil {
+		return false
+	}
+	node := &corev1.Node{}
+	if err := e.apiReader.Get(ctx, types.NamespacedName{Name: e.nodeName}, node); err != nil {
+		e.logger.Error(err, "unable to read Node conditions", "node", e.nodeName)
+		return false
+	}
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeDiskPressure && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// selectVictims returns the digests to evict, with the message for the Evicted condition. The
+// least recently used Caches are evicted until the Caches use no more than budget bytes. With
+// DiskPressure, at least one Cache is evicted on each check. Caches that were already removed
+// for another PVC Status of the digest are always evicted.
+func selectVictims(usages []*cacheUsage, budget int64, diskPressure bool) map[string]string {
+	victims := make(map[string]string)
+
+	var total int64
+	var candidates []*cacheUsage
+	for _, usage := range usages {
+		if usage.removed {
+			if usage.evictable {
+				victims[usage.digest] = "The Kernel Cache is no longer on the node"
+			}
+			continue
+		}
+		total += usage.bytes
+		if usage.evictable {
+			candidates = append(candidates, usage)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].lastUsed.Equal(candidates[j].lastUsed) {
+			return candidates[i].digest < candidates[j].digest
+		}
+		return candidates[i].lastUsed.Before(candidates[j].lastUsed)
+	})
+
+	freed := false
+	for _, usage := range candidates {
+		switch {
+		case budget > 0 && total > budget:
+			victims[usage.digest] = fmt.Sprintf(
+				"Evicted to free disk space, the Kernel Caches on the node use %d bytes of the %d byte budget",
+				total, budget)
+		case diskPressure && !freed:
+			victims[usage.digest] = "Evicted to free disk space, the node reports DiskPressure"
+		default:
+			return victims
+		}
+		total -= usage.bytes
+		freed = true
+	}
+	return victims
+}
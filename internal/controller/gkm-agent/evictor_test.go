@@ -0,0 +1,454 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gkmAgent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	gkmv1alpha1 "github.com/redhat-et/GKM/api/v1alpha1"
+	"github.com/redhat-et/GKM/pkg/extract"
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+const testEvictDigest2 = "sha256:0e2ac2d4b6a1c1e0cf0c1bd94d2d2ae45b0b0e8a5e2c7a4f3d8c1ea4b9c06b12"
+
+// testPvcStatus returns an Agent owned PVC Status with condition set, last transitioned at
+// lastTransition.
+func testPvcStatus(condition gkmv1alpha1.GkmConditionType, lastTransition time.Time) gkmv1alpha1.PvcStatus {
+	pvcStatus := gkmv1alpha1.PvcStatus{PvcName: "vector-add", PvcOwner: gkmv1alpha1.PvcOwnerAgent}
+	cond := condition.Condition()
+	cond.LastTransitionTime = metav1.NewTime(lastTransition)
+	pvcStatus.Conditions = []metav1.Condition{cond}
+	return pvcStatus
+}
+
+// testNodeStatus returns a GKMCacheNode Status with one Cache per digest.
+func testNodeStatus(pvcStatuses map[string]gkmv1alpha1.PvcStatus) gkmv1alpha1.GKMCacheNodeStatus {
+	digests := make(map[string]gkmv1alpha1.CacheStatus)
+	for digest, pvcStatus := range pvcStatuses {
+		digests[digest] = gkmv1alpha1.CacheStatus{
+			PvcStatus: map[string]gkmv1alpha1.PvcStatus{"ns1": pvcStatus},
+		}
+	}
+	return gkmv1alpha1.GKMCacheNodeStatus{
+		CacheStatuses: map[string]map[string]gkmv1alpha1.CacheStatus{"vector-add": digests},
+	}
+}
+
+func TestSelectVictims(t *testing.T) {
+	now := time.Now()
+	oldest := &cacheUsage{digest: "sha256:a", bytes: 100, lastUsed: now.Add(-2 * time.Hour), extracted: true, evictable: true}
+	older := &cacheUsage{digest: "sha256:b", bytes: 100, lastUsed: now.Add(-time.Hour), extracted: true, evictable: true}
+	running := &cacheUsage{digest: "sha256:c", bytes: 100, lastUsed: now.Add(-3 * time.Hour), extracted: true}
+	removed := &cacheUsage{digest: "sha256:d", extracted: true, evictable: true, removed: true}
+
+	t.Run("Test eviction within the budget", func(t *testing.T) {
+		t.Logf("TEST: selectVictims() under budget - Should only evict removed caches")
+		victims := selectVictims([]*cacheUsage{oldest, older, running, removed}, 300, false)
+		require.Len(t, victims, 1)
+		require.Contains(t, victims, removed.digest)
+
+		t.Logf("TEST: selectVictims() without a budget - Should not evict anything")
+		victims = selectVictims([]*cacheUsage{oldest, older, running}, 0, false)
+		require.Empty(t, victims)
+	})
+
+	t.Run("Test eviction over the budget", func(t *testing.T) {
+		t.Logf("TEST: selectVictims() over budget - Should evict the least recently used cache")
+		victims := selectVictims([]*cacheUsage{older, running, oldest}, 250, false)
+		require.Len(t, victims, 1)
+		require.Contains(t, victims[oldest.digest], "300 bytes of the 250 byte budget")
+
+		t.Logf("TEST: selectVictims() far over budget - Should never evict a running cache")
+		victims = selectVictims([]*cacheUsage{older, running, oldest}, 50, false)
+		require.Len(t, victims, 2)
+		require.Contains(t, victims, oldest.digest)
+		require.Contains(t, victims, older.digest)
+	})
+
+	t.Run("Test eviction with DiskPressure", func(t *testing.T) {
+		t.Logf("TEST: selectVictims() with DiskPressure - Should evict one cache")
+		victims := selectVictims([]*cacheUsage{older, running, oldest}, 0, true)
+		require.Len(t, victims, 1)
+		require.Contains(t, victims[oldest.digest], "DiskPressure")
+	})
+}
+
+func TestEvictor(t *testing.T) {
+	now := time.Now()
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, gkmv1alpha1.AddToScheme(scheme))
+
+	t.Run("Test cache usage of the Node", func(t *testing.T) {
+		hostDir := t.TempDir()
+		writeTestExtraction(t, filepath.Join(hostDir, utils.CacheDirName(testScrubDigest)), "image1")
+		require.NoError(t, os.MkdirAll(filepath.Join(hostDir, utils.CacheDirName(testEvictDigest2)), 0755))
+		e := NewEvictor(nil, nil, "node-a", hostDir, 0, time.Minute, logr.Discard())
+		e.sizeFn = func(string) (int64, error) { return 1000, nil }
+
+		extracted := testPvcStatus(gkmv1alpha1.GkmCondExtracted, now.Add(-time.Hour))
+		extracted.LastUsedTime = &metav1.Time{Time: now.Add(-time.Minute)}
+		statuses := []gkmv1alpha1.GKMCacheNodeStatus{
+			testNodeStatus(map[string]gkmv1alpha1.PvcStatus{
+				testScrubDigest:  extracted,
+				testEvictDigest2: testPvcStatus(gkmv1alpha1.GkmCondExtracted, now),
+			}),
+			testNodeStatus(map[string]gkmv1alpha1.PvcStatus{
+				testEvictDigest2: testPvcStatus(gkmv1alpha1.GkmCondEvicted, now),
+				"sha256:legacy":  testPvcStatus(gkmv1alpha1.GkmCondExtracted, now),
+			}),
+		}
+
+		t.Logf("TEST: cacheUsage() - Should size the extracted caches and skip the legacy layout")
+		usages := e.cacheUsage(statuses)
+		require.Len(t, usages, 2)
+		for _, usage := range usages {
+			require.True(t, usage.evictable)
+			switch usage.digest {
+			case testScrubDigest:
+				require.Equal(t, int64(1000), usage.bytes)
+				require.False(t, usage.removed)
+				require.WithinDuration(t, now.Add(-time.Minute), usage.lastUsed, time.Second)
+			case testEvictDigest2:
+				require.True(t, usage.removed)
+			default:
+				t.Fatalf("unexpected digest %s", usage.digest)
+			}
+		}
+
+		t.Logf("TEST: cacheUsage() of a running cache - Should not be evictable")
+		statuses = append(statuses, testNodeStatus(map[string]gkmv1alpha1.PvcStatus{
+			testScrubDigest: testPvcStatus(gkmv1alpha1.GkmCondRunning, now),
+		}))
+		for _, usage := range e.cacheUsage(statuses) {
+			if usage.digest == testScrubDigest {
+				require.False(t, usage.evictable)
+			}
+		}
+	})
+
+	t.Run("Test eviction check of the Node", func(t *testing.T) {
+		hostDir := t.TempDir()
+		writeTestExtraction(t, filepath.Join(hostDir, utils.CacheDirName(testScrubDigest)), "image1")
+		cacheNode := &gkmv1alpha1.GKMCacheNode{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "ns1-node-a",
+				Namespace: "ns1",
+				Labels:    map[string]string{utils.GKMCacheLabelHostname: "node-a"},
+			},
+			Status: testNodeStatus(map[string]gkmv1alpha1.PvcStatus{
+				testScrubDigest: testPvcStatus(gkmv1alpha1.GkmCondExtracted, now),
+			}),
+		}
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}}
+		objClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(cacheNode, node).Build()
+		e := NewEvictor(objClient, objClient, "node-a", hostDir, 0, time.Minute, logr.Discard())
+		events := e.Subscribe()
+
+		t.Logf("TEST: Check() without a budget or DiskPressure - Should not evict anything")
+		e.Check(t.Context())
+		_, evicting := e.Evicting(testScrubDigest)
+		require.False(t, evicting)
+		require.Empty(t, events)
+
+		t.Logf("TEST: Check() with DiskPressure - Should select the cache and notify the subscribers")
+		node.Status.Conditions = []corev1.NodeCondition{{Type: corev1.NodeDiskPressure, Status: corev1.ConditionTrue}}
+		require.NoError(t, objClient.Status().Update(t.Context(), node))
+		e.Check(t.Context())
+		e.Check(t.Context())
+		require.Len(t, events, 1)
+		message, evicting := e.Evicting(testScrubDigest)
+		require.True(t, evicting)
+		require.Contains(t, message, "DiskPressure")
+	})
+
+	t.Run("Test eviction and re-extraction of a cache", func(t *testing.T) {
+		gkmCache := gkmv1alpha1.GKMCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "vector-add", Namespace: "ns1"},
+			Spec: gkmv1alpha1.GKMCacheSpec{
+				Image: "quay.io/gkm/cache-examples:vector-add-cache-rocm-v2-rocm",
+			},
+		}
+		gkmCacheNode := gkmv1alpha1.GKMCacheNode{
+			ObjectMeta: metav1.ObjectMeta{Name: "ns1-node-a", Namespace: "ns1"},
+		}
+		imageURL := utils.ReplaceUrlTag(gkmCache.Spec.Image, testScrubDigest)
+		hostDir := t.TempDir()
+		cacheDir := filepath.Join(hostDir, utils.CacheDirName(testScrubDigest))
+		writeTestExtraction(t, cacheDir, imageURL)
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "ns1"},
+			Spec: corev1.PodSpec{
+				NodeName: "node-a",
+				Volumes: []corev1.Volume{{
+					Name: "cache",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "vector-add"},
+					},
+				}},
+			},
+		}
+		objClient := fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithIndex(&corev1.Pod{}, "spec.nodeName", func(obj client.Object) []string {
+				return []string{obj.(*corev1.Pod).Spec.NodeName}
+			}).
+			WithObjects(pod).
+			Build()
+
+		recorder := record.NewFakeRecorder(10)
+		r := &ReconcilerCommonAgent[
+			gkmv1alpha1.GKMCache,
+			gkmv1alpha1.GKMCacheList,
+			gkmv1alpha1.GKMCacheNode,
+			gkmv1alpha1.GKMCacheNodeList,
+		]{
+			Client:      objClient,
+			Logger:      logr.Discard(),
+			Recorder:    recorder,
+			NodeName:    "node-a",
+			Extractor:   NewExtractor(hostDir, 1, true, logr.Discard()),
+			Evictor:     NewEvictor(objClient, nil, "node-a", hostDir, 1, time.Minute, logr.Discard()),
+			CrdCacheStr: utils.CrdGKMCache,
+		}
+		r.Evictor.victims = map[string]string{testScrubDigest: "Evicted to free disk space"}
+
+		pvcStatus := testPvcStatus(gkmv1alpha1.GkmCondExtracted, now)
+
+		t.Logf("TEST: manageEvict() of a cache used by a Pod - Should leave the cache extracted")
+		updated, _, pending, err := r.manageEvict(t.Context(), &gkmCache, &gkmCacheNode, &pvcStatus, "ns1", testScrubDigest)
+		require.NoError(t, err)
+		require.False(t, updated)
+		require.False(t, pending)
+		_, err = os.Stat(filepath.Join(cacheDir, extract.InitFileName))
+		require.NoError(t, err)
+
+		t.Logf("TEST: manageEvict() of a cache whose directory backs a PV used by a Pod - Should leave the cache extracted")
+		require.NoError(t, objClient.Delete(t.Context(), pod))
+		trimDigest := strings.TrimPrefix(testScrubDigest, utils.DigestPrefix)
+		pv := &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "other-cache-pv",
+				Labels: map[string]string{
+					utils.PvLabelCache:        "other-cache",
+					utils.PvLabelPvcNamespace: "ns2",
+					utils.PvLabelNode:         "node-a",
+					utils.PvLabelDigest:       trimDigest[:utils.MaxLabelValueLength],
+				},
+			},
+		}
+		otherPod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "other-app", Namespace: "ns2"},
+			Spec: corev1.PodSpec{
+				NodeName: "node-a",
+				Volumes: []corev1.Volume{{
+					Name: "cache",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "other-cache"},
+					},
+				}},
+			},
+		}
+		require.NoError(t, objClient.Create(t.Context(), pv))
+		require.NoError(t, objClient.Create(t.Context(), otherPod))
+		updated, _, pending, err = r.manageEvict(t.Context(), &gkmCache, &gkmCacheNode, &pvcStatus, "ns1", testScrubDigest)
+		require.NoError(t, err)
+		require.False(t, updated)
+		require.False(t, pending)
+		_, err = os.Stat(filepath.Join(cacheDir, extract.InitFileName))
+		require.NoError(t, err)
+
+		t.Logf("TEST: manageEvict() of a cache used by a Pod once its directory is fenced - Should put the cache back")
+		require.NoError(t, objClient.Delete(t.Context(), otherPod))
+		r.Client = interceptor.NewClient(objClient, interceptor.Funcs{
+			List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+				// The Pod starts once the directory is gone.
+				if _, ok := list.(*corev1.PodList); ok {
+					if _, err := os.Stat(cacheDir); os.IsNotExist(err) {
+						otherPod.ResourceVersion = ""
+						_ = c.Create(ctx, otherPod)
+					}
+				}
+				return c.List(ctx, list, opts...)
+			},
+		})
+		updated, _, pending, err = r.manageEvict(t.Context(), &gkmCache, &gkmCacheNode, &pvcStatus, "ns1", testScrubDigest)
+		require.NoError(t, err)
+		require.False(t, updated)
+		require.False(t, pending)
+		require.True(t, gkmv1alpha1.GkmCondExtracted.IsConditionSet(pvcStatus.Conditions))
+		_, err = os.Stat(filepath.Join(cacheDir, extract.InitFileName))
+		require.NoError(t, err)
+		r.Client = objClient
+
+		t.Logf("TEST: manageEvict() of an unused cache - Should remove it and move the PVC Status to Evicted")
+		require.NoError(t, objClient.Delete(t.Context(), otherPod))
+		updated, updateReason, pending, err := r.manageEvict(t.Context(), &gkmCache, &gkmCacheNode, &pvcStatus, "ns1", testScrubDigest)
+		require.NoError(t, err)
+		require.True(t, updated, updateReason)
+		require.False(t, pending)
+		require.True(t, gkmv1alpha1.GkmCondEvicted.IsConditionSet(pvcStatus.Conditions))
+		_, err = os.Stat(cacheDir)
+		require.True(t, os.IsNotExist(err))
+		require.Len(t, recorder.Events, 1)
+		require.True(t, strings.HasPrefix(<-recorder.Events, "Normal Evicted"))
+
+		t.Logf("TEST: manageEvict() of an Evicted PVC Status - Should do nothing")
+		updated, _, pending, err = r.manageEvict(t.Context(), &gkmCache, &gkmCacheNode, &pvcStatus, "ns1", testScrubDigest)
+		require.NoError(t, err)
+		require.False(t, updated)
+		require.False(t, pending)
+
+		t.Logf("TEST: addCounts() of an Evicted cache used by a Pod - Should move the PVC Status to Pending")
+		pod.ResourceVersion = ""
+		require.NoError(t, objClient.Create(t.Context(), pod))
+		cnts := gkmv1alpha1.CacheCounts{}
+		updated, updateReason, _ = r.addCounts(t.Context(), nil, "vector-add", &gkmCacheNode, &cnts, "ns1",
+			&pvcStatus, gkmv1alpha1.MountModePVC, testScrubDigest)
+		require.True(t, updated, updateReason)
+		condition := gkmv1alpha1.GetLatestConditionType(pvcStatus.Conditions)
+		require.Equal(t, string(gkmv1alpha1.GkmCondPending), condition.Type)
+		require.Contains(t, condition.Message, "evicted")
+	})
+
+	t.Run("Test cache usage of PVCs provisioned by the StorageClass", func(t *testing.T) {
+		e := NewEvictor(nil, nil, "node-a", "", 0, time.Minute, logr.Discard())
+		e.sizeFn = func(string) (int64, error) { return 0, fmt.Errorf("no host cache directory") }
+
+		nodeStatus := testNodeStatus(map[string]gkmv1alpha1.PvcStatus{
+			testScrubDigest:  testPvcStatus(gkmv1alpha1.GkmCondExtracted, now.Add(-time.Hour)),
+			testEvictDigest2: testPvcStatus(gkmv1alpha1.GkmCondEvicted, now),
+		})
+		cacheStatus := nodeStatus.CacheStatuses["vector-add"][testScrubDigest]
+		cacheStatus.VolumeSize = 1000
+		cacheStatus.PvcStatus["ns2"] = testPvcStatus(gkmv1alpha1.GkmCondExtracted, now)
+		nodeStatus.CacheStatuses["vector-add"][testScrubDigest] = cacheStatus
+
+		t.Logf("TEST: cacheUsage() without a host cache directory - Should size each PVC from the volumeSize")
+		usages := e.cacheUsage([]gkmv1alpha1.GKMCacheNodeStatus{nodeStatus})
+		require.Len(t, usages, 1)
+		require.Equal(t, testScrubDigest, usages[0].digest)
+		require.Equal(t, int64(2000), usages[0].bytes)
+		require.True(t, usages[0].evictable)
+		require.False(t, usages[0].removed)
+
+		t.Logf("TEST: selectVictims() over the budget - Should select the cache")
+		victims := selectVictims(usages, 1500, false)
+		require.Contains(t, victims, testScrubDigest)
+	})
+
+	t.Run("Test eviction of a cache on a PVC provisioned by the StorageClass", func(t *testing.T) {
+		gkmCache := gkmv1alpha1.GKMCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "vector-add", Namespace: "ns1"},
+			Spec: gkmv1alpha1.GKMCacheSpec{
+				Image: "quay.io/gkm/cache-examples:vector-add-cache-rocm-v2-rocm",
+			},
+		}
+		gkmCacheNode := gkmv1alpha1.GKMCacheNode{
+			ObjectMeta: metav1.ObjectMeta{Name: "ns1-node-a", Namespace: "ns1"},
+		}
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "vector-add-x7k2p", Namespace: "ns1"},
+		}
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "ns1"},
+			Spec: corev1.PodSpec{
+				NodeName: "node-a",
+				Volumes: []corev1.Volume{{
+					Name: "cache",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "vector-add"},
+					},
+				}},
+			},
+		}
+		objClient := fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithIndex(&corev1.Pod{}, "spec.nodeName", func(obj client.Object) []string {
+				return []string{obj.(*corev1.Pod).Spec.NodeName}
+			}).
+			WithObjects(pvc, pod).
+			Build()
+
+		// Job mode: no in-agent Extractor and no host cache directory.
+		r := &ReconcilerCommonAgent[
+			gkmv1alpha1.GKMCache,
+			gkmv1alpha1.GKMCacheList,
+			gkmv1alpha1.GKMCacheNode,
+			gkmv1alpha1.GKMCacheNodeList,
+		]{
+			Client:      objClient,
+			Logger:      logr.Discard(),
+			NodeName:    "node-a",
+			Evictor:     NewEvictor(objClient, nil, "node-a", "", 1, time.Minute, logr.Discard()),
+			CrdCacheStr: utils.CrdGKMCache,
+		}
+		r.Evictor.victims = map[string]string{testScrubDigest: "Evicted to free disk space"}
+
+		pvcStatus := testPvcStatus(gkmv1alpha1.GkmCondExtracted, now)
+		pvcStatus.PvcName = pvc.Name
+		pvcStatus.PvName = "pvc-0123"
+
+		t.Logf("TEST: manageEvict() of a cache used by a Pod - Should keep the PVC")
+		updated, _, pending, err := r.manageEvict(t.Context(), &gkmCache, &gkmCacheNode, &pvcStatus, "ns1", testScrubDigest)
+		require.NoError(t, err)
+		require.False(t, updated)
+		require.False(t, pending)
+		require.NoError(t, objClient.Get(t.Context(), client.ObjectKeyFromObject(pvc), &corev1.PersistentVolumeClaim{}))
+
+		t.Logf("TEST: manageEvict() of an unused cache - Should delete the PVC and move the PVC Status to Evicted")
+		require.NoError(t, objClient.Delete(t.Context(), pod))
+		updated, updateReason, pending, err := r.manageEvict(t.Context(), &gkmCache, &gkmCacheNode, &pvcStatus, "ns1", testScrubDigest)
+		require.NoError(t, err)
+		require.True(t, updated, updateReason)
+		require.False(t, pending)
+		require.True(t, gkmv1alpha1.GkmCondEvicted.IsConditionSet(pvcStatus.Conditions))
+		require.Empty(t, pvcStatus.PvcName)
+		require.Empty(t, pvcStatus.PvName)
+		err = objClient.Get(t.Context(), client.ObjectKeyFromObject(pvc), &corev1.PersistentVolumeClaim{})
+		require.True(t, apierrors.IsNotFound(err))
+
+		t.Logf("TEST: addCounts() of the Evicted cache used by a Pod - Should move the PVC Status to Pending")
+		pod.ResourceVersion = ""
+		require.NoError(t, objClient.Create(t.Context(), pod))
+		cnts := gkmv1alpha1.CacheCounts{}
+		updated, updateReason, _ = r.addCounts(t.Context(), nil, "vector-add", &gkmCacheNode, &cnts, "ns1",
+			&pvcStatus, gkmv1alpha1.MountModePVC, testScrubDigest)
+		require.True(t, updated, updateReason)
+		require.True(t, gkmv1alpha1.GkmCondPending.IsConditionSet(pvcStatus.Conditions))
+	})
+}
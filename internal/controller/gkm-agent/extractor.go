@@ -0,0 +1,322 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gkmAgent
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/redhat-et/GKM/pkg/extract"
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+// ExtractState is the state of a GPU Kernel Cache extraction run by the Extractor.
+type ExtractState string
+
+const (
+	ExtractStateQueued    ExtractState = "Queued"
+	ExtractStateRunning   ExtractState = "Running"
+	ExtractStateSucceeded ExtractState = "Succeeded"
+	ExtractStateFailed    ExtractState = "Failed"
+)
+
+// ExtractStatus is a snapshot of the state of an extraction.
+type ExtractStatus struct {
+	State ExtractState
+
+	// QueuePosition is the number of extractions ahead of this one in the queue,
+	// starting at 1. Only valid when State is Queued.
+	QueuePosition int
+
+	// ExtractedBytes is the number of bytes written to the cache directory so far.
+	ExtractedBytes int64
+
+	// ExpectedBytes is the size of the cache from the OCI Image label, 0 if unknown.
+	ExpectedBytes int64
+
+	// Result is the outcome of the extraction. Only valid when State is Succeeded.
+	Result *extract.Result
+
+	// Err is the reason the extraction failed. Only valid when State is Failed.
+	Err error
+}
+
+// Progress returns a human readable summary of the extraction, used as the message on
+// the PVC Status condition while the extraction is in progress.
+func (s ExtractStatus) Progress() string {
+	switch s.State {
+	case ExtractStateQueued:
+		return fmt.Sprintf("Extraction queued in GKM Agent, position %d", s.QueuePosition)
+	case ExtractStateRunning:
+		if s.ExpectedBytes > 0 {
+			percent := s.ExtractedBytes * 100 / s.ExpectedBytes
+			if percent > 99 {
+				percent = 99
+			}
+			return fmt.Sprintf("Extracting in GKM Agent, %d%% (%d of %d bytes)", percent, s.ExtractedBytes, s.ExpectedBytes)
+		}
+		return fmt.Sprintf("Extracting in GKM Agent, %d bytes", s.ExtractedBytes)
+	default:
+		return fmt.Sprintf("Extraction %s in GKM Agent", s.State)
+	}
+}
+
+type extractTask struct {
+	key          string
+	imageURL     string
+	cacheDir     string
+	registryAuth []byte
+	inUse        func(ctx context.Context) bool
+	status       ExtractStatus
+}
+
+type extractFunc func(cacheDir, imageURL string, noGpu bool, inUse func() bool, log logr.Logger) (*extract.Result, error)
+
+// Extractor extracts GPU Kernel Caches in the GKM Agent process, instead of launching a
+// Job per extraction. Extractions are queued and run by a fixed number of workers. The
+// reconcilers submit work and poll for the result, so a reconcile is never blocked on an
+// extraction. Extractor implements manager.Runnable so the workers are started and stopped
+// with the controller manager.
+type Extractor struct {
+	cacheDir string
+	workers  int
+	noGpu    bool
+	logger   logr.Logger
+
+	// Overwritten in unit tests.
+	extractFn        extractFunc
+	sizeFn           func(dir string) (int64, error)
+	progressInterval time.Duration
+
+	mu    sync.Mutex
+	cond  *sync.Cond
+	tasks map[string]*extractTask
+	queue []string
+	done  bool
+}
+
+// NewExtractor creates an Extractor that extracts into cacheDir, which is the host cache
+// directory mounted in the GKM Agent, with at most workers extractions running at once.
+// Each digest is extracted into its own sub-directory of cacheDir.
+func NewExtractor(cacheDir string, workers int, noGpu bool, logger logr.Logger) *Extractor {
+	if workers < 1 {
+		workers = 1
+	}
+	e := &Extractor{
+		cacheDir:         cacheDir,
+		workers:          workers,
+		noGpu:            noGpu,
+		logger:           logger,
+		extractFn:        extract.ExtractCache,
+		sizeFn:           extract.DirectorySize,
+		progressInterval: 5 * time.Second,
+		tasks:            make(map[string]*extractTask),
+	}
+	e.cond = sync.NewCond(&e.mu)
+	return e
+}
+
+// Start runs the workers until ctx is cancelled.
+func (e *Extractor) Start(ctx context.Context) error {
+	e.logger.Info("Starting in-agent extraction", "workers", e.workers, "cacheDir", e.cacheDir)
+
+	var wg sync.WaitGroup
+	for i := 0; i < e.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.worker(ctx)
+		}()
+	}
+
+	<-ctx.Done()
+	e.mu.Lock()
+	e.done = true
+	e.cond.Broadcast()
+	e.mu.Unlock()
+	wg.Wait()
+	return nil
+}
+
+// Submit queues an extraction of imageURL, resolved to resolvedDigest, tracked by key. The
+// image is pulled with the registry credentials in registryAuth, a Docker config.json, if set.
+// inUse, if set, reports whether pods use the cache, so an earlier extraction in the directory
+// is not removed under them, see extract.ExtractCache. If key is already known, this is a
+// no-op, so it is safe to call on every reconcile.
+func (e *Extractor) Submit(
+	key, imageURL, resolvedDigest string,
+	expectedBytes int64,
+	registryAuth []byte,
+	inUse func(ctx context.Context) bool,
+) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, exists := e.tasks[key]; exists {
+		return
+	}
+	e.tasks[key] = &extractTask{
+		key:          key,
+		imageURL:     imageURL,
+		cacheDir:     filepath.Join(e.cacheDir, utils.CacheDirName(resolvedDigest)),
+		registryAuth: registryAuth,
+		inUse:        inUse,
+		status: ExtractStatus{
+			State:         ExtractStateQueued,
+			ExpectedBytes: expectedBytes,
+		},
+	}
+	e.queue = append(e.queue, key)
+	e.cond.Signal()
+}
+
+// Status returns the current state of the extraction tracked by key, and false if key
+// is not known, either because it was never submitted or the Agent has restarted.
+func (e *Extractor) Status(key string) (ExtractStatus, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	task, exists := e.tasks[key]
+	if !exists {
+		return ExtractStatus{}, false
+	}
+	status := task.status
+	if status.State == ExtractStateQueued {
+		for i, queued := range e.queue {
+			if queued == key {
+				status.QueuePosition = i + 1
+				break
+			}
+		}
+	}
+	return status, true
+}
+
+// RegistryAuth returns the registry credentials submitted with an extraction of imageURL, or
+// nil if there are none. It is set as the registry credentials of the extractions with
+// extract.SetRegistryAuth.
+func (e *Extractor) RegistryAuth(imageURL string) []byte {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, task := range e.tasks {
+		if task.imageURL == imageURL && task.registryAuth != nil {
+			return task.registryAuth
+		}
+	}
+	return nil
+}
+
+// Forget stops tracking the extraction for key. A queued extraction is removed from the
+// queue. A running extraction completes, but its result is discarded.
+func (e *Extractor) Forget(key string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.tasks, key)
+	for i, queued := range e.queue {
+		if queued == key {
+			e.queue = append(e.queue[:i], e.queue[i+1:]...)
+			break
+		}
+	}
+}
+
+func (e *Extractor) worker(ctx context.Context) {
+	for {
+		e.mu.Lock()
+		for len(e.queue) == 0 && !e.done {
+			e.cond.Wait()
+		}
+		if e.done {
+			e.mu.Unlock()
+			return
+		}
+		key := e.queue[0]
+		e.queue = e.queue[1:]
+		task := e.tasks[key]
+		task.status.State = ExtractStateRunning
+		imageURL := task.imageURL
+		cacheDir := task.cacheDir
+		e.mu.Unlock()
+
+		e.run(ctx, task, imageURL, cacheDir)
+	}
+}
+
+func (e *Extractor) run(ctx context.Context, task *extractTask, imageURL, cacheDir string) {
+	log := e.logger.WithValues("key", task.key, "imageURL", imageURL)
+	log.Info("In-agent extraction started", "cacheDir", cacheDir)
+	start := time.Now()
+
+	// The directory may still hold an earlier extraction until the new one is swapped into
+	// place, so track progress as the growth of the directory since the extraction started.
+	startSize, _ := e.sizeFn(cacheDir)
+	stopProgress := make(chan struct{})
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		ticker := time.NewTicker(e.progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-stopProgress:
+				return
+			case <-ticker.C:
+				size, err := e.sizeFn(cacheDir)
+				if err != nil {
+					continue
+				}
+				e.mu.Lock()
+				task.status.ExtractedBytes = max(size-startSize, 0)
+				e.mu.Unlock()
+			}
+		}
+	}()
+
+	var inUse func() bool
+	if task.inUse != nil {
+		inUse = func() bool { return task.inUse(ctx) }
+	}
+	result, err := e.extractFn(cacheDir, imageURL, e.noGpu, inUse, log)
+	close(stopProgress)
+	<-progressDone
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil {
+		task.status.State = ExtractStateFailed
+		task.status.Err = err
+		log.Error(err, "In-agent extraction failed", "duration", time.Since(start))
+		return
+	}
+	task.status.State = ExtractStateSucceeded
+	task.status.Result = result
+	if result != nil && result.BytesExtracted > 0 {
+		task.status.ExtractedBytes = result.BytesExtracted
+	} else if size, err := e.sizeFn(cacheDir); err == nil {
+		task.status.ExtractedBytes = max(size-startSize, 0)
+	}
+	log.Info("In-agent extraction completed", "duration", time.Since(start), "bytes", task.status.ExtractedBytes)
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gkmAgent
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redhat-et/GKM/pkg/extract"
+)
+
+// newTestExtractor returns an Extractor with the MCV extraction replaced by a stub that
+// blocks until released, so the queue can be inspected.
+func newTestExtractor(t *testing.T, workers int, release chan struct{}, running *int32, peak *int32) *Extractor {
+	e := NewExtractor(t.TempDir(), workers, true, logr.Discard())
+	e.progressInterval = 10 * time.Millisecond
+	e.sizeFn = func(dir string) (int64, error) { return 0, nil }
+	e.extractFn = func(cacheDir, imageURL string, noGpu bool, inUse func() bool, log logr.Logger) (*extract.Result, error) {
+		cnt := atomic.AddInt32(running, 1)
+		for {
+			old := atomic.LoadInt32(peak)
+			if cnt <= old || atomic.CompareAndSwapInt32(peak, old, cnt) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(running, -1)
+		if imageURL == "quay.io/test/bad@sha256:1234" {
+			return nil, fmt.Errorf("image not found")
+		}
+		return &extract.Result{MatchedIds: []int{0}, UnmatchedIds: []int{1}, BytesExtracted: 100}, nil
+	}
+	return e
+}
+
+func waitForState(t *testing.T, e *Extractor, key string, state ExtractState) ExtractStatus {
+	var status ExtractStatus
+	require.Eventually(t, func() bool {
+		var found bool
+		status, found = e.Status(key)
+		return found && status.State == state
+	}, 5*time.Second, 10*time.Millisecond, "waiting for %s to be %s", key, state)
+	return status
+}
+
+func TestExtractor(t *testing.T) {
+	t.Run("Test in-agent extraction worker pool", func(t *testing.T) {
+		var running, peak int32
+		release := make(chan struct{})
+		e := newTestExtractor(t, 2, release, &running, &peak)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() { _ = e.Start(ctx) }()
+
+		t.Logf("TEST: Status() of unknown key - Should return not found")
+		_, found := e.Status("unknown")
+		require.False(t, found)
+
+		t.Logf("TEST: Submit() more extractions than workers - Should queue the rest")
+		e.Submit("pvc-a", "quay.io/test/a@sha256:1234", "sha256:1234", 100, nil, nil)
+		e.Submit("pvc-b", "quay.io/test/b@sha256:1234", "sha256:1234", 100, nil, nil)
+		e.Submit("pvc-c", "quay.io/test/bad@sha256:1234", "sha256:1234", 100, nil, nil)
+		e.Submit("pvc-d", "quay.io/test/d@sha256:1234", "sha256:1234", 100, nil, nil)
+		waitForState(t, e, "pvc-a", ExtractStateRunning)
+		waitForState(t, e, "pvc-b", ExtractStateRunning)
+
+		status := waitForState(t, e, "pvc-c", ExtractStateQueued)
+		require.Equal(t, 1, status.QueuePosition)
+		require.Contains(t, status.Progress(), "position 1")
+		status = waitForState(t, e, "pvc-d", ExtractStateQueued)
+		require.Equal(t, 2, status.QueuePosition)
+
+		t.Logf("TEST: Submit() of a known key - Should be a no-op")
+		e.Submit("pvc-d", "quay.io/test/d@sha256:1234", "sha256:1234", 100, nil, nil)
+		status, _ = e.Status("pvc-d")
+		require.Equal(t, 2, status.QueuePosition)
+
+		t.Logf("TEST: Forget() of a queued key - Should remove it from the queue")
+		e.Forget("pvc-d")
+		_, found = e.Status("pvc-d")
+		require.False(t, found)
+
+		t.Logf("TEST: Release extractions - Should never exceed the number of workers")
+		close(release)
+		status = waitForState(t, e, "pvc-a", ExtractStateSucceeded)
+		require.Equal(t, []int{0}, status.Result.MatchedIds)
+		require.Equal(t, []int{1}, status.Result.UnmatchedIds)
+		require.Equal(t, int64(100), status.ExtractedBytes)
+		waitForState(t, e, "pvc-b", ExtractStateSucceeded)
+		status = waitForState(t, e, "pvc-c", ExtractStateFailed)
+		require.ErrorContains(t, status.Err, "image not found")
+		require.LessOrEqual(t, atomic.LoadInt32(&peak), int32(2))
+	})
+
+	t.Run("Test in-agent extraction directory", func(t *testing.T) {
+		e := NewExtractor(t.TempDir(), 1, true, logr.Discard())
+		dirs := make(chan string, 1)
+		inUses := make(chan bool, 1)
+		e.extractFn = func(cacheDir, imageURL string, noGpu bool, inUse func() bool, log logr.Logger) (*extract.Result, error) {
+			dirs <- cacheDir
+			inUses <- inUse != nil && inUse()
+			return &extract.Result{}, nil
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() { _ = e.Start(ctx) }()
+
+		t.Logf("TEST: Submit() - Should extract into the sub-directory of the digest")
+		e.Submit("pvc-a", "quay.io/test/a@sha256:1234", "sha256:1234", 0, nil, nil)
+		waitForState(t, e, "pvc-a", ExtractStateSucceeded)
+		require.Equal(t, filepath.Join(e.cacheDir, "1234"), <-dirs)
+		require.False(t, <-inUses)
+
+		t.Logf("TEST: Submit() of a cache in use - Should pass the in-use check to the extraction")
+		e.Submit("pvc-b", "quay.io/test/a@sha256:1234", "sha256:1234", 0, nil,
+			func(ctx context.Context) bool { return ctx != nil })
+		waitForState(t, e, "pvc-b", ExtractStateSucceeded)
+		<-dirs
+		require.True(t, <-inUses)
+	})
+
+	t.Run("Test in-agent extraction registry credentials", func(t *testing.T) {
+		e := NewExtractor(t.TempDir(), 1, true, logr.Discard())
+		auth := []byte(`{"auths":{"quay.io":{"auth":"dXNlcjpwYXNz"}}}`)
+		e.Submit("pvc-a", "quay.io/test/a@sha256:1234", "sha256:1234", 0, nil, nil)
+		e.Submit("pvc-b", "quay.io/test/a@sha256:1234", "sha256:1234", 0, auth, nil)
+
+		t.Logf("TEST: RegistryAuth() of a submitted image - Should return its credentials")
+		require.Equal(t, auth, e.RegistryAuth("quay.io/test/a@sha256:1234"))
+
+		t.Logf("TEST: RegistryAuth() of an unknown image - Should return nil")
+		require.Nil(t, e.RegistryAuth("quay.io/test/b@sha256:1234"))
+
+		t.Logf("TEST: RegistryAuth() after Forget() - Should return nil")
+		e.Forget("pvc-b")
+		require.Nil(t, e.RegistryAuth("quay.io/test/a@sha256:1234"))
+	})
+
+	t.Run("Test in-agent extraction progress", func(t *testing.T) {
+		t.Logf("TEST: Progress() while running with expected size - Should report percent")
+		status := ExtractStatus{State: ExtractStateRunning, ExtractedBytes: 50, ExpectedBytes: 200}
+		require.Equal(t, "Extracting in GKM Agent, 25% (50 of 200 bytes)", status.Progress())
+
+		t.Logf("TEST: Progress() while running past expected size - Should cap below 100 percent")
+		status = ExtractStatus{State: ExtractStateRunning, ExtractedBytes: 300, ExpectedBytes: 200}
+		require.Equal(t, "Extracting in GKM Agent, 99% (300 of 200 bytes)", status.Progress())
+
+		t.Logf("TEST: Progress() while running without expected size - Should report bytes")
+		status = ExtractStatus{State: ExtractStateRunning, ExtractedBytes: 300}
+		require.Equal(t, "Extracting in GKM Agent, 300 bytes", status.Progress())
+	})
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gkmAgent
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	gkmv1alpha1 "github.com/redhat-et/GKM/api/v1alpha1"
+	mcvFetcher "github.com/redhat-et/GKM/mcv/pkg/fetcher"
+)
+
+// LayerServer serves the image layers in the layer cache of in-agent extraction to the
+// extractions on other Nodes, by digest, so an image already pulled on one Node is not pulled
+// from the registry again by every other Node. The extractions check the digest of what they
+// receive, and pull from the registry when no other Node has a layer. The base URL of the
+// LayerServer is advertised in the GKMCacheNode and ClusterGKMCacheNode status, where the other
+// Agents find it. LayerServer implements manager.Runnable so it is started and stopped with the
+// controller manager.
+type LayerServer struct {
+	dir     string
+	port    int
+	address string
+	logger  logr.Logger
+}
+
+// NewLayerServer creates a LayerServer that serves the layer cache in dir on port. podIP is the
+// IP address of the GKM Agent Pod, where the other Nodes reach it.
+func NewLayerServer(dir string, port int, podIP string, logger logr.Logger) *LayerServer {
+	return &LayerServer{
+		dir:     dir,
+		port:    port,
+		address: "http://" + net.JoinHostPort(podIP, strconv.Itoa(port)),
+		logger:  logger,
+	}
+}
+
+// Address returns the base URL the other Nodes fetch layers from.
+func (s *LayerServer) Address() string {
+	return s.address
+}
+
+// Start serves the layer cache until ctx is cancelled.
+func (s *LayerServer) Start(ctx context.Context) error {
+	s.logger.Info("Starting layer server", "address", s.address, "dir", s.dir)
+
+	server := &http.Server{
+		Addr:              ":" + strconv.Itoa(s.port),
+		Handler:           mcvFetcher.LayerHandler(s.dir),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// FindLayerPeers returns the base URLs of the LayerServers on the Nodes other than nodeName
+// that extracted resolvedDigest, so are likely to hold its layers, in random order to spread
+// the extractions of the same image over them.
+func FindLayerPeers(ctx context.Context, c client.Reader, nodeName, resolvedDigest string) ([]string, error) {
+	var statuses []gkmv1alpha1.GKMCacheNodeStatus
+
+	cacheNodeList := &gkmv1alpha1.GKMCacheNodeList{}
+	if err := c.List(ctx, cacheNodeList); err != nil {
+		return nil, err
+	}
+	for _, cacheNode := range cacheNodeList.Items {
+		statuses = append(statuses, cacheNode.Status)
+	}
+
+	clusterCacheNodeList := &gkmv1alpha1.ClusterGKMCacheNodeList{}
+	if err := c.List(ctx, clusterCacheNodeList); err != nil {
+		return nil, err
+	}
+	for _, cacheNode := range clusterCacheNodeList.Items {
+		statuses = append(statuses, cacheNode.Status)
+	}
+
+	found := make(map[string]bool)
+	var peers []string
+	for _, nodeStatus := range statuses {
+		if nodeStatus.NodeName == nodeName || nodeStatus.LayerServer == "" || found[nodeStatus.LayerServer] {
+			continue
+		}
+		if extractedOnNode(nodeStatus, resolvedDigest) {
+			found[nodeStatus.LayerServer] = true
+			peers = append(peers, nodeStatus.LayerServer)
+		}
+	}
+	rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+	return peers, nil
+}
+
+// extractedOnNode returns true if a Cache in nodeStatus has resolvedDigest extracted.
+func extractedOnNode(nodeStatus gkmv1alpha1.GKMCacheNodeStatus, resolvedDigest string) bool {
+	for _, digests := range nodeStatus.CacheStatuses {
+		cacheStatus, exists := digests[resolvedDigest]
+		if !exists {
+			continue
+		}
+		for _, pvcStatus := range cacheStatus.PvcStatus {
+			if gkmv1alpha1.IsConditionDownloadSet(pvcStatus.Conditions) {
+				return true
+			}
+		}
+	}
+	return false
+}
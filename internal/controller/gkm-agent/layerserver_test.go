@@ -0,0 +1,128 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gkmAgent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	gkmv1alpha1 "github.com/redhat-et/GKM/api/v1alpha1"
+	mcvFetcher "github.com/redhat-et/GKM/mcv/pkg/fetcher"
+)
+
+func TestLayerServer(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, gkmv1alpha1.AddToScheme(scheme))
+
+	t.Run("Test serving the layer cache", func(t *testing.T) {
+		dir := t.TempDir()
+		layer := []byte("layer content")
+		sum := sha256.Sum256(layer)
+		digest := hex.EncodeToString(sum[:])
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "blobs", "sha256", digest), layer, 0644))
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		port := listener.Addr().(*net.TCPAddr).Port
+		require.NoError(t, listener.Close())
+
+		s := NewLayerServer(dir, port, "127.0.0.1", logr.Discard())
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- s.Start(ctx) }()
+
+		t.Logf("TEST: GET of a layer from the LayerServer - Should return the layer")
+		var resp *http.Response
+		require.Eventually(t, func() bool {
+			resp, err = http.Get(s.Address() + mcvFetcher.LayerPath + "/sha256/" + digest)
+			return err == nil
+		}, 5*time.Second, 10*time.Millisecond)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, layer, body)
+
+		t.Logf("TEST: Start() after the context is cancelled - Should stop serving")
+		cancel()
+		require.NoError(t, <-done)
+		_, err = http.Get(s.Address() + mcvFetcher.LayerPath)
+		require.Error(t, err)
+	})
+
+	t.Run("Test finding the layer peers of a digest", func(t *testing.T) {
+		nodeStatus := func(nodeName, layerServer string, condition gkmv1alpha1.GkmConditionType) gkmv1alpha1.GKMCacheNodeStatus {
+			status := testNodeStatus(map[string]gkmv1alpha1.PvcStatus{
+				testScrubDigest: testPvcStatus(condition, time.Now()),
+			})
+			status.NodeName = nodeName
+			status.LayerServer = layerServer
+			return status
+		}
+		objClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			&gkmv1alpha1.GKMCacheNode{
+				ObjectMeta: metav1.ObjectMeta{Name: "ns1-node-a", Namespace: "ns1"},
+				Status:     nodeStatus("node-a", "http://10.0.0.1:8095", gkmv1alpha1.GkmCondExtracted),
+			},
+			&gkmv1alpha1.GKMCacheNode{
+				ObjectMeta: metav1.ObjectMeta{Name: "ns1-node-b", Namespace: "ns1"},
+				Status:     nodeStatus("node-b", "http://10.0.0.2:8095", gkmv1alpha1.GkmCondExtracted),
+			},
+			&gkmv1alpha1.GKMCacheNode{
+				ObjectMeta: metav1.ObjectMeta{Name: "ns2-node-b", Namespace: "ns2"},
+				Status:     nodeStatus("node-b", "http://10.0.0.2:8095", gkmv1alpha1.GkmCondRunning),
+			},
+			&gkmv1alpha1.GKMCacheNode{
+				ObjectMeta: metav1.ObjectMeta{Name: "ns1-node-c", Namespace: "ns1"},
+				Status:     nodeStatus("node-c", "http://10.0.0.3:8095", gkmv1alpha1.GkmCondDownloading),
+			},
+			&gkmv1alpha1.ClusterGKMCacheNode{
+				ObjectMeta: metav1.ObjectMeta{Name: "node-d"},
+				Status:     nodeStatus("node-d", "http://10.0.0.4:8095", gkmv1alpha1.GkmCondExtracted),
+			},
+			&gkmv1alpha1.ClusterGKMCacheNode{
+				ObjectMeta: metav1.ObjectMeta{Name: "node-e"},
+				Status:     nodeStatus("node-e", "", gkmv1alpha1.GkmCondExtracted),
+			},
+		).Build()
+
+		t.Logf("TEST: FindLayerPeers() - Should return the other Nodes with the digest extracted and a LayerServer")
+		peers, err := FindLayerPeers(context.Background(), objClient, "node-a", testScrubDigest)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"http://10.0.0.2:8095", "http://10.0.0.4:8095"}, peers)
+
+		t.Logf("TEST: FindLayerPeers() of a digest not extracted anywhere - Should return no peers")
+		peers, err = FindLayerPeers(context.Background(), objClient, "node-a", testEvictDigest2)
+		require.NoError(t, err)
+		require.Empty(t, peers)
+	})
+}
@@ -36,6 +36,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	gkmv1alpha1 "github.com/redhat-et/GKM/api/v1alpha1"
 	"github.com/redhat-et/GKM/pkg/common"
@@ -44,13 +45,17 @@ import (
 
 // +kubebuilder:rbac:groups=batch,resources=jobs,verbs=create;list;watch;delete
 // +kubebuilder:rbac:groups="",resources=pods,verbs=list;watch
+// +kubebuilder:rbac:groups="",resources=pods/log,verbs=get
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=get
 // +kubebuilder:rbac:groups="",resources=persistentvolumes,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",namespace=system,resources=secrets,verbs=get
 // +kubebuilder:rbac:groups=gkm.io,resources=gkmcaches,verbs=get;list;watch
 // +kubebuilder:rbac:groups=gkm.io,resources=gkmcachenodes,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=gkm.io,resources=gkmcachenodes/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=gkm.io,resources=gkmcachenodes/finalizers,verbs=update
 // +kubebuilder:rbac:groups="",resources=events,verbs=create;patch;update
+// +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;watch;create;update;patch
 
 // GKMCacheAgentReconciler reconciles a GKMCache object
 type GKMCacheAgentReconciler struct {
@@ -73,7 +78,7 @@ func (r *GKMCacheAgentReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *GKMCacheAgentReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&gkmv1alpha1.GKMCache{}).
 		// Trigger reconciliation if the GKMCacheNode for this node is modified.
 		// Own() doesn't work because the GKMCacheNode is per Namespace and the
@@ -88,8 +93,21 @@ func (r *GKMCacheAgentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 			&corev1.Pod{},
 			handler.EnqueueRequestsFromMapFunc(r.enqueueGKMCacheNode),
 			builder.WithPredicates(common.PodPredicate(r.NodeName)),
-		).
-		Complete(r)
+		)
+	// Trigger reconciliation if scrubbing finds the extracted Cache corrupted.
+	if r.Scrubber != nil {
+		b = b.WatchesRawSource(source.Channel(r.Scrubber.Subscribe(), &handler.EnqueueRequestForObject{}))
+	}
+	if r.Evictor != nil {
+		b = b.WatchesRawSource(source.Channel(r.Evictor.Subscribe(), &handler.EnqueueRequestForObject{}))
+	}
+	if r.DiskMonitor != nil {
+		b = b.WatchesRawSource(source.Channel(r.DiskMonitor.Subscribe(), &handler.EnqueueRequestForObject{}))
+	}
+	if r.ExtractQueue != nil && r.MaxRegistryPulls > 0 {
+		b = b.WatchesRawSource(source.Channel(r.ExtractQueue.Subscribe(), &handler.EnqueueRequestForObject{}))
+	}
+	return b.Complete(r)
 }
 
 // Only reconcile if a program has been created for a controller's node.
@@ -0,0 +1,329 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gkmAgent
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	"github.com/redhat-et/GKM/pkg/common"
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+// queueStaleTimeout is how long a waiting extraction stays in the queue without being
+// seen by a reconcile. This keeps a deleted Cache from blocking the queue forever.
+const queueStaleTimeout = 2 * time.Minute
+
+// pullLeaseRenewInterval is how often the registry pull slots of the running extractions are
+// renewed. A Lease is only written once a third of its duration has passed, so this keeps it
+// well within the duration.
+const pullLeaseRenewInterval = utils.PullLeaseDuration / 4
+
+type queuedExtraction struct {
+	key      string
+	cacheKey string
+	priority int32
+	created  time.Time
+	lastSeen time.Time
+}
+
+// ExtractQueue limits the number of GPU Kernel Cache extractions running at once on a
+// Node. It is shared by the GKMCache and ClusterGKMCache reconcilers. Each extraction is
+// tracked by a key, which is the PVC the Cache is extracted to. Extractions wait in the
+// queue until admitted, ordered by the priority of the Cache, then by the creation time of
+// the Cache. The queue only lives in memory. After an Agent restart, the reconcilers call
+// MarkRunning for extractions that were already in progress. With a cluster wide limit on
+// registry pulls, ExtractQueue implements manager.Runnable and renews the registry pull slot of
+// each running extraction while it runs, see EnablePullLeases.
+type ExtractQueue struct {
+	maxConcurrent int
+
+	// Registry pull slots, set by EnablePullLeases.
+	client   client.Client
+	maxPulls int
+	logger   logr.Logger
+
+	// Overwritten in unit tests.
+	now func() time.Time
+
+	mu          sync.Mutex
+	running     map[string]string // key to cacheKey
+	waiting     map[string]*queuedExtraction
+	pulls       map[string]string // key to the holder of the registry pull slot
+	lost        map[string]bool   // keys whose registry pull slot could not be renewed
+	subscribers []chan event.GenericEvent
+}
+
+// NewExtractQueue creates an ExtractQueue that admits at most maxConcurrent extractions.
+func NewExtractQueue(maxConcurrent int) *ExtractQueue {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	return &ExtractQueue{
+		maxConcurrent: maxConcurrent,
+		now:           time.Now,
+		running:       make(map[string]string),
+		waiting:       make(map[string]*queuedExtraction),
+		pulls:         make(map[string]string),
+		lost:          make(map[string]bool),
+	}
+}
+
+// EnablePullLeases has the ExtractQueue renew the registry pull slots, one of maxPulls Leases,
+// held by the running extractions, see HoldPull. Must be called before Start.
+func (q *ExtractQueue) EnablePullLeases(objClient client.Client, maxPulls int, logger logr.Logger) {
+	q.client = objClient
+	q.maxPulls = maxPulls
+	q.logger = logger
+}
+
+// Subscribe returns a channel that receives an event each time a running extraction loses its
+// registry pull slot. Each reconciler watches its own channel. Must be called before Start.
+func (q *ExtractQueue) Subscribe() <-chan event.GenericEvent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ch := make(chan event.GenericEvent, 1)
+	q.subscribers = append(q.subscribers, ch)
+	return ch
+}
+
+// Start renews the registry pull slots every pullLeaseRenewInterval until ctx is cancelled.
+func (q *ExtractQueue) Start(ctx context.Context) error {
+	q.logger.Info("Starting registry pull slot renewal", "interval", pullLeaseRenewInterval, "maxPulls", q.maxPulls)
+
+	ticker := time.NewTicker(pullLeaseRenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			q.RenewPullLeases(ctx)
+		}
+	}
+}
+
+// RenewPullLeases renews the registry pull slot of each running extraction once. If a slot
+// was taken by another Agent, for example because KubeAPI Server could not be reached for the
+// duration of the Lease, the extraction is reported by PullLost and the subscribers are
+// notified, so the reconcilers stop the extraction and queue it again.
+func (q *ExtractQueue) RenewPullLeases(ctx context.Context) {
+	if q.client == nil || q.maxPulls == 0 {
+		return
+	}
+
+	q.mu.Lock()
+	pulls := make(map[string]string, len(q.pulls))
+	for key, holder := range q.pulls {
+		pulls[key] = holder
+	}
+	q.mu.Unlock()
+
+	lost := false
+	for key, holder := range pulls {
+		acquired, err := common.AcquirePullLease(ctx, q.client, utils.GKMDefaultNamespace, q.maxPulls, holder, q.logger)
+		if err != nil {
+			// Retried on the next tick, the Lease is only free once its duration has passed.
+			q.logger.Error(err, "unable to renew registry pull slot", "holder", holder)
+			continue
+		} else if acquired {
+			continue
+		}
+
+		q.mu.Lock()
+		if q.pulls[key] == holder {
+			q.logger.Info("Registry pull slot lost", "key", key, "holder", holder)
+			delete(q.pulls, key)
+			q.lost[key] = true
+			lost = true
+		}
+		q.mu.Unlock()
+	}
+	if !lost {
+		return
+	}
+
+	q.mu.Lock()
+	subscribers := q.subscribers
+	q.mu.Unlock()
+	for _, ch := range subscribers {
+		// Reconcile covers every Cache, so one pending event per reconciler is enough.
+		select {
+		case ch <- event.GenericEvent{Object: &metav1.PartialObjectMetadata{
+			ObjectMeta: metav1.ObjectMeta{Name: "gkm-pull-slot"},
+		}}:
+		default:
+		}
+	}
+}
+
+// HoldPull records that the running extraction tracked by key holds a registry pull slot as
+// holder, so the slot is renewed until the extraction is released or requeued.
+func (q *ExtractQueue) HoldPull(key, holder string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, isRunning := q.running[key]; !isRunning {
+		return
+	}
+	q.pulls[key] = holder
+	delete(q.lost, key)
+}
+
+// PullLost returns true if the registry pull slot of the extraction tracked by key could not be
+// renewed, until the extraction is released or requeued.
+func (q *ExtractQueue) PullLost(key string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.lost[key]
+}
+
+// Admit adds the extraction to the queue if needed, and admits it if there is a free slot
+// and no other waiting extraction is ahead of it. Returns true if the extraction may start,
+// otherwise returns its position in the queue, starting at 1.
+func (q *ExtractQueue) Admit(key, cacheKey string, priority int32, created time.Time) (bool, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, isRunning := q.running[key]; isRunning {
+		return true, 0
+	}
+
+	now := q.now()
+	if waiter, isWaiting := q.waiting[key]; isWaiting {
+		waiter.priority = priority
+		waiter.lastSeen = now
+	} else {
+		q.waiting[key] = &queuedExtraction{
+			key:      key,
+			cacheKey: cacheKey,
+			priority: priority,
+			created:  created,
+			lastSeen: now,
+		}
+	}
+
+	order := q.orderLocked()
+	position := 0
+	for i, waiter := range order {
+		if waiter.key == key {
+			position = i + 1
+			break
+		}
+	}
+
+	if position <= q.maxConcurrent-len(q.running) {
+		delete(q.waiting, key)
+		q.running[key] = cacheKey
+		return true, 0
+	}
+	return false, position
+}
+
+// Requeue moves an admitted extraction back to the queue, for example when it was admitted
+// on the Node but could not get a cluster wide registry pull slot, or lost it.
+func (q *ExtractQueue) Requeue(key string, priority int32, created time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	cacheKey, isRunning := q.running[key]
+	if !isRunning {
+		return
+	}
+	delete(q.running, key)
+	delete(q.pulls, key)
+	delete(q.lost, key)
+	q.waiting[key] = &queuedExtraction{
+		key:      key,
+		cacheKey: cacheKey,
+		priority: priority,
+		created:  created,
+		lastSeen: q.now(),
+	}
+}
+
+// MarkRunning records an extraction that is already in progress, so it counts against the
+// limit. Used to rebuild the queue state after an Agent restart.
+func (q *ExtractQueue) MarkRunning(key, cacheKey string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.waiting, key)
+	q.running[key] = cacheKey
+}
+
+// Release removes the extraction from the queue, freeing its slot if it was running.
+// Returns true if the extraction was known to the queue.
+func (q *ExtractQueue) Release(key string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	_, isRunning := q.running[key]
+	_, isWaiting := q.waiting[key]
+	delete(q.running, key)
+	delete(q.waiting, key)
+	delete(q.pulls, key)
+	delete(q.lost, key)
+	return isRunning || isWaiting
+}
+
+// Position returns the best queue position, starting at 1, of all the waiting extractions
+// for the given Cache, or 0 if none of them are waiting.
+func (q *ExtractQueue) Position(cacheKey string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, waiter := range q.orderLocked() {
+		if waiter.cacheKey == cacheKey {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// orderLocked prunes stale waiters and returns the rest in the order they will be admitted.
+// Must be called with the lock held.
+func (q *ExtractQueue) orderLocked() []*queuedExtraction {
+	now := q.now()
+	order := make([]*queuedExtraction, 0, len(q.waiting))
+	for key, waiter := range q.waiting {
+		if now.Sub(waiter.lastSeen) > queueStaleTimeout {
+			delete(q.waiting, key)
+			continue
+		}
+		order = append(order, waiter)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		if order[i].priority != order[j].priority {
+			return order[i].priority > order[j].priority
+		}
+		if !order[i].created.Equal(order[j].created) {
+			return order[i].created.Before(order[j].created)
+		}
+		return order[i].key < order[j].key
+	})
+	return order
+}
@@ -0,0 +1,221 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gkmAgent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	gkmv1alpha1 "github.com/redhat-et/GKM/api/v1alpha1"
+	"github.com/redhat-et/GKM/pkg/common"
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+func TestExtractQueue(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Test extraction queue ordering and limits", func(t *testing.T) {
+		q := NewExtractQueue(1)
+		q.now = func() time.Time { return base }
+
+		t.Logf("TEST: Admit() with a free slot - Should admit")
+		admitted, position := q.Admit("pvc-a", "ns/a@sha256:1", 0, base)
+		require.True(t, admitted)
+		require.Equal(t, 0, position)
+
+		t.Logf("TEST: Admit() of a running extraction - Should still be admitted")
+		admitted, _ = q.Admit("pvc-a", "ns/a@sha256:1", 0, base)
+		require.True(t, admitted)
+
+		t.Logf("TEST: Admit() with no free slot - Should queue by priority, then creation time")
+		admitted, position = q.Admit("pvc-old", "ns/old@sha256:1", 0, base.Add(1*time.Minute))
+		require.False(t, admitted)
+		require.Equal(t, 1, position)
+		admitted, position = q.Admit("pvc-new", "ns/new@sha256:1", 0, base.Add(2*time.Minute))
+		require.False(t, admitted)
+		require.Equal(t, 2, position)
+		admitted, position = q.Admit("pvc-high", "ns/high@sha256:1", 10, base.Add(3*time.Minute))
+		require.False(t, admitted)
+		require.Equal(t, 1, position)
+		require.Equal(t, 3, q.Position("ns/new@sha256:1"))
+		require.Equal(t, 0, q.Position("ns/a@sha256:1"))
+
+		t.Logf("TEST: Admit() after Release() - Should only admit the head of the queue")
+		require.True(t, q.Release("pvc-a"))
+		admitted, position = q.Admit("pvc-old", "ns/old@sha256:1", 0, base.Add(1*time.Minute))
+		require.False(t, admitted)
+		require.Equal(t, 2, position)
+		admitted, _ = q.Admit("pvc-high", "ns/high@sha256:1", 10, base.Add(3*time.Minute))
+		require.True(t, admitted)
+
+		t.Logf("TEST: Requeue() - Should give the slot to the next extraction")
+		q.Requeue("pvc-high", 10, base.Add(3*time.Minute))
+		require.Equal(t, 1, q.Position("ns/high@sha256:1"))
+		require.True(t, q.Release("pvc-high"))
+		admitted, _ = q.Admit("pvc-old", "ns/old@sha256:1", 0, base.Add(1*time.Minute))
+		require.True(t, admitted)
+
+		t.Logf("TEST: Release() of an unknown extraction - Should return false")
+		require.False(t, q.Release("pvc-unknown"))
+	})
+
+	t.Run("Test extraction queue restart and stale entries", func(t *testing.T) {
+		now := base
+		q := NewExtractQueue(2)
+		q.now = func() time.Time { return now }
+
+		t.Logf("TEST: MarkRunning() - Should count against the limit")
+		q.MarkRunning("pvc-a", "ns/a@sha256:1")
+		q.MarkRunning("pvc-b", "ns/b@sha256:1")
+		admitted, position := q.Admit("pvc-c", "ns/c@sha256:1", 0, base)
+		require.False(t, admitted)
+		require.Equal(t, 1, position)
+
+		t.Logf("TEST: Position() after the waiter is not seen for a while - Should be pruned")
+		now = now.Add(queueStaleTimeout + time.Second)
+		require.Equal(t, 0, q.Position("ns/c@sha256:1"))
+		require.False(t, q.Release("pvc-c"))
+	})
+
+	t.Run("Test registry pull slot renewal", func(t *testing.T) {
+		scheme := runtime.NewScheme()
+		require.NoError(t, clientgoscheme.AddToScheme(scheme))
+		objClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+		leaseKey := types.NamespacedName{Namespace: utils.GKMDefaultNamespace, Name: common.PullLeaseName(0)}
+
+		q := NewExtractQueue(1)
+		q.EnablePullLeases(objClient, 1, logr.Discard())
+		events := q.Subscribe()
+		admitted, _ := q.Admit("pvc-a", "ns/a@sha256:1", 0, base)
+		require.True(t, admitted)
+		acquired, err := common.AcquirePullLease(t.Context(), objClient, utils.GKMDefaultNamespace, 1, "node-a/pvc-a", logr.Discard())
+		require.NoError(t, err)
+		require.True(t, acquired)
+		q.HoldPull("pvc-a", "node-a/pvc-a")
+
+		t.Logf("TEST: RenewPullLeases() of a running extraction - Should renew its Lease")
+		lease := &coordinationv1.Lease{}
+		require.NoError(t, objClient.Get(t.Context(), leaseKey, lease))
+		stale := metav1.NewMicroTime(time.Now().Add(-utils.PullLeaseDuration / 2))
+		lease.Spec.RenewTime = &stale
+		require.NoError(t, objClient.Update(t.Context(), lease))
+		q.RenewPullLeases(t.Context())
+		require.NoError(t, objClient.Get(t.Context(), leaseKey, lease))
+		require.True(t, lease.Spec.RenewTime.After(stale.Time))
+		require.False(t, q.PullLost("pvc-a"))
+		require.Empty(t, events)
+
+		t.Logf("TEST: RenewPullLeases() once another Agent took the slot - Should report it lost and notify")
+		now := metav1.NewMicroTime(time.Now())
+		lease.Spec.HolderIdentity = ptr.To("node-b/pvc-b")
+		lease.Spec.RenewTime = &now
+		require.NoError(t, objClient.Update(t.Context(), lease))
+		q.RenewPullLeases(t.Context())
+		require.True(t, q.PullLost("pvc-a"))
+		require.Len(t, events, 1)
+
+		t.Logf("TEST: Requeue() of the extraction - Should clear the lost slot")
+		q.Requeue("pvc-a", 0, base)
+		require.False(t, q.PullLost("pvc-a"))
+	})
+
+	t.Run("Test extraction stopped when its registry pull slot is lost", func(t *testing.T) {
+		scheme := runtime.NewScheme()
+		require.NoError(t, clientgoscheme.AddToScheme(scheme))
+		require.NoError(t, gkmv1alpha1.AddToScheme(scheme))
+		objClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+
+		q := NewExtractQueue(1)
+		q.EnablePullLeases(objClient, 1, logr.Discard())
+		r := &ReconcilerCommonAgent[
+			gkmv1alpha1.GKMCache,
+			gkmv1alpha1.GKMCacheList,
+			gkmv1alpha1.GKMCacheNode,
+			gkmv1alpha1.GKMCacheNodeList,
+		]{
+			Client:           objClient,
+			Logger:           logr.Discard(),
+			NodeName:         "node-a",
+			ExtractQueue:     q,
+			MaxRegistryPulls: 1,
+			CrdCacheStr:      utils.CrdGKMCache,
+		}
+		gkmCache := gkmv1alpha1.GKMCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "vector-add", Namespace: "ns1"},
+			Spec:       gkmv1alpha1.GKMCacheSpec{Image: "quay.io/example/vector-add:latest"},
+			Status:     gkmv1alpha1.GKMCacheStatus{PvcOwner: gkmv1alpha1.PvcOwnerAgent},
+		}
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "vector-add-abcde-job-download-xyz12", Namespace: "ns1"},
+		}
+		require.NoError(t, objClient.Create(t.Context(), job))
+
+		cacheStatus := gkmv1alpha1.CacheStatus{}
+		pvcStatus := gkmv1alpha1.PvcStatus{PvcName: "vector-add-abcde", PvcOwner: gkmv1alpha1.PvcOwnerAgent}
+		gkmv1alpha1.SetPvcStatusConditions(&pvcStatus, gkmv1alpha1.GkmCondPending.Condition())
+
+		t.Logf("TEST: manageExtractQueue() of a Pending extraction - Should admit it and hold a registry pull slot")
+		admitted, _, _, _, err := r.manageExtractQueue(t.Context(), &gkmCache, &cacheStatus, &pvcStatus, "ns1", testScrubDigest)
+		require.NoError(t, err)
+		require.True(t, admitted)
+
+		t.Logf("TEST: manageExtractQueue() of a running extraction - Should keep it running")
+		gkmv1alpha1.SetPvcStatusConditions(&pvcStatus, gkmv1alpha1.GkmCondDownloading.Condition())
+		pvcStatus.JobName = job.Name
+		admitted, updated, _, _, err := r.manageExtractQueue(t.Context(), &gkmCache, &cacheStatus, &pvcStatus, "ns1", testScrubDigest)
+		require.NoError(t, err)
+		require.True(t, admitted)
+		require.False(t, updated)
+
+		t.Logf("TEST: manageExtractQueue() once the slot was lost - Should delete the Job and move the PVC Status to Pending")
+		lease := &coordinationv1.Lease{}
+		require.NoError(t, objClient.Get(t.Context(),
+			types.NamespacedName{Namespace: utils.GKMDefaultNamespace, Name: common.PullLeaseName(0)}, lease))
+		now := metav1.NewMicroTime(time.Now())
+		lease.Spec.HolderIdentity = ptr.To("node-b/pvc-b")
+		lease.Spec.RenewTime = &now
+		require.NoError(t, objClient.Update(t.Context(), lease))
+		q.RenewPullLeases(t.Context())
+		require.True(t, q.PullLost(pvcStatus.PvcName))
+
+		admitted, updated, updateReason, _, err := r.manageExtractQueue(t.Context(), &gkmCache, &cacheStatus, &pvcStatus, "ns1", testScrubDigest)
+		require.NoError(t, err)
+		require.False(t, admitted)
+		require.True(t, updated)
+		require.Equal(t, "Requeue Extraction", updateReason)
+		require.True(t, gkmv1alpha1.GkmCondPending.IsConditionSet(pvcStatus.Conditions))
+		require.Error(t, objClient.Get(t.Context(), client.ObjectKeyFromObject(job), &batchv1.Job{}))
+		require.False(t, q.PullLost(pvcStatus.PvcName))
+
+		t.Logf("TEST: manageExtractQueue() while the other Agent holds the slot - Should wait for a registry pull slot")
+		admitted, _, _, _, err = r.manageExtractQueue(t.Context(), &gkmCache, &cacheStatus, &pvcStatus, "ns1", testScrubDigest)
+		require.NoError(t, err)
+		require.False(t, admitted)
+	})
+}
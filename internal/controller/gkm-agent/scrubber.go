@@ -0,0 +1,185 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gkmAgent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	mcvCache "github.com/redhat-et/GKM/mcv/pkg/cache"
+	"github.com/redhat-et/GKM/pkg/extract"
+)
+
+type scrubFunc func(cacheDir string, log logr.Logger) (*extract.ScrubReport, error)
+
+// Scrubber periodically verifies the GPU Kernel Caches extracted in the host cache directory
+// against the integrity manifest of their OCI Image, to catch files that were modified, truncated
+// or added after extraction. When the cache is corrupted, the reconcilers are triggered so they
+// can flag the PVC Status and extract the cache again. Scrubber implements manager.Runnable so
+// it is started and stopped with the controller manager.
+type Scrubber struct {
+	cacheDir string
+	interval time.Duration
+	logger   logr.Logger
+
+	// Overwritten in unit tests.
+	scrubFn scrubFunc
+
+	mu          sync.Mutex
+	corrupted   map[string]*extract.ScrubReport // Indexed by cache directory
+	subscribers []chan event.GenericEvent
+}
+
+// NewScrubber creates a Scrubber that scrubs the caches in cacheDir, which is the host cache
+// directory mounted in the GKM Agent, every interval.
+func NewScrubber(cacheDir string, interval time.Duration, logger logr.Logger) *Scrubber {
+	return &Scrubber{
+		cacheDir: cacheDir,
+		interval: interval,
+		logger:   logger,
+		scrubFn:  extract.ScrubCache,
+	}
+}
+
+// CacheDir returns the directory scrubbed by the Scrubber.
+func (s *Scrubber) CacheDir() string {
+	return s.cacheDir
+}
+
+// Subscribe returns a channel that receives an event each time scrubbing finds a cache
+// corrupted. Each reconciler watches its own channel. Must be called before Start.
+func (s *Scrubber) Subscribe() <-chan event.GenericEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := make(chan event.GenericEvent, 1)
+	s.subscribers = append(s.subscribers, ch)
+	return ch
+}
+
+// Start scrubs the caches every interval until ctx is cancelled.
+func (s *Scrubber) Start(ctx context.Context) error {
+	s.logger.Info("Starting cache scrubbing", "interval", s.interval, "cacheDir", s.cacheDir)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			s.Scrub()
+		}
+	}
+}
+
+// Scrub verifies each cache once, and notifies the subscribers if any is corrupted.
+func (s *Scrubber) Scrub() {
+	entries, err := os.ReadDir(s.cacheDir)
+	if err != nil {
+		s.logger.Error(err, "unable to list caches", "cacheDir", s.cacheDir)
+		return
+	}
+
+	corrupted := make(map[string]*extract.ScrubReport)
+	var inProgress []string
+	for _, entry := range entries {
+		// Each digest is extracted in its own directory, see utils.CacheDirName().
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		cacheDir := filepath.Join(s.cacheDir, entry.Name())
+		report, err := s.scrubFn(cacheDir, s.logger)
+		switch {
+		case errors.Is(err, extract.ErrExtractInProgress):
+			// The extraction replaces the files, so check again next time.
+			s.logger.V(1).Info("Extraction in progress, skipping scrub", "cacheDir", cacheDir)
+			inProgress = append(inProgress, cacheDir)
+		case errors.Is(err, extract.ErrNotExtracted), errors.Is(err, extract.ErrNoIntegrityManifest):
+			s.logger.V(1).Info("Nothing to scrub", "cacheDir", cacheDir, "reason", err)
+		case err != nil:
+			s.logger.Error(err, "unable to scrub cache", "cacheDir", cacheDir)
+		case len(report.Issues) == 0:
+			// Intact
+		default:
+			s.logger.Info("Extracted cache is corrupted",
+				"imageURL", report.ImageURL,
+				"cacheDir", cacheDir,
+				"issues", mcvCache.IntegrityIssuesMessage(report.Issues))
+			corrupted[cacheDir] = report
+		}
+	}
+
+	s.mu.Lock()
+	for _, cacheDir := range inProgress {
+		if report, found := s.corrupted[cacheDir]; found {
+			corrupted[cacheDir] = report
+		}
+	}
+	s.corrupted = corrupted
+	subscribers := s.subscribers
+	s.mu.Unlock()
+
+	if len(corrupted) == 0 {
+		return
+	}
+	for _, ch := range subscribers {
+		// Reconcile covers every Cache, so one pending event per reconciler is enough.
+		select {
+		case ch <- event.GenericEvent{Object: &metav1.PartialObjectMetadata{
+			ObjectMeta: metav1.ObjectMeta{Name: "gkm-scrub"},
+		}}:
+		default:
+		}
+	}
+}
+
+// Corrupted returns the files that did not match the integrity manifest the last time the
+// cache was scrubbed, if the cache was extracted from imageURL.
+func (s *Scrubber) Corrupted(imageURL string) ([]mcvCache.IntegrityIssue, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, report := range s.corrupted {
+		if report.ImageURL == imageURL {
+			return report.Issues, true
+		}
+	}
+	return nil, false
+}
+
+// Clear forgets that the cache extracted from imageURL was corrupted, once it is being
+// extracted again.
+func (s *Scrubber) Clear(imageURL string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for cacheDir, report := range s.corrupted {
+		if report.ImageURL == imageURL {
+			delete(s.corrupted, cacheDir)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gkmAgent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	gkmv1alpha1 "github.com/redhat-et/GKM/api/v1alpha1"
+	mcvCache "github.com/redhat-et/GKM/mcv/pkg/cache"
+	"github.com/redhat-et/GKM/pkg/extract"
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+const testScrubDigest = "sha256:bf6f7ea60274882031ad81434aa9c9ac0e4ff280cd1513db239dbbd705b6511c"
+
+// writeTestExtraction fills cacheDir as if imageURL, with an integrity manifest, was extracted
+// into it.
+func writeTestExtraction(t *testing.T, cacheDir, imageURL string) {
+	require.NoError(t, os.MkdirAll(filepath.Join(cacheDir, "abc"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(cacheDir, "abc", "kernel.json"), []byte("{}"), 0644))
+	manifest, err := mcvCache.BuildIntegrityManifest(cacheDir)
+	require.NoError(t, err)
+	require.NoError(t, mcvCache.WriteIntegrityManifest(filepath.Join(cacheDir, extract.IntegrityFileName), manifest))
+	require.NoError(t, os.WriteFile(filepath.Join(cacheDir, extract.InitFileName), []byte(imageURL+"\n"), 0644))
+}
+
+func TestScrubber(t *testing.T) {
+	gkmCache := gkmv1alpha1.GKMCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "vector-add", Namespace: "ns1"},
+		Spec: gkmv1alpha1.GKMCacheSpec{
+			Image: "quay.io/gkm/cache-examples:vector-add-cache-rocm-v2-rocm",
+		},
+	}
+	gkmCacheNode := gkmv1alpha1.GKMCacheNode{
+		ObjectMeta: metav1.ObjectMeta{Name: "ns1-node-a", Namespace: "ns1"},
+	}
+	imageURL := utils.ReplaceUrlTag(gkmCache.Spec.Image, testScrubDigest)
+
+	t.Run("Test scrubbing of the host cache directory", func(t *testing.T) {
+		hostDir := t.TempDir()
+		cacheDir := filepath.Join(hostDir, utils.CacheDirName(testScrubDigest))
+		otherDir := filepath.Join(hostDir, "0e2ac2d4b6a1")
+		s := NewScrubber(hostDir, time.Hour, logr.Discard())
+		events := s.Subscribe()
+
+		t.Logf("TEST: Scrub() of an empty directory - Should not report corruption")
+		s.Scrub()
+		_, corrupted := s.Corrupted(imageURL)
+		require.False(t, corrupted)
+
+		t.Logf("TEST: Scrub() of intact caches - Should not report corruption")
+		writeTestExtraction(t, cacheDir, imageURL)
+		writeTestExtraction(t, otherDir, imageURL+"0")
+		s.Scrub()
+		_, corrupted = s.Corrupted(imageURL)
+		require.False(t, corrupted)
+		require.Empty(t, events)
+
+		t.Logf("TEST: Scrub() of a modified cache - Should report the file and notify the subscribers")
+		require.NoError(t, os.WriteFile(filepath.Join(cacheDir, "abc", "kernel.json"), []byte("[]"), 0644))
+		s.Scrub()
+		s.Scrub()
+		require.Len(t, events, 1)
+		issues, corrupted := s.Corrupted(imageURL)
+		require.True(t, corrupted)
+		require.Equal(t, []mcvCache.IntegrityIssue{{Path: "abc/kernel.json", Kind: mcvCache.IntegrityModified}}, issues)
+
+		t.Logf("TEST: Corrupted() of another image - Should not report corruption")
+		_, corrupted = s.Corrupted(imageURL + "0")
+		require.False(t, corrupted)
+
+		t.Logf("TEST: Scrub() while the corrupted cache is extracted again - Should keep reporting it")
+		lf, err := os.OpenFile(filepath.Join(cacheDir, extract.LockFileName), os.O_RDWR|os.O_CREATE, 0600)
+		require.NoError(t, err)
+		require.NoError(t, syscall.Flock(int(lf.Fd()), syscall.LOCK_EX))
+		s.Scrub()
+		require.NoError(t, lf.Close())
+		_, corrupted = s.Corrupted(imageURL)
+		require.True(t, corrupted)
+
+		t.Logf("TEST: Clear() - Should forget the corruption")
+		s.Clear(imageURL)
+		_, corrupted = s.Corrupted(imageURL)
+		require.False(t, corrupted)
+	})
+
+	t.Run("Test re-extraction of a corrupted cache", func(t *testing.T) {
+		hostDir := t.TempDir()
+		cacheDir := filepath.Join(hostDir, utils.CacheDirName(testScrubDigest))
+		writeTestExtraction(t, cacheDir, imageURL)
+		require.NoError(t, os.Remove(filepath.Join(cacheDir, "abc", "kernel.json")))
+
+		recorder := record.NewFakeRecorder(10)
+		r := &ReconcilerCommonAgent[
+			gkmv1alpha1.GKMCache,
+			gkmv1alpha1.GKMCacheList,
+			gkmv1alpha1.GKMCacheNode,
+			gkmv1alpha1.GKMCacheNodeList,
+		]{
+			Logger:      logr.Discard(),
+			Recorder:    recorder,
+			NodeName:    "node-a",
+			Extractor:   NewExtractor(hostDir, 1, true, logr.Discard()),
+			Scrubber:    NewScrubber(hostDir, time.Hour, logr.Discard()),
+			CrdCacheStr: utils.CrdGKMCache,
+		}
+		r.Scrubber.Scrub()
+
+		pvcStatus := &gkmv1alpha1.PvcStatus{PvcName: "vector-add-abcde"}
+		gkmv1alpha1.SetPvcStatusConditions(pvcStatus, gkmv1alpha1.GkmCondRunning.Condition())
+
+		t.Logf("TEST: manageScrub() of a corrupted cache - Should move the PVC Status to Corrupted")
+		updated, updateReason, pending, err := r.manageScrub(t.Context(), &gkmCache, &gkmCacheNode, pvcStatus, "ns1", testScrubDigest)
+		require.NoError(t, err)
+		require.True(t, updated, updateReason)
+		require.False(t, pending)
+		condition := gkmv1alpha1.GetLatestConditionType(pvcStatus.Conditions)
+		require.Equal(t, string(gkmv1alpha1.GkmCondCorrupted), condition.Type)
+		require.Contains(t, condition.Message, "abc/kernel.json (missing)")
+		require.Len(t, recorder.Events, 1)
+		require.True(t, strings.HasPrefix(<-recorder.Events, "Warning Corrupted"))
+
+		t.Logf("TEST: manageScrub() of a Corrupted PVC Status - Should invalidate the cache and move to Pending")
+		updated, updateReason, pending, err = r.manageScrub(t.Context(), &gkmCache, &gkmCacheNode, pvcStatus, "ns1", testScrubDigest)
+		require.NoError(t, err)
+		require.True(t, updated, updateReason)
+		require.False(t, pending)
+		require.True(t, gkmv1alpha1.GkmCondPending.IsConditionSet(pvcStatus.Conditions))
+		_, err = os.Stat(filepath.Join(cacheDir, extract.InitFileName))
+		require.True(t, os.IsNotExist(err))
+		_, corrupted := r.Scrubber.Corrupted(imageURL)
+		require.False(t, corrupted)
+
+		t.Logf("TEST: manageScrub() of a Pending PVC Status - Should do nothing")
+		updated, _, pending, err = r.manageScrub(t.Context(), &gkmCache, &gkmCacheNode, pvcStatus, "ns1", testScrubDigest)
+		require.NoError(t, err)
+		require.False(t, updated)
+		require.False(t, pending)
+	})
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
@@ -27,6 +28,8 @@ import (
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -44,7 +47,12 @@ type GKMInstance interface {
 	GetPodTemplate() *gkmv1alpha1.PodTemplate
 	GetStorageClassName() string
 	GetAccessMode() []corev1.PersistentVolumeAccessMode
+	GetMountMode() gkmv1alpha1.MountMode
+	GetPriority() int32
+	GetTTLSecondsAfterUnused() *int64
+	GetTTLAction() gkmv1alpha1.TTLAction
 	GetWorkloadNamespaces() []string
+	GetImagePullSecrets() (string, []string)
 	GetPvcOwner() gkmv1alpha1.PvcOwner
 	GetAnnotations() map[string]string
 	GetLabels() map[string]string
@@ -91,8 +99,12 @@ type ReconcilerCommonOperator[
 	client.Client
 	Scheme          *runtime.Scheme
 	Logger          logr.Logger
+	Recorder        record.EventRecorder // For Events on the GKMCache or ClusterGKMCache, may be nil
+	KubeClient      kubernetes.Interface // For reading the log of failed Job Pods, may be nil
+	SecretReader    client.Reader        // For reading image pull Secrets, uncached, defaults to the Client
 	NoGpu           bool
 	KindCluster     bool
+	ExtractInAgent  bool // Agent extracts into the host cache directory instead of a Job
 	ExtractLogLevel string
 	ExtractImage    string
 	CrdCacheStr     string // For logging/errors: GKMCache or ClusterGKMCache
@@ -150,6 +162,9 @@ func (r *ReconcilerCommonOperator[C, CL, N, NL]) reconcileCommonOperator(
 	errorHit := false
 	stillInUse := false
 
+	// Time until the next Cache with a TTL needs to be checked for expiry, 0 if none.
+	var expiryRequeue time.Duration
+
 	r.Logger.V(1).Info("Start reconcileCommonOperator()")
 
 	// This is a Map indexed by the Cache Namespace and Name. If a GKMCache or
@@ -219,10 +234,24 @@ func (r *ReconcilerCommonOperator[C, CL, N, NL]) reconcileCommonOperator(
 					// GKMCache object was updated. Return and change will retrigger a new reconcile.
 					return ctrl.Result{Requeue: false}, nil
 				}
+
+				// Copy the image pull Secrets to where the Agents and the extraction Jobs read
+				// them, before any extraction is launched.
+				if err := r.manageRegistryAuth(ctx, &gkmCache); err != nil {
+					errorHit = true
+					continue
+				}
 			}
 
+			// An expired Cache is removed from the Nodes like a deleted Cache, but the Cache
+			// itself is kept.
+			cacheExpired := gkmv1alpha1.GkmCondExpired.IsConditionSet(gkmCache.GetStatus().Conditions)
+
 			gkmCacheStatus := gkmCache.GetStatus()
 			gkmCacheStatus.Counts = gkmv1alpha1.CacheCounts{}
+			gkmCacheStatus.Storage = nil
+			gkmCacheStatus.FailureReasons = nil
+			gkmCacheStatus.Failures = nil
 			gkmCacheStatus.ResolvedDigest = resolvedDigest
 
 			// The PvcOwner is the controller that creates and manages the PV/PVC/Job.
@@ -242,7 +271,7 @@ func (r *ReconcilerCommonOperator[C, CL, N, NL]) reconcileCommonOperator(
 				// Initialize the condition to pending.
 				r.setCacheConditions(gkmCacheStatus, gkmv1alpha1.GkmCondPending.Condition())
 
-				gkmCacheStatus.PvcOwner = determineOwner(gkmCache.GetAccessMode())
+				gkmCacheStatus.PvcOwner = determineOwner(gkmCache.GetMountMode(), gkmCache.GetAccessMode())
 				r.Logger.Info("Owner not set, setting now", "Updated Value", gkmCacheStatus.PvcOwner)
 			}
 
@@ -304,7 +333,7 @@ func (r *ReconcilerCommonOperator[C, CL, N, NL]) reconcileCommonOperator(
 				}
 
 				// CREATE or UPDATE
-				if !cacheDeleting && !namespaceDeleting {
+				if !cacheDeleting && !cacheExpired && !namespaceDeleting {
 
 					// Get the PVC Status, which is the Per Namespace PV and PVC information.
 					if gkmCacheStatus.PvcStatus == nil {
@@ -359,7 +388,25 @@ func (r *ReconcilerCommonOperator[C, CL, N, NL]) reconcileCommonOperator(
 						continue
 					}
 
-					if updated, updateReason, pvcInUse, pvcDeleting, err = common.ManagePvcStatusDelete(
+					if gkmCache.GetMountMode() == gkmv1alpha1.MountModeImageVolume {
+						// No Serving PVC with an Image Volume, just determine if still in use.
+						pvcInUse = common.GetImageVolumeUsedByList(
+							ctx,
+							r.Client,
+							"", // NodeName
+							pvcNamespace,
+							resolvedDigest,
+							r.Logger,
+						) != 0
+						if pvcInUse {
+							stillInUse = true
+							if !gkmv1alpha1.GkmCondDeleting.IsConditionSet(pvcStatus.Conditions) {
+								gkmv1alpha1.SetPvcStatusConditions(&pvcStatus, gkmv1alpha1.GkmCondDeleting.Condition())
+								updated = true
+								updateReason = "Update Condition to Deleting"
+							}
+						}
+					} else if updated, updateReason, pvcInUse, pvcDeleting, err = common.ManagePvcStatusDelete(
 						ctx,
 						r.Client,
 						gkmCache.GetNamespace(),
@@ -436,9 +483,18 @@ func (r *ReconcilerCommonOperator[C, CL, N, NL]) reconcileCommonOperator(
 			}
 
 			// Adjust the Cache Condition if need. This is a summary of all the Nodes.
-			if gkmCacheStatus.Counts.NodeErrorCnt != 0 {
-				if !gkmv1alpha1.GkmCondError.IsConditionSet(gkmCacheStatus.Conditions) {
-					r.setCacheConditions(gkmCacheStatus, gkmv1alpha1.GkmCondError.Condition())
+			if cacheExpired {
+				// Stays Expired until a Pod references the Cache again, see manageExpiry().
+			} else if gkmCacheStatus.Counts.NodeErrorCnt != 0 {
+				// Name the failing Nodes in the message, so "kubectl describe" shows where and
+				// why extraction failed.
+				condition := gkmv1alpha1.GkmCondError.Condition()
+				if len(gkmCacheStatus.Failures) != 0 {
+					condition.Message = common.NodeFailuresMessage(gkmCacheStatus.Counts.NodeErrorCnt, gkmCacheStatus.Failures)
+				}
+				current := meta.FindStatusCondition(gkmCacheStatus.Conditions, condition.Type)
+				if current == nil || current.Message != condition.Message {
+					r.setCacheConditions(gkmCacheStatus, condition)
 					updated = true
 					updateReason = "Set Error Cache Condition"
 				}
@@ -462,6 +518,29 @@ func (r *ReconcilerCommonOperator[C, CL, N, NL]) reconcileCommonOperator(
 				}
 			}
 
+			// Track how long the Cache has been unused and expire it once past its TTL.
+			if !cacheDeleting {
+				expiryUpdated, expiryReason, deleted, requeueAfter, err := r.manageExpiry(
+					ctx,
+					&gkmCache,
+					gkmCacheStatus,
+					resolvedDigest,
+				)
+				if err != nil {
+					errorHit = true
+					continue
+				} else if deleted {
+					// The delete will retrigger a new reconcile.
+					return ctrl.Result{Requeue: false}, nil
+				} else if expiryUpdated {
+					updated = true
+					updateReason = expiryReason
+				}
+				if requeueAfter > 0 && (expiryRequeue == 0 || requeueAfter < expiryRequeue) {
+					expiryRequeue = requeueAfter
+				}
+			}
+
 			if updated || !reflect.DeepEqual(gkmCache.GetStatus(), gkmCacheStatus) {
 				gkmCacheStatus.LastUpdated = metav1.Now()
 
@@ -482,8 +561,12 @@ func (r *ReconcilerCommonOperator[C, CL, N, NL]) reconcileCommonOperator(
 
 			if cacheDeleting {
 				if gkmCacheStatus.Counts.NodeCnt == 0 && !pvcDeleting {
-					// Everything should be cleaned up, so delete the GKMCacheNode specific
-					// finalizer from the GKMCache.
+					// Everything should be cleaned up, so delete the copies of the image pull
+					// Secrets and the GKMCacheNode specific finalizer from the GKMCache.
+					if err := r.deleteRegistryAuth(ctx, &gkmCache); err != nil {
+						errorHit = true
+						continue
+					}
 					changed, err := reconciler.cacheRemoveFinalizer(ctx, &gkmCache)
 					if err != nil {
 						errorHit = true
@@ -516,6 +599,9 @@ func (r *ReconcilerCommonOperator[C, CL, N, NL]) reconcileCommonOperator(
 		// If an error was encountered during a single GKMCache instance, or a Job to extract
 		// the Cache is still in progress, retry after a pause.
 		return ctrl.Result{Requeue: true, RequeueAfter: utils.RetryOperatorFailure}, nil
+	} else if expiryRequeue > 0 {
+		// Wake up to warn about or expire the next unused Cache with a TTL.
+		return ctrl.Result{Requeue: true, RequeueAfter: expiryRequeue}, nil
 	} else {
 		return ctrl.Result{Requeue: false}, nil
 	}
@@ -546,6 +632,21 @@ func (r *ReconcilerCommonOperator[C, CL, N, NL]) managePvcStatusModify(
 	pending := false
 	var err error
 
+	// For a ClusterGKMCache with multiple Namespaces, extract once and populate the
+	// remaining Namespaces from a VolumeSnapshot, if the StorageClass supports it.
+	if gkmCacheStatus.PvcOwner == gkmv1alpha1.PvcOwnerOperator && namespaceExists {
+		if handled, updated, updateReason, pending, err := r.manageSnapshot(
+			ctx,
+			gkmCache,
+			gkmCacheStatus,
+			pvcStatus,
+			pvcNamespace,
+			capacity,
+		); err != nil || handled {
+			return updated, updateReason, pending, err
+		}
+	}
+
 	// Since Operator owns PV/PVC, manage each now.
 	// If updated is already true, still manage PV and PVCs, because up to this
 	// point, it's just been initialization and allocation of structures, no
@@ -566,6 +667,35 @@ func (r *ReconcilerCommonOperator[C, CL, N, NL]) managePvcStatusModify(
 
 	// Launch Job to Extract Cache
 	if gkmCacheStatus.PvcOwner == gkmv1alpha1.PvcOwnerOperator {
+		// If the extraction failed with a transient error, retry it once the backoff delay has
+		// passed. The failed Job is deleted first, so a new Job can be launched.
+		if retryPending, remaining := common.ExtractRetryPending(pvcStatus); retryPending {
+			if remaining > 0 {
+				return updated, updateReason, true, nil
+			}
+			if updated, updateReason, err = common.DeleteJob(
+				ctx,
+				r.Client,
+				pvcNamespace,
+				"", // NodeName
+				resolvedDigest,
+				pvcStatus,
+				gkmv1alpha1.PvcOwnerOperator,
+				r.Logger,
+			); err != nil {
+				return updated, updateReason, pending, err
+			}
+
+			r.Logger.Info("Retrying extraction",
+				"Namespace", (*gkmCache).GetNamespace(),
+				"Name", (*gkmCache).GetName(),
+				"PVC Name", pvcStatus.PvcName,
+				"digest", resolvedDigest,
+				"attempt", pvcStatus.RetryCount+1)
+			common.RetryExtract(pvcStatus)
+			return true, "Retry Extraction", pending, nil
+		}
+
 		updated, updateReason, pending, err = r.manageJob(
 			ctx,
 			gkmCache,
@@ -578,6 +708,183 @@ func (r *ReconcilerCommonOperator[C, CL, N, NL]) managePvcStatusModify(
 	return updated, updateReason, pending, err
 }
 
+// manageSnapshot handles a ClusterGKMCache with more than one Workload Namespace when the
+// StorageClass supports VolumeSnapshots. The first Namespace in the list is the seed. The
+// GPU Kernel Cache is extracted into the seed PVC by a Job as normal, then a VolumeSnapshot
+// of the seed PVC is taken. The PVCs in the remaining Namespaces are populated from that
+// VolumeSnapshot instead of launching a Job per Namespace. Returns handled set to false if
+// the normal PV/PVC/Job processing should be used for this Namespace.
+func (r *ReconcilerCommonOperator[C, CL, N, NL]) manageSnapshot(
+	ctx context.Context,
+	gkmCache *C,
+	gkmCacheStatus *gkmv1alpha1.GKMCacheStatus,
+	pvcStatus *gkmv1alpha1.PvcStatus,
+	pvcNamespace string,
+	capacity string,
+) (bool, bool, string, bool, error) {
+	handled := false
+	updated := false
+	updateReason := ""
+	pending := false
+
+	namespaceList := (*gkmCache).GetWorkloadNamespaces()
+	if (*gkmCache).GetNamespace() != "" || len(namespaceList) < 2 {
+		return handled, updated, updateReason, pending, nil
+	}
+	seedNamespace := namespaceList[0]
+
+	// The name of the VolumeSnapshot includes the digest, so after the image of the Cache changes,
+	// the snapshot of the previous digest is not used to populate a PVC.
+	snapshotName := common.VolumeSnapshotName((*gkmCache).GetName(), gkmCacheStatus.ResolvedDigest)
+
+	if pvcNamespace == seedNamespace {
+		// Nothing to do until the seed PVC has been extracted, or if the snapshot was already taken.
+		if !gkmv1alpha1.IsConditionDownloadSet(pvcStatus.Conditions) || pvcStatus.VolumeSnapshotName == snapshotName {
+			return handled, updated, updateReason, pending, nil
+		}
+	} else if !gkmv1alpha1.GkmCondPending.IsConditionSet(pvcStatus.Conditions) || pvcStatus.PvcName != "" {
+		// PVC already populated, or the Job is already running for this Namespace.
+		return handled, updated, updateReason, pending, nil
+	}
+
+	snapshotClass, err := common.GetVolumeSnapshotClass(ctx, r.Client, (*gkmCache).GetStorageClassName(), r.Logger)
+	if err != nil || snapshotClass == "" {
+		return handled, updated, updateReason, pending, err
+	}
+	handled = true
+
+	if pvcNamespace == seedNamespace {
+		// Call KubeAPI to delete the VolumeSnapshot taken of a previous digest.
+		if pvcStatus.VolumeSnapshotName != "" {
+			if err := common.DeleteVolumeSnapshot(ctx, r.Client, seedNamespace, pvcStatus.VolumeSnapshotName, r.Logger); err != nil {
+				return handled, updated, updateReason, pending, err
+			}
+			pvcStatus.VolumeSnapshotName = ""
+			updated = true
+			updateReason = "Delete Outdated VolumeSnapshot"
+		}
+
+		// Call KubeAPI to take the VolumeSnapshot of the extracted seed PVC.
+		created, err := common.CreateVolumeSnapshot(
+			ctx,
+			r.Client,
+			r.Scheme,
+			(*gkmCache).GetClientObject(),
+			(*gkmCache).GetNamespace(),
+			(*gkmCache).GetName(),
+			snapshotName,
+			seedNamespace,
+			snapshotClass,
+			pvcStatus.PvcName,
+			gkmCacheStatus.ResolvedDigest,
+			r.Logger,
+		)
+		if err != nil {
+			return handled, updated, updateReason, pending, err
+		} else if !created {
+			// A VolumeSnapshot of another digest is being deleted, take it again once gone.
+			pending = true
+			return handled, updated, updateReason, pending, nil
+		}
+		pvcStatus.VolumeSnapshotName = snapshotName
+		updated = true
+		updateReason = "Create VolumeSnapshot"
+		return handled, updated, updateReason, pending, nil
+	}
+
+	// Wait for the seed PVC to be extracted and the VolumeSnapshot taken. If the seed Namespace
+	// does not exist, fall back to extracting in this Namespace.
+	seedPvcStatus, seedExists := gkmCacheStatus.PvcStatus[seedNamespace]
+	if !seedExists || gkmv1alpha1.GkmCondNoNamespace.IsConditionSet(seedPvcStatus.Conditions) {
+		handled = false
+		return handled, updated, updateReason, pending, nil
+	}
+	if seedPvcStatus.VolumeSnapshotName != snapshotName {
+		pending = true
+		return handled, updated, updateReason, pending, nil
+	}
+
+	if pvcStatus.VolumeSnapshotName != snapshotName {
+		// Call KubeAPI to delete the copy of a VolumeSnapshot taken of a previous digest.
+		if pvcStatus.VolumeSnapshotName != "" {
+			if err := common.DeleteVolumeSnapshot(ctx, r.Client, pvcNamespace, pvcStatus.VolumeSnapshotName, r.Logger); err != nil {
+				return handled, updated, updateReason, pending, err
+			}
+			pvcStatus.VolumeSnapshotName = ""
+			updated = true
+			updateReason = "Delete Outdated VolumeSnapshot"
+		}
+
+		// Call KubeAPI to make the seed VolumeSnapshot available in this Namespace.
+		copied, err := common.CopyVolumeSnapshot(
+			ctx,
+			r.Client,
+			r.Scheme,
+			(*gkmCache).GetClientObject(),
+			(*gkmCache).GetNamespace(),
+			(*gkmCache).GetName(),
+			seedNamespace,
+			seedPvcStatus.VolumeSnapshotName,
+			snapshotName,
+			pvcNamespace,
+			gkmCacheStatus.ResolvedDigest,
+			r.Logger,
+		)
+		if err != nil {
+			return handled, updated, updateReason, pending, err
+		} else if !copied {
+			pending = true
+			return handled, updated, updateReason, pending, nil
+		}
+		pvcStatus.VolumeSnapshotName = snapshotName
+		updated = true
+		updateReason = "Copy VolumeSnapshot"
+		return handled, updated, updateReason, pending, nil
+	}
+
+	// The PVC can only be populated once the copied VolumeSnapshot is ready to use.
+	ready, err := common.IsVolumeSnapshotReady(ctx, r.Client, pvcNamespace, pvcStatus.VolumeSnapshotName)
+	if err != nil {
+		return handled, updated, updateReason, pending, err
+	} else if !ready {
+		r.Logger.Info("VolumeSnapshot not ready",
+			"Snapshot Namespace", pvcNamespace,
+			"Snapshot Name", pvcStatus.VolumeSnapshotName,
+		)
+		pending = true
+		return handled, updated, updateReason, pending, nil
+	}
+
+	// Call KubeAPI to create the PVC populated from the VolumeSnapshot. No Job is needed,
+	// so the Cache is Extracted as soon as the PVC is created.
+	pvcStatus.PvcName = (*gkmCache).GetName()
+	if err := common.CreatePvc(
+		ctx,
+		r.Client,
+		r.Scheme,
+		(*gkmCache).GetClientObject(),
+		(*gkmCache).GetNamespace(),
+		(*gkmCache).GetName(),
+		"", // NodeName
+		"", // PvName
+		pvcStatus.PvcName,
+		pvcNamespace,
+		(*gkmCache).GetAccessMode(),
+		(*gkmCache).GetStorageClassName(),
+		capacity,
+		gkmCacheStatus.ResolvedDigest,
+		pvcStatus.VolumeSnapshotName,
+		r.Logger,
+	); err != nil && !errors.IsAlreadyExists(err) {
+		return handled, updated, updateReason, pending, err
+	}
+	gkmv1alpha1.SetPvcStatusConditions(pvcStatus, gkmv1alpha1.GkmCondExtracted.Condition())
+	updated = true
+	updateReason = "Create PVC from VolumeSnapshot"
+
+	return handled, updated, updateReason, pending, nil
+}
+
 // managePVandPVC manages the PV and PVC that the GPU Kernel Cache is extracted to. If PVC does not exist, then
 // this function calls KubeAPI to create the PVC. It MAY need to create the PV first. If both are created, this
 // function determines if the PVC is in a valid state to receive the extracted GPU Kernel Cache.
@@ -625,10 +932,23 @@ func (r *ReconcilerCommonOperator[C, CL, N, NL]) managePVandPVC(
 			return updated, updateReason, pending, nil
 		}
 
+		// In ImageVolume mode, the workload mounts the OCI Image directly, so there is no
+		// Serving PV/PVC to create. At least one Node has processed the image, so just
+		// update the condition.
+		if (*gkmCache).GetMountMode() == gkmv1alpha1.MountModeImageVolume {
+			gkmv1alpha1.SetPvcStatusConditions(pvcStatus, gkmv1alpha1.GkmCondExtracted.Condition())
+			updated = true
+			updateReason = "Update Condition to Extracted"
+			return updated, updateReason, pending, nil
+		}
+
 		// The preferred method for creating a PV is to create the PVC and Kubelet auto-creates the PV.
 		// In a KIND cluster, there is not a true CSI driver for storage management, so the PV must be
-		// manually created.
-		if r.KindCluster {
+		// manually created. This is only done for the Serving PVC. When the Operator owns the PVC
+		// (ReadOnlyMany), the StorageClass must dynamically provision a volume that can be shared
+		// across Nodes, which a static hostPath PV can not provide. When the Agent extracts the
+		// Cache in-process, it writes to the host cache directory, so a hostPath PV is needed too.
+		if (r.KindCluster || r.ExtractInAgent) && gkmCacheStatus.PvcOwner == gkmv1alpha1.PvcOwnerAgent {
 			_, found, updatedName, err := common.PvExists(
 				ctx,
 				r.Client,
@@ -668,6 +988,7 @@ func (r *ReconcilerCommonOperator[C, CL, N, NL]) managePVandPVC(
 					(*gkmCache).GetStorageClassName(),
 					capacity,
 					gkmCacheStatus.ResolvedDigest,
+					corev1.HostPathDirectoryOrCreate,
 					r.Logger,
 				)
 
@@ -708,9 +1029,15 @@ func (r *ReconcilerCommonOperator[C, CL, N, NL]) managePVandPVC(
 				// created in GKMDefaultNamespace.
 				pvcStatus.PvcName = (*gkmCache).GetName()
 
+				// The Serving PVC references the Download PVC directories on each Node.
+				// When the Operator owns the PVC, request the AccessModes from the Cache
+				// so the StorageClass provisions a ReadOnlyMany volume.
 				accessModes := []corev1.PersistentVolumeAccessMode{
 					corev1.ReadWriteOnce,
 				}
+				if gkmCacheStatus.PvcOwner == gkmv1alpha1.PvcOwnerOperator {
+					accessModes = (*gkmCache).GetAccessMode()
+				}
 
 				err := common.CreatePvc(
 					ctx,
@@ -727,6 +1054,7 @@ func (r *ReconcilerCommonOperator[C, CL, N, NL]) managePVandPVC(
 					(*gkmCache).GetStorageClassName(),
 					capacity,
 					gkmCacheStatus.ResolvedDigest,
+					"", // snapshotName
 					r.Logger,
 				)
 
@@ -829,6 +1157,9 @@ func (r *ReconcilerCommonOperator[C, CL, N, NL]) manageJob(
 			r.NoGpu,
 			r.KindCluster,
 			r.ExtractImage,
+			false, // verifyOnly
+			nil,   // layerPeers
+			registryAuthSecret(gkmCache),
 			pvcStatus,
 			(*gkmCache).GetPodTemplate(),
 			r.Logger,
@@ -913,18 +1244,24 @@ func (r *ReconcilerCommonOperator[C, CL, N, NL]) manageJob(
 		switch {
 		case latestJob.Status.Succeeded > 0:
 			if !gkmv1alpha1.IsConditionDownloadSet(pvcStatus.Conditions) {
+				pvcStatus.RetryCount = 0
 				gkmv1alpha1.SetPvcStatusConditions(pvcStatus, gkmv1alpha1.GkmCondExtracted.Condition())
 				updated = true
 				updateReason = "Update Condition to Extracted"
 			}
-			/*
-				case latestJob.Status.Failed > 0:
-					if !gkmv1alpha1.GkmCondError.IsConditionSet(pvcStatus.Conditions) {
-						gkmv1alpha1.SetPvcStatusConditions(pvcStatus, gkmv1alpha1.GkmCondError.Condition())
-						updated = true
-						logStr = "Update Condition to Error"
-					}
-			*/
+		case latestJob.Status.Failed > 0:
+			if !gkmv1alpha1.GkmCondError.IsConditionSet(pvcStatus.Conditions) {
+				reason, message := common.GetJobFailureReason(ctx, r.Client, r.KubeClient, latestJob, r.Logger)
+				r.Logger.Info("Extract Job failed",
+					"Namespace", (*gkmCache).GetNamespace(),
+					"Name", (*gkmCache).GetName(),
+					"Job Name", latestJob.Name,
+					"reason", reason,
+					"retryCount", pvcStatus.RetryCount)
+				common.SetExtractFailure(pvcStatus, reason, message)
+				updated = true
+				updateReason = "Update Condition to Error"
+			}
 		case latestJob.Status.Ready != nil && *latestJob.Status.Ready > 0:
 			if !gkmv1alpha1.GkmCondDownloading.IsConditionSet(pvcStatus.Conditions) {
 				gkmv1alpha1.SetPvcStatusConditions(pvcStatus, gkmv1alpha1.GkmCondDownloading.Condition())
@@ -961,12 +1298,20 @@ func (r *ReconcilerCommonOperator[C, CL, N, NL]) collectNodeCounts(
 		return err
 	}
 
+	// Failures of this Cache on each Node, summarized in the GKMCache Status below.
+	var failures []gkmv1alpha1.NodeFailure
+
 	// Loop through each GKMCacheNode (i.e. each Node)
 	for _, gkmCacheNode := range (*gkmCacheNodeList).GetItems() {
 		nodeStatus := gkmCacheNode.GetStatus()
 		if nodeStatus != nil {
 			// See if this GKMCache has been added to the GKMCacheNode
-			if _, ok := nodeStatus.CacheStatuses[(*gkmCache).GetName()]; ok {
+			if digestList, ok := nodeStatus.CacheStatuses[(*gkmCache).GetName()]; ok {
+				if cacheStatus, ok := digestList[gkmCacheStatus.ResolvedDigest]; ok {
+					failures = append(failures, common.GetNodeFailures(nodeStatus.NodeName, &cacheStatus)...)
+					addNodeStorage(gkmCacheStatus, nodeStatus, &cacheStatus)
+				}
+
 				// This Cache was found in a GKMCacheNode instance so collect a summary
 				// of the counts for all Namespaces (cluster scoped may have more than
 				// one namespace).
@@ -997,7 +1342,8 @@ func (r *ReconcilerCommonOperator[C, CL, N, NL]) collectNodeCounts(
 							}
 
 							switch gkmv1alpha1.GetLatestConditionType(pvcStatus.Conditions).Type {
-							case string(gkmv1alpha1.GkmCondPending):
+							case string(gkmv1alpha1.GkmCondPending), string(gkmv1alpha1.GkmCondVerifying),
+								string(gkmv1alpha1.GkmCondCorrupted):
 								// Temp state, ignore
 							case string(gkmv1alpha1.GkmCondExtracted):
 								cnts.NodeNotInUseCnt++
@@ -1011,6 +1357,8 @@ func (r *ReconcilerCommonOperator[C, CL, N, NL]) collectNodeCounts(
 								cnts.NodeErrorCnt++
 							case string(gkmv1alpha1.GkmCondOutdated):
 								cnts.PodOutdatedCnt++
+							case string(gkmv1alpha1.GkmCondEvicted):
+								// Removed from the Node to free disk space, extracted again when used
 							}
 						}
 					}
@@ -1019,6 +1367,8 @@ func (r *ReconcilerCommonOperator[C, CL, N, NL]) collectNodeCounts(
 		}
 	}
 
+	gkmCacheStatus.FailureReasons, gkmCacheStatus.Failures = common.SummarizeNodeFailures(failures)
+
 	r.Logger.V(1).Info("Processed GKMCache",
 		"Namespace", (*gkmCache).GetNamespace(),
 		"CacheName", (*gkmCache).GetName(),
@@ -1029,12 +1379,46 @@ func (r *ReconcilerCommonOperator[C, CL, N, NL]) collectNodeCounts(
 		"PodRunning", gkmCacheStatus.Counts.PodRunningCnt,
 		"PodDeleting", gkmCacheStatus.Counts.PodDeletingCnt,
 		"PodOutdated", gkmCacheStatus.Counts.PodOutdatedCnt,
+		"FailureReasons", gkmCacheStatus.FailureReasons,
 		"Conditions", gkmCacheStatus.Conditions,
 	)
 
 	return nil
 }
 
+// addNodeStorage adds the disk space a Cache uses on a Node, and the disk space still available on
+// the Node, to the storage summary in the GKMCache or ClusterGKMCache Status. The disk usage
+// measured by the Agent is used when reported, otherwise the size of the extracted Cache.
+func addNodeStorage(
+	gkmCacheStatus *gkmv1alpha1.GKMCacheStatus,
+	nodeStatus *gkmv1alpha1.GKMCacheNodeStatus,
+	cacheStatus *gkmv1alpha1.CacheStatus,
+) {
+	size := cacheStatus.DiskUsage
+	if size == 0 {
+		size = cacheStatus.VolumeSize
+	}
+	if size == 0 && nodeStatus.Storage == nil {
+		return
+	}
+
+	if gkmCacheStatus.Storage == nil {
+		gkmCacheStatus.Storage = &gkmv1alpha1.CacheStorage{}
+	}
+	storage := gkmCacheStatus.Storage
+	if size != 0 {
+		storage.UsedBytes += size
+		storage.NodeCnt++
+		storage.MaxNodeBytes = max(storage.MaxNodeBytes, size)
+	}
+	if nodeStatus.Storage != nil {
+		available := nodeStatus.Storage.AvailableBytes
+		if storage.MinAvailableBytes == nil || available < *storage.MinAvailableBytes {
+			storage.MinAvailableBytes = &available
+		}
+	}
+}
+
 // manageStrandedPvcs walks the GKMCacheNode or ClusterGKMCacheNode and determines if any PVCs are
 // stranded (GKMCache or ClusterGKMCache was deleted but Pod was still using PVC). If so, see if the
 // Pod using them is still active. If not, clean them up.
@@ -1263,9 +1647,16 @@ func (r *ReconcilerCommonOperator[C, CL, N, NL]) namespaceExists(ctx context.Con
 }
 
 // determineOwner walks the list of AccessMode values and if any of the values are
-// ReadOnlyMany then the owner is PvcOwnerOperator, otherwise PvcOwnerAgent.
-func determineOwner(accessMode []corev1.PersistentVolumeAccessMode) gkmv1alpha1.PvcOwner {
+// ReadOnlyMany then the owner is PvcOwnerOperator, otherwise PvcOwnerAgent. An Image
+// Volume is pulled by Kubelet on each Node, so the owner is always PvcOwnerAgent.
+func determineOwner(
+	mountMode gkmv1alpha1.MountMode,
+	accessMode []corev1.PersistentVolumeAccessMode,
+) gkmv1alpha1.PvcOwner {
 	pvcOwner := gkmv1alpha1.PvcOwnerAgent
+	if mountMode == gkmv1alpha1.MountModeImageVolume {
+		return pvcOwner
+	}
 	for _, mode := range accessMode {
 		if mode == corev1.ReadOnlyMany {
 			pvcOwner = gkmv1alpha1.PvcOwnerOperator
@@ -0,0 +1,256 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gkmOperator
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	gkmv1alpha1 "github.com/redhat-et/GKM/api/v1alpha1"
+	"github.com/redhat-et/GKM/pkg/common"
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+const (
+	testSnapshotDigest  = "sha256:bf6f7ea60274882031ad81434aa9c9ac0e4ff280cd1513db239dbbd705b6511c"
+	testSnapshotDigest2 = "sha256:0e2ac2d4b6a1c1e0cf0c1bd94d2d2ae45b0b0e8a5e2c7a4f3d8c1ea4b9c06b12"
+)
+
+func TestAddNodeStorage(t *testing.T) {
+	t.Run("Test storage summary across nodes", func(t *testing.T) {
+		status := &gkmv1alpha1.GKMCacheStatus{}
+
+		t.Logf("TEST: addNodeStorage() of a node without a size - Should not set storage")
+		addNodeStorage(status, &gkmv1alpha1.GKMCacheNodeStatus{}, &gkmv1alpha1.CacheStatus{})
+		require.Nil(t, status.Storage)
+
+		t.Logf("TEST: addNodeStorage() of a node with only the volume size - Should use the volume size")
+		addNodeStorage(status, &gkmv1alpha1.GKMCacheNodeStatus{}, &gkmv1alpha1.CacheStatus{VolumeSize: 1000})
+		require.NotNil(t, status.Storage)
+		require.Equal(t, int64(1000), status.Storage.UsedBytes)
+		require.Equal(t, 1, status.Storage.NodeCnt)
+		require.Nil(t, status.Storage.MinAvailableBytes)
+
+		t.Logf("TEST: addNodeStorage() of nodes with a disk usage - Should add it and track the least available")
+		addNodeStorage(status,
+			&gkmv1alpha1.GKMCacheNodeStatus{Storage: &gkmv1alpha1.NodeStorage{AvailableBytes: 5000}},
+			&gkmv1alpha1.CacheStatus{VolumeSize: 1000, DiskUsage: 3000})
+		addNodeStorage(status,
+			&gkmv1alpha1.GKMCacheNodeStatus{Storage: &gkmv1alpha1.NodeStorage{AvailableBytes: 9000}},
+			&gkmv1alpha1.CacheStatus{DiskUsage: 2000})
+		require.Equal(t, int64(6000), status.Storage.UsedBytes)
+		require.Equal(t, 3, status.Storage.NodeCnt)
+		require.Equal(t, int64(3000), status.Storage.MaxNodeBytes)
+		require.NotNil(t, status.Storage.MinAvailableBytes)
+		require.Equal(t, int64(5000), *status.Storage.MinAvailableBytes)
+	})
+}
+
+func TestDetermineOwner(t *testing.T) {
+	readOnlyMany := []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce, corev1.ReadOnlyMany}
+	readWriteOnce := []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+
+	t.Run("Test PVC owner", func(t *testing.T) {
+		t.Logf("TEST: determineOwner() of a ReadOnlyMany PVC - Should be owned by the Operator")
+		require.Equal(t, gkmv1alpha1.PvcOwnerOperator, determineOwner(gkmv1alpha1.MountModePVC, readOnlyMany))
+
+		t.Logf("TEST: determineOwner() of a ReadWriteOnce PVC - Should be owned by the Agent")
+		require.Equal(t, gkmv1alpha1.PvcOwnerAgent, determineOwner(gkmv1alpha1.MountModePVC, readWriteOnce))
+		require.Equal(t, gkmv1alpha1.PvcOwnerAgent, determineOwner("", nil))
+	})
+
+	t.Run("Test Image Volume owner", func(t *testing.T) {
+		t.Logf("TEST: determineOwner() of an Image Volume - Should be owned by the Agent whatever the access mode")
+		require.Equal(t, gkmv1alpha1.PvcOwnerAgent, determineOwner(gkmv1alpha1.MountModeImageVolume, readOnlyMany))
+		require.Equal(t, gkmv1alpha1.PvcOwnerAgent, determineOwner(gkmv1alpha1.MountModeImageVolume, nil))
+	})
+}
+
+// setSnapshotReady simulates the CSI snapshotter binding the VolumeSnapshot.
+func setSnapshotReady(t *testing.T, objClient client.Client, namespace, name, contentName string) {
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(common.VolumeSnapshotGVK)
+	require.NoError(t, objClient.Get(t.Context(), types.NamespacedName{Namespace: namespace, Name: name}, snapshot))
+	snapshot.Object["status"] = map[string]interface{}{
+		"readyToUse":                     true,
+		"boundVolumeSnapshotContentName": contentName,
+	}
+	require.NoError(t, objClient.Update(t.Context(), snapshot))
+}
+
+func TestManageSnapshot(t *testing.T) {
+	const (
+		seedNs     = "seed-ns"
+		workloadNs = "workload-ns"
+		driver     = "hostpath.csi.k8s.io"
+	)
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, gkmv1alpha1.AddToScheme(scheme))
+	for _, kind := range []string{"VolumeSnapshot", "VolumeSnapshotContent", "VolumeSnapshotClass"} {
+		gvk := schema.GroupVersionKind{Group: utils.SnapshotGroup, Version: utils.SnapshotVersion, Kind: kind}
+		scheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+		gvk.Kind += "List"
+		scheme.AddKnownTypeWithName(gvk, &unstructured.UnstructuredList{})
+	}
+
+	snapshotClass := &unstructured.Unstructured{}
+	snapshotClass.SetGroupVersionKind(schema.GroupVersionKind{
+		Group: utils.SnapshotGroup, Version: utils.SnapshotVersion, Kind: "VolumeSnapshotClass",
+	})
+	snapshotClass.SetName("csi-hostpath-snapclass")
+	snapshotClass.Object["driver"] = driver
+	seedContent := &unstructured.Unstructured{}
+	seedContent.SetGroupVersionKind(common.VolumeSnapshotContentGVK)
+	seedContent.SetName("snapcontent-seed")
+	seedContent.SetUID("5678")
+	seedContent.Object["spec"] = map[string]interface{}{"driver": driver}
+	seedContent.Object["status"] = map[string]interface{}{"snapshotHandle": "handle-1234"}
+	gkmCache := gkmv1alpha1.ClusterGKMCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "vector-add", UID: "1234"},
+		Spec: gkmv1alpha1.GKMCacheSpec{
+			Image:              "quay.io/example/vector-add:latest",
+			StorageClassName:   "csi-hostpath-sc",
+			AccessModes:        []corev1.PersistentVolumeAccessMode{corev1.ReadOnlyMany},
+			WorkloadNamespaces: []string{seedNs, workloadNs},
+		},
+	}
+	objClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(
+			&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "csi-hostpath-sc"}, Provisioner: driver},
+			snapshotClass,
+			seedContent,
+		).
+		Build()
+	r := &ReconcilerCommonOperator[
+		gkmv1alpha1.ClusterGKMCache,
+		gkmv1alpha1.ClusterGKMCacheList,
+		gkmv1alpha1.ClusterGKMCacheNode,
+		gkmv1alpha1.ClusterGKMCacheNodeList,
+	]{
+		Client:      objClient,
+		Scheme:      scheme,
+		Logger:      logr.Discard(),
+		CrdCacheStr: utils.CrdClusterGKMCache,
+	}
+
+	seedPvcStatus := gkmv1alpha1.PvcStatus{PvcName: "vector-add", PvcOwner: gkmv1alpha1.PvcOwnerOperator}
+	gkmv1alpha1.SetPvcStatusConditions(&seedPvcStatus, gkmv1alpha1.GkmCondExtracted.Condition())
+	gkmCacheStatus := gkmv1alpha1.GKMCacheStatus{
+		ResolvedDigest: testSnapshotDigest,
+		PvcOwner:       gkmv1alpha1.PvcOwnerOperator,
+		PvcStatus:      map[string]gkmv1alpha1.PvcStatus{},
+	}
+	snapshotName := common.VolumeSnapshotName(gkmCache.Name, testSnapshotDigest)
+
+	t.Run("Test PVC populated once the VolumeSnapshot is ready", func(t *testing.T) {
+		t.Logf("TEST: manageSnapshot() of the extracted seed PVC - Should take the VolumeSnapshot")
+		handled, updated, _, pending, err := r.manageSnapshot(t.Context(), &gkmCache, &gkmCacheStatus, &seedPvcStatus, seedNs, "1Gi")
+		require.NoError(t, err)
+		require.True(t, handled)
+		require.True(t, updated)
+		require.False(t, pending)
+		require.Equal(t, snapshotName, seedPvcStatus.VolumeSnapshotName)
+		gkmCacheStatus.PvcStatus[seedNs] = seedPvcStatus
+
+		pvcStatus := gkmv1alpha1.PvcStatus{PvcOwner: gkmv1alpha1.PvcOwnerOperator}
+		gkmv1alpha1.SetPvcStatusConditions(&pvcStatus, gkmv1alpha1.GkmCondPending.Condition())
+
+		t.Logf("TEST: manageSnapshot() of a workload Namespace before the seed is ready - Should be pending")
+		handled, updated, _, pending, err = r.manageSnapshot(t.Context(), &gkmCache, &gkmCacheStatus, &pvcStatus, workloadNs, "1Gi")
+		require.NoError(t, err)
+		require.True(t, handled)
+		require.False(t, updated)
+		require.True(t, pending)
+
+		t.Logf("TEST: manageSnapshot() of a workload Namespace once the seed is ready - Should copy the VolumeSnapshot")
+		setSnapshotReady(t, objClient, seedNs, snapshotName, seedContent.GetName())
+		_, updated, _, _, err = r.manageSnapshot(t.Context(), &gkmCache, &gkmCacheStatus, &pvcStatus, workloadNs, "1Gi")
+		require.NoError(t, err)
+		require.True(t, updated)
+		require.Equal(t, snapshotName, pvcStatus.VolumeSnapshotName)
+
+		t.Logf("TEST: manageSnapshot() before the copied VolumeSnapshot is ready - Should not create the PVC")
+		_, updated, _, pending, err = r.manageSnapshot(t.Context(), &gkmCache, &gkmCacheStatus, &pvcStatus, workloadNs, "1Gi")
+		require.NoError(t, err)
+		require.False(t, updated)
+		require.True(t, pending)
+		require.Empty(t, pvcStatus.PvcName)
+		require.True(t, gkmv1alpha1.GkmCondPending.IsConditionSet(pvcStatus.Conditions))
+
+		t.Logf("TEST: manageSnapshot() once the copied VolumeSnapshot is ready - Should create the PVC and be Extracted")
+		setSnapshotReady(t, objClient, workloadNs, snapshotName, "")
+		_, updated, _, pending, err = r.manageSnapshot(t.Context(), &gkmCache, &gkmCacheStatus, &pvcStatus, workloadNs, "1Gi")
+		require.NoError(t, err)
+		require.True(t, updated)
+		require.False(t, pending)
+		require.True(t, gkmv1alpha1.GkmCondExtracted.IsConditionSet(pvcStatus.Conditions))
+		pvc := &corev1.PersistentVolumeClaim{}
+		require.NoError(t, objClient.Get(t.Context(), types.NamespacedName{Namespace: workloadNs, Name: pvcStatus.PvcName}, pvc))
+		require.Equal(t, snapshotName, pvc.Spec.DataSource.Name)
+	})
+
+	t.Run("Test VolumeSnapshot taken again after a digest change", func(t *testing.T) {
+		gkmCacheStatus.ResolvedDigest = testSnapshotDigest2
+		newSnapshotName := common.VolumeSnapshotName(gkmCache.Name, testSnapshotDigest2)
+
+		t.Logf("TEST: manageSnapshot() of the seed after a digest change - Should replace the VolumeSnapshot")
+		handled, updated, _, _, err := r.manageSnapshot(t.Context(), &gkmCache, &gkmCacheStatus, &seedPvcStatus, seedNs, "1Gi")
+		require.NoError(t, err)
+		require.True(t, handled)
+		require.True(t, updated)
+		require.Equal(t, newSnapshotName, seedPvcStatus.VolumeSnapshotName)
+		snapshot := &unstructured.Unstructured{}
+		snapshot.SetGroupVersionKind(common.VolumeSnapshotGVK)
+		err = objClient.Get(t.Context(), types.NamespacedName{Namespace: seedNs, Name: snapshotName}, snapshot)
+		require.True(t, apierrors.IsNotFound(err))
+		require.NoError(t, objClient.Get(t.Context(), types.NamespacedName{Namespace: seedNs, Name: newSnapshotName}, snapshot))
+		require.Equal(t, testSnapshotDigest2[len(utils.DigestPrefix):][:utils.MaxLabelValueLength],
+			snapshot.GetLabels()[utils.SnapshotLabelDigest])
+
+		t.Logf("TEST: manageSnapshot() of a workload Namespace with a copy of the previous digest - Should wait for the seed")
+		pvcStatus := gkmv1alpha1.PvcStatus{PvcOwner: gkmv1alpha1.PvcOwnerOperator, VolumeSnapshotName: snapshotName}
+		gkmv1alpha1.SetPvcStatusConditions(&pvcStatus, gkmv1alpha1.GkmCondPending.Condition())
+		_, _, _, pending, err := r.manageSnapshot(t.Context(), &gkmCache, &gkmCacheStatus, &pvcStatus, workloadNs, "1Gi")
+		require.NoError(t, err)
+		require.True(t, pending)
+
+		t.Logf("TEST: manageSnapshot() once the seed is updated - Should delete the copy of the previous digest")
+		gkmCacheStatus.PvcStatus[seedNs] = seedPvcStatus
+		setSnapshotReady(t, objClient, seedNs, newSnapshotName, seedContent.GetName())
+		_, updated, _, _, err = r.manageSnapshot(t.Context(), &gkmCache, &gkmCacheStatus, &pvcStatus, workloadNs, "1Gi")
+		require.NoError(t, err)
+		require.True(t, updated)
+		require.Equal(t, newSnapshotName, pvcStatus.VolumeSnapshotName)
+		err = objClient.Get(t.Context(), types.NamespacedName{Namespace: workloadNs, Name: snapshotName}, snapshot)
+		require.True(t, apierrors.IsNotFound(err))
+	})
+}
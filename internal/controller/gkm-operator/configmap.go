@@ -85,6 +85,16 @@ func (r *GKMConfigMapReconciler) ReconcileGKMConfigMap(ctx context.Context, req
 	agentImage := gkmConfigMap.Data[utils.ConfigMapIndexAgentImage]
 	extractLogLevel := gkmConfigMap.Data[utils.ConfigMapIndexExtractLogLevel]
 	extractImage := gkmConfigMap.Data[utils.ConfigMapIndexExtractImage]
+	extractMode := gkmConfigMap.Data[utils.ConfigMapIndexExtractMode]
+	extractWorkers := gkmConfigMap.Data[utils.ConfigMapIndexExtractWorkers]
+	extractMaxPulls := gkmConfigMap.Data[utils.ConfigMapIndexExtractMaxPulls]
+	scrubInterval := gkmConfigMap.Data[utils.ConfigMapIndexScrubInterval]
+	cacheBudget := gkmConfigMap.Data[utils.ConfigMapIndexCacheBudget]
+	evictInterval := gkmConfigMap.Data[utils.ConfigMapIndexEvictInterval]
+	diskUsageInterval := gkmConfigMap.Data[utils.ConfigMapIndexDiskUsageInterval]
+	cacheDedup := gkmConfigMap.Data[utils.ConfigMapIndexCacheDedup]
+	layerCacheSize := gkmConfigMap.Data[utils.ConfigMapIndexLayerCacheSize]
+	layerPeerPort := gkmConfigMap.Data[utils.ConfigMapIndexLayerPeerPort]
 	noGpu := gkmConfigMap.Data[utils.ConfigMapIndexNoGpu]
 	kindCluster := gkmConfigMap.Data[utils.ConfigMapIndexKindCluster]
 
@@ -93,6 +103,16 @@ func (r *GKMConfigMapReconciler) ReconcileGKMConfigMap(ctx context.Context, req
 		"agentLogLevel", agentLogLevel,
 		"extractImage", extractImage,
 		"extractLogLevel", extractLogLevel,
+		"extractMode", extractMode,
+		"extractWorkers", extractWorkers,
+		"extractMaxPulls", extractMaxPulls,
+		"scrubInterval", scrubInterval,
+		"cacheBudget", cacheBudget,
+		"evictInterval", evictInterval,
+		"diskUsageInterval", diskUsageInterval,
+		"cacheDedup", cacheDedup,
+		"layerCacheSize", layerCacheSize,
+		"layerPeerPort", layerPeerPort,
 		"noGpu", noGpu,
 		"kindCluster", kindCluster,
 	)
@@ -0,0 +1,180 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gkmOperator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	gkmv1alpha1 "github.com/redhat-et/GKM/api/v1alpha1"
+	"github.com/redhat-et/GKM/pkg/common"
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+// expiryWarning returns how long before a Cache with the given TTL expires the Warning Event is
+// recorded.
+func expiryWarning(ttl time.Duration) time.Duration {
+	return min(utils.CacheExpiryWarning, ttl/2)
+}
+
+// manageExpiry applies spec.ttlSecondsAfterUnused to a GKMCache or ClusterGKMCache. It tracks
+// when the Cache stopped being used by any Pod in status.unusedSince, records a Warning Event when
+// the Cache is about to expire, and expires the Cache once it has been unused for longer than the
+// TTL. Depending on spec.ttlAction, an expired Cache is either deleted, or set to Expired so its
+// PVCs and PVs are removed from every Node. An Expired Cache is restored once a Pod references it
+// again. It returns whether the Cache Status was updated and why, whether the Cache was deleted,
+// and how long until the next expiry step, which is 0 if there is none.
+func (r *ReconcilerCommonOperator[C, CL, N, NL]) manageExpiry(
+	ctx context.Context,
+	gkmCache *C,
+	gkmCacheStatus *gkmv1alpha1.GKMCacheStatus,
+	resolvedDigest string,
+) (bool, string, bool, time.Duration, error) {
+	ttl := (*gkmCache).GetTTLSecondsAfterUnused()
+
+	if gkmv1alpha1.GkmCondExpired.IsConditionSet(gkmCacheStatus.Conditions) {
+		if ttl != nil && !r.cacheReferenced(ctx, gkmCache, resolvedDigest) {
+			return false, "", false, 0, nil
+		}
+		r.Logger.Info("Restoring expired cache",
+			"Namespace", (*gkmCache).GetNamespace(),
+			"Name", (*gkmCache).GetName())
+		r.setCacheConditions(gkmCacheStatus, gkmv1alpha1.GkmCondPending.Condition())
+		gkmCacheStatus.UnusedSince = nil
+		gkmCacheStatus.ExpiryTime = nil
+		r.recordCacheEvent(gkmCache, corev1.EventTypeNormal, gkmv1alpha1.GkmCacheEventReasonRestored,
+			fmt.Sprintf("%s %q is used again, restoring it on the nodes", r.CrdCacheStr, (*gkmCache).GetName()))
+		return true, "Restore Expired Cache", false, 0, nil
+	}
+
+	if ttl == nil || gkmCacheStatus.Counts.PodRunningCnt != 0 {
+		if gkmCacheStatus.UnusedSince == nil && gkmCacheStatus.ExpiryTime == nil {
+			return false, "", false, 0, nil
+		}
+		gkmCacheStatus.UnusedSince = nil
+		gkmCacheStatus.ExpiryTime = nil
+		return true, "Clear Unused Since", false, 0, nil
+	}
+
+	now := time.Now()
+	if gkmCacheStatus.UnusedSince == nil {
+		// The Status write triggers a new Reconcile, which schedules the next step.
+		gkmCacheStatus.UnusedSince = &metav1.Time{Time: now}
+		return true, "Set Unused Since", false, 0, nil
+	}
+
+	ttlDuration := time.Duration(*ttl) * time.Second
+	expiry := gkmCacheStatus.UnusedSince.Add(ttlDuration)
+	warning := expiry.Add(-expiryWarning(ttlDuration))
+
+	switch {
+	case !now.Before(expiry):
+		message := fmt.Sprintf("%s %q was not used for %s", r.CrdCacheStr, (*gkmCache).GetName(), ttlDuration)
+		if (*gkmCache).GetTTLAction() == gkmv1alpha1.TTLActionDelete {
+			r.Logger.Info("Deleting expired cache",
+				"Namespace", (*gkmCache).GetNamespace(),
+				"Name", (*gkmCache).GetName(),
+				"UnusedSince", gkmCacheStatus.UnusedSince)
+			r.recordCacheEvent(gkmCache, corev1.EventTypeWarning, gkmv1alpha1.GkmCacheEventReasonExpired,
+				message+", deleting it")
+			if err := r.Delete(ctx, (*gkmCache).GetClientObject()); err != nil && !errors.IsNotFound(err) {
+				return false, "", false, 0, err
+			}
+			return false, "", true, 0, nil
+		}
+
+		r.Logger.Info("Removing expired cache from nodes",
+			"Namespace", (*gkmCache).GetNamespace(),
+			"Name", (*gkmCache).GetName(),
+			"UnusedSince", gkmCacheStatus.UnusedSince)
+		r.recordCacheEvent(gkmCache, corev1.EventTypeWarning, gkmv1alpha1.GkmCacheEventReasonExpired,
+			message+", removing it from the nodes")
+		r.setCacheConditions(gkmCacheStatus, gkmv1alpha1.GkmCondExpired.Condition())
+		return true, "Set Expired Cache Condition", false, 0, nil
+
+	case !now.Before(warning):
+		if gkmCacheStatus.ExpiryTime != nil {
+			return false, "", false, expiry.Sub(now), nil
+		}
+		action := "deleted"
+		if (*gkmCache).GetTTLAction() == gkmv1alpha1.TTLActionRemoveFromNodes {
+			action = "removed from the nodes"
+		}
+		r.recordCacheEvent(gkmCache, corev1.EventTypeWarning, gkmv1alpha1.GkmCacheEventReasonExpiring,
+			fmt.Sprintf("%s %q has not been used since %s and will be %s at %s unless a Pod uses it",
+				r.CrdCacheStr, (*gkmCache).GetName(),
+				gkmCacheStatus.UnusedSince.UTC().Format(time.RFC3339), action, expiry.UTC().Format(time.RFC3339)))
+		gkmCacheStatus.ExpiryTime = &metav1.Time{Time: expiry}
+		return true, "Set Expiry Time", false, 0, nil
+
+	default:
+		return false, "", false, warning.Sub(now), nil
+	}
+}
+
+// cacheReferenced returns true if a Pod in one of the workload Namespaces of the Cache, on any
+// Node, references the PVC or Image Volume of the Cache.
+func (r *ReconcilerCommonOperator[C, CL, N, NL]) cacheReferenced(
+	ctx context.Context,
+	gkmCache *C,
+	resolvedDigest string,
+) bool {
+	for _, pvcNamespace := range (*gkmCache).GetWorkloadNamespaces() {
+		podUseCnt := 0
+		if (*gkmCache).GetMountMode() == gkmv1alpha1.MountModeImageVolume {
+			podUseCnt = common.GetImageVolumeUsedByList(
+				ctx,
+				r.Client,
+				"", // NodeName
+				pvcNamespace,
+				resolvedDigest,
+				r.Logger,
+			)
+		} else {
+			podUseCnt = common.GetPvcUsedByList(
+				ctx,
+				r.Client,
+				"", // NodeName
+				pvcNamespace,
+				(*gkmCache).GetName(), /* PvcName: Serving PVC has same name as Cache */
+				r.Logger,
+			)
+		}
+		if podUseCnt != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// recordCacheEvent records an Event on the GKMCache or ClusterGKMCache, if a Recorder is set.
+func (r *ReconcilerCommonOperator[C, CL, N, NL]) recordCacheEvent(
+	gkmCache *C,
+	eventType string,
+	reason gkmv1alpha1.GkmCacheEventReason,
+	message string,
+) {
+	if r.Recorder == nil {
+		return
+	}
+	r.Recorder.Event((*gkmCache).GetClientObject(), eventType, string(reason), message)
+}
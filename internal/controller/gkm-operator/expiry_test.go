@@ -0,0 +1,192 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gkmOperator
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	gkmv1alpha1 "github.com/redhat-et/GKM/api/v1alpha1"
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+const testExpiryDigest = "sha256:bf6f7ea60274882031ad81434aa9c9ac0e4ff280cd1513db239dbbd705b6511c"
+
+func TestManageExpiry(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, gkmv1alpha1.AddToScheme(scheme))
+
+	ttl := int64(3600)
+	newCache := func(action gkmv1alpha1.TTLAction) gkmv1alpha1.GKMCache {
+		return gkmv1alpha1.GKMCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "vector-add", Namespace: "ns1"},
+			Spec: gkmv1alpha1.GKMCacheSpec{
+				Image:                 "quay.io/gkm/cache-examples:vector-add-cache-rocm-v2-rocm",
+				TTLSecondsAfterUnused: &ttl,
+				TTLAction:             action,
+			},
+		}
+	}
+	newReconciler := func(objs ...client.Object) (*ReconcilerCommonOperator[
+		gkmv1alpha1.GKMCache,
+		gkmv1alpha1.GKMCacheList,
+		gkmv1alpha1.GKMCacheNode,
+		gkmv1alpha1.GKMCacheNodeList,
+	], *record.FakeRecorder) {
+		recorder := record.NewFakeRecorder(10)
+		return &ReconcilerCommonOperator[
+			gkmv1alpha1.GKMCache,
+			gkmv1alpha1.GKMCacheList,
+			gkmv1alpha1.GKMCacheNode,
+			gkmv1alpha1.GKMCacheNodeList,
+		]{
+			Client:      fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build(),
+			Logger:      logr.Discard(),
+			Recorder:    recorder,
+			CrdCacheStr: utils.CrdGKMCache,
+		}, recorder
+	}
+
+	t.Run("Test tracking of an unused cache", func(t *testing.T) {
+		gkmCache := newCache(gkmv1alpha1.TTLActionDelete)
+		r, recorder := newReconciler()
+		status := &gkmv1alpha1.GKMCacheStatus{}
+
+		t.Logf("TEST: manageExpiry() of an unused cache - Should set unusedSince")
+		updated, updateReason, deleted, requeueAfter, err := r.manageExpiry(t.Context(), &gkmCache, status, testExpiryDigest)
+		require.NoError(t, err)
+		require.True(t, updated, updateReason)
+		require.False(t, deleted)
+		require.Zero(t, requeueAfter)
+		require.NotNil(t, status.UnusedSince)
+
+		t.Logf("TEST: manageExpiry() before the warning - Should requeue at the warning")
+		updated, _, deleted, requeueAfter, err = r.manageExpiry(t.Context(), &gkmCache, status, testExpiryDigest)
+		require.NoError(t, err)
+		require.False(t, updated)
+		require.False(t, deleted)
+		require.InDelta(t, (30 * time.Minute).Seconds(), requeueAfter.Seconds(), 5)
+		require.Empty(t, recorder.Events)
+
+		t.Logf("TEST: manageExpiry() of a cache in use - Should clear unusedSince")
+		status.Counts.PodRunningCnt = 1
+		updated, updateReason, _, requeueAfter, err = r.manageExpiry(t.Context(), &gkmCache, status, testExpiryDigest)
+		require.NoError(t, err)
+		require.True(t, updated, updateReason)
+		require.Zero(t, requeueAfter)
+		require.Nil(t, status.UnusedSince)
+
+		t.Logf("TEST: manageExpiry() of a cache without a TTL - Should do nothing")
+		gkmCache.Spec.TTLSecondsAfterUnused = nil
+		status.Counts.PodRunningCnt = 0
+		updated, _, _, requeueAfter, err = r.manageExpiry(t.Context(), &gkmCache, status, testExpiryDigest)
+		require.NoError(t, err)
+		require.False(t, updated)
+		require.Zero(t, requeueAfter)
+		require.Nil(t, status.UnusedSince)
+	})
+
+	t.Run("Test warning and deletion of an expired cache", func(t *testing.T) {
+		gkmCache := newCache(gkmv1alpha1.TTLActionDelete)
+		r, recorder := newReconciler(&gkmCache)
+		status := &gkmv1alpha1.GKMCacheStatus{
+			UnusedSince: &metav1.Time{Time: time.Now().Add(-50 * time.Minute)},
+		}
+
+		t.Logf("TEST: manageExpiry() within the warning period - Should set expiryTime and record a Warning")
+		updated, updateReason, deleted, _, err := r.manageExpiry(t.Context(), &gkmCache, status, testExpiryDigest)
+		require.NoError(t, err)
+		require.True(t, updated, updateReason)
+		require.False(t, deleted)
+		require.NotNil(t, status.ExpiryTime)
+		require.Len(t, recorder.Events, 1)
+		event := <-recorder.Events
+		require.True(t, strings.HasPrefix(event, "Warning Expiring"), event)
+		require.Contains(t, event, "will be deleted")
+
+		t.Logf("TEST: manageExpiry() after the warning - Should requeue at the expiry without another Warning")
+		updated, _, _, requeueAfter, err := r.manageExpiry(t.Context(), &gkmCache, status, testExpiryDigest)
+		require.NoError(t, err)
+		require.False(t, updated)
+		require.InDelta(t, (10 * time.Minute).Seconds(), requeueAfter.Seconds(), 5)
+		require.Empty(t, recorder.Events)
+
+		t.Logf("TEST: manageExpiry() past the TTL - Should delete the cache")
+		status.UnusedSince = &metav1.Time{Time: time.Now().Add(-2 * time.Hour)}
+		_, _, deleted, _, err = r.manageExpiry(t.Context(), &gkmCache, status, testExpiryDigest)
+		require.NoError(t, err)
+		require.True(t, deleted)
+		require.True(t, strings.HasPrefix(<-recorder.Events, "Warning Expired"))
+		err = r.Get(t.Context(), client.ObjectKeyFromObject(&gkmCache), &gkmv1alpha1.GKMCache{})
+		require.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("Test removal and restore of an expired cache", func(t *testing.T) {
+		gkmCache := newCache(gkmv1alpha1.TTLActionRemoveFromNodes)
+		r, recorder := newReconciler(&gkmCache)
+		status := &gkmv1alpha1.GKMCacheStatus{
+			UnusedSince: &metav1.Time{Time: time.Now().Add(-2 * time.Hour)},
+		}
+
+		t.Logf("TEST: manageExpiry() past the TTL - Should set the Expired condition and keep the cache")
+		updated, updateReason, deleted, _, err := r.manageExpiry(t.Context(), &gkmCache, status, testExpiryDigest)
+		require.NoError(t, err)
+		require.True(t, updated, updateReason)
+		require.False(t, deleted)
+		require.True(t, gkmv1alpha1.GkmCondExpired.IsConditionSet(status.Conditions))
+		require.Contains(t, <-recorder.Events, "removing it from the nodes")
+		require.NoError(t, r.Get(t.Context(), client.ObjectKeyFromObject(&gkmCache), &gkmv1alpha1.GKMCache{}))
+
+		t.Logf("TEST: manageExpiry() of an Expired cache not referenced by a Pod - Should stay Expired")
+		updated, _, _, _, err = r.manageExpiry(t.Context(), &gkmCache, status, testExpiryDigest)
+		require.NoError(t, err)
+		require.False(t, updated)
+
+		t.Logf("TEST: manageExpiry() of an Expired cache referenced by a Pod - Should restore the cache")
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "ns1"},
+			Spec: corev1.PodSpec{
+				Volumes: []corev1.Volume{{
+					Name: "cache",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "vector-add"},
+					},
+				}},
+			},
+		}
+		require.NoError(t, r.Create(t.Context(), pod))
+		updated, updateReason, _, _, err = r.manageExpiry(t.Context(), &gkmCache, status, testExpiryDigest)
+		require.NoError(t, err)
+		require.True(t, updated, updateReason)
+		require.True(t, gkmv1alpha1.GkmCondPending.IsConditionSet(status.Conditions))
+		require.Nil(t, status.UnusedSince)
+		require.True(t, strings.HasPrefix(<-recorder.Events, "Normal Restored"))
+	})
+}
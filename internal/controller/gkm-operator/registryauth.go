@@ -0,0 +1,172 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gkmOperator
+
+import (
+	"bytes"
+	"context"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+// registryAuthSecret returns the name of the copy of the image pull Secrets of gkmCache made by
+// manageRegistryAuth(), or "" if gkmCache has no image pull Secrets.
+func registryAuthSecret[C GKMInstance](gkmCache *C) string {
+	if _, names := (*gkmCache).GetImagePullSecrets(); len(names) == 0 {
+		return ""
+	}
+	return utils.RegistryAuthSecretName((*gkmCache).GetClientObject().GetUID())
+}
+
+// registryAuthNamespaces returns the Namespaces the image pull Secrets of gkmCache are copied
+// to: the Workload Namespaces, where the extraction Jobs run, and the GKM Namespace, where the
+// Agents read them. The GKM Namespace is last, so its copy is the last one removed.
+func registryAuthNamespaces[C GKMInstance](gkmCache *C) []string {
+	namespaces := []string{}
+	for _, namespace := range (*gkmCache).GetWorkloadNamespaces() {
+		if namespace != utils.GKMDefaultNamespace && !slices.Contains(namespaces, namespace) {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return append(namespaces, utils.GKMDefaultNamespace)
+}
+
+// secretReader returns the reader of Secrets, which are not cached by the Client.
+func (r *ReconcilerCommonOperator[C, CL, N, NL]) secretReader() client.Reader {
+	if r.SecretReader == nil {
+		return r.Client
+	}
+	return r.SecretReader
+}
+
+// manageRegistryAuth copies the registry credentials in the image pull Secrets of gkmCache,
+// merged into a single Docker config.json, to the Namespaces returned by
+// registryAuthNamespaces(). The Agents only read the copy in the GKM Namespace, so they need no
+// access to the Secrets of the other Namespaces, and the extraction Jobs mount the copy in their
+// Namespace, so the Agents never create Secrets. The copies are updated when the image pull
+// Secrets change, and removed when gkmCache no longer has any.
+func (r *ReconcilerCommonOperator[C, CL, N, NL]) manageRegistryAuth(ctx context.Context, gkmCache *C) error {
+	namespace, names := (*gkmCache).GetImagePullSecrets()
+	if len(names) == 0 {
+		// Copies are only left behind if the image pull Secrets were removed from gkmCache.
+		secretName := utils.RegistryAuthSecretName((*gkmCache).GetClientObject().GetUID())
+		err := r.secretReader().Get(ctx,
+			types.NamespacedName{Namespace: utils.GKMDefaultNamespace, Name: secretName}, &corev1.Secret{})
+		if errors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return r.deleteRegistryAuth(ctx, gkmCache)
+	}
+
+	registryAuth, err := utils.RegistryAuth(ctx, r.secretReader(), namespace, names)
+	if err != nil {
+		r.Logger.Error(err, "unable to read image pull secrets",
+			"Namespace", (*gkmCache).GetNamespace(),
+			"Name", (*gkmCache).GetName())
+		return err
+	}
+
+	for _, copyNamespace := range registryAuthNamespaces(gkmCache) {
+		namespaceExists, namespaceDeleting, err := r.namespaceExists(ctx, copyNamespace)
+		if err != nil {
+			return err
+		}
+		if !namespaceExists || namespaceDeleting {
+			continue
+		}
+		if err := r.copyRegistryAuth(ctx, gkmCache, copyNamespace, registryAuth); err != nil {
+			r.Logger.Error(err, "unable to copy registry credentials",
+				"Namespace", (*gkmCache).GetNamespace(),
+				"Name", (*gkmCache).GetName(),
+				"Secret Namespace", copyNamespace)
+			return err
+		}
+	}
+	return nil
+}
+
+// copyRegistryAuth creates or updates the copy of the registry credentials of gkmCache in
+// namespace. The copy is owned by gkmCache when owner references allow it, which is always for a
+// ClusterGKMCache, and only in its own Namespace for a GKMCache. The other copies are removed by
+// deleteRegistryAuth().
+func (r *ReconcilerCommonOperator[C, CL, N, NL]) copyRegistryAuth(
+	ctx context.Context,
+	gkmCache *C,
+	namespace string,
+	registryAuth []byte,
+) error {
+	secretName := registryAuthSecret(gkmCache)
+
+	secret := &corev1.Secret{}
+	err := r.secretReader().Get(ctx, types.NamespacedName{Namespace: namespace, Name: secretName}, secret)
+	if err == nil {
+		if bytes.Equal(secret.Data[utils.JobExtractAuthFileName], registryAuth) {
+			return nil
+		}
+		secret.Data = map[string][]byte{utils.JobExtractAuthFileName: registryAuth}
+		r.Logger.Info("Updating registry credentials", "Secret Namespace", namespace, "Secret Name", secretName)
+		return r.Client.Update(ctx, secret)
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secretName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				utils.RegistryAuthLabelCache:          (*gkmCache).GetName(),
+				utils.RegistryAuthLabelCacheNamespace: (*gkmCache).GetNamespace(),
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{utils.JobExtractAuthFileName: registryAuth},
+	}
+	if cacheNamespace := (*gkmCache).GetNamespace(); cacheNamespace == "" || cacheNamespace == namespace {
+		if err := controllerutil.SetOwnerReference((*gkmCache).GetClientObject(), secret, r.Scheme); err != nil {
+			return err
+		}
+	}
+	r.Logger.Info("Copying registry credentials", "Secret Namespace", namespace, "Secret Name", secretName)
+	return r.Client.Create(ctx, secret)
+}
+
+// deleteRegistryAuth removes the copies of the registry credentials of gkmCache.
+func (r *ReconcilerCommonOperator[C, CL, N, NL]) deleteRegistryAuth(ctx context.Context, gkmCache *C) error {
+	secretName := utils.RegistryAuthSecretName((*gkmCache).GetClientObject().GetUID())
+	for _, namespace := range registryAuthNamespaces(gkmCache) {
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: secretName, Namespace: namespace}}
+		if err := r.Client.Delete(ctx, secret); err != nil && !errors.IsNotFound(err) {
+			r.Logger.Error(err, "unable to delete registry credentials",
+				"Namespace", (*gkmCache).GetNamespace(),
+				"Name", (*gkmCache).GetName(),
+				"Secret Namespace", namespace)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gkmOperator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	gkmv1alpha1 "github.com/redhat-et/GKM/api/v1alpha1"
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+func TestManageRegistryAuth(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, gkmv1alpha1.AddToScheme(scheme))
+
+	pullSecret := func(namespace, registry string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "quay-pull", Namespace: namespace},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{
+				corev1.DockerConfigJsonKey: []byte(`{"auths":{"` + registry + `":{"auth":"cXVheTpw"}}}`),
+			},
+		}
+	}
+	newClient := func(objs ...client.Object) client.Client {
+		objs = append(objs,
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: utils.GKMDefaultNamespace}},
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns1"}},
+		)
+		return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	}
+	getCopy := func(objClient client.Client, namespace, uid string) (*corev1.Secret, error) {
+		secret := &corev1.Secret{}
+		err := objClient.Get(ctx, types.NamespacedName{
+			Namespace: namespace,
+			Name:      utils.RegistryAuthSecretName(types.UID(uid)),
+		}, secret)
+		return secret, err
+	}
+
+	t.Run("Test GKMCache image pull Secrets copied", func(t *testing.T) {
+		objClient := newClient(pullSecret("ns1", "quay.io"))
+		r := &ReconcilerCommonOperator[
+			gkmv1alpha1.GKMCache,
+			gkmv1alpha1.GKMCacheList,
+			gkmv1alpha1.GKMCacheNode,
+			gkmv1alpha1.GKMCacheNodeList,
+		]{
+			Client:      objClient,
+			Scheme:      scheme,
+			Logger:      logr.Discard(),
+			CrdCacheStr: utils.CrdGKMCache,
+		}
+		gkmCache := gkmv1alpha1.GKMCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "vector-add", Namespace: "ns1", UID: "1234"},
+			Spec: gkmv1alpha1.GKMCacheSpec{
+				Image:            "quay.io/example/vector-add:latest",
+				ImagePullSecrets: []corev1.LocalObjectReference{{Name: "quay-pull"}},
+			},
+		}
+
+		t.Logf("TEST: manageRegistryAuth() - Should copy the credentials to the GKM and Cache Namespaces")
+		require.NoError(t, r.manageRegistryAuth(ctx, &gkmCache))
+		registryAuth, err := utils.RegistryAuth(ctx, objClient, "ns1", []string{"quay-pull"})
+		require.NoError(t, err)
+		agentCopy, err := getCopy(objClient, utils.GKMDefaultNamespace, "1234")
+		require.NoError(t, err)
+		require.Equal(t, registryAuth, agentCopy.Data[utils.JobExtractAuthFileName])
+		require.Empty(t, agentCopy.OwnerReferences)
+		jobCopy, err := getCopy(objClient, "ns1", "1234")
+		require.NoError(t, err)
+		require.Equal(t, registryAuth, jobCopy.Data[utils.JobExtractAuthFileName])
+		require.Len(t, jobCopy.OwnerReferences, 1)
+		require.Equal(t, "vector-add", jobCopy.OwnerReferences[0].Name)
+
+		t.Logf("TEST: manageRegistryAuth() after the image pull Secret changed - Should update the copies")
+		require.NoError(t, objClient.Update(ctx, pullSecret("ns1", "ghcr.io")))
+		require.NoError(t, r.manageRegistryAuth(ctx, &gkmCache))
+		registryAuth, err = utils.RegistryAuth(ctx, objClient, "ns1", []string{"quay-pull"})
+		require.NoError(t, err)
+		for _, namespace := range []string{utils.GKMDefaultNamespace, "ns1"} {
+			secret, err := getCopy(objClient, namespace, "1234")
+			require.NoError(t, err)
+			require.Equal(t, registryAuth, secret.Data[utils.JobExtractAuthFileName])
+		}
+
+		t.Logf("TEST: manageRegistryAuth() after the image pull Secrets were removed - Should remove the copies")
+		gkmCache.Spec.ImagePullSecrets = nil
+		require.NoError(t, r.manageRegistryAuth(ctx, &gkmCache))
+		for _, namespace := range []string{utils.GKMDefaultNamespace, "ns1"} {
+			_, err := getCopy(objClient, namespace, "1234")
+			require.True(t, apierrors.IsNotFound(err))
+		}
+	})
+
+	t.Run("Test ClusterGKMCache image pull Secrets copied", func(t *testing.T) {
+		objClient := newClient(pullSecret(utils.GKMDefaultNamespace, "quay.io"))
+		r := &ReconcilerCommonOperator[
+			gkmv1alpha1.ClusterGKMCache,
+			gkmv1alpha1.ClusterGKMCacheList,
+			gkmv1alpha1.ClusterGKMCacheNode,
+			gkmv1alpha1.ClusterGKMCacheNodeList,
+		]{
+			Client:      objClient,
+			Scheme:      scheme,
+			Logger:      logr.Discard(),
+			CrdCacheStr: utils.CrdClusterGKMCache,
+		}
+		gkmCache := gkmv1alpha1.ClusterGKMCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "vector-add", UID: "5678"},
+			Spec: gkmv1alpha1.GKMCacheSpec{
+				Image:                     "quay.io/example/vector-add:latest",
+				ImagePullSecrets:          []corev1.LocalObjectReference{{Name: "quay-pull"}},
+				ImagePullSecretsNamespace: utils.GKMDefaultNamespace,
+				WorkloadNamespaces:        []string{"ns1", "ns2"},
+			},
+		}
+
+		t.Logf("TEST: manageRegistryAuth() - Should copy the credentials to the existing Namespaces, owned by the Cache")
+		require.NoError(t, r.manageRegistryAuth(ctx, &gkmCache))
+		for _, namespace := range []string{utils.GKMDefaultNamespace, "ns1"} {
+			secret, err := getCopy(objClient, namespace, "5678")
+			require.NoError(t, err)
+			require.Len(t, secret.OwnerReferences, 1)
+			require.Equal(t, "ClusterGKMCache", secret.OwnerReferences[0].Kind)
+		}
+		_, err := getCopy(objClient, "ns2", "5678")
+		require.True(t, apierrors.IsNotFound(err))
+
+		t.Logf("TEST: deleteRegistryAuth() - Should remove the copies")
+		require.NoError(t, r.deleteRegistryAuth(ctx, &gkmCache))
+		for _, namespace := range []string{utils.GKMDefaultNamespace, "ns1"} {
+			_, err := getCopy(objClient, namespace, "5678")
+			require.True(t, apierrors.IsNotFound(err))
+		}
+	})
+}
@@ -5,10 +5,11 @@ import (
 	"os"
 
 	"github.com/containers/buildah"
-	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/redhat-et/GKM/mcv/pkg/client"
 	"github.com/redhat-et/GKM/mcv/pkg/config"
+	"github.com/redhat-et/GKM/mcv/pkg/constants"
 	"github.com/redhat-et/GKM/mcv/pkg/imgbuild"
+	"github.com/redhat-et/GKM/mcv/pkg/localimage"
 	"github.com/redhat-et/GKM/mcv/pkg/logformat"
 	"github.com/redhat-et/GKM/mcv/pkg/utils"
 	logging "github.com/sirupsen/logrus"
@@ -56,6 +57,11 @@ func buildRootCommand() *cobra.Command {
 	var imageName, cacheDirName, logLevel, builder string
 	var createFlag, extractFlag, baremetalFlag, noGPUFlag, checkCompatFlag, gpuInfoFlag, stubFlag, versionFlag bool
 	var timeout int
+	var limits extractLimitFlags
+	var layerCache layerCacheFlags
+	var registries registryFlags
+	var pushFlag bool
+	var sign signFlags
 
 	cmd := &cobra.Command{
 		Use:   "mcv",
@@ -73,18 +79,39 @@ and performing hardware compatibility checks.`,
 				fmt.Printf("mcv version %s\n", version)
 				os.Exit(exitNormal)
 			}
-			handleRunCommand(imageName, cacheDirName, logLevel, builder, createFlag, extractFlag, baremetalFlag, noGPUFlag, checkCompatFlag, gpuInfoFlag, stubFlag, timeout)
+			configureLayerCache(layerCache)
+			configureRegistries(registries)
+			if err := validatePushFlags(createFlag, pushFlag, imageName, builder, sign); err != nil {
+				logging.Error(err)
+				os.Exit(exitLogError)
+			}
+			if pushFlag {
+				if err := validateFlagCombinations(createFlag, extractFlag, gpuInfoFlag, checkCompatFlag, imageName, cacheDirName, stubFlag); err != nil {
+					logging.Error(err)
+					os.Exit(exitLogError)
+				}
+				// The image is built and pushed without a daemon, like mcv push.
+				runPush(pushFlags{imageName: imageName, cacheDir: cacheDirName}, sign)
+				return
+			}
+			handleRunCommand(imageName, cacheDirName, logLevel, builder, createFlag, extractFlag, baremetalFlag, noGPUFlag, checkCompatFlag, gpuInfoFlag, stubFlag, timeout, limits)
 		},
 	}
 
 	addFlags(cmd, &imageName, &cacheDirName, &logLevel, &builder, &createFlag, &extractFlag, &baremetalFlag, &noGPUFlag, &checkCompatFlag, &gpuInfoFlag, &stubFlag, &timeout)
+	addExtractLimitFlags(cmd, &limits)
+	addLayerCacheFlags(cmd, &layerCache)
+	addRegistryFlags(cmd, &registries)
+	cmd.Flags().BoolVar(&pushFlag, "push", false, "Push the image created with --create to its registry without a daemon, and print its digest reference")
+	addSignFlags(cmd, &sign)
 	cmd.Flags().BoolVar(&versionFlag, "version", false, "Display the version of the application")
+	cmd.AddCommand(buildPushCommand())
 	return cmd
 }
 
 func addFlags(cmd *cobra.Command, imageName, cacheDirName, logLevel, builder *string, createFlag, extractFlag, baremetalFlag, noGPUFlag, checkCompatFlag, gpuInfoFlag, stubFlag *bool, timeout *int) {
 	// Image operations
-	cmd.Flags().StringVarP(imageName, "image", "i", "", "OCI image name (required for create, extract, check-compat)")
+	cmd.Flags().StringVarP(imageName, "image", "i", "", "OCI image name, or oci:<path>[:<ref>], oci-archive:<path>[:<ref>] or docker-archive:<path>[:<name:tag>] (required for create, extract, check-compat)")
 	cmd.Flags().StringVarP(cacheDirName, "dir", "d", "", "Triton/vLLM cache directory path")
 
 	// Actions (mutually exclusive main operations)
@@ -96,7 +123,7 @@ func addFlags(cmd *cobra.Command, imageName, cacheDirName, logLevel, builder *st
 	cmd.Flags().BoolVar(checkCompatFlag, "check-compat", false, "Check GPU compatibility with specified image")
 
 	// Configuration options
-	cmd.Flags().StringVarP(logLevel, "log-level", "l", "info", "Set logging verbosity (debug, info, warning, error)")
+	cmd.PersistentFlags().StringVarP(logLevel, "log-level", "l", "info", "Set logging verbosity (debug, info, warning, error)")
 	cmd.Flags().BoolVarP(baremetalFlag, "baremetal", "b", false, "Enable detailed baremetal preflight checks")
 	cmd.Flags().BoolVar(noGPUFlag, "no-gpu", false, "Disable GPU detection and preflight checks (for testing)")
 	cmd.Flags().BoolVar(stubFlag, "stub", false, "Use mock/stub data for hardware info (for testing)")
@@ -109,7 +136,73 @@ func addFlags(cmd *cobra.Command, imageName, cacheDirName, logLevel, builder *st
 	cmd.MarkFlagsMutuallyExclusive("no-gpu", "check-compat")
 }
 
-func handleRunCommand(imageName, cacheDirName, logLevel, builder string, createFlag, extractFlag, baremetalFlag, noGPUFlag, checkCompatFlag, gpuInfoFlag, stubFlag bool, timeout int) {
+// extractLimitFlags holds the limits applied to the image content with --extract.
+type extractLimitFlags struct {
+	maxBytes     int64
+	maxFiles     int
+	maxFileBytes int64
+}
+
+func addExtractLimitFlags(cmd *cobra.Command, limits *extractLimitFlags) {
+	cmd.Flags().Int64Var(&limits.maxBytes, "max-extract-bytes", 0, "Maximum bytes of cache files to extract (0 = default of 32GiB, -1 = no limit)")
+	cmd.Flags().IntVar(&limits.maxFiles, "max-extract-files", 0, "Maximum number of files to extract (0 = default of 200000, -1 = no limit)")
+	cmd.Flags().Int64Var(&limits.maxFileBytes, "max-extract-file-bytes", 0, "Maximum size of a single extracted file (0 = default of 4GiB, -1 = no limit)")
+}
+
+// layerCacheFlags holds the location and size of the local cache of fetched image layers, the
+// layer servers of other hosts to fetch missing layers from, and the container runtime to read
+// the images it already pulled from.
+type layerCacheFlags struct {
+	dir       string
+	maxBytes  int64
+	peers     []string
+	criSocket string
+}
+
+func addLayerCacheFlags(cmd *cobra.Command, layerCache *layerCacheFlags) {
+	cmd.Flags().StringVar(&layerCache.dir, "layer-cache-dir", "", "Directory caching fetched image layers by digest (default ~/.cache/mcv/layers)")
+	cmd.Flags().Int64Var(&layerCache.maxBytes, "layer-cache-size", 0, "Maximum size of the layer cache in bytes (0 = default of 10GiB, -1 = disable the cache)")
+	cmd.Flags().StringSliceVar(&layerCache.peers, "layer-peers", nil, "Base URLs of layer servers to fetch missing layers from before the registry (e.g. http://10.0.0.2:8095)")
+	cmd.Flags().StringVar(&layerCache.criSocket, "cri-socket", "", "Socket of the container runtime to read images it already pulled from (default /run/containerd/containerd.sock if it exists, \"none\" to disable)")
+}
+
+// configureLayerCache applies the layer cache flags, used by --extract and --check-compat.
+func configureLayerCache(layerCache layerCacheFlags) {
+	if layerCache.dir != "" {
+		constants.LayerCacheDir = layerCache.dir
+	}
+	constants.LayerCacheMaxBytes = layerCache.maxBytes
+	constants.LayerPeers = layerCache.peers
+	constants.CRISocket = layerCache.criSocket
+}
+
+// registryFlags holds the registries configuration and credentials images are pulled with.
+type registryFlags struct {
+	conf     string
+	certsDir string
+	caBundle string
+	authFile string
+}
+
+func addRegistryFlags(cmd *cobra.Command, registries *registryFlags) {
+	cmd.Flags().StringVar(&registries.conf, "registries-conf", "", "registries.conf with the registry mirrors, insecure and blocked registries (default the registries.conf of the host)")
+	cmd.Flags().StringVar(&registries.certsDir, "registry-certs-dir", "", "Directory of the CA certificates of each registry as <host[:port]>/*.crt (default /etc/containers/certs.d)")
+	cmd.Flags().StringVar(&registries.caBundle, "registry-ca-bundle", "", "PEM file of CA certificates trusted for every registry")
+	cmd.Flags().StringVar(&registries.authFile, "authfile", "", "Docker config.json or Podman auth.json with registry credentials (default $REGISTRY_AUTH_FILE)")
+}
+
+// configureRegistries applies the registry flags, used by --extract and --check-compat.
+func configureRegistries(registries registryFlags) {
+	constants.RegistriesConf = registries.conf
+	constants.RegistryCertsDir = registries.certsDir
+	constants.RegistryCABundle = registries.caBundle
+	constants.RegistryAuthFile = registries.authFile
+	if constants.RegistryAuthFile == "" {
+		constants.RegistryAuthFile = os.Getenv("REGISTRY_AUTH_FILE")
+	}
+}
+
+func handleRunCommand(imageName, cacheDirName, logLevel, builder string, createFlag, extractFlag, baremetalFlag, noGPUFlag, checkCompatFlag, gpuInfoFlag, stubFlag bool, timeout int, limits extractLimitFlags) {
 	// Validate flag combinations
 	if err := validateFlagCombinations(createFlag, extractFlag, gpuInfoFlag, checkCompatFlag, imageName, cacheDirName, stubFlag); err != nil {
 		logging.Error(err)
@@ -135,7 +228,7 @@ func handleRunCommand(imageName, cacheDirName, logLevel, builder string, createF
 	}
 
 	if extractFlag {
-		runExtract(imageName, cacheDirName, logLevel, baremetalFlag)
+		runExtract(imageName, cacheDirName, logLevel, baremetalFlag, limits)
 		return
 	}
 
@@ -174,9 +267,8 @@ func validateFlagCombinations(createFlag, extractFlag, gpuInfoFlag, checkCompatF
 
 	// Validate imageName against imageNameRegex
 	if imageName != "" {
-		_, err := name.ParseReference(imageName, name.StrictValidation)
-		if err != nil {
-			return fmt.Errorf("error validating image name: %v", err)
+		if err := client.ValidateImageName(imageName); err != nil {
+			return err
 		}
 	}
 
@@ -193,6 +285,27 @@ func validateFlagCombinations(createFlag, extractFlag, gpuInfoFlag, checkCompatF
 	return nil
 }
 
+// validatePushFlags checks that --push is only used to create registry images, and the signing
+// flags only with --push.
+func validatePushFlags(createFlag, pushFlag bool, imageName, builder string, sign signFlags) error {
+	if !pushFlag {
+		if sign.requested() {
+			return fmt.Errorf("--sign, --key, --identity-token, --fulcio-url and --rekor-url require --create --push")
+		}
+		return nil
+	}
+	if !createFlag {
+		return fmt.Errorf("--push can only be used with --create")
+	}
+	if builder != "" {
+		return fmt.Errorf("--builder cannot be used with --push")
+	}
+	if localimage.IsLocal(imageName) {
+		return fmt.Errorf("--push cannot be used with %s", imageName)
+	}
+	return nil
+}
+
 func handleGPUInfo(timeout int) {
 	stub := config.IsStubEnabled()
 	summary, err := client.GetSystemGPUInfo(client.HwOptions{EnableStub: &stub, Timeout: timeout})
@@ -260,10 +373,18 @@ func runCreate(imageName, cacheDir, builder string) {
 	// Initialize the image builder
 	var builderInstance imgbuild.ImageBuilder
 	var err error
-	if builder == "" {
+	switch {
+	case localimage.IsLocal(imageName):
+		// OCI layouts and archives are written without a daemon.
+		if builder != "" {
+			logging.Errorf("--builder cannot be used with %s", imageName)
+			os.Exit(exitCreateError)
+		}
+		builderInstance = imgbuild.NewLocal()
+	case builder == "":
 		// Default to old behavior: auto-detect builder
 		builderInstance, err = imgbuild.New()
-	} else {
+	default:
 		builderInstance, err = imgbuild.NewWithBuilder(builder)
 	}
 
@@ -281,14 +402,27 @@ func runCreate(imageName, cacheDir, builder string) {
 	logging.Info("OCI image created successfully.")
 }
 
-func runExtract(imageName, cacheDir, logLevel string, baremetalFlag bool) {
+func runExtract(imageName, cacheDir, logLevel string, baremetalFlag bool, limits extractLimitFlags) {
 	gpuEnabled := config.IsGPUEnabled()
 	opts := client.Options{
-		ImageName:       imageName,
-		CacheDir:        cacheDir,
-		EnableGPU:       &gpuEnabled,
-		LogLevel:        logLevel,
-		EnableBaremetal: &baremetalFlag,
+		ImageName:           imageName,
+		CacheDir:            cacheDir,
+		EnableGPU:           &gpuEnabled,
+		LogLevel:            logLevel,
+		EnableBaremetal:     &baremetalFlag,
+		MaxExtractBytes:     limits.maxBytes,
+		MaxExtractFiles:     limits.maxFiles,
+		MaxExtractFileBytes: limits.maxFileBytes,
+
+		LayerCacheDir:      constants.LayerCacheDir,
+		LayerCacheMaxBytes: constants.LayerCacheMaxBytes,
+		LayerPeers:         constants.LayerPeers,
+		CRISocket:          constants.CRISocket,
+
+		RegistriesConf:   constants.RegistriesConf,
+		RegistryCertsDir: constants.RegistryCertsDir,
+		RegistryCABundle: constants.RegistryCABundle,
+		RegistryAuthFile: constants.RegistryAuthFile,
 	}
 	if _, _, err := client.ExtractCache(opts); err != nil {
 		logging.Errorf("Error extracting image: %v", err)
@@ -50,6 +50,25 @@ func TestValidateFlagCombinations(t *testing.T) {
 			cacheDirName: testCacheDirName,
 			expectError:  true,
 		},
+		{
+			name:         "Valid create flag with OCI layout",
+			createFlag:   true,
+			imageName:    "oci:/tmp/cache-layout:vector-add",
+			cacheDirName: testCacheDirName,
+			expectError:  false,
+		},
+		{
+			name:        "Valid extract flag with Docker archive",
+			extractFlag: true,
+			imageName:   "docker-archive:/tmp/cache.tar:quay.io/gkm/cache-examples:vector-add-cache-cuda",
+			expectError: false,
+		},
+		{
+			name:        "Invalid Docker archive reference",
+			extractFlag: true,
+			imageName:   "docker-archive:/tmp/cache.tar:Invalid_Name",
+			expectError: true,
+		},
 		{
 			name:        "Stub flag without gpu-info",
 			stubFlag:    true,
@@ -73,6 +92,35 @@ func TestValidateFlagCombinations(t *testing.T) {
 	}
 }
 
+func TestValidatePushFlags(t *testing.T) {
+	tests := []struct {
+		name        string
+		createFlag  bool
+		pushFlag    bool
+		imageName   string
+		builder     string
+		sign        signFlags
+		expectError bool
+	}{
+		{name: "Create without push", createFlag: true, imageName: testImageName},
+		{name: "Create and push", createFlag: true, pushFlag: true, imageName: testImageName},
+		{name: "Create, push and sign with a key", createFlag: true, pushFlag: true, imageName: testImageName, sign: signFlags{key: "cosign.key"}},
+		{name: "Push without create", pushFlag: true, imageName: testImageName, expectError: true},
+		{name: "Push with a builder", createFlag: true, pushFlag: true, imageName: testImageName, builder: "docker", expectError: true},
+		{name: "Push to a local image", createFlag: true, pushFlag: true, imageName: "oci-archive:cache.tar", expectError: true},
+		{name: "Sign without push", createFlag: true, imageName: testImageName, sign: signFlags{sign: true}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePushFlags(tt.createFlag, tt.pushFlag, tt.imageName, tt.builder, tt.sign)
+			if (err != nil) != tt.expectError {
+				t.Errorf("Expected error: %v, got: %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
 // TestConfigureBoolFlagsNoGPU verifies that configureBoolFlags disables GPU
 // detection when noGPUFlag is true, and re-enables it when noGPUFlag is false.
 func TestConfigureBoolFlagsNoGPU(t *testing.T) {
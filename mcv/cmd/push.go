@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/redhat-et/GKM/mcv/pkg/imgbuild"
+	"github.com/redhat-et/GKM/mcv/pkg/signing"
+	"github.com/redhat-et/GKM/mcv/pkg/utils"
+	logging "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// pushFlags holds the flags of mcv push.
+type pushFlags struct {
+	imageName    string
+	cacheDir     string
+	format       string
+	artifactType string
+	retries      int
+	digestFile   string
+}
+
+// signFlags holds the flags signing a pushed image.
+type signFlags struct {
+	sign          bool
+	key           string
+	identityToken string
+	fulcioURL     string
+	rekorURL      string
+	tlogUpload    bool
+	yes           bool
+}
+
+func addSignFlags(cmd *cobra.Command, sign *signFlags) {
+	cmd.Flags().BoolVar(&sign.sign, "sign", false, "Sign the pushed image with Cosign, keyless unless --key is set, and attest its cache manifest and summary")
+	cmd.Flags().StringVar(&sign.key, "key", "", "Cosign private key file or KMS URI to sign with (implies --sign, password from $COSIGN_PASSWORD)")
+	cmd.Flags().StringVar(&sign.identityToken, "identity-token", "", "OIDC identity token, or a file holding it, for keyless signing (default $SIGSTORE_ID_TOKEN or the token of the CI environment)")
+	cmd.Flags().StringVar(&sign.fulcioURL, "fulcio-url", "", "Fulcio URL for keyless signing (default the public Sigstore instance)")
+	cmd.Flags().StringVar(&sign.rekorURL, "rekor-url", "", "Rekor transparency log URL (default the public Sigstore instance)")
+	cmd.Flags().BoolVar(&sign.tlogUpload, "tlog-upload", true, "Upload the signatures to the Rekor transparency log (required by the GKM operator for keyless signatures)")
+	cmd.Flags().BoolVarP(&sign.yes, "yes", "y", false, "Skip the confirmation of uploading to the transparency log")
+}
+
+// requested reports whether a signing flag was set.
+func (s signFlags) requested() bool {
+	return s.sign || s.key != "" || s.identityToken != "" || s.fulcioURL != "" || s.rekorURL != ""
+}
+
+// options returns the signing options of the flags, or nil if the image is not signed.
+func (s signFlags) options() *signing.Options {
+	if !s.sign && s.key == "" {
+		return nil
+	}
+	return &signing.Options{
+		KeyRef:           s.key,
+		IDToken:          s.identityToken,
+		FulcioURL:        s.fulcioURL,
+		RekorURL:         s.rekorURL,
+		TlogUpload:       s.tlogUpload,
+		SkipConfirmation: s.yes,
+	}
+}
+
+func buildPushCommand() *cobra.Command {
+	var push pushFlags
+	var sign signFlags
+	var registries registryFlags
+
+	cmd := &cobra.Command{
+		Use:   "push",
+		Short: "Build a cache image and push it to a registry without a daemon",
+		Long: `push builds the OCI image of a Triton/vLLM cache directory and pushes it straight to
+a registry, without Docker or Buildah. The image is in the compat format, like mcv --create
+builds, or in the OCI artifact format. With --sign or --key, the pushed image is signed with
+Cosign and its cache manifest and summary are attached as signed attestations. The digest
+reference of the pushed image is printed, ready to be used in a GKMCache.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			configureRegistries(registries)
+			runPush(push, sign)
+		},
+	}
+
+	cmd.Flags().StringVarP(&push.imageName, "image", "i", "", "Image name to push to (required)")
+	cmd.Flags().StringVarP(&push.cacheDir, "dir", "d", "", "Triton/vLLM cache directory path (required)")
+	cmd.Flags().StringVar(&push.format, "format", string(imgbuild.FormatCompat), "Image format: compat, or artifact for an OCI artifact with the application/cache.<type>.content.layer.v1+<type> layer")
+	cmd.Flags().StringVar(&push.artifactType, "artifact-type", "", "artifactType of an artifact image (default application/vnd.gkm.cache.<type>.v1)")
+	cmd.Flags().IntVar(&push.retries, "retries", 0, fmt.Sprintf("Times a request failing with a temporary error is retried (0 = default of %d, -1 = no retries)", imgbuild.DefaultPushRetries))
+	cmd.Flags().StringVar(&push.digestFile, "digestfile", "", "File to write the digest of the pushed image to")
+	_ = cmd.MarkFlagRequired("image")
+	_ = cmd.MarkFlagRequired("dir")
+	addSignFlags(cmd, &sign)
+	addRegistryFlags(cmd, &registries)
+	return cmd
+}
+
+func runPush(push pushFlags, sign signFlags) {
+	if _, err := utils.FilePathExists(push.cacheDir); err != nil {
+		logging.Errorf("Error checking cache file path: %v", err)
+		os.Exit(exitCreateError)
+	}
+	if sign.identityToken != "" && sign.key != "" {
+		logging.Error("--identity-token cannot be used with --key")
+		os.Exit(exitCreateError)
+	}
+	if push.artifactType != "" && imgbuild.Format(push.format) != imgbuild.FormatArtifact {
+		logging.Errorf("--artifact-type can only be used with --format %s", imgbuild.FormatArtifact)
+		os.Exit(exitCreateError)
+	}
+
+	digest, err := imgbuild.Push(push.imageName, push.cacheDir, imgbuild.PushOptions{
+		BuildOptions: imgbuild.BuildOptions{
+			Format:       imgbuild.Format(push.format),
+			ArtifactType: push.artifactType,
+		},
+		Retries: push.retries,
+		Sign:    sign.options(),
+	})
+	if err != nil {
+		logging.Errorf("Failed to push the image: %v", err)
+		os.Exit(exitCreateError)
+	}
+
+	if push.digestFile != "" {
+		if err := os.WriteFile(push.digestFile, []byte(digest.DigestStr()), 0644); err != nil {
+			logging.Errorf("Failed to write the digest file: %v", err)
+			os.Exit(exitCreateError)
+		}
+	}
+	fmt.Println(digest.String())
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
 
 	"github.com/redhat-et/GKM/mcv/pkg/constants"
 	logging "github.com/sirupsen/logrus"
@@ -162,15 +163,22 @@ func SetCachesBuildDir(caches []Cache, path string) {
 	}
 }
 
-func ExtractCacheDirectory(r io.Reader, cacheType string) (extractedDirs []string, extractedBytes int64, err error) {
+// ExtractCacheDirectory extracts the cache and manifest directories of a layer tarball.
+// limiter accounts for every layer of the image; if nil, the default limits apply to this
+// layer alone. Entries that could write outside the extraction directories, or that exceed
+// the limits, stop the extraction with an *ArchiveError.
+func ExtractCacheDirectory(r io.Reader, cacheType string, limiter *ExtractLimiter) (extractedDirs []string, extractedBytes int64, err error) {
 	if cacheType == "" {
 		return nil, 0, fmt.Errorf("cache type is empty")
 	}
+	if limiter == nil {
+		limiter = NewExtractLimiter(DefaultExtractLimits())
+	}
 	switch cacheType {
 	case constants.Triton:
-		return ExtractTritonCacheDirectory(r)
+		return ExtractTritonCacheDirectory(r, limiter)
 	case constants.VLLM:
-		return ExtractVLLMCacheDirectory(r)
+		return ExtractVLLMCacheDirectory(r, limiter)
 	default:
 		return nil, 0, fmt.Errorf("unsupported cache type: %s", cacheType)
 	}
@@ -180,6 +188,7 @@ func ExtractCacheDirectory(r io.Reader, cacheType string) (extractedDirs []strin
 func extractCacheAndManifestDirectory(
 	r io.Reader,
 	cacheDirPrefix, manifestDirPrefix, extractCacheDir, extractManifestDir string,
+	limiter *ExtractLimiter,
 ) (extractedDirs []string, extractedBytes int64, err error) {
 	gr, err := gzip.NewReader(r)
 	if err != nil {
@@ -197,6 +206,20 @@ func extractCacheAndManifestDirectory(
 		return nil, 0, fmt.Errorf("failed to create manifest directory: %w", err)
 	}
 
+	// rootOf maps a name in the tarball to the extraction directory it belongs to, and
+	// its path relative to that directory.
+	rootOf := func(name string) (root, rel string, isCache, ok bool) {
+		switch {
+		case strings.HasPrefix(name, cacheDirPrefix):
+			rel = strings.TrimLeft(strings.TrimPrefix(name, cacheDirPrefix), "/")
+			return extractCacheDir, rel, true, true
+		case strings.HasPrefix(name, manifestDirPrefix+"manifest.json"),
+			name == manifestDirPrefix+IntegrityFileName:
+			return extractManifestDir, strings.TrimPrefix(name, manifestDirPrefix), false, true
+		}
+		return "", "", false, false
+	}
+
 	for {
 		h, ret := tr.Next()
 		if ret == io.EOF {
@@ -205,28 +228,31 @@ func extractCacheAndManifestDirectory(
 			return nil, 0, fmt.Errorf("error reading tar archive: %w", ret)
 		}
 
+		// No legitimate layer has names outside of its root.
+		if err = checkEntryName(h.Name); err != nil {
+			return nil, 0, &ArchiveError{Name: h.Name, Err: err}
+		}
+
 		// Skip irrelevant files
-		if !strings.HasPrefix(h.Name, cacheDirPrefix) &&
-			!strings.HasPrefix(h.Name, manifestDirPrefix+"manifest.json") {
+		root, rel, isCache, ok := rootOf(h.Name)
+		if !ok || rel == "" {
 			continue
 		}
 
-		// Determine output path
-		var filePath string
-		if strings.HasPrefix(h.Name, cacheDirPrefix) {
-			rel := strings.TrimPrefix(h.Name, cacheDirPrefix)
-			if rel == "" {
-				continue
-			}
-			filePath = filepath.Join(extractCacheDir, rel)
+		if err = checkEntryType(h); err != nil {
+			return nil, 0, &ArchiveError{Name: h.Name, Err: err}
+		}
 
+		// Determine output path
+		filePath, err := safeJoin(root, rel)
+		if err != nil {
+			return nil, 0, &ArchiveError{Name: h.Name, Err: err}
+		}
+		if isCache {
 			topDir := filepath.Join(extractCacheDir, filepath.Dir(rel))
 			if !stringInSlice(topDir, extractedDirs) {
 				extractedDirs = append(extractedDirs, topDir)
 			}
-		} else if strings.HasPrefix(h.Name, manifestDirPrefix) {
-			rel := strings.TrimPrefix(h.Name, manifestDirPrefix)
-			filePath = filepath.Join(extractManifestDir, rel)
 		}
 
 		// Ensure parent dir exists
@@ -236,16 +262,71 @@ func extractCacheAndManifestDirectory(
 
 		switch h.Typeflag {
 		case tar.TypeDir:
-			if err = os.MkdirAll(filePath, os.FileMode(h.Mode)); err != nil {
+			if err = limiter.addEntry(0, isCache); err != nil {
+				return nil, 0, &ArchiveError{Name: h.Name, Err: err}
+			}
+			if err = os.MkdirAll(filePath, os.FileMode(h.Mode).Perm()); err != nil {
 				return nil, 0, fmt.Errorf("failed to create directory %s: %w", filePath, err)
 			}
 		case tar.TypeReg:
-			if err = writeFile(filePath, tr, os.FileMode(h.Mode)); err != nil {
+			if err = limiter.addEntry(h.Size, isCache); err != nil {
+				return nil, 0, &ArchiveError{Name: h.Name, Err: err}
+			}
+			if isCache && limiter.reuse != nil {
+				err = limiter.reuse.writeFile(filePath, rel, tr, h.Size, os.FileMode(h.Mode).Perm())
+			} else {
+				err = writeFile(filePath, tr, os.FileMode(h.Mode).Perm())
+			}
+			if err != nil {
 				return nil, 0, fmt.Errorf("failed to write file %s: %w", filePath, err)
 			}
-			if strings.HasPrefix(h.Name, cacheDirPrefix) {
+			if isCache {
 				extractedBytes += h.Size
 			}
+		case tar.TypeSymlink:
+			if err = checkSymlink(rel, h.Linkname); err != nil {
+				return nil, 0, &ArchiveError{Name: h.Name, Err: err}
+			}
+			if err = limiter.addEntry(0, isCache); err != nil {
+				return nil, 0, &ArchiveError{Name: h.Name, Err: err}
+			}
+			if err = removeIfNotDir(filePath); err != nil {
+				return nil, 0, fmt.Errorf("failed to replace %s: %w", filePath, err)
+			}
+			if err = os.Symlink(h.Linkname, filePath); err != nil {
+				return nil, 0, fmt.Errorf("failed to create symlink %s: %w", filePath, err)
+			}
+		case tar.TypeLink:
+			// Hard links name another entry of the tarball, which must already be
+			// extracted as a regular file in the same directory.
+			if checkEntryName(h.Linkname) != nil {
+				return nil, 0, &ArchiveError{Name: h.Name, Err: ErrLinkEscape}
+			}
+			linkRoot, linkRel, _, ok := rootOf(h.Linkname)
+			if !ok || linkRoot != root || linkRel == "" {
+				return nil, 0, &ArchiveError{Name: h.Name, Err: ErrLinkEscape}
+			}
+			target, err := safeJoin(root, linkRel)
+			if err != nil {
+				return nil, 0, &ArchiveError{Name: h.Name, Err: ErrLinkEscape}
+			}
+			info, err := os.Lstat(target)
+			if err != nil || !info.Mode().IsRegular() {
+				return nil, 0, &ArchiveError{Name: h.Name, Err: ErrLinkEscape}
+			}
+			// Counted at full size, like the cache-size-bytes label does.
+			if err = limiter.addEntry(info.Size(), isCache); err != nil {
+				return nil, 0, &ArchiveError{Name: h.Name, Err: err}
+			}
+			if err = removeIfNotDir(filePath); err != nil {
+				return nil, 0, fmt.Errorf("failed to replace %s: %w", filePath, err)
+			}
+			if err = os.Link(target, filePath); err != nil {
+				return nil, 0, fmt.Errorf("failed to create hard link %s: %w", filePath, err)
+			}
+			if isCache {
+				extractedBytes += info.Size()
+			}
 		default:
 			logging.Debugf("Skipping unsupported type: %c in file %s", h.Typeflag, h.Name)
 		}
@@ -263,13 +344,18 @@ func stringInSlice(str string, list []string) bool {
 	return false
 }
 
+// writeFile writes the content of a tar entry to filePath. An existing file or link at
+// filePath is replaced rather than written through.
 func writeFile(filePath string, tarReader io.Reader, mode os.FileMode) error {
 	// Create any parent directories if needed
 	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
 		return fmt.Errorf("failed to create parent directories for %s: %w", filePath, err)
 	}
 
-	outFile, err := os.Create(filePath)
+	if err := removeIfNotDir(filePath); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", filePath, err)
+	}
+	outFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL|syscall.O_NOFOLLOW, 0600)
 	if err != nil {
 		return fmt.Errorf("failed to create file %s: %w", filePath, err)
 	}
@@ -279,7 +365,7 @@ func writeFile(filePath string, tarReader io.Reader, mode os.FileMode) error {
 		return fmt.Errorf("failed to copy content to file %s: %w", filePath, err)
 	}
 
-	if err := os.Chmod(filePath, mode); err != nil {
+	if err := outFile.Chmod(mode); err != nil {
 		return fmt.Errorf("failed to set file permissions for %s: %w", filePath, err)
 	}
 
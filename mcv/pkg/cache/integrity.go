@@ -0,0 +1,226 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// IntegrityFileName is the per-file integrity manifest stored next to manifest.json.
+	IntegrityFileName = "integrity.json"
+
+	integrityVersion   = "v1"
+	integrityAlgorithm = "sha256"
+)
+
+// IntegrityEntry is the size and SHA-256 digest of one cache file.
+type IntegrityEntry struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// IntegrityManifest lists every regular file of a cache by its path, relative to the
+// root of the cache and using forward slashes.
+type IntegrityManifest struct {
+	Version   string                    `json:"version"`
+	Algorithm string                    `json:"algorithm"`
+	Files     map[string]IntegrityEntry `json:"files"`
+}
+
+// IntegrityIssueKind describes how a file differs from the integrity manifest.
+type IntegrityIssueKind string
+
+const (
+	IntegrityModified  IntegrityIssueKind = "modified"
+	IntegrityTruncated IntegrityIssueKind = "truncated"
+	IntegrityMissing   IntegrityIssueKind = "missing"
+	IntegrityAdded     IntegrityIssueKind = "added"
+)
+
+// IntegrityIssue is a file that does not match the integrity manifest.
+type IntegrityIssue struct {
+	Path string             `json:"path"`
+	Kind IntegrityIssueKind `json:"kind"`
+}
+
+func (i IntegrityIssue) String() string {
+	return fmt.Sprintf("%s (%s)", i.Path, i.Kind)
+}
+
+// BuildIntegrityManifest hashes every regular file under root.
+func BuildIntegrityManifest(root string) (*IntegrityManifest, error) {
+	m := &IntegrityManifest{
+		Version:   integrityVersion,
+		Algorithm: integrityAlgorithm,
+		Files:     map[string]IntegrityEntry{},
+	}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		entry, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		m.Files[filepath.ToSlash(rel)] = entry
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build integrity manifest: %w", err)
+	}
+	return m, nil
+}
+
+// WriteIntegrityManifest writes m to path as JSON.
+func WriteIntegrityManifest(path string, m *IntegrityManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal integrity manifest: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write integrity manifest: %w", err)
+	}
+	return nil
+}
+
+// ReadIntegrityManifest reads the integrity manifest at path. The returned error wraps
+// fs.ErrNotExist if there is no manifest, as for images built before it was added.
+func ReadIntegrityManifest(path string) (*IntegrityManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &IntegrityManifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to parse integrity manifest %s: %w", path, err)
+	}
+	if m.Algorithm != integrityAlgorithm {
+		return nil, fmt.Errorf("unsupported integrity manifest algorithm %q", m.Algorithm)
+	}
+	return m, nil
+}
+
+// Verify checks every file listed in m against the files under root. Files that
+// are not listed are not checked, see Unlisted.
+func (m *IntegrityManifest) Verify(root string) ([]IntegrityIssue, error) {
+	var issues []IntegrityIssue
+	for rel, want := range m.Files {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		info, err := os.Lstat(path)
+		if errors.Is(err, fs.ErrNotExist) || (err == nil && !info.Mode().IsRegular()) {
+			issues = append(issues, IntegrityIssue{Path: rel, Kind: IntegrityMissing})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if info.Size() < want.Size {
+			issues = append(issues, IntegrityIssue{Path: rel, Kind: IntegrityTruncated})
+			continue
+		}
+		got, err := hashFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if got != want {
+			issues = append(issues, IntegrityIssue{Path: rel, Kind: IntegrityModified})
+		}
+	}
+	sortIntegrityIssues(issues)
+	return issues, nil
+}
+
+// Unlisted returns the regular files under the dirs of root that are not listed in m.
+// dirs are relative to root. skip, if set, is called with the path of each entry
+// relative to root and returns true for entries to ignore.
+func (m *IntegrityManifest) Unlisted(root string, dirs []string, skip func(rel string) bool) ([]IntegrityIssue, error) {
+	var issues []IntegrityIssue
+	seen := map[string]bool{}
+	for _, dir := range dirs {
+		err := filepath.WalkDir(filepath.Join(root, dir), func(path string, d fs.DirEntry, err error) error {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if rel == "." {
+				return nil
+			}
+			if skip != nil && skip(rel) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() || seen[rel] {
+				return nil
+			}
+			seen[rel] = true
+			if _, ok := m.Files[rel]; !ok {
+				issues = append(issues, IntegrityIssue{Path: rel, Kind: IntegrityAdded})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sortIntegrityIssues(issues)
+	return issues, nil
+}
+
+// IntegrityIssuesMessage describes the files that do not match an integrity manifest,
+// naming the first few.
+func IntegrityIssuesMessage(issues []IntegrityIssue) string {
+	const maxListed = 5
+	names := make([]string, 0, maxListed+1)
+	for i, issue := range issues {
+		if i == maxListed {
+			names = append(names, "...")
+			break
+		}
+		names = append(names, issue.String())
+	}
+	return fmt.Sprintf("%d file(s) do not match the integrity manifest: %s", len(issues), strings.Join(names, ", "))
+}
+
+func sortIntegrityIssues(issues []IntegrityIssue) {
+	sort.Slice(issues, func(i, j int) bool { return issues[i].Path < issues[j].Path })
+}
+
+func hashFile(path string) (IntegrityEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return IntegrityEntry{}, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return IntegrityEntry{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return IntegrityEntry{Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
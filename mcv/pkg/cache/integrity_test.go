@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrityManifest_RoundTrip(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "abc", "kernel.json"), []byte("{}"))
+	writeTestFile(t, filepath.Join(root, "abc", "kernel.hsaco"), []byte("binary"))
+
+	m, err := BuildIntegrityManifest(root)
+	require.NoError(t, err)
+	assert.Len(t, m.Files, 2)
+	assert.Equal(t, int64(6), m.Files["abc/kernel.hsaco"].Size)
+
+	path := filepath.Join(t.TempDir(), IntegrityFileName)
+	require.NoError(t, WriteIntegrityManifest(path, m))
+	read, err := ReadIntegrityManifest(path)
+	require.NoError(t, err)
+	assert.Equal(t, m, read)
+
+	issues, err := read.Verify(root)
+	require.NoError(t, err)
+	assert.Empty(t, issues)
+}
+
+func TestReadIntegrityManifest_Missing(t *testing.T) {
+	_, err := ReadIntegrityManifest(filepath.Join(t.TempDir(), IntegrityFileName))
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestIntegrityManifest_Verify(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "abc", "modified"), []byte("original"))
+	writeTestFile(t, filepath.Join(root, "abc", "truncated"), []byte("original"))
+	writeTestFile(t, filepath.Join(root, "abc", "missing"), []byte("original"))
+	writeTestFile(t, filepath.Join(root, "abc", "intact"), []byte("original"))
+
+	m, err := BuildIntegrityManifest(root)
+	require.NoError(t, err)
+
+	writeTestFile(t, filepath.Join(root, "abc", "modified"), []byte("0riginal"))
+	writeTestFile(t, filepath.Join(root, "abc", "truncated"), []byte("orig"))
+	require.NoError(t, os.Remove(filepath.Join(root, "abc", "missing")))
+	writeTestFile(t, filepath.Join(root, "abc", "added"), []byte("new"))
+	writeTestFile(t, filepath.Join(root, ".metadata"), []byte("skipped"))
+
+	issues, err := m.Verify(root)
+	require.NoError(t, err)
+	assert.Equal(t, []IntegrityIssue{
+		{Path: "abc/missing", Kind: IntegrityMissing},
+		{Path: "abc/modified", Kind: IntegrityModified},
+		{Path: "abc/truncated", Kind: IntegrityTruncated},
+	}, issues)
+
+	skip := func(rel string) bool { return strings.HasPrefix(rel, ".") }
+	added, err := m.Unlisted(root, []string{"."}, skip)
+	require.NoError(t, err)
+	assert.Equal(t, []IntegrityIssue{{Path: "abc/added", Kind: IntegrityAdded}}, added)
+
+	assert.Equal(t,
+		"3 file(s) do not match the integrity manifest: abc/missing (missing), abc/modified (modified), abc/truncated (truncated)",
+		IntegrityIssuesMessage(issues))
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// reuseBufferSize is how much of a file is compared with the earlier extraction at a time.
+const reuseBufferSize = 256 << 10
+
+// ReuseSource is the root of an earlier extraction of a cache, usually of a previous digest of
+// the same image. While a new image is extracted, each cache file is compared with the file at
+// the same path in the earlier extraction as it is read from the layer. A file that is unchanged
+// is hard linked from the earlier extraction, or copied from it if it cannot be linked, instead of
+// being written again. A changed file is written from the first byte that differs, the bytes
+// before it are copied from the earlier extraction.
+type ReuseSource struct {
+	root  string
+	files int
+	bytes int64
+}
+
+// NewReuseSource returns a ReuseSource for the earlier extraction in root.
+func NewReuseSource(root string) *ReuseSource {
+	return &ReuseSource{root: root}
+}
+
+// Files returns the number of files reused from the earlier extraction.
+func (s *ReuseSource) Files() int {
+	return s.files
+}
+
+// Bytes returns the number of bytes of the files reused from the earlier extraction.
+func (s *ReuseSource) Bytes() int64 {
+	return s.bytes
+}
+
+// previous returns the regular file at rel in the earlier extraction, if it has the given size.
+func (s *ReuseSource) previous(rel string, size int64) (*os.File, os.FileInfo, bool) {
+	path, err := safeJoin(s.root, rel)
+	if err != nil {
+		return nil, nil, false
+	}
+	f, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		return nil, nil, false
+	}
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() || info.Size() != size {
+		_ = f.Close()
+		return nil, nil, false
+	}
+	return f, info, true
+}
+
+// writeFile writes the size bytes of tarReader to filePath, reusing the file at rel in the
+// earlier extraction where the content is the same.
+func (s *ReuseSource) writeFile(filePath, rel string, tarReader io.Reader, size int64, mode os.FileMode) error {
+	prev, info, ok := s.previous(rel, size)
+	if !ok {
+		return writeFile(filePath, tarReader, mode)
+	}
+	defer prev.Close()
+
+	buf := make([]byte, min(size, reuseBufferSize))
+	prevBuf := make([]byte, len(buf))
+	var same int64
+	for same < size {
+		n, err := io.ReadFull(tarReader, buf[:min(size-same, int64(len(buf)))])
+		if err != nil {
+			return fmt.Errorf("failed to read content of %s: %w", filePath, err)
+		}
+		m, err := io.ReadFull(prev, prevBuf[:n])
+		if err != nil || !bytes.Equal(buf[:n], prevBuf[:m]) {
+			// Changed, so only the part before this chunk is taken from the earlier extraction.
+			return writeChangedFile(filePath, prev, same, io.MultiReader(bytes.NewReader(buf[:n]), tarReader), size, mode)
+		}
+		same += int64(n)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("failed to create parent directories for %s: %w", filePath, err)
+	}
+	if err := removeIfNotDir(filePath); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", filePath, err)
+	}
+	// A link shares the mode of the earlier file, so a file whose mode changed is copied.
+	linked := info.Mode().Perm() == mode && os.Link(prev.Name(), filePath) == nil
+	if !linked {
+		if _, err := prev.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", prev.Name(), err)
+		}
+		if err := writeFile(filePath, prev, mode); err != nil {
+			return err
+		}
+	}
+	s.files++
+	s.bytes += size
+	return nil
+}
+
+// writeChangedFile writes the first offset bytes of prev followed by rest to filePath, which
+// must then hold size bytes.
+func writeChangedFile(filePath string, prev *os.File, offset int64, rest io.Reader, size int64, mode os.FileMode) error {
+	if _, err := prev.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to copy %s: %w", prev.Name(), err)
+	}
+	if err := writeFile(filePath, io.MultiReader(io.LimitReader(prev, offset), rest), mode); err != nil {
+		return err
+	}
+	// The earlier file may have been truncated while it was compared.
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	if info.Size() != size {
+		return fmt.Errorf("failed to copy %s: file changed while it was reused", prev.Name())
+	}
+	return nil
+}
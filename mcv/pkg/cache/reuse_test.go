@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractCacheAndManifestDirectory_ReusesUnchangedFiles(t *testing.T) {
+	root, cacheDir, manifestDir := testExtractRoot(t)
+	prevDir := filepath.Join(root, "outside", "previous")
+	large := strings.Repeat("k", reuseBufferSize+1000)
+	writePrev := func(rel, content string, mode os.FileMode) {
+		path := filepath.Join(prevDir, rel)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), mode))
+		require.NoError(t, os.Chmod(path, mode))
+	}
+	writePrev("abc/kernel.hsaco", "binary", 0644)
+	writePrev("abc/kernel.json", "{}", 0644)
+	writePrev("abc/mode.bin", "mode", 0600)
+	writePrev("abc/large.bin", large, 0644)
+	writePrev("abc/resized.bin", "short", 0644)
+
+	data := buildTar(t, []testEntry{
+		regEntry(testCachePrefix+"abc/kernel.hsaco", "binary"),
+		regEntry(testCachePrefix+"abc/kernel.json", "[]"),
+		regEntry(testCachePrefix+"abc/mode.bin", "mode"),
+		regEntry(testCachePrefix+"abc/large.bin", large[:len(large)-1]+"x"),
+		regEntry(testCachePrefix+"abc/resized.bin", "longer"),
+		regEntry(testCachePrefix+"abc/new.bin", "new"),
+		regEntry(testManifestPrefix+"manifest.json", "[]"),
+	})
+
+	reuse := NewReuseSource(prevDir)
+	limiter := NewExtractLimiter(DefaultExtractLimits())
+	limiter.SetReuseSource(reuse)
+	_, extractedBytes, err := extractTestLayer(t, data, cacheDir, manifestDir, limiter)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6+2+4+len(large)+6+3), extractedBytes)
+
+	sameFile := func(rel string) bool {
+		info, err := os.Stat(filepath.Join(cacheDir, rel))
+		require.NoError(t, err)
+		prevInfo, err := os.Stat(filepath.Join(prevDir, rel))
+		require.NoError(t, err)
+		return os.SameFile(info, prevInfo)
+	}
+	readFile := func(rel string) string {
+		content, err := os.ReadFile(filepath.Join(cacheDir, rel))
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	// Unchanged files are linked, or copied when the mode changed.
+	assert.True(t, sameFile("abc/kernel.hsaco"))
+	assert.Equal(t, "binary", readFile("abc/kernel.hsaco"))
+	assert.False(t, sameFile("abc/mode.bin"))
+	assert.Equal(t, "mode", readFile("abc/mode.bin"))
+	info, err := os.Stat(filepath.Join(cacheDir, "abc", "mode.bin"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+	assert.Equal(t, 2, reuse.Files())
+	assert.Equal(t, int64(6+4), reuse.Bytes())
+
+	// Changed files are written with the new content, the earlier ones are untouched.
+	assert.False(t, sameFile("abc/kernel.json"))
+	assert.Equal(t, "[]", readFile("abc/kernel.json"))
+	assert.False(t, sameFile("abc/large.bin"))
+	assert.Equal(t, large[:len(large)-1]+"x", readFile("abc/large.bin"))
+	assert.Equal(t, "longer", readFile("abc/resized.bin"))
+	assert.Equal(t, "new", readFile("abc/new.bin"))
+	prevContent, err := os.ReadFile(filepath.Join(prevDir, "abc", "large.bin"))
+	require.NoError(t, err)
+	assert.Equal(t, large, string(prevContent))
+}
@@ -0,0 +1,187 @@
+package cache
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Default limits applied when extracting a Kernel Cache image. They can be overridden
+// per extraction, see client.Options.
+const (
+	DefaultMaxExtractBytes     int64 = 32 << 30 // 32 GiB of cache files
+	DefaultMaxExtractFiles     int   = 200000   // Files, directories and links
+	DefaultMaxExtractFileBytes int64 = 4 << 30  // 4 GiB for a single file
+)
+
+// Errors wrapped by ArchiveError, identifying why an archive entry was rejected.
+var (
+	ErrAbsolutePath     = errors.New("absolute path")
+	ErrPathTraversal    = errors.New("path escapes the extraction directory")
+	ErrSymlinkInPath    = errors.New("path goes through a symbolic link")
+	ErrLinkEscape       = errors.New("link target escapes the extraction directory")
+	ErrUnsupportedEntry = errors.New("device and FIFO entries are not allowed")
+	ErrFileTooLarge     = errors.New("file is larger than the maximum file size")
+	ErrTooManyFiles     = errors.New("image has more files than the maximum file count")
+	ErrCacheTooLarge    = errors.New("cache is larger than the maximum cache size")
+	ErrExceedsSizeLabel = errors.New("cache is larger than its cache-size-bytes label")
+)
+
+// ArchiveError is returned when an entry of a layer tarball is rejected during extraction.
+// Extraction stops at the first rejected entry.
+type ArchiveError struct {
+	Name string // Name of the entry in the tarball
+	Err  error  // Wraps one of the Err* values above
+}
+
+func (e *ArchiveError) Error() string {
+	return fmt.Sprintf("rejected archive entry %q: %v", e.Name, e.Err)
+}
+
+func (e *ArchiveError) Unwrap() error {
+	return e.Err
+}
+
+// ExtractLimits bounds what a single image may write to disk during extraction.
+// A zero value disables the corresponding limit.
+type ExtractLimits struct {
+	MaxTotalBytes int64 // Maximum bytes of cache files, across all layers
+	MaxFiles      int   // Maximum number of files, directories and links, across all layers
+	MaxFileBytes  int64 // Maximum size of a single file
+	LabelBytes    int64 // Cache size recorded in the cache-size-bytes label of the image
+}
+
+// DefaultExtractLimits returns the limits used when none are configured.
+func DefaultExtractLimits() ExtractLimits {
+	return ExtractLimits{
+		MaxTotalBytes: DefaultMaxExtractBytes,
+		MaxFiles:      DefaultMaxExtractFiles,
+		MaxFileBytes:  DefaultMaxExtractFileBytes,
+	}
+}
+
+// ExtractLimiter enforces ExtractLimits across all the layers extracted from one image.
+type ExtractLimiter struct {
+	limits ExtractLimits
+	files  int
+	bytes  int64
+	reuse  *ReuseSource
+}
+
+// NewExtractLimiter returns an ExtractLimiter for the extraction of one image.
+func NewExtractLimiter(limits ExtractLimits) *ExtractLimiter {
+	return &ExtractLimiter{limits: limits}
+}
+
+// SetReuseSource makes the extraction reuse the unchanged files of an earlier extraction, see
+// ReuseSource.
+func (l *ExtractLimiter) SetReuseSource(reuse *ReuseSource) {
+	l.reuse = reuse
+}
+
+// addEntry accounts for an extracted entry, with size bytes of cache content.
+func (l *ExtractLimiter) addEntry(size int64, isCache bool) error {
+	l.files++
+	if l.limits.MaxFiles > 0 && l.files > l.limits.MaxFiles {
+		return fmt.Errorf("%w (%d)", ErrTooManyFiles, l.limits.MaxFiles)
+	}
+	if l.limits.MaxFileBytes > 0 && size > l.limits.MaxFileBytes {
+		return fmt.Errorf("%w (%d > %d bytes)", ErrFileTooLarge, size, l.limits.MaxFileBytes)
+	}
+	if !isCache {
+		return nil
+	}
+	l.bytes += size
+	if l.limits.LabelBytes > 0 && l.bytes > l.limits.LabelBytes {
+		return fmt.Errorf("%w (%d bytes)", ErrExceedsSizeLabel, l.limits.LabelBytes)
+	}
+	if l.limits.MaxTotalBytes > 0 && l.bytes > l.limits.MaxTotalBytes {
+		return fmt.Errorf("%w (%d bytes)", ErrCacheTooLarge, l.limits.MaxTotalBytes)
+	}
+	return nil
+}
+
+// checkEntryName rejects tarball entries with an absolute name, or a name that leaves the
+// root of the layer.
+func checkEntryName(name string) error {
+	if strings.HasPrefix(name, "/") || filepath.IsAbs(name) {
+		return ErrAbsolutePath
+	}
+	if !filepath.IsLocal(name) {
+		return ErrPathTraversal
+	}
+	return nil
+}
+
+// safeJoin returns the path of rel under root, making sure it stays in root and that none
+// of its parent directories below root are symbolic links, so the write cannot be redirected.
+func safeJoin(root, rel string) (string, error) {
+	if filepath.IsAbs(rel) {
+		return "", ErrAbsolutePath
+	}
+	if !filepath.IsLocal(rel) {
+		return "", ErrPathTraversal
+	}
+
+	dir := root
+	parts := strings.Split(filepath.Dir(filepath.Clean(rel)), string(filepath.Separator))
+	for _, part := range parts {
+		if part == "." {
+			continue
+		}
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Created by MkdirAll, so the rest cannot be links either.
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", ErrSymlinkInPath
+		}
+	}
+	return filepath.Join(root, rel), nil
+}
+
+// checkSymlink rejects a symbolic link at rel, relative to the extraction root, whose
+// target is absolute or leaves the extraction root.
+func checkSymlink(rel, target string) error {
+	if target == "" || filepath.IsAbs(target) {
+		return ErrLinkEscape
+	}
+	if !filepath.IsLocal(filepath.Join(filepath.Dir(rel), target)) {
+		return ErrLinkEscape
+	}
+	return nil
+}
+
+// checkEntryType rejects the entry types that are never part of a Kernel Cache.
+func checkEntryType(h *tar.Header) error {
+	switch h.Typeflag {
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		return ErrUnsupportedEntry
+	}
+	return nil
+}
+
+// removeIfNotDir removes path so an entry can replace it, unless it does not exist or is a
+// directory. Links are removed rather than written through.
+func removeIfNotDir(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,392 @@
+package cache
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testCachePrefix    = "io.triton.cache/"
+	testManifestPrefix = "io.triton.manifest/"
+)
+
+// testEntry is an entry of a test layer tarball.
+type testEntry struct {
+	name     string
+	typeflag byte
+	content  string
+	linkname string
+}
+
+func regEntry(name, content string) testEntry {
+	return testEntry{name: name, typeflag: tar.TypeReg, content: content}
+}
+
+// buildTar returns an uncompressed tarball holding entries.
+func buildTar(t testing.TB, entries []testEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		h := &tar.Header{
+			Name:     e.name,
+			Typeflag: e.typeflag,
+			Linkname: e.linkname,
+			Mode:     0644,
+		}
+		if e.typeflag == tar.TypeReg {
+			h.Size = int64(len(e.content))
+		}
+		if e.typeflag == tar.TypeDir {
+			h.Mode = 0755
+		}
+		require.NoError(t, tw.WriteHeader(h))
+		if e.content != "" {
+			_, err := tw.Write([]byte(e.content))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func gzipBytes(t testing.TB, data []byte) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	_, err := gw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+	return &buf
+}
+
+// testExtractRoot creates the cache and manifest directories under a temporary root, next to
+// an "outside" directory that extraction must never write to.
+func testExtractRoot(t testing.TB) (root, cacheDir, manifestDir string) {
+	t.Helper()
+	root = t.TempDir()
+	cacheDir = filepath.Join(root, "cache")
+	manifestDir = filepath.Join(root, "manifest")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "outside"), 0755))
+	return root, cacheDir, manifestDir
+}
+
+func extractTestLayer(t testing.TB, data []byte, cacheDir, manifestDir string, limiter *ExtractLimiter) ([]string, int64, error) {
+	t.Helper()
+	if limiter == nil {
+		limiter = NewExtractLimiter(DefaultExtractLimits())
+	}
+	return extractCacheAndManifestDirectory(gzipBytes(t, data),
+		testCachePrefix, testManifestPrefix, cacheDir, manifestDir, limiter)
+}
+
+// assertOutsideUntouched fails if extraction created anything next to the extraction
+// directories, or a link that points out of them.
+func assertOutsideUntouched(t testing.TB, root string) {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join(root, "outside"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	entries, err = os.ReadDir(root)
+	require.NoError(t, err)
+	for _, e := range entries {
+		assert.Contains(t, []string{"cache", "manifest", "outside"}, e.Name())
+	}
+
+	err = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.Type()&os.ModeSymlink == 0 {
+			return err
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		assert.False(t, filepath.IsAbs(target), "absolute link %s -> %s", path, target)
+		resolved := filepath.Join(filepath.Dir(path), target)
+		assert.True(t, isUnder(filepath.Join(root, "cache"), resolved) || isUnder(filepath.Join(root, "manifest"), resolved),
+			"link %s -> %s escapes", path, target)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+// isUnder returns true if path is dir or is in dir.
+func isUnder(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+func TestExtractCacheAndManifestDirectory_Valid(t *testing.T) {
+	root, cacheDir, manifestDir := testExtractRoot(t)
+	data := buildTar(t, []testEntry{
+		{name: testCachePrefix, typeflag: tar.TypeDir},
+		{name: testCachePrefix + "abc", typeflag: tar.TypeDir},
+		regEntry(testCachePrefix+"abc/kernel.json", "{}"),
+		regEntry(testCachePrefix+"abc/kernel.hsaco", "binary"),
+		{name: testCachePrefix + "abc/latest", typeflag: tar.TypeSymlink, linkname: "kernel.hsaco"},
+		{name: testCachePrefix + "def/kernel.hsaco", typeflag: tar.TypeLink, linkname: testCachePrefix + "abc/kernel.hsaco"},
+		regEntry(testManifestPrefix+"manifest.json", "[]"),
+		regEntry(testManifestPrefix+IntegrityFileName, "{}"),
+		regEntry("unrelated/file", "skipped"),
+	})
+
+	dirs, extractedBytes, err := extractTestLayer(t, data, cacheDir, manifestDir, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2+6+6), extractedBytes)
+	assert.ElementsMatch(t, []string{cacheDir, filepath.Join(cacheDir, "abc"), filepath.Join(cacheDir, "def")}, dirs)
+
+	content, err := os.ReadFile(filepath.Join(cacheDir, "abc", "latest"))
+	require.NoError(t, err)
+	assert.Equal(t, "binary", string(content))
+	content, err = os.ReadFile(filepath.Join(cacheDir, "def", "kernel.hsaco"))
+	require.NoError(t, err)
+	assert.Equal(t, "binary", string(content))
+	assert.FileExists(t, filepath.Join(manifestDir, "manifest.json"))
+	assert.FileExists(t, filepath.Join(manifestDir, IntegrityFileName))
+	assertOutsideUntouched(t, root)
+}
+
+func TestExtractCacheAndManifestDirectory_Rejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []testEntry
+		limits  *ExtractLimits
+		want    error
+	}{
+		{
+			name:    "absolute path",
+			entries: []testEntry{regEntry("/etc/passwd", "x")},
+			want:    ErrAbsolutePath,
+		},
+		{
+			name:    "parent path",
+			entries: []testEntry{regEntry("../outside/file", "x")},
+			want:    ErrPathTraversal,
+		},
+		{
+			name:    "parent path below the cache prefix",
+			entries: []testEntry{regEntry(testCachePrefix+"../outside/file", "x")},
+			want:    ErrPathTraversal,
+		},
+		{
+			name:    "absolute symlink",
+			entries: []testEntry{{name: testCachePrefix + "link", typeflag: tar.TypeSymlink, linkname: "/etc/passwd"}},
+			want:    ErrLinkEscape,
+		},
+		{
+			name:    "escaping symlink",
+			entries: []testEntry{{name: testCachePrefix + "abc/link", typeflag: tar.TypeSymlink, linkname: "../../outside"}},
+			want:    ErrLinkEscape,
+		},
+		{
+			name: "write through a symlink",
+			entries: []testEntry{
+				{name: testCachePrefix + "abc", typeflag: tar.TypeDir},
+				{name: testCachePrefix + "link", typeflag: tar.TypeSymlink, linkname: "abc"},
+				regEntry(testCachePrefix+"link/file", "x"),
+			},
+			want: ErrSymlinkInPath,
+		},
+		{
+			name: "symlink chained through a symlink",
+			entries: []testEntry{
+				{name: testCachePrefix + "self", typeflag: tar.TypeSymlink, linkname: "."},
+				{name: testCachePrefix + "self/up", typeflag: tar.TypeSymlink, linkname: ".."},
+			},
+			want: ErrSymlinkInPath,
+		},
+		{
+			name:    "hardlink outside the cache",
+			entries: []testEntry{{name: testCachePrefix + "link", typeflag: tar.TypeLink, linkname: "etc/passwd"}},
+			want:    ErrLinkEscape,
+		},
+		{
+			name:    "hardlink with a parent path",
+			entries: []testEntry{{name: testCachePrefix + "link", typeflag: tar.TypeLink, linkname: "../outside/file"}},
+			want:    ErrLinkEscape,
+		},
+		{
+			name: "hardlink to the manifest",
+			entries: []testEntry{
+				regEntry(testManifestPrefix+"manifest.json", "[]"),
+				{name: testCachePrefix + "link", typeflag: tar.TypeLink, linkname: testManifestPrefix + "manifest.json"},
+			},
+			want: ErrLinkEscape,
+		},
+		{
+			name: "hardlink to a symlink",
+			entries: []testEntry{
+				{name: testCachePrefix + "sym", typeflag: tar.TypeSymlink, linkname: "file"},
+				{name: testCachePrefix + "link", typeflag: tar.TypeLink, linkname: testCachePrefix + "sym"},
+			},
+			want: ErrLinkEscape,
+		},
+		{
+			name:    "character device",
+			entries: []testEntry{{name: testCachePrefix + "null", typeflag: tar.TypeChar}},
+			want:    ErrUnsupportedEntry,
+		},
+		{
+			name:    "block device",
+			entries: []testEntry{{name: testCachePrefix + "sda", typeflag: tar.TypeBlock}},
+			want:    ErrUnsupportedEntry,
+		},
+		{
+			name:    "FIFO",
+			entries: []testEntry{{name: testCachePrefix + "fifo", typeflag: tar.TypeFifo}},
+			want:    ErrUnsupportedEntry,
+		},
+		{
+			name:    "file too large",
+			entries: []testEntry{regEntry(testCachePrefix+"big", "0123456789")},
+			limits:  &ExtractLimits{MaxFileBytes: 9},
+			want:    ErrFileTooLarge,
+		},
+		{
+			name:    "too many files",
+			entries: []testEntry{regEntry(testCachePrefix+"a", "a"), regEntry(testCachePrefix+"b", "b")},
+			limits:  &ExtractLimits{MaxFiles: 1},
+			want:    ErrTooManyFiles,
+		},
+		{
+			name:    "cache too large",
+			entries: []testEntry{regEntry(testCachePrefix+"a", "aaaa"), regEntry(testCachePrefix+"b", "bbbb")},
+			limits:  &ExtractLimits{MaxTotalBytes: 7},
+			want:    ErrCacheTooLarge,
+		},
+		{
+			name:    "cache larger than its label",
+			entries: []testEntry{regEntry(testCachePrefix+"a", "aaaa"), regEntry(testCachePrefix+"b", "bbbb")},
+			limits:  &ExtractLimits{MaxTotalBytes: 100, LabelBytes: 4},
+			want:    ErrExceedsSizeLabel,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, cacheDir, manifestDir := testExtractRoot(t)
+			limits := DefaultExtractLimits()
+			if tt.limits != nil {
+				limits = *tt.limits
+			}
+
+			_, _, err := extractTestLayer(t, buildTar(t, tt.entries), cacheDir, manifestDir, NewExtractLimiter(limits))
+			require.Error(t, err)
+			assert.ErrorIs(t, err, tt.want)
+			var archiveErr *ArchiveError
+			assert.True(t, errors.As(err, &archiveErr))
+			assertOutsideUntouched(t, root)
+		})
+	}
+}
+
+func TestExtractCacheAndManifestDirectory_ReplacesExistingSymlink(t *testing.T) {
+	root, cacheDir, manifestDir := testExtractRoot(t)
+	require.NoError(t, os.MkdirAll(cacheDir, 0755))
+	// A link left in a shared cache directory must not redirect the write.
+	require.NoError(t, os.Symlink(filepath.Join(root, "outside", "target"), filepath.Join(cacheDir, "kernel.json")))
+
+	_, _, err := extractTestLayer(t, buildTar(t, []testEntry{regEntry(testCachePrefix+"kernel.json", "{}")}),
+		cacheDir, manifestDir, nil)
+	require.NoError(t, err)
+
+	info, err := os.Lstat(filepath.Join(cacheDir, "kernel.json"))
+	require.NoError(t, err)
+	assert.True(t, info.Mode().IsRegular())
+	assertOutsideUntouched(t, root)
+}
+
+func TestExtractCacheAndManifestDirectory_LimitsAcrossLayers(t *testing.T) {
+	_, cacheDir, manifestDir := testExtractRoot(t)
+	limiter := NewExtractLimiter(ExtractLimits{MaxTotalBytes: 6})
+
+	_, _, err := extractTestLayer(t, buildTar(t, []testEntry{regEntry(testCachePrefix+"a", "aaaa")}),
+		cacheDir, manifestDir, limiter)
+	require.NoError(t, err)
+	_, _, err = extractTestLayer(t, buildTar(t, []testEntry{regEntry(testCachePrefix+"b", "bbbb")}),
+		cacheDir, manifestDir, limiter)
+	assert.ErrorIs(t, err, ErrCacheTooLarge)
+}
+
+func TestExtractCacheAndManifestDirectory_StripsSpecialModeBits(t *testing.T) {
+	_, cacheDir, manifestDir := testExtractRoot(t)
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Name: testCachePrefix + "setuid", Typeflag: tar.TypeReg, Mode: 04755, Size: 1,
+	}))
+	_, err := tw.Write([]byte("x"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	_, _, err = extractTestLayer(t, buf.Bytes(), cacheDir, manifestDir, nil)
+	require.NoError(t, err)
+	info, err := os.Stat(filepath.Join(cacheDir, "setuid"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode())
+}
+
+// FuzzExtractCacheAndManifestDirectory extracts arbitrary tarballs and checks that nothing
+// is ever written outside of the extraction directories, whether extraction fails or not.
+func FuzzExtractCacheAndManifestDirectory(f *testing.F) {
+	seeds := [][]testEntry{
+		{regEntry(testCachePrefix+"abc/kernel.json", "{}"), regEntry(testManifestPrefix+"manifest.json", "[]")},
+		{regEntry(testCachePrefix+"../outside/file", "x")},
+		{{name: testCachePrefix + "link", typeflag: tar.TypeSymlink, linkname: "../outside"}},
+		{
+			{name: testCachePrefix + "self", typeflag: tar.TypeSymlink, linkname: "."},
+			{name: testCachePrefix + "self/up", typeflag: tar.TypeSymlink, linkname: ".."},
+			regEntry(testCachePrefix+"self/up/outside/file", "x"),
+		},
+		{
+			regEntry(testCachePrefix+"a", "a"),
+			{name: testCachePrefix + "b", typeflag: tar.TypeLink, linkname: testCachePrefix + "a"},
+			{name: testCachePrefix + "c", typeflag: tar.TypeLink, linkname: "../outside/file"},
+		},
+		{{name: testCachePrefix + "fifo", typeflag: tar.TypeFifo}},
+	}
+	for _, entries := range seeds {
+		f.Add(buildTar(f, entries))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		root, cacheDir, manifestDir := testExtractRoot(t)
+		limiter := NewExtractLimiter(ExtractLimits{MaxTotalBytes: 1 << 20, MaxFiles: 64, MaxFileBytes: 1 << 16})
+		_, _, _ = extractTestLayer(t, data, cacheDir, manifestDir, limiter)
+		assertOutsideUntouched(t, root)
+	})
+}
+
+// FuzzSafeJoin checks that a path accepted by safeJoin, or a symlink target accepted by
+// checkSymlink, always stays under the extraction root.
+func FuzzSafeJoin(f *testing.F) {
+	for _, seed := range [][2]string{
+		{"abc/kernel.json", "kernel.hsaco"},
+		{"../x", "../../etc"},
+		{"/etc/passwd", "/etc/passwd"},
+		{"a/./../../b", "a/../.."},
+		{"a//b", "./b"},
+	} {
+		f.Add(seed[0], seed[1])
+	}
+
+	f.Fuzz(func(t *testing.T, rel, target string) {
+		root := t.TempDir()
+		if path, err := safeJoin(root, rel); err == nil {
+			assert.True(t, isUnder(root, path), "%q joined to %q", rel, path)
+		}
+		if err := checkSymlink(rel, target); err == nil {
+			resolved := filepath.Join(root, filepath.Dir(rel), target)
+			assert.True(t, isUnder(root, resolved), "%q -> %q resolved to %q", rel, target, resolved)
+		}
+	})
+}
@@ -336,24 +336,23 @@ func BuildTritonSummary(metadata []TritonCacheMetadata) (*Summary, error) {
 		return nil, errors.New("no metadata provided to summarize")
 	}
 
-	seen := make(map[string]SummaryTargetInfo)
+	// Targets are kept in the order they are first seen, so the summary label is the same for
+	// every build of the cache.
+	seen := make(map[string]bool)
+	var targets []SummaryTargetInfo
 
 	for _, entry := range metadata {
 		key := fmt.Sprintf("%s-%s-%d", entry.Backend, entry.Arch, entry.WarpSize)
-		if _, exists := seen[key]; !exists {
-			seen[key] = SummaryTargetInfo{
+		if !seen[key] {
+			seen[key] = true
+			targets = append(targets, SummaryTargetInfo{
 				Backend:  entry.Backend,
 				Arch:     ConvertArchToString(entry.Arch),
 				WarpSize: entry.WarpSize,
-			}
+			})
 		}
 	}
 
-	targets := make([]SummaryTargetInfo, 0, len(seen))
-	for _, v := range seen {
-		targets = append(targets, v)
-	}
-
 	return &Summary{Targets: targets}, nil
 }
 
@@ -363,12 +362,13 @@ func (t *TritonCache) SetTmpPath(path string) {
 	}
 }
 
-func ExtractTritonCacheDirectory(r io.Reader) (extractedDirs []string, extractedBytes int64, err error) {
+func ExtractTritonCacheDirectory(r io.Reader, limiter *ExtractLimiter) (extractedDirs []string, extractedBytes int64, err error) {
 	return extractCacheAndManifestDirectory(
 		r,
 		constants.MCVTritonCacheDir,
 		"io.triton.manifest/",
 		constants.ExtractCacheDir,
 		constants.ExtractManifestDir,
+		limiter,
 	)
 }
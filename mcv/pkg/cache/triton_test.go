@@ -0,0 +1,28 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildTritonSummaryKeepsTargetOrder(t *testing.T) {
+	metadata := []TritonCacheMetadata{
+		{Hash: "a", Target: Target{Backend: "hip", Arch: "gfx90a", WarpSize: 64}},
+		{Hash: "b", Target: Target{Backend: "cuda", Arch: float64(80), WarpSize: 32}},
+		{Hash: "c", Target: Target{Backend: "hip", Arch: "gfx90a", WarpSize: 64}},
+		{Hash: "d", Target: Target{Backend: "cuda", Arch: float64(75), WarpSize: 32}},
+	}
+
+	// The summary is a label of the image, so it must not change between builds.
+	for range 10 {
+		summary, err := BuildTritonSummary(metadata)
+		require.NoError(t, err)
+		assert.Equal(t, []SummaryTargetInfo{
+			{Backend: "hip", Arch: "gfx90a", WarpSize: 64},
+			{Backend: "cuda", Arch: "80", WarpSize: 32},
+			{Backend: "cuda", Arch: "75", WarpSize: 32},
+		}, summary.Targets)
+	}
+}
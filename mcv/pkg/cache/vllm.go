@@ -152,16 +152,20 @@ func detectAndProcessAOTCache(torchCompileCachePath string) (metadata []VLLMCach
 	logging.Debugf("Detected AOT compile cache format with %d entries", len(aotCacheData))
 	// Group AOT cache entries by hash
 	aotByHash := make(map[string][]AOTCompileCacheMetadata)
+	var hashes []string
 	for _, aotCache := range aotCacheData {
+		if _, exists := aotByHash[aotCache.Hash]; !exists {
+			hashes = append(hashes, aotCache.Hash)
+		}
 		aotByHash[aotCache.Hash] = append(aotByHash[aotCache.Hash], aotCache)
 	}
 
-	// Create metadata entries for each hash
-	for hash, entries := range aotByHash {
+	// Create metadata entries for each hash, in the order the hashes were detected
+	for _, hash := range hashes {
 		vllmMetadata := VLLMCacheMetadata{
 			VllmHash:          hash,
 			CacheFormat:       AOTCompileCacheFormat,
-			AOTCompileEntries: entries,
+			AOTCompileEntries: aotByHash[hash],
 		}
 		logging.Debugf("Adding VLLM AOT compile cache metadata: %+v", vllmMetadata)
 		metadata = append(metadata, vllmMetadata)
@@ -651,7 +655,9 @@ func detectActualGPUInfo() (backend, arch string, warpSize, ptxVersion int) {
 
 // buildBinaryCacheSummary builds a summary from binary cache metadata
 func buildBinaryCacheSummary(metadata []VLLMCacheMetadata) (*Summary, error) {
-	targetMap := make(map[string]SummaryTargetInfo)
+	// Targets are kept in the order they are first seen, so the summary label is stable.
+	targetSeen := make(map[string]bool)
+	var targets []SummaryTargetInfo
 
 	// Detect actual GPU from the system once (not per metadata entry)
 	// NOTE: We detect the actual system GPU rather than trusting VLLM_TARGET_DEVICE
@@ -747,7 +753,8 @@ func buildBinaryCacheSummary(metadata []VLLMCacheMetadata) (*Summary, error) {
 
 			// Create unique key including version info for better cache matching
 			key := fmt.Sprintf("%s-%s-%d-%s-%s", backend, arch, warpSize, cudaVersion, rocmVersion)
-			if _, exists := targetMap[key]; !exists {
+			if !targetSeen[key] {
+				targetSeen[key] = true
 				targetInfo := SummaryTargetInfo{
 					Backend:  backend,
 					Arch:     arch,
@@ -760,16 +767,11 @@ func buildBinaryCacheSummary(metadata []VLLMCacheMetadata) (*Summary, error) {
 				if cudaVersion != "" {
 					targetInfo.CUDAVersion = cudaVersion
 				}
-				targetMap[key] = targetInfo
+				targets = append(targets, targetInfo)
 			}
 		}
 	}
 
-	targets := make([]SummaryTargetInfo, 0, len(targetMap))
-	for _, target := range targetMap {
-		targets = append(targets, target)
-	}
-
 	if len(targets) == 0 {
 		return nil, fmt.Errorf("no targets found in binary cache metadata")
 	}
@@ -924,12 +926,13 @@ func (v *VLLMCache) SetTmpPath(path string) {
 
 // Extracts the vllm cache and manifest in a given reader for tar.gz.
 // This is only used for *compat* variant.
-func ExtractVLLMCacheDirectory(r io.Reader) (extractedDirs []string, extractedBytes int64, err error) {
+func ExtractVLLMCacheDirectory(r io.Reader, limiter *ExtractLimiter) (extractedDirs []string, extractedBytes int64, err error) {
 	return extractCacheAndManifestDirectory(
 		r,
 		constants.MCVVLLMCacheDir,
 		"io.vllm.manifest/",
 		constants.ExtractCacheDir,
 		constants.ExtractManifestDir,
+		limiter,
 	)
 }
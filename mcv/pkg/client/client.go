@@ -13,8 +13,10 @@ import (
 	"github.com/redhat-et/GKM/mcv/pkg/config"
 	"github.com/redhat-et/GKM/mcv/pkg/constants"
 	"github.com/redhat-et/GKM/mcv/pkg/fetcher"
+	"github.com/redhat-et/GKM/mcv/pkg/localimage"
 	"github.com/redhat-et/GKM/mcv/pkg/logformat"
 	"github.com/redhat-et/GKM/mcv/pkg/preflightcheck"
+	"github.com/redhat-et/GKM/mcv/pkg/registries"
 	logging "github.com/sirupsen/logrus"
 )
 
@@ -26,6 +28,26 @@ type Options struct {
 	LogLevel        string // Logging level: debug, info, warning, error
 	EnableBaremetal *bool  // If true, enables full hardware checks including kernel dummy key validation (for baremetal envs only)
 	SkipPrecheck    *bool  // If true, skips summary-level preflight GPU compatibility checks
+	IntegrityFile   string // If set, the integrity manifest of the image is saved to this path after extraction
+	ReuseDir        string // If set, files unchanged from the earlier extraction in this directory are reused
+
+	// Local cache of fetched image layers, keyed by digest, so the same image is not pulled again.
+	LayerCacheDir      string   // Directory of the layer cache; if not specified, defaults to ~/.cache/mcv/layers
+	LayerCacheMaxBytes int64    // Maximum size of the layer cache (0 = default of 10GiB, negative = disable the cache)
+	LayerPeers         []string // Base URLs of layer servers of other hosts, tried before the registry for missing layers
+	CRISocket          string   // Socket of the container runtime to read images it already pulled from; if not specified, /run/containerd/containerd.sock if it exists, "none" to disable
+
+	// Registries configuration images are pulled with: mirrors, insecure and blocked registries, and CA certificates.
+	RegistriesConf   string // Path of a registries.conf; if not specified, the registries.conf of the host is used
+	RegistryCertsDir string // Directory of the CA certificates of each registry as <host[:port]>/*.crt; if not specified, defaults to /etc/containers/certs.d
+	RegistryCABundle string // PEM file of CA certificates trusted for every registry
+	RegistryAuthFile string // Docker config.json or Podman auth.json with registry credentials, used before the default ones
+
+	// Extraction limits (0 = default, negative = no limit). The cache is also never allowed
+	// to be larger than the cache-size-bytes label of the image.
+	MaxExtractBytes     int64 // Maximum bytes of cache files in the image
+	MaxExtractFiles     int   // Maximum number of files, directories and links in the image
+	MaxExtractFileBytes int64 // Maximum size of a single file in the image
 }
 
 type HwOptions struct {
@@ -38,14 +60,29 @@ func InspectCacheImage(img string) (labels map[string]string, err error) {
 		return nil, fmt.Errorf("image name must be specified")
 	}
 
-	_, err = name.ParseReference(img, name.StrictValidation)
-	if err != nil {
-		return nil, fmt.Errorf("error validating image name: %v", err)
+	if err = ValidateImageName(img); err != nil {
+		return nil, err
 	}
 
 	return fetcher.NewImgFetcher().InspectImg(img)
 }
 
+// ValidateImageName checks that img is an image name, or a reference to an image in an OCI
+// layout (oci:<path>[:<reference>]), an OCI archive (oci-archive:<path>[:<reference>]) or a
+// Docker archive (docker-archive:<path>[:<name:tag>]).
+func ValidateImageName(img string) error {
+	if localimage.IsLocal(img) {
+		if _, err := localimage.Parse(img); err != nil {
+			return fmt.Errorf("error validating image name: %v", err)
+		}
+		return nil
+	}
+	if _, err := name.ParseReference(img, name.StrictValidation); err != nil {
+		return fmt.Errorf("error validating image name: %v", err)
+	}
+	return nil
+}
+
 // ExtractCache pulls and extracts a kernel cache from the specified OCI image.
 // It uses the provided options to configure behavior such as GPU checks, logging, and
 // output directory. If GPU checks are enabled, it also verifies hardware compatibility.
@@ -107,12 +144,17 @@ func ExtractCache(opts Options) (matchedIDs, unmatchedIDs []int, err error) {
 		}
 		constants.ExtractCacheDir = cacheDir
 	}
+	constants.ExtractIntegrityFile = opts.IntegrityFile
+	constants.ExtractReuseDir = opts.ReuseDir
+	constants.ExtractMaxBytes = opts.MaxExtractBytes
+	constants.ExtractMaxFiles = opts.MaxExtractFiles
+	constants.ExtractMaxFileBytes = opts.MaxExtractFileBytes
 
 	// If caller asked to skip preflight, do not run it here or downstream.
 	// Otherwise, run it ONCE here, and then set SkipPrecheck=true so downstream won’t repeat it.
 	shouldRunPreflight := config.IsGPUEnabled() && !config.IsSkipPrecheckEnabled()
 	if shouldRunPreflight {
-		matchedIDs, unmatchedIDs, err = PreflightCheck(opts.ImageName)
+		matchedIDs, unmatchedIDs, err = preflightCheck(opts.ImageName, fetcher.NewImgFetcherWithConfig(fetchConfig(opts)))
 		if err != nil {
 			return nil, nil, fmt.Errorf("preflight check failed: %w", err)
 		}
@@ -128,7 +170,7 @@ func ExtractCache(opts Options) (matchedIDs, unmatchedIDs []int, err error) {
 		logging.Debug("Skipping preflight (GPU disabled)")
 	}
 
-	return matchedIDs, unmatchedIDs, fetcher.New().FetchAndExtractCache(opts.ImageName)
+	return matchedIDs, unmatchedIDs, fetcher.NewWithConfig(fetchConfig(opts)).FetchAndExtractCache(opts.ImageName)
 }
 
 // GetSystemGPUInfo returns a summary of GPU devices with information
@@ -213,6 +255,11 @@ func PrintGPUSummary(summary *devices.GPUFleetSummary) {
 //
 // Returns slices of matched and unmatched GPUs, along with any error encountered.
 func PreflightCheck(imageName string) (matchedIDs, unmatchedIDs []int, err error) {
+	return preflightCheck(imageName, fetcher.NewImgFetcher())
+}
+
+// preflightCheck is PreflightCheck of imageName fetched with imgFetcher.
+func preflightCheck(imageName string, imgFetcher fetcher.ImgFetcher) (matchedIDs, unmatchedIDs []int, err error) {
 	if !config.IsInitialized() {
 		if _, err = config.Initialize(config.ConfDir); err != nil {
 			return nil, nil, fmt.Errorf("failed to initialize config: %w", err)
@@ -234,7 +281,7 @@ func PreflightCheck(imageName string) (matchedIDs, unmatchedIDs []int, err error
 	}
 
 	// Fetch the image
-	img, err := fetcher.NewImgFetcher().FetchImg(imageName)
+	img, err := imgFetcher.FetchImg(imageName)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to fetch image: %w", err)
 	}
@@ -253,6 +300,35 @@ func PreflightCheck(imageName string) (matchedIDs, unmatchedIDs []int, err error
 	return matchedIDs, unmatchedIDs, nil
 }
 
+// PreflightCheckImage is PreflightCheck of opts.ImageName, fetched with the layer cache,
+// registries configuration and credentials in opts. The other options are ignored. The fetch
+// options are only used for this call, so it can run while an extraction with other options
+// runs.
+func PreflightCheckImage(opts Options) (matchedIDs, unmatchedIDs []int, err error) {
+	return preflightCheck(opts.ImageName, fetcher.NewImgFetcherWithConfig(fetchConfig(opts)))
+}
+
+// fetchConfig returns the configuration to fetch images with of opts. Only the layer cache
+// directory defaults to the one set in constants.
+func fetchConfig(opts Options) fetcher.Config {
+	cfg := fetcher.Config{
+		LayerCacheDir:      constants.LayerCacheDir,
+		LayerCacheMaxBytes: opts.LayerCacheMaxBytes,
+		LayerPeers:         opts.LayerPeers,
+		CRISocket:          opts.CRISocket,
+		Registries: registries.Config{
+			ConfPath: opts.RegistriesConf,
+			CertsDir: opts.RegistryCertsDir,
+			CABundle: opts.RegistryCABundle,
+		},
+		RegistryAuthFile: opts.RegistryAuthFile,
+	}
+	if opts.LayerCacheDir != "" {
+		cfg.LayerCacheDir = opts.LayerCacheDir
+	}
+	return cfg
+}
+
 func extractGPUIDs(infos []devices.TritonGPUInfo) []int {
 	ids := make([]int, 0, len(infos))
 	for _, ti := range infos {
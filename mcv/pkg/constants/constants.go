@@ -35,6 +35,13 @@ const (
 
 	// Cache type identifiers
 	CacheTypeVLLMTorchCompile = "torch-compile"
+
+	// Default size of the local layer cache, in bytes.
+	DefaultLayerCacheMaxBytes = 10 << 30
+
+	// DefaultCRISocket is the socket of containerd, serving both the CRI ImageService and its
+	// content store.
+	DefaultCRISocket = "/run/containerd/containerd.sock"
 )
 
 // Configurable runtime paths
@@ -42,10 +49,47 @@ var (
 	TritonCacheDir     string
 	ExtractCacheDir    string
 	ExtractManifestDir string
+	// ExtractIntegrityFile, if set, is where the integrity manifest of the extracted
+	// image is saved, so the extracted files can be verified again later.
+	ExtractIntegrityFile string
+	// ExtractReuseDir, if set, is an earlier extraction of the cache whose unchanged files
+	// are reused instead of being written again.
+	ExtractReuseDir string
+	// Limits applied while extracting an image. Zero uses the defaults of the cache
+	// package, a negative value disables the limit.
+	ExtractMaxBytes     int64
+	ExtractMaxFiles     int
+	ExtractMaxFileBytes int64
+	// LayerCacheDir is where the manifests, configs and layers of fetched images are cached
+	// by digest, so the same image is not pulled again. LayerCacheMaxBytes is its size limit:
+	// zero uses DefaultLayerCacheMaxBytes, a negative value disables the cache.
+	LayerCacheDir      string
+	LayerCacheMaxBytes int64
 	VLLMCacheDir       string
 	HasTritonCache     bool
 	HasVLLMCache       bool
 	LogLevels          = []string{"debug", "info", "warning", "error"} // accepted log levels
+
+	// LayerPeers are the base URLs of the layer servers of other hosts, serving their layer
+	// cache. Layers missing from the layer cache are fetched from them first, and from the
+	// registry if no peer has them.
+	LayerPeers []string
+
+	// RegistriesConf is the registries.conf, in the containers-registries.conf(5) format, with
+	// the mirrors, insecure and blocked registries images are pulled with. If empty, the
+	// registries.conf of the host is used. RegistryCertsDir holds the CA certificates of each
+	// registry as <host[:port]>/*.crt, and RegistryCABundle is a PEM file of CA certificates
+	// trusted for every registry.
+	RegistriesConf   string
+	RegistryCertsDir string
+	RegistryCABundle string
+	// RegistryAuthFile is a Docker config.json or Podman auth.json with registry credentials,
+	// used before those of the user and the workload identity of the host.
+	RegistryAuthFile string
+
+	// CRISocket is the socket of the container runtime of the host, used to read the images it
+	// has already pulled. If empty, DefaultCRISocket is used if it exists. "none" disables it.
+	CRISocket string
 )
 
 func init() {
@@ -69,6 +113,13 @@ func init() {
 		HasTritonCache = true
 	}
 
+	// The layer cache outlives MCVBuildDir, which is removed after each extraction.
+	if dir, err := os.UserCacheDir(); err == nil && dir != "" {
+		LayerCacheDir = filepath.Join(dir, "mcv", "layers")
+	} else {
+		LayerCacheDir = filepath.Join(os.TempDir(), "mcv-layers")
+	}
+
 	VLLMCacheDir = filepath.Join(home, VLLMCache)
 	if _, err := os.Stat(VLLMCacheDir); err == nil {
 		HasVLLMCache = true
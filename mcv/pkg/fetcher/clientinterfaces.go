@@ -5,10 +5,13 @@ import (
 	"io"
 
 	"github.com/containers/podman/v5/pkg/bindings/images"
+	"github.com/containers/podman/v5/pkg/domain/entities/types"
+	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/client"
 )
 
 type DockerClient interface {
+	ImageInspect(ctx context.Context, imageID string, options ...client.ImageInspectOption) (image.InspectResponse, error)
 	ImageSave(ctx context.Context, images []string, options ...client.ImageSaveOption) (io.ReadCloser, error)
 	Close() error
 }
@@ -16,4 +19,5 @@ type DockerClient interface {
 type PodmanClient interface {
 	Export(ctx context.Context, names []string, w io.Writer, opts *images.ExportOptions) error
 	Exists(ctx context.Context, name string, opts *images.ExistsOptions) (bool, error)
+	GetImage(ctx context.Context, name string, opts *images.GetOptions) (*types.ImageInspectReport, error)
 }
@@ -0,0 +1,79 @@
+package fetcher
+
+import (
+	"os"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/redhat-et/GKM/mcv/pkg/constants"
+	"github.com/redhat-et/GKM/mcv/pkg/registries"
+)
+
+// Config is the configuration images are fetched with: the layer cache, the layer servers of
+// other hosts, the container runtime and the registries. Each fetcher keeps its own Config, so
+// fetches with different configurations can run at the same time in a process.
+type Config struct {
+	LayerCacheDir      string   // Directory of the layer cache, empty disables it
+	LayerCacheMaxBytes int64    // Maximum size of the layer cache (0 = default, negative = disable the cache)
+	LayerPeers         []string // Base URLs of layer servers of other hosts
+	CRISocket          string   // Socket of the container runtime, empty for the default one, "none" to disable
+	Registries         registries.Config
+	RegistryAuthFile   string // Docker config.json or Podman auth.json with registry credentials
+}
+
+// DefaultConfig returns the Config set in constants, as by the mcv command line.
+func DefaultConfig() Config {
+	return Config{
+		LayerCacheDir:      constants.LayerCacheDir,
+		LayerCacheMaxBytes: constants.LayerCacheMaxBytes,
+		LayerPeers:         constants.LayerPeers,
+		CRISocket:          constants.CRISocket,
+		Registries: registries.Config{
+			ConfPath: constants.RegistriesConf,
+			CertsDir: constants.RegistryCertsDir,
+			CABundle: constants.RegistryCABundle,
+		},
+		RegistryAuthFile: constants.RegistryAuthFile,
+	}
+}
+
+// orDefault returns the Config c points to, or DefaultConfig if it is nil, as for fetchers
+// built without one.
+func (c *Config) orDefault() Config {
+	if c == nil {
+		return DefaultConfig()
+	}
+	return *c
+}
+
+// criSocket returns the CRI socket of the Config, or DefaultCRISocket if it exists, or an empty
+// string if there is none.
+func (c Config) criSocket() string {
+	switch c.CRISocket {
+	case criSocketDisabled:
+		return ""
+	case "":
+		if _, err := os.Stat(constants.DefaultCRISocket); err == nil {
+			return constants.DefaultCRISocket
+		}
+		return ""
+	default:
+		return c.CRISocket
+	}
+}
+
+// remoteOptions returns the options used to pull images and layers from a registry.
+func (c Config) remoteOptions() []remote.Option {
+	return []remote.Option{remote.WithAuthFromKeychain(registries.Keychain(c.RegistryAuthFile))}
+}
+
+// newLayerCache returns the layer cache of the Config, or nil if it is disabled.
+func (c Config) newLayerCache() *layerCache {
+	if c.LayerCacheDir == "" || c.LayerCacheMaxBytes < 0 {
+		return nil
+	}
+	maxBytes := c.LayerCacheMaxBytes
+	if maxBytes == 0 {
+		maxBytes = constants.DefaultLayerCacheMaxBytes
+	}
+	return &layerCache{dir: c.LayerCacheDir, maxBytes: maxBytes, peers: c.LayerPeers}
+}
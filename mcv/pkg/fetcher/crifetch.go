@@ -0,0 +1,344 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	contentapi "github.com/containerd/containerd/api/services/content/v1"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/redhat-et/GKM/mcv/pkg/registries"
+	logging "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+const (
+	// criSocketDisabled as the CRI socket disables the CRI fetcher.
+	criSocketDisabled = "none"
+
+	// Namespace of containerd holding the images pulled through its CRI plugin, and the gRPC
+	// header selecting it.
+	containerdNamespace       = "k8s.io"
+	containerdNamespaceHeader = "containerd-namespace"
+
+	// criStatusTimeout bounds the lookup of an image in the container runtime, so a runtime
+	// that does not answer does not hold up fetching the image from elsewhere.
+	criStatusTimeout = 10 * time.Second
+)
+
+// criFetcher reads the images the container runtime of the host has already pulled, so a Node
+// does not pull them again. The image is looked up with the CRI ImageService, and read from the
+// content store of containerd, which serves both on its socket. Runtimes without a content
+// store on their socket, like CRI-O, only report if they have the image, so it is fetched from
+// the other image stores or the registry.
+//
+// The runtime holds the images pulled with the image pull Secrets of every Pod of the host, and
+// serves them without credentials. So an image is only read from it once the registry confirms
+// the credentials of this pull can read the image.
+type criFetcher struct {
+	images  runtimeapi.ImageServiceClient
+	content contentapi.ContentClient
+	// authorize checks that the manifest or index target of ref can be pulled from the
+	// registry. Replaced in tests.
+	authorize func(ref name.Reference, target v1.Hash) error
+}
+
+func newCRIFetcher(socket string, cfg Config) (*criFetcher, error) {
+	conn, err := grpc.NewClient("unix://"+strings.TrimPrefix(socket, "unix://"),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to CRI socket %s: %w", socket, err)
+	}
+	return &criFetcher{
+		images:  runtimeapi.NewImageServiceClient(conn),
+		content: contentapi.NewContentClient(conn),
+		authorize: func(ref name.Reference, target v1.Hash) error {
+			return authorizeRemote(cfg, ref, target)
+		},
+	}, nil
+}
+
+// authorizeRemote checks with a HEAD request that the manifest or index target of ref can be
+// pulled from its registry, or one of its mirrors, with the credentials of this pull in cfg.
+func authorizeRemote(cfg Config, ref name.Reference, target v1.Hash) error {
+	_, _, _, err := registries.Try(cfg.Registries, ref.Context().Digest(target.String()), cfg.remoteOptions(), remote.Head)
+	return err
+}
+
+func (f *criFetcher) FetchImg(imgName string) (v1.Image, error) {
+	logging.Debugf("Checking for image: %s via CRI", imgName)
+
+	ref, err := name.ParseReference(imgName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image reference %s: %w", imgName, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), criStatusTimeout)
+	defer cancel()
+	resp, err := f.images.ImageStatus(ctx, &runtimeapi.ImageStatusRequest{
+		Image: &runtimeapi.ImageSpec{Image: ref.Name()},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get CRI image status: %w", err)
+	}
+	if resp.GetImage() == nil {
+		return nil, fmt.Errorf("CRI image not found: %s", imgName)
+	}
+	configDigest, err := v1.NewHash(localImageID(resp.GetImage().GetId()))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CRI image ID %q: %w", resp.GetImage().GetId(), err)
+	}
+	target, err := criTargetDigest(ref, resp.GetImage().GetRepoDigests())
+	if err != nil {
+		return nil, err
+	}
+	if err := f.authorize(ref, target); err != nil {
+		return nil, fmt.Errorf("image %s in the container runtime not authorized by the registry: %w", imgName, err)
+	}
+
+	rawManifest, err := f.readBlob(target)
+	if err != nil {
+		return nil, err
+	}
+	manifest, rawManifest, err := f.platformManifest(rawManifest, configDigest)
+	if err != nil {
+		return nil, err
+	}
+	rawConfig, err := f.readBlob(manifest.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+	// containerd removes the layers it has unpacked when discard_unpacked_layers is set, so the
+	// image is only read from the runtime if every layer is still in the content store.
+	if err := f.checkLayers(manifest); err != nil {
+		return nil, err
+	}
+
+	logging.Debugf("Image %s found in the container runtime", imgName)
+	return partial.CompressedToImage(&criImage{
+		fetcher:     f,
+		manifest:    manifest,
+		rawManifest: rawManifest,
+		rawConfig:   rawConfig,
+	})
+}
+
+// criTargetDigest returns the digest of the manifest or index of ref in the container runtime:
+// the digest of ref itself, or the repo digest of its repository.
+func criTargetDigest(ref name.Reference, repoDigests []string) (v1.Hash, error) {
+	if d, ok := ref.(name.Digest); ok {
+		return v1.NewHash(d.DigestStr())
+	}
+	for _, repoDigest := range repoDigests {
+		d, err := name.NewDigest(repoDigest)
+		if err != nil {
+			continue
+		}
+		if d.Context().Name() == ref.Context().Name() {
+			return v1.NewHash(d.DigestStr())
+		}
+	}
+	return v1.Hash{}, fmt.Errorf("no repo digest of %s in the container runtime", ref.Context())
+}
+
+// platformManifest returns the image manifest in rawManifest, or, if rawManifest is an index,
+// the manifest of the image with the config configDigest, which is the one the runtime pulled.
+func (f *criFetcher) platformManifest(rawManifest []byte, configDigest v1.Hash) (*v1.Manifest, []byte, error) {
+	index, err := v1.ParseIndexManifest(bytes.NewReader(rawManifest))
+	if err != nil || !isIndex(index) {
+		manifest, err := v1.ParseManifest(bytes.NewReader(rawManifest))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse image manifest: %w", err)
+		}
+		return manifest, rawManifest, nil
+	}
+
+	for _, desc := range index.Manifests {
+		if desc.MediaType.IsIndex() {
+			continue
+		}
+		// The runtime only stores the manifests of the platforms it pulled.
+		raw, err := f.readBlob(desc.Digest)
+		if err != nil {
+			continue
+		}
+		manifest, err := v1.ParseManifest(bytes.NewReader(raw))
+		if err == nil && manifest.Config.Digest == configDigest {
+			return manifest, raw, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("no manifest with config %s in the container runtime", configDigest)
+}
+
+func isIndex(index *v1.IndexManifest) bool {
+	return index.MediaType.IsIndex() || (index.MediaType == "" && len(index.Manifests) != 0)
+}
+
+// checkLayers checks that the content store holds every layer of manifest, with its size.
+func (f *criFetcher) checkLayers(manifest *v1.Manifest) error {
+	ctx, cancel := context.WithTimeout(
+		metadata.AppendToOutgoingContext(context.Background(), containerdNamespaceHeader, containerdNamespace),
+		criStatusTimeout)
+	defer cancel()
+	for _, desc := range manifest.Layers {
+		resp, err := f.content.Info(ctx, &contentapi.InfoRequest{Digest: desc.Digest.String()})
+		if err != nil {
+			return fmt.Errorf("layer %s not in the container runtime: %w", desc.Digest, err)
+		}
+		if size := resp.GetInfo().GetSize(); size != desc.Size {
+			return fmt.Errorf("layer %s in the container runtime has size %d, expected %d", desc.Digest, size, desc.Size)
+		}
+	}
+	return nil
+}
+
+// readBlob reads the blob h from the content store and checks its digest.
+func (f *criFetcher) readBlob(h v1.Hash) ([]byte, error) {
+	rc, err := f.openBlob(h)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// openBlob streams the blob h from the content store. The digest is checked once it has been
+// read to the end.
+func (f *criFetcher) openBlob(h v1.Hash) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(
+		metadata.AppendToOutgoingContext(context.Background(), containerdNamespaceHeader, containerdNamespace))
+	stream, err := f.content.Read(ctx, &contentapi.ReadContentRequest{Digest: h.String()})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to read %s from the container runtime: %w", h, err)
+	}
+	rc := &contentReader{stream: stream, cancel: cancel}
+	// The first message tells if the runtime has a content store and the blob.
+	if err := rc.fill(); err != nil && !errors.Is(err, io.EOF) {
+		cancel()
+		if status.Code(err) == codes.Unimplemented {
+			return nil, fmt.Errorf("container runtime has no content store: %w", err)
+		}
+		return nil, fmt.Errorf("failed to read %s from the container runtime: %w", h, err)
+	}
+	return &verifyingReader{
+		r:      rc,
+		closer: rc,
+		hasher: sha256.New(),
+		want:   h,
+		onEOF: func(ok bool) error {
+			if !ok {
+				return fmt.Errorf("digest mismatch for %s in the container runtime", h)
+			}
+			return nil
+		},
+	}, nil
+}
+
+// contentReader reads the messages of a content store Read stream.
+type contentReader struct {
+	stream contentapi.Content_ReadClient
+	cancel context.CancelFunc
+	buf    []byte
+	err    error
+}
+
+// fill receives the next non-empty message into buf, or sets err.
+func (r *contentReader) fill() error {
+	for len(r.buf) == 0 && r.err == nil {
+		msg, err := r.stream.Recv()
+		if err != nil {
+			r.err = err
+			break
+		}
+		r.buf = msg.GetData()
+	}
+	if len(r.buf) != 0 {
+		return nil
+	}
+	return r.err
+}
+
+func (r *contentReader) Read(p []byte) (int, error) {
+	if err := r.fill(); err != nil {
+		return 0, err
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *contentReader) Close() error {
+	r.cancel()
+	return nil
+}
+
+// criImage is an image in the content store of the container runtime.
+type criImage struct {
+	fetcher     *criFetcher
+	manifest    *v1.Manifest
+	rawManifest []byte
+	rawConfig   []byte
+}
+
+var _ partial.CompressedImageCore = (*criImage)(nil)
+
+func (i *criImage) RawConfigFile() ([]byte, error) {
+	return i.rawConfig, nil
+}
+
+func (i *criImage) MediaType() (types.MediaType, error) {
+	if i.manifest.MediaType != "" {
+		return i.manifest.MediaType, nil
+	}
+	return types.OCIManifestSchema1, nil
+}
+
+func (i *criImage) RawManifest() ([]byte, error) {
+	return i.rawManifest, nil
+}
+
+func (i *criImage) LayerByDigest(h v1.Hash) (partial.CompressedLayer, error) {
+	for _, desc := range i.manifest.Layers {
+		if desc.Digest == h {
+			return &criLayer{image: i, desc: desc}, nil
+		}
+	}
+	return nil, fmt.Errorf("layer %s not found in the image", h)
+}
+
+// criLayer is a layer of a criImage.
+type criLayer struct {
+	image *criImage
+	desc  v1.Descriptor
+}
+
+func (l *criLayer) Digest() (v1.Hash, error) {
+	return l.desc.Digest, nil
+}
+
+func (l *criLayer) Size() (int64, error) {
+	return l.desc.Size, nil
+}
+
+func (l *criLayer) MediaType() (types.MediaType, error) {
+	return l.desc.MediaType, nil
+}
+
+func (l *criLayer) Compressed() (io.ReadCloser, error) {
+	return l.image.fetcher.openBlob(l.desc.Digest)
+}
@@ -0,0 +1,185 @@
+package fetcher
+
+import (
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/redhat-et/GKM/mcv/pkg/constants"
+	"github.com/redhat-et/GKM/mcv/pkg/fetcher/fakecri"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCRI starts a fake container runtime for the test and returns a CRI fetcher using it. The
+// images of the runtime are not checked against a registry.
+func testCRI(t *testing.T, opts ...fakecri.Option) (*fakecri.Server, *criFetcher) {
+	server, err := fakecri.NewServer(opts...)
+	require.NoError(t, err)
+	t.Cleanup(server.Close)
+	f, err := newCRIFetcher(server.Socket, DefaultConfig())
+	require.NoError(t, err)
+	f.authorize = func(name.Reference, v1.Hash) error { return nil }
+	return server, f
+}
+
+func TestCRIFetcher_FetchesPulledImage(t *testing.T) {
+	server, f := testCRI(t)
+	img, err := random.Image(1024, 2)
+	require.NoError(t, err)
+	require.NoError(t, server.AddImage("quay.io/gkm/cache:v1", img))
+	want, err := img.Digest()
+	require.NoError(t, err)
+
+	for _, ref := range []string{"quay.io/gkm/cache:v1", "quay.io/gkm/cache@" + want.String()} {
+		fetched, err := f.FetchImg(ref)
+		require.NoError(t, err, ref)
+		digest, err := fetched.Digest()
+		require.NoError(t, err)
+		assert.Equal(t, want, digest, ref)
+		assert.Equal(t, 2, readImage(t, fetched), ref)
+	}
+}
+
+func TestCRIFetcher_SelectsPulledPlatformOfIndex(t *testing.T) {
+	server, f := testCRI(t)
+	pulled, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	other, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	index := mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{Add: other},
+		mutate.IndexAddendum{Add: pulled},
+	)
+	require.NoError(t, server.AddIndex("quay.io/gkm/cache:v1", index, pulled))
+
+	fetched, err := f.FetchImg("quay.io/gkm/cache:v1")
+	require.NoError(t, err)
+	want, err := pulled.Digest()
+	require.NoError(t, err)
+	digest, err := fetched.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, want, digest)
+}
+
+func TestCRIFetcher_ImageNotPulled(t *testing.T) {
+	server, f := testCRI(t)
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, server.AddImage("quay.io/gkm/cache:v1", img))
+
+	_, err = f.FetchImg("quay.io/gkm/cache:v2")
+	assert.ErrorContains(t, err, "not found")
+	_, err = f.FetchImg("quay.io/gkm/other:v1")
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestCRIFetcher_CorruptedLayer(t *testing.T) {
+	server, f := testCRI(t)
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, server.AddImage("quay.io/gkm/cache:v1", img))
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	digest, err := layers[0].Digest()
+	require.NoError(t, err)
+	server.CorruptBlob(digest)
+
+	fetched, err := f.FetchImg("quay.io/gkm/cache:v1")
+	require.NoError(t, err)
+	fetchedLayers, err := fetched.Layers()
+	require.NoError(t, err)
+	rc, err := fetchedLayers[0].Compressed()
+	require.NoError(t, err)
+	defer rc.Close()
+	buf := make([]byte, 4096)
+	for err == nil {
+		_, err = rc.Read(buf)
+	}
+	assert.ErrorContains(t, err, "digest mismatch")
+}
+
+func TestCRIFetcher_AuthorizedByRegistry(t *testing.T) {
+	server, f := testCRI(t)
+	f.authorize = func(ref name.Reference, target v1.Hash) error {
+		return authorizeRemote(DefaultConfig(), ref, target)
+	}
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	ref, _ := testRegistry(t, img)
+	require.NoError(t, server.AddImage(ref, img))
+
+	fetched, err := f.FetchImg(ref)
+	require.NoError(t, err)
+	assert.Equal(t, 1, readImage(t, fetched))
+
+	// An image the registry does not serve to this pull is not read from the runtime.
+	other, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	digest, err := other.Digest()
+	require.NoError(t, err)
+	parsed, err := name.NewDigest(ref)
+	require.NoError(t, err)
+	otherRef := parsed.Context().Digest(digest.String()).String()
+	require.NoError(t, server.AddImage(otherRef, other))
+	_, err = f.FetchImg(otherRef)
+	assert.ErrorContains(t, err, "not authorized")
+}
+
+func TestCRIFetcher_DiscardedLayer(t *testing.T) {
+	server, cri := testCRI(t)
+	img, err := random.Image(1024, 2)
+	require.NoError(t, err)
+	ref, _ := testRegistry(t, img)
+	require.NoError(t, server.AddImage(ref, img))
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	digest, err := layers[1].Digest()
+	require.NoError(t, err)
+	server.RemoveBlob(digest)
+
+	_, err = cri.FetchImg(ref)
+	assert.ErrorContains(t, err, "not in the container runtime")
+
+	// The image is fetched from the next source instead.
+	f := &fetcher{local: []Fetcher{cri}, remote: &remoteFetcher{}}
+	fetched, err := f.FetchImg(ref)
+	require.NoError(t, err)
+	assert.Equal(t, 2, readImage(t, fetched))
+	assert.Zero(t, server.Reads(digest))
+}
+
+func TestCRIFetcher_NoContentStore(t *testing.T) {
+	server, f := testCRI(t, fakecri.WithoutContentStore())
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, server.AddImage("quay.io/gkm/cache:v1", img))
+
+	_, err = f.FetchImg("quay.io/gkm/cache:v1")
+	assert.ErrorContains(t, err, "no content store")
+}
+
+func TestCRIFetcher_FallBackToRemote(t *testing.T) {
+	_, cri := testCRI(t, fakecri.WithoutContentStore())
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	ref, _ := testRegistry(t, img)
+
+	f := &fetcher{local: []Fetcher{cri}, remote: &remoteFetcher{}}
+	fetched, err := f.FetchImg(ref)
+	require.NoError(t, err)
+	assert.Equal(t, 1, readImage(t, fetched))
+}
+
+func TestCRISocket(t *testing.T) {
+	saved := constants.CRISocket
+	t.Cleanup(func() { constants.CRISocket = saved })
+
+	constants.CRISocket = "/run/k3s/containerd/containerd.sock"
+	assert.Equal(t, "/run/k3s/containerd/containerd.sock", DefaultConfig().criSocket())
+	constants.CRISocket = "none"
+	assert.Empty(t, DefaultConfig().criSocket())
+}
@@ -12,20 +12,26 @@ import (
 
 type dockerFetcher struct {
 	client DockerClient
+	cfg    *Config // nil is DefaultConfig
 }
 
 // newDockerFetcher creates a new instance of dockerFetcher with a Docker API client.
 // It initializes the client using environment variables and enables API version negotiation.
 // Returns a pointer to dockerFetcher and an error if the client creation fails.
-func newDockerFetcher() (*dockerFetcher, error) {
+func newDockerFetcher(cfg Config) (*dockerFetcher, error) {
 	apiClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Docker client: %w", err)
 	}
-	return &dockerFetcher{client: apiClient}, nil
+	return &dockerFetcher{client: apiClient, cfg: &cfg}, nil
 }
 
 func (d *dockerFetcher) FetchImg(imgName string) (v1.Image, error) {
+	inspect, err := d.client.ImageInspect(context.Background(), imgName)
+	if err != nil {
+		return nil, fmt.Errorf("docker image not found: %w", err)
+	}
+
 	logging.Debugf("Saving Docker image: %s", imgName)
 
 	imageFunc := func(w io.Writer) error {
@@ -38,7 +44,7 @@ func (d *dockerFetcher) FetchImg(imgName string) (v1.Image, error) {
 		return err
 	}
 
-	return fetchToTempTar(imageFunc)
+	return fetchToTempTar(d.cfg.orDefault().newLayerCache(), inspect.ID, imageFunc)
 }
 
 var _ Fetcher = (*dockerFetcher)(nil)
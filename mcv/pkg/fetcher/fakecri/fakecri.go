@@ -0,0 +1,265 @@
+// Package fakecri provides an in-process container runtime for tests, serving the CRI
+// ImageService and the containerd content store on a unix socket, like containerd does.
+package fakecri
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	contentapi "github.com/containerd/containerd/api/services/content/v1"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// Namespace is the containerd namespace images are served from.
+const Namespace = "k8s.io"
+
+// readChunkSize is the size of the messages blobs are streamed in.
+const readChunkSize = 32 << 10
+
+// Server is a fake container runtime. Images added to it are reported by ImageStatus and
+// their blobs served by the content store, unless it was started without one, like CRI-O.
+type Server struct {
+	runtimeapi.UnimplementedImageServiceServer
+	contentapi.UnimplementedContentServer
+
+	// Socket is the path of the unix socket the server listens on.
+	Socket string
+
+	server *grpc.Server
+	dir    string
+
+	mu     sync.Mutex
+	images map[string]*runtimeapi.Image // by repo tag and repo digest
+	blobs  map[string][]byte
+	reads  map[string]int
+}
+
+// Option configures a Server.
+type Option func(*options)
+
+type options struct {
+	noContentStore bool
+}
+
+// WithoutContentStore starts a Server without a content store, like the socket of CRI-O.
+func WithoutContentStore() Option {
+	return func(o *options) { o.noContentStore = true }
+}
+
+// NewServer starts a Server on a unix socket in a new temporary directory.
+func NewServer(opts ...Option) (*Server, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	// Unix socket paths are limited to about 100 bytes, so do not use the test directory.
+	dir, err := os.MkdirTemp("", "fakecri-")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		Socket: filepath.Join(dir, "cri.sock"),
+		server: grpc.NewServer(),
+		dir:    dir,
+		images: map[string]*runtimeapi.Image{},
+		blobs:  map[string][]byte{},
+		reads:  map[string]int{},
+	}
+	listener, err := net.Listen("unix", s.Socket)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	runtimeapi.RegisterImageServiceServer(s.server, s)
+	if !o.noContentStore {
+		contentapi.RegisterContentServer(s.server, s)
+	}
+	go func() { _ = s.server.Serve(listener) }()
+	return s, nil
+}
+
+// Close stops the Server and removes its socket.
+func (s *Server) Close() {
+	s.server.Stop()
+	_ = os.RemoveAll(s.dir)
+}
+
+// AddImage stores img as if the runtime had pulled it as ref, which is a tag or a digest
+// reference.
+func (s *Server) AddImage(ref string, img v1.Image) error {
+	digest, err := img.Digest()
+	if err != nil {
+		return err
+	}
+	return s.add(ref, digest, img)
+}
+
+// AddIndex stores index as if the runtime had pulled it as ref, selecting img, one of its
+// manifests. Only the blobs of img are stored, like a runtime pulling a single platform.
+func (s *Server) AddIndex(ref string, index v1.ImageIndex, img v1.Image) error {
+	digest, err := index.Digest()
+	if err != nil {
+		return err
+	}
+	rawIndex, err := index.RawManifest()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.blobs[digest.String()] = rawIndex
+	s.mu.Unlock()
+	return s.add(ref, digest, img)
+}
+
+// add stores the blobs of img, and the image under ref with the repo digest target.
+func (s *Server) add(ref string, target v1.Hash, img v1.Image) error {
+	parsed, err := name.ParseReference(ref)
+	if err != nil {
+		return err
+	}
+	manifestDigest, err := img.Digest()
+	if err != nil {
+		return err
+	}
+	rawManifest, err := img.RawManifest()
+	if err != nil {
+		return err
+	}
+	configName, err := img.ConfigName()
+	if err != nil {
+		return err
+	}
+	rawConfig, err := img.RawConfigFile()
+	if err != nil {
+		return err
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return err
+	}
+	blobs := map[string][]byte{
+		manifestDigest.String(): rawManifest,
+		configName.String():     rawConfig,
+	}
+	for _, layer := range layers {
+		digest, err := layer.Digest()
+		if err != nil {
+			return err
+		}
+		rc, err := layer.Compressed()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			return err
+		}
+		blobs[digest.String()] = data
+	}
+
+	repoDigest := parsed.Context().Digest(target.String()).String()
+	image := &runtimeapi.Image{
+		Id:          configName.String(),
+		RepoDigests: []string{repoDigest},
+		Size:        1,
+	}
+	if tag, ok := parsed.(name.Tag); ok {
+		image.RepoTags = []string{tag.Name()}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for digest, data := range blobs {
+		s.blobs[digest] = data
+	}
+	s.images[parsed.Name()] = image
+	s.images[repoDigest] = image
+	return nil
+}
+
+// CorruptBlob replaces the content of the blob with digest.
+func (s *Server) CorruptBlob(digest v1.Hash) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data := append([]byte{}, s.blobs[digest.String()]...)
+	if len(data) != 0 {
+		data[len(data)-1] ^= 0xff
+	}
+	s.blobs[digest.String()] = data
+}
+
+// RemoveBlob removes the blob with digest from the content store, like containerd does with the
+// layers it has unpacked when discard_unpacked_layers is set.
+func (s *Server) RemoveBlob(digest v1.Hash) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blobs, digest.String())
+}
+
+// Reads returns the number of reads of the blob with digest from the content store.
+func (s *Server) Reads(digest v1.Hash) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reads[digest.String()]
+}
+
+// ImageStatus implements the CRI ImageService. Unknown images are reported with a nil Image.
+func (s *Server) ImageStatus(_ context.Context, req *runtimeapi.ImageStatusRequest) (*runtimeapi.ImageStatusResponse, error) {
+	ref, err := name.ParseReference(req.GetImage().GetImage())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &runtimeapi.ImageStatusResponse{Image: s.images[ref.Name()]}, nil
+}
+
+// Info implements the containerd content store. Blobs are only reported in Namespace.
+func (s *Server) Info(ctx context.Context, req *contentapi.InfoRequest) (*contentapi.InfoResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if namespaces := md.Get("containerd-namespace"); len(namespaces) != 1 || namespaces[0] != Namespace {
+		return nil, status.Error(codes.FailedPrecondition, "namespace is required")
+	}
+	s.mu.Lock()
+	data, ok := s.blobs[req.GetDigest()]
+	s.mu.Unlock()
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "content digest %s: not found", req.GetDigest())
+	}
+	return &contentapi.InfoResponse{Info: &contentapi.Info{Digest: req.GetDigest(), Size: int64(len(data))}}, nil
+}
+
+// Read implements the containerd content store. Blobs are only served in Namespace.
+func (s *Server) Read(req *contentapi.ReadContentRequest, stream contentapi.Content_ReadServer) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	if namespaces := md.Get("containerd-namespace"); len(namespaces) != 1 || namespaces[0] != Namespace {
+		return status.Error(codes.FailedPrecondition, "namespace is required")
+	}
+	s.mu.Lock()
+	data, ok := s.blobs[req.GetDigest()]
+	if ok {
+		s.reads[req.GetDigest()]++
+	}
+	s.mu.Unlock()
+	if !ok {
+		return status.Errorf(codes.NotFound, "content digest %s: not found", req.GetDigest())
+	}
+	for offset := 0; offset < len(data); offset += readChunkSize {
+		end := min(offset+readChunkSize, len(data))
+		if err := stream.Send(&contentapi.ReadContentResponse{Offset: int64(offset), Data: data[offset:end]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
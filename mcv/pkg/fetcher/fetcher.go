@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path"
 	"path/filepath"
+	"strings"
 
+	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/redhat-et/GKM/mcv/pkg/constants"
+	"github.com/redhat-et/GKM/mcv/pkg/localimage"
 	"github.com/redhat-et/GKM/mcv/pkg/utils"
 	logging "github.com/sirupsen/logrus"
 )
@@ -20,10 +22,16 @@ type Fetcher interface {
 type fetcher struct {
 	local  []Fetcher
 	remote Fetcher
+	cfg    *Config // nil is DefaultConfig
 }
 
 // Factory function to create a new Fetcher with the specified backend.
 func NewFetcher() Fetcher {
+	return NewFetcherWithConfig(DefaultConfig())
+}
+
+// NewFetcherWithConfig creates a new Fetcher that fetches images with cfg.
+func NewFetcherWithConfig(cfg Config) Fetcher {
 	var localFetchers []Fetcher
 
 	addFetcher := func(fetcher Fetcher, err error) {
@@ -34,17 +42,40 @@ func NewFetcher() Fetcher {
 		}
 	}
 
+	// The container runtime of the Node is tried first, it has the images its Pods use.
+	if socket := cfg.criSocket(); socket != "" {
+		addFetcher(newCRIFetcher(socket, cfg))
+	}
 	if utils.HasApp("docker") {
-		addFetcher(newDockerFetcher())
+		addFetcher(newDockerFetcher(cfg))
 	}
 	if utils.HasApp("podman") {
-		addFetcher(newPodmanFetcher())
+		addFetcher(newPodmanFetcher(cfg))
 	}
 
-	return &fetcher{local: localFetchers, remote: &remoteFetcher{}}
+	return &fetcher{local: localFetchers, remote: &remoteFetcher{cfg: &cfg}, cfg: &cfg}
 }
 
 func (f *fetcher) FetchImg(imgName string) (v1.Image, error) {
+	// A local image is only read from its OCI layout or archive.
+	if localimage.IsLocal(imgName) {
+		return fetchLocalImg(imgName)
+	}
+
+	// An image pinned by digest is the same wherever it comes from, so use the layer cache
+	// without asking the local stores or the registry.
+	cfg := f.cfg.orDefault()
+	if c := cfg.newLayerCache(); c != nil {
+		if ref, err := name.NewDigest(imgName); err == nil {
+			if repo, opts, err := preferredSource(cfg, ref); err == nil {
+				if img, err := c.lookup(ref, repo, opts...); err == nil {
+					logging.Debugf("Image %s found in the layer cache", imgName)
+					return img, nil
+				}
+			}
+		}
+	}
+
 	// Try to fetch locally first
 	for _, localFetcher := range f.local {
 		logging.Debugf("Trying local fetcher: %T", localFetcher)
@@ -68,7 +99,33 @@ func (f *fetcher) FetchImg(imgName string) (v1.Image, error) {
 	return img, nil
 }
 
-func fetchToTempTar(fetchFn func(io.Writer) error) (v1.Image, error) {
+// fetchLocalImg reads the image in the OCI layout, OCI archive or Docker archive imgName refers
+// to. OCI archives are unpacked in MCVBuildDir, which is removed after the extraction.
+func fetchLocalImg(imgName string) (v1.Image, error) {
+	ref, err := localimage.Parse(imgName)
+	if err != nil {
+		return nil, err
+	}
+	img, err := ref.Image(filepath.Join(constants.MCVBuildDir, constants.CacheDir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch image: %w", err)
+	}
+	logging.Debugf("Image %s read from %s", ref.Reference, ref.Path)
+	return img, nil
+}
+
+// fetchToTempTar saves the image with the ID id in a local image store to a tarball with fetchFn
+// and loads it. With the layer cache c, the image is loaded from the cache if it is there, or
+// added to it and the tarball removed, so the image is only saved once.
+func fetchToTempTar(c *layerCache, id string, fetchFn func(io.Writer) error) (v1.Image, error) {
+	imageID, idErr := v1.NewHash(localImageID(id))
+	if c != nil && idErr == nil {
+		if img, err := c.lookupLocal(imageID); err == nil {
+			logging.Debugf("Image %s found in the layer cache", id)
+			return img, nil
+		}
+	}
+
 	tmpDir := filepath.Join(constants.MCVBuildDir, constants.CacheDir)
 
 	if err := os.MkdirAll(tmpDir, 0755); err != nil {
@@ -76,11 +133,11 @@ func fetchToTempTar(fetchFn func(io.Writer) error) (v1.Image, error) {
 	}
 	logging.Debugf("cache tmp extract dir: %s", tmpDir)
 
-	tarballFilePath := path.Join(tmpDir, "tmp.tar")
-	tarballFile, err := os.Create(tarballFilePath)
+	tarballFile, err := os.CreateTemp(tmpDir, "image-*.tar")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create tarball file: %v", err)
 	}
+	tarballFilePath := tarballFile.Name()
 
 	if err := fetchFn(tarballFile); err != nil {
 		tarballFile.Close() // Close on error too
@@ -94,5 +151,26 @@ func fetchToTempTar(fetchFn func(io.Writer) error) (v1.Image, error) {
 
 	logging.Debugf("Saved image to tarball: %s", tarballFilePath)
 
-	return loadImageFromTarball(tarballFilePath)
+	img, err := loadImageFromTarball(tarballFilePath)
+	if err != nil || c == nil || idErr != nil {
+		return img, err
+	}
+	cached, err := c.putLocal(imageID, img)
+	if err != nil {
+		logging.Warnf("Failed to add image to the layer cache: %v", err)
+		return img, nil
+	}
+	if err := os.Remove(tarballFilePath); err != nil {
+		logging.Debugf("Failed to remove tarball %s: %v", tarballFilePath, err)
+	}
+	return cached, nil
+}
+
+// localImageID returns the ID of an image in a local image store as a digest. Some stores
+// report it without the algorithm.
+func localImageID(id string) string {
+	if id != "" && !strings.Contains(id, ":") {
+		return "sha256:" + id
+	}
+	return id
 }
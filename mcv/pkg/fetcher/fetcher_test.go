@@ -5,10 +5,17 @@ import (
 	"context"
 	"errors"
 	"io"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/containers/podman/v5/pkg/bindings/images"
+	"github.com/containers/podman/v5/pkg/domain/entities/types"
+	"github.com/containers/podman/v5/pkg/inspect"
+	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/client"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/redhat-et/GKM/mcv/pkg/localimage"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -17,6 +24,13 @@ type mockDockerClient struct {
 	shouldFail bool
 }
 
+func (m *mockDockerClient) ImageInspect(ctx context.Context, imageID string, options ...client.ImageInspectOption) (image.InspectResponse, error) {
+	if m.shouldFail {
+		return image.InspectResponse{}, errors.New("mock docker failure")
+	}
+	return image.InspectResponse{ID: "sha256:" + strings.Repeat("a", 64)}, nil
+}
+
 func (m *mockDockerClient) ImageSave(ctx context.Context, imgs []string, options ...client.ImageSaveOption) (io.ReadCloser, error) {
 	if m.shouldFail {
 		return nil, errors.New("mock docker failure")
@@ -37,6 +51,10 @@ func (m *mockPodmanClient) Exists(ctx context.Context, name string, opts *images
 	return m.exists, nil
 }
 
+func (m *mockPodmanClient) GetImage(ctx context.Context, name string, opts *images.GetOptions) (*types.ImageInspectReport, error) {
+	return &types.ImageInspectReport{ImageData: &inspect.ImageData{ID: strings.Repeat("b", 64)}}, nil
+}
+
 func (m *mockPodmanClient) Export(ctx context.Context, names []string, w io.Writer, opts *images.ExportOptions) error {
 	if m.exportErr != nil {
 		return m.exportErr
@@ -110,3 +128,21 @@ func TestLoadImageFromTarball(t *testing.T) {
 	_, err := loadImageFromTarball("/tmp/nonexistent.tar")
 	assert.Error(t, err)
 }
+
+func TestFetcher_LocalImage(t *testing.T) {
+	img, err := random.Image(1024, 2)
+	assert.NoError(t, err)
+	image := "oci-archive:" + filepath.Join(t.TempDir(), "cache.tar") + ":v1"
+	ref, err := localimage.Parse(image)
+	assert.NoError(t, err)
+	assert.NoError(t, ref.Write(img))
+
+	// Neither the local image stores nor the registry are used.
+	f := &fetcher{local: []Fetcher{&dockerFetcher{client: &mockDockerClient{shouldFail: true}}}, remote: &remoteFetcher{}}
+	fetched, err := f.FetchImg(image)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, readImage(t, fetched))
+
+	_, err = f.FetchImg("oci:" + filepath.Join(t.TempDir(), "missing"))
+	assert.ErrorContains(t, err, "OCI layout")
+}
@@ -21,6 +21,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -64,6 +65,11 @@ type ImgMgr interface {
 
 // Factory function to create a new ImgMgr.
 func New() ImgMgr {
+	return NewWithConfig(DefaultConfig())
+}
+
+// NewWithConfig creates a new ImgMgr that fetches images with cfg.
+func NewWithConfig(cfg Config) ImgMgr {
 	var a accelerator.Accelerator
 
 	if config.IsGPUEnabled() {
@@ -79,7 +85,7 @@ func New() ImgMgr {
 	}
 
 	return &imgMgr{
-		fetcher:   NewImgFetcher(),
+		fetcher:   NewImgFetcherWithConfig(cfg),
 		extractor: &cacheExtractor{acc: a},
 	}
 }
@@ -140,6 +146,11 @@ func NewImgFetcher() ImgFetcher {
 	return &imgFetcher{fetcher: NewFetcher()}
 }
 
+// NewImgFetcherWithConfig creates a new ImgFetcher that fetches images with cfg.
+func NewImgFetcherWithConfig(cfg Config) ImgFetcher {
+	return &imgFetcher{fetcher: NewFetcherWithConfig(cfg)}
+}
+
 // FetchImg pulls the image from the registry and extracts the Triton or vLLM Cache
 func (i *imgFetcher) FetchImg(imgName string) (v1.Image, error) {
 	if i.fetcher == nil {
@@ -242,20 +253,45 @@ func (e *cacheExtractor) ExtractCache(img v1.Image) error {
 	// MCV create (docker/buildah) produces *compat* images with standard layer media types.
 	// Try compat extraction first regardless of manifest type, then fall back to the *oci*
 	// artifact variant which uses custom application/cache.<type>.content.layer.v1+<type> layers.
-	extractedDirs, extractedBytes, extractErr = extractCompatImg(img, ct)
-	if extractErr != nil {
-		extractedDirs, extractedBytes, extractErr = extractOCIArtifactImg(img, ct)
+	// An image whose layers were rejected is not tried again as the other variant.
+	limits := extractLimits(labels, ct)
+	var archiveErr *cache.ArchiveError
+	var reuse *cache.ReuseSource
+	newLimiter := func() *cache.ExtractLimiter {
+		limiter := cache.NewExtractLimiter(limits)
+		if constants.ExtractReuseDir != "" {
+			reuse = cache.NewReuseSource(constants.ExtractReuseDir)
+			limiter.SetReuseSource(reuse)
+		}
+		return limiter
+	}
+	extractedDirs, extractedBytes, extractErr = extractCompatImg(img, ct, newLimiter())
+	if extractErr != nil && !errors.As(extractErr, &archiveErr) {
+		extractedDirs, extractedBytes, extractErr = extractOCIArtifactImg(img, ct, newLimiter())
 	}
 
 	if extractErr != nil {
 		return fmt.Errorf("could not extract %s Cache: %w", ct, extractErr)
 	}
+	if reuse != nil {
+		logging.Infof("Reused %d unchanged files (%d bytes) from %s", reuse.Files(), reuse.Bytes(), constants.ExtractReuseDir)
+	}
 
 	// Validate extracted cache size matches the image label (bytes written this run only).
 	if err := validateExtractedCacheSize(labels, ct, extractedBytes); err != nil {
 		logging.Warnf("Cache size validation: %v", err)
 	}
 
+	// Verify every file listed in the integrity manifest of the image.
+	if err := verifyExtractedIntegrity(); err != nil {
+		for _, dir := range extractedDirs {
+			if rmErr := os.RemoveAll(dir); rmErr != nil {
+				logging.Warnf("Failed to clean up extracted kernel dir %s: %v", dir, rmErr)
+			}
+		}
+		return err
+	}
+
 	// Full manifest compatibility check (after extraction)
 	manifestPath := filepath.Join(constants.ExtractManifestDir, constants.ManifestFileName)
 	if config.IsGPUEnabled() && config.IsBaremetalEnabled() && !config.IsSkipPrecheckEnabled() {
@@ -293,7 +329,7 @@ func (i *imgMgr) FetchAndExtractCache(imgName string) error {
 
 // extractOCIArtifactImg extracts the triton/vllm cache from the
 // *oci* variant Kernel Cache image:  //TODO ADD URL
-func extractOCIArtifactImg(img v1.Image, cacheType string) (extractedDirs []string, extractedBytes int64, err error) {
+func extractOCIArtifactImg(img v1.Image, cacheType string, limiter *cache.ExtractLimiter) (extractedDirs []string, extractedBytes int64, err error) {
 	if cacheType == "" {
 		return nil, 0, fmt.Errorf("cache type is empty")
 	}
@@ -338,9 +374,9 @@ func extractOCIArtifactImg(img v1.Image, cacheType string) (extractedDirs []stri
 	}
 	defer r.Close()
 
-	dirs, bytesWritten, err := cache.ExtractCacheDirectory(r, cacheType)
+	dirs, bytesWritten, err := cache.ExtractCacheDirectory(r, cacheType, limiter)
 	if err != nil {
-		return nil, 0, fmt.Errorf("could not extract %s Kernel Cache: %v", cacheType, err)
+		return nil, 0, fmt.Errorf("could not extract %s Kernel Cache: %w", cacheType, err)
 	}
 	return dirs, bytesWritten, nil
 }
@@ -351,7 +387,7 @@ func isCompatLayerMediaType(mt types.MediaType) bool {
 
 // extractCompatImg extracts cache from compat-format images (standard tar.gz layers).
 // See mcv/docs/spec-compat.md.
-func extractCompatImg(img v1.Image, cacheType string) (extractedDirs []string, extractedBytes int64, err error) {
+func extractCompatImg(img v1.Image, cacheType string, limiter *cache.ExtractLimiter) (extractedDirs []string, extractedBytes int64, err error) {
 	if cacheType == "" {
 		return nil, 0, fmt.Errorf("cache type is empty")
 	}
@@ -386,10 +422,10 @@ func extractCompatImg(img v1.Image, cacheType string) (extractedDirs []string, e
 			return nil, 0, fmt.Errorf("could not get layer content: %v", err)
 		}
 
-		dirs, bytesWritten, err := cache.ExtractCacheDirectory(r, cacheType)
+		dirs, bytesWritten, err := cache.ExtractCacheDirectory(r, cacheType, limiter)
 		r.Close()
 		if err != nil {
-			return nil, 0, fmt.Errorf("could not extract %s Kernel Cache: %v", cacheType, err)
+			return nil, 0, fmt.Errorf("could not extract %s Kernel Cache: %w", cacheType, err)
 		}
 		extractedDirs = append(extractedDirs, dirs...)
 		extractedBytes += bytesWritten
@@ -397,16 +433,78 @@ func extractCompatImg(img v1.Image, cacheType string) (extractedDirs []string, e
 	return extractedDirs, extractedBytes, nil
 }
 
-// validateExtractedCacheSize validates that the extracted cache size matches the image label.
-func validateExtractedCacheSize(labels map[string]string, cacheType string, extractedBytes int64) error {
-	var labelKey string
+// verifyExtractedIntegrity checks the extracted cache files against the integrity manifest
+// of the image, and saves the manifest to constants.ExtractIntegrityFile if it is set.
+// Images built before the integrity manifest was added are only logged.
+func verifyExtractedIntegrity() error {
+	manifestPath := filepath.Join(constants.ExtractManifestDir, cache.IntegrityFileName)
+	integrity, err := cache.ReadIntegrityManifest(manifestPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		logging.Warnf("Image has no integrity manifest, skipping file verification")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("integrity check failed: %w", err)
+	}
+
+	issues, err := integrity.Verify(constants.ExtractCacheDir)
+	if err != nil {
+		return fmt.Errorf("integrity check failed: %w", err)
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("integrity check failed: %s", cache.IntegrityIssuesMessage(issues))
+	}
+	logging.Infof("Verified %d files against the integrity manifest", len(integrity.Files))
+
+	if constants.ExtractIntegrityFile != "" {
+		if err := cache.WriteIntegrityManifest(constants.ExtractIntegrityFile, integrity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cacheSizeLabelKey returns the label holding the cache size of an image of cacheType.
+func cacheSizeLabelKey(cacheType string) (string, error) {
 	switch cacheType {
 	case constants.Triton:
-		labelKey = "cache.triton.image/cache-size-bytes"
+		return "cache.triton.image/cache-size-bytes", nil
 	case constants.VLLM:
-		labelKey = "cache.vllm.image/cache-size-bytes"
+		return "cache.vllm.image/cache-size-bytes", nil
 	default:
-		return fmt.Errorf("unsupported cache type: %s", cacheType)
+		return "", fmt.Errorf("unsupported cache type: %s", cacheType)
+	}
+}
+
+// extractLimits returns the limits for extracting an image: the configured limits, and the
+// cache size from the image labels. Extraction stops as soon as the cache is larger than its
+// label, a smaller cache is reported by validateExtractedCacheSize.
+func extractLimits(labels map[string]string, cacheType string) cache.ExtractLimits {
+	limits := cache.DefaultExtractLimits()
+	if constants.ExtractMaxBytes != 0 {
+		limits.MaxTotalBytes = max(constants.ExtractMaxBytes, 0)
+	}
+	if constants.ExtractMaxFiles != 0 {
+		limits.MaxFiles = max(constants.ExtractMaxFiles, 0)
+	}
+	if constants.ExtractMaxFileBytes != 0 {
+		limits.MaxFileBytes = max(constants.ExtractMaxFileBytes, 0)
+	}
+
+	if labelKey, err := cacheSizeLabelKey(cacheType); err == nil {
+		if size, err := strconv.ParseInt(labels[labelKey], 10, 64); err == nil && size > 0 {
+			limits.LabelBytes = size
+		}
+	}
+	logging.Debugf("Extract limits: %+v", limits)
+	return limits
+}
+
+// validateExtractedCacheSize validates that the extracted cache size matches the image label.
+func validateExtractedCacheSize(labels map[string]string, cacheType string, extractedBytes int64) error {
+	labelKey, err := cacheSizeLabelKey(cacheType)
+	if err != nil {
+		return err
 	}
 
 	expectedSizeStr, ok := labels[labelKey]
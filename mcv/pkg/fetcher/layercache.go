@@ -0,0 +1,518 @@
+package fetcher
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	logging "github.com/sirupsen/logrus"
+)
+
+const (
+	// Layout of the layer cache directory. Blobs are the manifests, configs and compressed
+	// layers, stored by digest. Aliases map the digest of a reference that is not the image
+	// manifest itself, like an index, or the ID of an image in a local store, to the digest
+	// of the image manifest.
+	layerCacheBlobsDir  = "blobs"
+	layerCacheRefsDir   = "refs"
+	layerCacheLocalDir  = "local"
+	layerCacheTmpDir    = "tmp"
+	layerCacheTmpMaxAge = time.Hour
+
+	// Bytes read past the point a layer reader is closed, to reach the end of the blob.
+	layerCacheDrainBytes = 1 << 20
+)
+
+// errNotCached is returned when an image or blob is not in the layer cache.
+var errNotCached = errors.New("not in the layer cache")
+
+// layerCache is a cache of the manifests, configs and compressed layers of images on the
+// local disk, keyed by digest. It is shared by every MCV process using the same directory:
+// blobs are only moved into place once complete and verified, and the least recently used
+// blobs are removed when the cache grows larger than maxBytes.
+type layerCache struct {
+	dir      string
+	maxBytes int64
+	peers    []string // Layer servers of other hosts missing blobs are fetched from first
+}
+
+func (c *layerCache) blobPath(h v1.Hash) string {
+	return filepath.Join(c.dir, layerCacheBlobsDir, h.Algorithm, h.Hex)
+}
+
+func (c *layerCache) aliasPath(kind string, h v1.Hash) string {
+	return filepath.Join(c.dir, kind, h.Algorithm, h.Hex)
+}
+
+// lookup returns the image of ref from the cache. Layers missing from the cache are pulled
+// from repo, the repository of ref or a mirror of it, when they are read, and added to the
+// cache.
+func (c *layerCache) lookup(ref name.Digest, repo name.Repository, opts ...remote.Option) (v1.Image, error) {
+	h, err := v1.NewHash(ref.DigestStr())
+	if err != nil {
+		return nil, err
+	}
+	return c.image(c.resolve(layerCacheRefsDir, h), &repo, opts)
+}
+
+// lookupLocal returns the image with the ID id in a local image store from the cache. Only
+// images with every layer in the cache are returned, since there is no registry to pull
+// missing layers from.
+func (c *layerCache) lookupLocal(id v1.Hash) (v1.Image, error) {
+	return c.image(c.resolve(layerCacheLocalDir, id), nil, nil)
+}
+
+// putRemote adds the manifest and config of img, pulled for ref, to the cache and returns an
+// image that adds its layers to the cache as they are read.
+func (c *layerCache) putRemote(ref name.Reference, img v1.Image, opts ...remote.Option) (v1.Image, error) {
+	digest, err := c.putManifest(img)
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := ref.(name.Digest); ok && d.DigestStr() != digest.String() {
+		// The reference is an index, the image is the manifest selected from it.
+		h, err := v1.NewHash(d.DigestStr())
+		if err != nil {
+			return nil, err
+		}
+		if err := c.writeAlias(layerCacheRefsDir, h, digest); err != nil {
+			return nil, err
+		}
+	}
+	c.gc()
+	repo := ref.Context()
+	return c.image(digest, &repo, opts)
+}
+
+// putLocal adds img, with the ID id in a local image store, and all its layers to the cache
+// and returns the cached image.
+func (c *layerCache) putLocal(id v1.Hash, img v1.Image) (v1.Image, error) {
+	digest, err := c.putManifest(img)
+	if err != nil {
+		return nil, err
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+	for _, layer := range layers {
+		h, err := layer.Digest()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(c.blobPath(h)); err == nil {
+			continue
+		}
+		rc, err := layer.Compressed()
+		if err != nil {
+			return nil, err
+		}
+		err = c.writeBlob(h, rc)
+		_ = rc.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := c.writeAlias(layerCacheLocalDir, id, digest); err != nil {
+		return nil, err
+	}
+	c.gc()
+	return c.image(digest, nil, nil)
+}
+
+// putManifest adds the manifest and config of img to the cache and returns the digest of
+// the manifest.
+func (c *layerCache) putManifest(img v1.Image) (v1.Hash, error) {
+	digest, err := img.Digest()
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	rawManifest, err := img.RawManifest()
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	configName, err := img.ConfigName()
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	rawConfig, err := img.RawConfigFile()
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	if err := c.writeBlob(configName, bytes.NewReader(rawConfig)); err != nil {
+		return v1.Hash{}, err
+	}
+	if err := c.writeBlob(digest, bytes.NewReader(rawManifest)); err != nil {
+		return v1.Hash{}, err
+	}
+	return digest, nil
+}
+
+// resolve returns the digest of the image manifest the alias of kind for h points to, or h if
+// there is no such alias.
+func (c *layerCache) resolve(kind string, h v1.Hash) v1.Hash {
+	data, err := os.ReadFile(c.aliasPath(kind, h))
+	if err != nil {
+		return h
+	}
+	target, err := v1.NewHash(strings.TrimSpace(string(data)))
+	if err != nil {
+		return h
+	}
+	return target
+}
+
+// image returns the image with the manifest digest from the cache. With a nil repo, every
+// layer must be in the cache.
+func (c *layerCache) image(digest v1.Hash, repo *name.Repository, opts []remote.Option) (v1.Image, error) {
+	rawManifest, err := c.readBlob(digest)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := v1.ParseManifest(bytes.NewReader(rawManifest))
+	if err != nil {
+		return nil, fmt.Errorf("invalid cached manifest %s: %w", digest, err)
+	}
+	rawConfig, err := c.readBlob(manifest.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+	if repo == nil {
+		for _, desc := range manifest.Layers {
+			if _, err := os.Stat(c.blobPath(desc.Digest)); err != nil {
+				return nil, errNotCached
+			}
+		}
+	}
+	return partial.CompressedToImage(&cachedImage{
+		cache:       c,
+		manifest:    manifest,
+		rawManifest: rawManifest,
+		rawConfig:   rawConfig,
+		repo:        repo,
+		opts:        opts,
+	})
+}
+
+// readBlob returns the content of the small blob h, after checking its digest.
+func (c *layerCache) readBlob(h v1.Hash) ([]byte, error) {
+	path := c.blobPath(h)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errNotCached
+	} else if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if h.Algorithm != "sha256" || hex.EncodeToString(sum[:]) != h.Hex {
+		_ = os.Remove(path)
+		return nil, errNotCached
+	}
+	c.touch(path)
+	return data, nil
+}
+
+// openBlob opens the blob h. Its digest is checked as it is read.
+func (c *layerCache) openBlob(h v1.Hash) (io.ReadCloser, error) {
+	path := c.blobPath(h)
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errNotCached
+	} else if err != nil {
+		return nil, err
+	}
+	c.touch(path)
+	return &verifyingReader{
+		r:      f,
+		closer: f,
+		hasher: sha256.New(),
+		want:   h,
+		onEOF: func(ok bool) error {
+			if !ok {
+				_ = os.Remove(path)
+				return fmt.Errorf("cached blob %s is corrupted", h)
+			}
+			return nil
+		},
+	}, nil
+}
+
+// writeBlob writes r to the cache as the blob h, if its digest matches.
+func (c *layerCache) writeBlob(h v1.Hash, r io.Reader) error {
+	if h.Algorithm != "sha256" {
+		return fmt.Errorf("unsupported digest algorithm %q", h.Algorithm)
+	}
+	tmp, err := c.createTemp()
+	if err != nil {
+		return err
+	}
+	hasher := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hasher), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && hex.EncodeToString(hasher.Sum(nil)) != h.Hex {
+		err = fmt.Errorf("digest mismatch for blob %s", h)
+	}
+	if err == nil {
+		err = c.commit(tmp.Name(), c.blobPath(h))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// writeAlias points the alias of kind for h to the image manifest target.
+func (c *layerCache) writeAlias(kind string, h, target v1.Hash) error {
+	tmp, err := c.createTemp()
+	if err != nil {
+		return err
+	}
+	_, err = tmp.WriteString(target.String() + "\n")
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = c.commit(tmp.Name(), c.aliasPath(kind, h))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (c *layerCache) createTemp() (*os.File, error) {
+	tmpDir := filepath.Join(c.dir, layerCacheTmpDir)
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(tmpDir, "blob-")
+}
+
+// commit moves the complete file tmpPath into place at path.
+func (c *layerCache) commit(tmpPath, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// touch records that the blob at path was used, for the least recently used eviction.
+func (c *layerCache) touch(path string) {
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+}
+
+// gc removes the least recently used blobs until the cache is no larger than maxBytes, and
+// the leftovers of interrupted writes.
+func (c *layerCache) gc() {
+	type blob struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var blobs []blob
+	var total int64
+	_ = filepath.WalkDir(filepath.Join(c.dir, layerCacheBlobsDir), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		blobs = append(blobs, blob{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+
+	if total > c.maxBytes {
+		sort.Slice(blobs, func(i, j int) bool { return blobs[i].modTime.Before(blobs[j].modTime) })
+		for _, b := range blobs {
+			if total <= c.maxBytes {
+				break
+			}
+			if err := os.Remove(b.path); err != nil {
+				continue
+			}
+			total -= b.size
+			logging.Debugf("Removed %s (%d bytes) from the layer cache", filepath.Base(b.path), b.size)
+		}
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(c.dir, layerCacheTmpDir))
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) > layerCacheTmpMaxAge {
+			_ = os.Remove(filepath.Join(c.dir, layerCacheTmpDir, entry.Name()))
+		}
+	}
+}
+
+// cachedImage is an image whose manifest and config are in the layer cache. Its layers are
+// read from the cache, or pulled from repo and added to the cache.
+type cachedImage struct {
+	cache       *layerCache
+	manifest    *v1.Manifest
+	rawManifest []byte
+	rawConfig   []byte
+	repo        *name.Repository
+	opts        []remote.Option
+}
+
+var _ partial.CompressedImageCore = (*cachedImage)(nil)
+
+func (i *cachedImage) RawConfigFile() ([]byte, error) {
+	return i.rawConfig, nil
+}
+
+func (i *cachedImage) MediaType() (types.MediaType, error) {
+	if i.manifest.MediaType != "" {
+		return i.manifest.MediaType, nil
+	}
+	return types.OCIManifestSchema1, nil
+}
+
+func (i *cachedImage) RawManifest() ([]byte, error) {
+	return i.rawManifest, nil
+}
+
+func (i *cachedImage) LayerByDigest(h v1.Hash) (partial.CompressedLayer, error) {
+	for _, desc := range i.manifest.Layers {
+		if desc.Digest == h {
+			return &cachedLayer{image: i, desc: desc}, nil
+		}
+	}
+	return nil, fmt.Errorf("layer %s not found in the image", h)
+}
+
+// cachedLayer is a layer of a cachedImage.
+type cachedLayer struct {
+	image *cachedImage
+	desc  v1.Descriptor
+}
+
+func (l *cachedLayer) Digest() (v1.Hash, error) {
+	return l.desc.Digest, nil
+}
+
+func (l *cachedLayer) Size() (int64, error) {
+	return l.desc.Size, nil
+}
+
+func (l *cachedLayer) MediaType() (types.MediaType, error) {
+	return l.desc.MediaType, nil
+}
+
+// Compressed reads the layer from the cache. A layer missing from the cache is fetched from
+// the layer peers, or else pulled, and added to the cache once it was read completely and its
+// digest matches.
+func (l *cachedLayer) Compressed() (io.ReadCloser, error) {
+	c := l.image.cache
+	if rc, err := c.openBlob(l.desc.Digest); err == nil {
+		logging.Debugf("Layer %s read from the layer cache", l.desc.Digest)
+		return rc, nil
+	}
+	if l.image.repo == nil {
+		return nil, fmt.Errorf("layer %s: %w", l.desc.Digest, errNotCached)
+	}
+	if rc, err := c.fetchFromPeers(l.desc.Digest); err == nil {
+		return rc, nil
+	}
+
+	layer, err := remote.Layer(l.image.repo.Digest(l.desc.Digest.String()), l.image.opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch layer %s: %w", l.desc.Digest, err)
+	}
+	rc, err := layer.Compressed()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch layer %s: %w", l.desc.Digest, err)
+	}
+	tmp, err := c.createTemp()
+	if err != nil {
+		// The layer is still read, it is only not cached.
+		logging.Debugf("Unable to cache layer %s: %v", l.desc.Digest, err)
+		return rc, nil
+	}
+	return &verifyingReader{
+		r:      io.TeeReader(rc, tmp),
+		closer: rc,
+		hasher: sha256.New(),
+		want:   l.desc.Digest,
+		onEOF: func(ok bool) error {
+			err := tmp.Close()
+			if ok && err == nil {
+				err = c.commit(tmp.Name(), c.blobPath(l.desc.Digest))
+			}
+			if !ok {
+				err = fmt.Errorf("digest mismatch for layer %s", l.desc.Digest)
+			}
+			if err != nil {
+				_ = os.Remove(tmp.Name())
+				return err
+			}
+			c.gc()
+			return nil
+		},
+		onClose: func() {
+			// Not read to the end, so not cached.
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		},
+	}, nil
+}
+
+// verifyingReader checks the digest of what is read from r once it reaches the end, and
+// reports it to onEOF. onClose is called if it is closed before the end.
+type verifyingReader struct {
+	r       io.Reader
+	closer  io.Closer
+	hasher  hash.Hash
+	want    v1.Hash
+	onEOF   func(ok bool) error
+	onClose func()
+	done    bool
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	v.hasher.Write(p[:n])
+	if errors.Is(err, io.EOF) && !v.done {
+		v.done = true
+		if eofErr := v.onEOF(hex.EncodeToString(v.hasher.Sum(nil)) == v.want.Hex); eofErr != nil {
+			return n, eofErr
+		}
+	}
+	return n, err
+}
+
+func (v *verifyingReader) Close() error {
+	if !v.done && v.onClose != nil {
+		// Readers of a layer stop at the end of the tar archive, so read the little that is
+		// left, like its padding, to still get to the end and cache the blob.
+		_, _ = io.CopyN(io.Discard, v, layerCacheDrainBytes)
+		if !v.done {
+			v.done = true
+			v.onClose()
+		}
+	}
+	return v.closer.Close()
+}
@@ -0,0 +1,263 @@
+package fetcher
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/redhat-et/GKM/mcv/pkg/constants"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useTestLayerCache points the layer cache to a temporary directory for the test.
+func useTestLayerCache(t *testing.T, maxBytes int64) string {
+	savedDir, savedMax := constants.LayerCacheDir, constants.LayerCacheMaxBytes
+	t.Cleanup(func() { constants.LayerCacheDir, constants.LayerCacheMaxBytes = savedDir, savedMax })
+	constants.LayerCacheDir = t.TempDir()
+	constants.LayerCacheMaxBytes = maxBytes
+	return constants.LayerCacheDir
+}
+
+// testRegistry starts an in-process registry holding img and returns the digest reference of
+// img and the number of requests the registry received.
+func testRegistry(t *testing.T, img v1.Image) (string, *atomic.Int64) {
+	var requests atomic.Int64
+	handler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	ref, err := name.ParseReference(strings.TrimPrefix(server.URL, "http://") + "/gkm/cache:v1")
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	requests.Store(0)
+	return ref.Context().Digest(digest.String()).String(), &requests
+}
+
+// readImage reads the config of img and every layer the way an extraction does, up to the end
+// of each tar archive, and returns the number of files in the layers.
+func readImage(t *testing.T, img v1.Image) int {
+	_, err := img.ConfigFile()
+	require.NoError(t, err)
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	files := 0
+	for _, layer := range layers {
+		rc, err := layer.Uncompressed()
+		require.NoError(t, err)
+		tr := tar.NewReader(rc)
+		for {
+			_, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err)
+			files++
+		}
+		require.NoError(t, rc.Close())
+	}
+	return files
+}
+
+func TestLayerCache_RepeatedFetchMakesNoRegistryCalls(t *testing.T) {
+	useTestLayerCache(t, 0)
+	img, err := random.Image(4096, 2)
+	require.NoError(t, err)
+	ref, requests := testRegistry(t, img)
+	f := &fetcher{remote: &remoteFetcher{}}
+
+	first, err := f.FetchImg(ref)
+	require.NoError(t, err)
+	files := readImage(t, first)
+	assert.Positive(t, requests.Load())
+
+	requests.Store(0)
+	second, err := f.FetchImg(ref)
+	require.NoError(t, err)
+	assert.Equal(t, files, readImage(t, second))
+	assert.Zero(t, requests.Load())
+
+	wantDigest, err := img.Digest()
+	require.NoError(t, err)
+	gotDigest, err := second.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, wantDigest, gotDigest)
+}
+
+func TestLayerCache_LayersMissingFromCacheArePulled(t *testing.T) {
+	dir := useTestLayerCache(t, 0)
+	img, err := random.Image(4096, 1)
+	require.NoError(t, err)
+	ref, requests := testRegistry(t, img)
+	f := &fetcher{remote: &remoteFetcher{}}
+
+	first, err := f.FetchImg(ref)
+	require.NoError(t, err)
+	readImage(t, first)
+
+	// Remove the layer only, the manifest and config stay cached.
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	h, err := layers[0].Digest()
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(filepath.Join(dir, layerCacheBlobsDir, h.Algorithm, h.Hex)))
+
+	requests.Store(0)
+	second, err := f.FetchImg(ref)
+	require.NoError(t, err)
+	readImage(t, second)
+	assert.Positive(t, requests.Load())
+	_, err = os.Stat(filepath.Join(dir, layerCacheBlobsDir, h.Algorithm, h.Hex))
+	assert.NoError(t, err)
+}
+
+func TestLayerCache_CorruptedBlobIsNotUsed(t *testing.T) {
+	dir := useTestLayerCache(t, 0)
+	img, err := random.Image(4096, 1)
+	require.NoError(t, err)
+	c := DefaultConfig().newLayerCache()
+	id := v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("c", 64)}
+	_, err = c.putLocal(id, img)
+	require.NoError(t, err)
+
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	h, err := layers[0].Digest()
+	require.NoError(t, err)
+	path := filepath.Join(dir, layerCacheBlobsDir, h.Algorithm, h.Hex)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)/2] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0644))
+
+	cached, err := c.lookupLocal(id)
+	require.NoError(t, err)
+	cachedLayers, err := cached.Layers()
+	require.NoError(t, err)
+	rc, err := cachedLayers[0].Compressed()
+	require.NoError(t, err)
+	_, err = io.ReadAll(rc)
+	assert.Error(t, err)
+	_ = rc.Close()
+
+	// The corrupted blob is removed, so the image is no longer complete in the cache.
+	_, err = c.lookupLocal(id)
+	assert.ErrorIs(t, err, errNotCached)
+}
+
+func TestLayerCache_GCRemovesLeastRecentlyUsedBlobs(t *testing.T) {
+	dir := useTestLayerCache(t, 0)
+	c := DefaultConfig().newLayerCache()
+	old, err := random.Image(64<<10, 1)
+	require.NoError(t, err)
+	recent, err := random.Image(64<<10, 1)
+	require.NoError(t, err)
+	oldID := v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("d", 64)}
+	recentID := v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("e", 64)}
+	_, err = c.putLocal(oldID, old)
+	require.NoError(t, err)
+	_, err = c.putLocal(recentID, recent)
+	require.NoError(t, err)
+
+	// Make the first image the least recently used, then shrink the cache below both.
+	oldDigest, err := old.Digest()
+	require.NoError(t, err)
+	oldLayers, err := old.Layers()
+	require.NoError(t, err)
+	oldLayer, err := oldLayers[0].Digest()
+	require.NoError(t, err)
+	oldConfig, err := old.ConfigName()
+	require.NoError(t, err)
+	past := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, h := range []v1.Hash{oldDigest, oldLayer, oldConfig} {
+		require.NoError(t, os.Chtimes(filepath.Join(dir, layerCacheBlobsDir, h.Algorithm, h.Hex), past, past))
+	}
+	recentSize, err := recent.Size()
+	require.NoError(t, err)
+	c.maxBytes = recentSize + 96<<10
+	c.gc()
+
+	_, err = c.lookupLocal(oldID)
+	assert.ErrorIs(t, err, errNotCached)
+	_, err = c.lookupLocal(recentID)
+	assert.NoError(t, err)
+}
+
+func TestFetchToTempTar_SavesImageOnce(t *testing.T) {
+	useTestLayerCache(t, 0)
+	img, err := random.Image(4096, 2)
+	require.NoError(t, err)
+	ref, err := name.ParseReference("localhost/gkm/cache:v1")
+	require.NoError(t, err)
+	saves := 0
+	save := func(w io.Writer) error {
+		saves++
+		return tarball.Write(ref, img, w)
+	}
+
+	first, err := fetchToTempTar(DefaultConfig().newLayerCache(), "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", save)
+	require.NoError(t, err)
+	files := readImage(t, first)
+
+	second, err := fetchToTempTar(DefaultConfig().newLayerCache(), "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", save)
+	require.NoError(t, err)
+	assert.Equal(t, files, readImage(t, second))
+	assert.Equal(t, 1, saves)
+
+	// The tarball is removed once the image is in the cache.
+	entries, err := os.ReadDir(filepath.Join(constants.MCVBuildDir, constants.CacheDir))
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.False(t, strings.HasPrefix(entry.Name(), "image-"), entry.Name())
+	}
+}
+
+func TestLayerCache_Disabled(t *testing.T) {
+	useTestLayerCache(t, -1)
+	assert.Nil(t, DefaultConfig().newLayerCache())
+}
+
+func TestLayerCache_FetcherConfigIsPerFetcher(t *testing.T) {
+	defaultDir := useTestLayerCache(t, 0)
+	img, err := random.Image(4096, 1)
+	require.NoError(t, err)
+	ref, _ := testRegistry(t, img)
+
+	// A fetcher with its own Config neither reads nor changes the one in constants.
+	cfg := DefaultConfig()
+	cfg.LayerCacheDir = t.TempDir()
+	f := &fetcher{remote: &remoteFetcher{cfg: &cfg}, cfg: &cfg}
+	fetched, err := f.FetchImg(ref)
+	require.NoError(t, err)
+	readImage(t, fetched)
+
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	h, err := layers[0].Digest()
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(cfg.LayerCacheDir, layerCacheBlobsDir, h.Algorithm, h.Hex))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(defaultDir, layerCacheBlobsDir, h.Algorithm, h.Hex))
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, defaultDir, constants.LayerCacheDir)
+}
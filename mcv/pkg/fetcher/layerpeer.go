@@ -0,0 +1,137 @@
+package fetcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	logging "github.com/sirupsen/logrus"
+)
+
+const (
+	// LayerPath is the path the layer server serves the blobs of the layer cache under, as
+	// LayerPath/<algorithm>/<hex>. A GET of LayerPath lists the digests of the blobs.
+	LayerPath = "/layers"
+
+	// A peer that does not answer within this time is skipped. The body of the blob is not
+	// limited, since layers can be large.
+	layerPeerDialTimeout     = 5 * time.Second
+	layerPeerResponseTimeout = 10 * time.Second
+)
+
+var sha256Hex = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// layerPeerClient is the HTTP client used to fetch layers from peers.
+var layerPeerClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: layerPeerDialTimeout}).DialContext,
+		ResponseHeaderTimeout: layerPeerResponseTimeout,
+		IdleConnTimeout:       90 * time.Second,
+	},
+}
+
+// LayerHandler returns an HTTP handler serving the blobs of the layer cache in dir to the
+// fetchers of other hosts, which list it in the LayerPeers of their Config. Blobs are served by digest,
+// so a client checks what it receives against the digest it asked for.
+func LayerHandler(dir string) http.Handler {
+	c := &layerCache{dir: dir}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		rest, ok := strings.CutPrefix(r.URL.Path, LayerPath)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if rest == "" || rest == "/" {
+			c.serveList(w)
+			return
+		}
+		algorithm, hex, ok := strings.Cut(strings.TrimPrefix(rest, "/"), "/")
+		if !ok || algorithm != "sha256" || !sha256Hex.MatchString(hex) {
+			http.NotFound(w, r)
+			return
+		}
+		c.serveBlob(w, r, v1.Hash{Algorithm: algorithm, Hex: hex})
+	})
+}
+
+// serveList writes the digests of the blobs in the cache as a JSON list.
+func (c *layerCache) serveList(w http.ResponseWriter) {
+	digests := []string{}
+	_ = filepath.WalkDir(filepath.Join(c.dir, layerCacheBlobsDir), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		digests = append(digests, filepath.Base(filepath.Dir(path))+":"+d.Name())
+		return nil
+	})
+	sort.Strings(digests)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(digests)
+}
+
+// serveBlob writes the blob h. Ranges and HEAD requests are supported.
+func (c *layerCache) serveBlob(w http.ResponseWriter, r *http.Request, h v1.Hash) {
+	path := c.blobPath(h)
+	f, err := os.Open(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	c.touch(path)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", h.String())
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
+
+// fetchFromPeers adds the blob h to the cache from the first of its peers that has it, and
+// opens it. The blob is only added if its digest matches.
+func (c *layerCache) fetchFromPeers(h v1.Hash) (io.ReadCloser, error) {
+	if len(c.peers) == 0 {
+		return nil, errNotCached
+	}
+	for _, peer := range c.peers {
+		if err := c.fetchFromPeer(peer, h); err != nil {
+			logging.Debugf("Layer %s not fetched from peer %s: %v", h, peer, err)
+			continue
+		}
+		logging.Debugf("Layer %s fetched from peer %s", h, peer)
+		c.gc()
+		return c.openBlob(h)
+	}
+	return nil, errNotCached
+}
+
+func (c *layerCache) fetchFromPeer(peer string, h v1.Hash) error {
+	url := fmt.Sprintf("%s%s/%s/%s", strings.TrimSuffix(peer, "/"), LayerPath, h.Algorithm, h.Hex)
+	resp, err := layerPeerClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return c.writeBlob(h, resp.Body)
+}
@@ -0,0 +1,138 @@
+package fetcher
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/redhat-et/GKM/mcv/pkg/constants"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useTestLayerPeers sets the layer peers for the test.
+func useTestLayerPeers(t *testing.T, peers ...string) {
+	saved := constants.LayerPeers
+	t.Cleanup(func() { constants.LayerPeers = saved })
+	constants.LayerPeers = peers
+}
+
+// testPeer starts a stand-in for the layer server of another host, holding img in its layer
+// cache, and returns its URL.
+func testPeer(t *testing.T, img v1.Image) string {
+	c := &layerCache{dir: t.TempDir(), maxBytes: constants.DefaultLayerCacheMaxBytes}
+	_, err := c.putLocal(v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("f", 64)}, img)
+	require.NoError(t, err)
+	server := httptest.NewServer(LayerHandler(c.dir))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestLayerPeer_LayersFetchedFromPeer(t *testing.T) {
+	dir := useTestLayerCache(t, 0)
+	img, err := random.Image(4096, 2)
+	require.NoError(t, err)
+	ref, requests := testRegistry(t, img)
+	useTestLayerPeers(t, testPeer(t, img))
+	f := &fetcher{remote: &remoteFetcher{}}
+
+	fetched, err := f.FetchImg(ref)
+	require.NoError(t, err)
+	requests.Store(0)
+	readImage(t, fetched)
+	assert.Zero(t, requests.Load())
+
+	// The layers are in the local cache once fetched from the peer.
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	for _, layer := range layers {
+		h, err := layer.Digest()
+		require.NoError(t, err)
+		_, err = os.Stat(filepath.Join(dir, layerCacheBlobsDir, h.Algorithm, h.Hex))
+		assert.NoError(t, err)
+	}
+}
+
+func TestLayerPeer_FallBackToRegistry(t *testing.T) {
+	img, err := random.Image(4096, 1)
+	require.NoError(t, err)
+	corrupt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("not the layer"))
+	}))
+	t.Cleanup(corrupt.Close)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	empty := httptest.NewServer(LayerHandler(t.TempDir()))
+	t.Cleanup(empty.Close)
+
+	for name, peer := range map[string]string{"corrupt": corrupt.URL, "down": down.URL, "empty": empty.URL} {
+		t.Run(name, func(t *testing.T) {
+			dir := useTestLayerCache(t, 0)
+			ref, requests := testRegistry(t, img)
+			useTestLayerPeers(t, peer)
+			f := &fetcher{remote: &remoteFetcher{}}
+
+			fetched, err := f.FetchImg(ref)
+			require.NoError(t, err)
+			requests.Store(0)
+			assert.Positive(t, readImage(t, fetched))
+			assert.Positive(t, requests.Load())
+
+			// Only the layer pulled from the registry, with a matching digest, is cached.
+			layers, err := img.Layers()
+			require.NoError(t, err)
+			h, err := layers[0].Digest()
+			require.NoError(t, err)
+			_, err = os.Stat(filepath.Join(dir, layerCacheBlobsDir, h.Algorithm, h.Hex))
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestLayerHandler(t *testing.T) {
+	img, err := random.Image(4096, 1)
+	require.NoError(t, err)
+	peer := testPeer(t, img)
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	h, err := layers[0].Digest()
+	require.NoError(t, err)
+
+	resp, err := http.Get(peer + LayerPath)
+	require.NoError(t, err)
+	var digests []string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&digests))
+	_ = resp.Body.Close()
+	assert.Contains(t, digests, h.String())
+
+	resp, err = http.Head(peer + LayerPath + "/sha256/" + h.Hex)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, h.String(), resp.Header.Get("Docker-Content-Digest"))
+
+	for _, path := range []string{
+		LayerPath + "/sha256/" + strings.Repeat("0", 64),
+		LayerPath + "/sha256/../../" + h.Hex,
+		LayerPath + "/md5/" + h.Hex,
+		"/v2/",
+	} {
+		resp, err = http.Get(peer + path)
+		require.NoError(t, err)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, path)
+	}
+
+	resp, err = http.Post(peer+LayerPath+"/sha256/"+h.Hex, "application/octet-stream", strings.NewReader(""))
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
@@ -9,15 +9,17 @@ import (
 
 	"github.com/containers/podman/v5/pkg/bindings"
 	"github.com/containers/podman/v5/pkg/bindings/images"
+	"github.com/containers/podman/v5/pkg/domain/entities/types"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	logging "github.com/sirupsen/logrus"
 )
 
 type podmanFetcher struct {
 	client PodmanClient
+	cfg    *Config // nil is DefaultConfig
 }
 
-func newPodmanFetcher() (*podmanFetcher, error) {
+func newPodmanFetcher(cfg Config) (*podmanFetcher, error) {
 	socket := getPodmanSock()
 	if socket == "" {
 		return nil, fmt.Errorf("could not determine Podman socket")
@@ -28,7 +30,7 @@ func newPodmanFetcher() (*podmanFetcher, error) {
 		return nil, fmt.Errorf("failed to connect to podman: %w", err)
 	}
 
-	return &podmanFetcher{client: &realPodmanClient{ctx: ctx}}, nil
+	return &podmanFetcher{client: &realPodmanClient{ctx: ctx}, cfg: &cfg}, nil
 }
 
 func (p *podmanFetcher) FetchImg(imgName string) (v1.Image, error) {
@@ -38,6 +40,10 @@ func (p *podmanFetcher) FetchImg(imgName string) (v1.Image, error) {
 	if err != nil || !found {
 		return nil, fmt.Errorf("podman image not found: %w", err)
 	}
+	report, err := p.client.GetImage(context.Background(), imgName, &images.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect podman image: %w", err)
+	}
 
 	imageFunc := func(w io.Writer) error {
 		var compress = true
@@ -48,7 +54,7 @@ func (p *podmanFetcher) FetchImg(imgName string) (v1.Image, error) {
 		})
 	}
 
-	return fetchToTempTar(imageFunc)
+	return fetchToTempTar(p.cfg.orDefault().newLayerCache(), report.ID, imageFunc)
 }
 
 func getPodmanSock() string {
@@ -77,6 +83,10 @@ func (r *realPodmanClient) Exists(ctx context.Context, name string, opts *images
 	return images.Exists(r.ctx, name, opts)
 }
 
+func (r *realPodmanClient) GetImage(ctx context.Context, name string, opts *images.GetOptions) (*types.ImageInspectReport, error) {
+	return images.GetImage(r.ctx, name, opts)
+}
+
 func (r *realPodmanClient) Export(ctx context.Context, names []string, w io.Writer, opts *images.ExportOptions) error {
 	return images.Export(r.ctx, names, w, opts)
 }
@@ -3,16 +3,20 @@ package fetcher
 import (
 	"fmt"
 
-	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/redhat-et/GKM/mcv/pkg/registries"
 	logging "github.com/sirupsen/logrus"
 )
 
-type remoteFetcher struct{}
+type remoteFetcher struct {
+	cfg *Config // nil is DefaultConfig
+}
 
 func (r *remoteFetcher) FetchImg(imgName string) (v1.Image, error) {
+	cfg := r.cfg.orDefault()
+
 	// Parse the image name into a reference (e.g., quay.io/gkm/triton-cache)
 	ref, err := name.ParseReference(imgName)
 	if err != nil {
@@ -20,12 +24,37 @@ func (r *remoteFetcher) FetchImg(imgName string) (v1.Image, error) {
 	}
 
 	logging.Debugf("Retrieve remote Img %s!!!!!!!!", imgName)
-	img, err := remote.Image(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	img, src, opts, err := registries.Try(cfg.Registries, ref, cfg.remoteOptions(), remote.Image)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch image: %w", err)
 	}
 
 	// Print the image details
 	logging.Debug("Img fetched successfully!!!!!!!!")
+
+	// Keep the manifest and config, and the layers as they are read, for the next fetch.
+	if c := cfg.newLayerCache(); c != nil {
+		cached, err := c.putRemote(src.Ref, img, opts...)
+		if err != nil {
+			logging.Warnf("Failed to add image to the layer cache: %v", err)
+			return img, nil
+		}
+		return cached, nil
+	}
 	return img, nil
 }
+
+// preferredSource returns the repository and remote options of the first source to pull the
+// image of ref from, the first mirror of its registry if there is one. Layers missing from the
+// layer cache are pulled from it.
+func preferredSource(cfg Config, ref name.Reference) (name.Repository, []remote.Option, error) {
+	sources, err := cfg.Registries.Sources(ref)
+	if err != nil {
+		return name.Repository{}, nil, err
+	}
+	opts, err := cfg.Registries.Options(sources[0])
+	if err != nil {
+		return name.Repository{}, nil, err
+	}
+	return sources[0].Ref.Context(), append(cfg.remoteOptions(), opts...), nil
+}
@@ -0,0 +1,64 @@
+package fetcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/redhat-et/GKM/mcv/pkg/constants"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useTestRegistriesConf sets the registries.conf for the test.
+func useTestRegistriesConf(t *testing.T, conf string) {
+	saved := constants.RegistriesConf
+	t.Cleanup(func() { constants.RegistriesConf = saved })
+	constants.RegistriesConf = filepath.Join(t.TempDir(), "registries.conf")
+	require.NoError(t, os.WriteFile(constants.RegistriesConf, []byte(conf), 0644))
+}
+
+func TestRemoteFetcher_PullsFromMirror(t *testing.T) {
+	useTestLayerCache(t, 0)
+	img, err := random.Image(4096, 2)
+	require.NoError(t, err)
+	mirrorRef, requests := testRegistry(t, img)
+	mirrorHost, _, _ := strings.Cut(mirrorRef, "/")
+	useTestRegistriesConf(t, fmt.Sprintf(`
+[[registry]]
+prefix = "registry.invalid/gkm"
+location = "registry.invalid/gkm"
+
+[[registry.mirror]]
+location = "%s/gkm"
+insecure = true
+`, mirrorHost))
+	_, digest, _ := strings.Cut(mirrorRef, "@")
+	ref := "registry.invalid/gkm/cache@" + digest
+	f := &fetcher{remote: &remoteFetcher{}}
+
+	first, err := f.FetchImg(ref)
+	require.NoError(t, err)
+	files := readImage(t, first)
+	assert.Positive(t, requests.Load())
+
+	requests.Store(0)
+	second, err := f.FetchImg(ref)
+	require.NoError(t, err)
+	assert.Equal(t, files, readImage(t, second))
+	assert.Zero(t, requests.Load())
+}
+
+func TestRemoteFetcher_BlockedRegistry(t *testing.T) {
+	useTestLayerCache(t, -1)
+	useTestRegistriesConf(t, `
+[[registry]]
+location = "registry.invalid"
+blocked = true
+`)
+	_, err := (&remoteFetcher{}).FetchImg("registry.invalid/gkm/cache:v1")
+	assert.ErrorContains(t, err, "blocked")
+}
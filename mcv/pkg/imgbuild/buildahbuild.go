@@ -23,6 +23,11 @@ func (b *buildahBuilder) CreateImage(imageName, cacheDir string) error {
 	// Add OCI title label for consistency with Docker path
 	prep.Labels[imageTitleLabel] = imageTitleFromName(imageName)
 
+	created, err := buildTimestamp()
+	if err != nil {
+		return err
+	}
+
 	buildStoreOptions, err := storage.DefaultStoreOptions()
 	if err != nil {
 		return fmt.Errorf("failed to get default store options: %w", err)
@@ -74,7 +79,8 @@ func (b *buildahBuilder) CreateImage(imageName, cacheDir string) error {
 		}
 	}()
 
-	addOptions := buildah.AddAndCopyOptions{}
+	// Timestamp the files and the image like schema2ImageFromBuildContext.
+	addOptions := buildah.AddAndCopyOptions{Timestamp: &created}
 	err = builder.Add(prep.ManifestTag, false, addOptions, prep.ManifestBuildDir+"/.")
 	if err != nil {
 		return fmt.Errorf("error adding manifest %s to builder: %v", prep.ManifestBuildDir, err)
@@ -92,6 +98,7 @@ func (b *buildahBuilder) CreateImage(imageName, cacheDir string) error {
 	imageID, _, _, err := builder.Commit(ctx, imageRef, buildah.CommitOptions{
 		Squash:                true,
 		PreferredManifestType: buildah.Dockerv2ImageManifest,
+		HistoryTimestamp:      &created,
 	})
 	if err != nil {
 		return err
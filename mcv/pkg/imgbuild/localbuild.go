@@ -0,0 +1,61 @@
+package imgbuild
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/redhat-et/GKM/mcv/pkg/localimage"
+	logging "github.com/sirupsen/logrus"
+)
+
+// localBuilder writes the compat cache image to an OCI layout, an OCI archive or a Docker
+// archive, without a daemon.
+type localBuilder struct{}
+
+// NewLocal returns a builder for images referenced with oci:, oci-archive: or docker-archive:.
+func NewLocal() ImageBuilder {
+	return &localBuilder{}
+}
+
+func (l *localBuilder) CreateImage(imageName, cacheDir string) error {
+	ref, err := localimage.Parse(imageName)
+	if err != nil {
+		return err
+	}
+
+	prep, err := prepareBuildContext("local", cacheDir)
+	if err != nil {
+		return err
+	}
+	defer CleanupDirs(prep.CacheBuildDir, prep.ManifestBuildDir)
+
+	img, err := schema2ImageFromBuildContext(prep, localTitleName(ref))
+	if err != nil {
+		return fmt.Errorf("failed to build image: %w", err)
+	}
+	if prep.TempLayerFile != "" {
+		defer os.Remove(prep.TempLayerFile)
+	}
+
+	if err := ref.Write(img); err != nil {
+		return err
+	}
+	logging.Infof("Image written to %s", ref)
+
+	if err := CleanupWithTimeout(); err != nil {
+		return fmt.Errorf("cleanup error: %w", err)
+	}
+	return nil
+}
+
+// localTitleName returns the name the title label of a local image is taken from: its
+// reference if it is an image name, or the file name of its path.
+func localTitleName(ref *localimage.Ref) string {
+	if ref.Transport == localimage.DockerArchive && ref.Reference != "" || strings.Contains(ref.Reference, "/") {
+		return ref.Reference
+	}
+	base := filepath.Base(ref.Path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
@@ -0,0 +1,37 @@
+package imgbuild
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/redhat-et/GKM/mcv/pkg/localimage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalBuilder_CreateImage(t *testing.T) {
+	dir := t.TempDir()
+	for image, title := range map[string]string{
+		"oci:" + filepath.Join(dir, "layout") + ":v1":                              "layout",
+		"oci-archive:" + filepath.Join(dir, "vector-add.tar"):                      "vector-add",
+		"docker-archive:" + filepath.Join(dir, "cache.tar") + ":quay.io/gkm/va:v1": "va",
+	} {
+		require.NoError(t, NewLocal().CreateImage(image, "../../example/vector-add-cache"), image)
+
+		ref, err := localimage.Parse(image)
+		require.NoError(t, err)
+		img, err := ref.Image(t.TempDir())
+		require.NoError(t, err, image)
+		cfg, err := img.ConfigFile()
+		require.NoError(t, err)
+		assert.Equal(t, title, cfg.Config.Labels[imageTitleLabel], image)
+		assert.NotEmpty(t, cfg.Config.Labels["cache.triton.image/summary"], image)
+		layers, err := img.Layers()
+		require.NoError(t, err)
+		assert.Len(t, layers, 1, image)
+	}
+}
+
+func TestLocalBuilder_InvalidReference(t *testing.T) {
+	assert.Error(t, NewLocal().CreateImage("quay.io/gkm/cache:v1", "../../example/vector-add-cache"))
+}
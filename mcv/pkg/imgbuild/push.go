@@ -0,0 +1,106 @@
+package imgbuild
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/redhat-et/GKM/mcv/pkg/constants"
+	"github.com/redhat-et/GKM/mcv/pkg/registries"
+	"github.com/redhat-et/GKM/mcv/pkg/signing"
+	logging "github.com/sirupsen/logrus"
+)
+
+// DefaultPushRetries is the number of times a failed request is retried while pushing.
+const DefaultPushRetries = 5
+
+// PushOptions configures Push.
+type PushOptions struct {
+	BuildOptions
+	// Keychain resolves the credentials of the registry. Defaults to registries.Keychain of
+	// constants.RegistryAuthFile.
+	Keychain authn.Keychain
+	// Retries is the number of times a request failing with a temporary error is retried, with
+	// an exponential backoff. 0 is DefaultPushRetries, negative disables retries.
+	Retries int
+	// Sign signs the pushed image and attests its cache manifest and summary, if it is set.
+	Sign *signing.Options
+}
+
+// Push builds the cache image of cacheDir without a daemon and pushes it to imageName, with
+// the registries configuration in constants. It returns the digest reference of the image, once
+// it is signed if opts.Sign is set.
+func Push(imageName, cacheDir string, opts PushOptions) (name.Digest, error) {
+	ref, err := name.ParseReference(NormalizeImageTag(imageName), name.StrictValidation)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("invalid image reference %q: %w", imageName, err)
+	}
+
+	img, attestations, cleanup, err := buildImage(imageName, cacheDir, opts.BuildOptions)
+	if err != nil {
+		return name.Digest{}, err
+	}
+	defer cleanup()
+	digest, err := img.Digest()
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("failed to compute image digest: %w", err)
+	}
+
+	cfg := registries.Config{
+		ConfPath: constants.RegistriesConf,
+		CertsDir: constants.RegistryCertsDir,
+		CABundle: constants.RegistryCABundle,
+	}
+	dst, err := cfg.Destination(ref)
+	if err != nil {
+		return name.Digest{}, err
+	}
+	remoteOpts, err := cfg.Options(dst)
+	if err != nil {
+		return name.Digest{}, err
+	}
+	keychain := opts.Keychain
+	if keychain == nil {
+		keychain = registries.Keychain(constants.RegistryAuthFile)
+	}
+	remoteOpts = append(remoteOpts,
+		remote.WithAuthFromKeychain(keychain),
+		remote.WithRetryBackoff(pushBackoff(opts.Retries)),
+	)
+
+	logging.Infof("Pushing %s", dst.Ref)
+	if err := remote.Write(dst.Ref, img, remoteOpts...); err != nil {
+		return name.Digest{}, fmt.Errorf("failed to push %s: %w", dst.Ref, err)
+	}
+	pushed := ref.Context().Digest(digest.String())
+	logging.Infof("Pushed %s", pushed)
+
+	if opts.Sign != nil {
+		// Sign the digest of the registry pushed to, which may be an insecure registry.
+		signed := dst.Ref.Context().Digest(digest.String())
+		if err := signing.Sign(context.Background(), signed, attestations, *opts.Sign, remoteOpts); err != nil {
+			return name.Digest{}, err
+		}
+	}
+
+	if err := CleanupWithTimeout(); err != nil {
+		return name.Digest{}, fmt.Errorf("cleanup error: %w", err)
+	}
+	return pushed, nil
+}
+
+// pushBackoff returns the backoff of the requests of a push retried retries times.
+func pushBackoff(retries int) remote.Backoff {
+	if retries == 0 {
+		retries = DefaultPushRetries
+	}
+	return remote.Backoff{
+		Duration: time.Second,
+		Factor:   2.0,
+		Jitter:   0.1,
+		Steps:    max(retries, 0) + 1,
+	}
+}
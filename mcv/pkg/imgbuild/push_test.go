@@ -0,0 +1,241 @@
+package imgbuild
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/redhat-et/GKM/mcv/pkg/registries"
+	"github.com/redhat-et/GKM/mcv/pkg/signing"
+	"github.com/sigstore/cosign/v3/pkg/cosign"
+	sigs "github.com/sigstore/cosign/v3/pkg/signature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCacheDir = "../../example/vector-add-cache"
+
+// testRegistry starts an in-process registry behind wrap and returns its host.
+func testRegistry(t *testing.T, wrap func(http.Handler) http.Handler) string {
+	handler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+// anonymous is a keychain without credentials, so the credentials of the host are not used.
+func anonymous(t *testing.T) PushOptions {
+	keychain, err := registries.KeychainFromConfig([]byte(`{"auths":{}}`))
+	require.NoError(t, err)
+	return PushOptions{Keychain: keychain}
+}
+
+// artifactType returns the artifactType of the manifest of img.
+func artifactType(t *testing.T, img v1.Image) string {
+	raw, err := img.RawManifest()
+	require.NoError(t, err)
+	var manifest struct {
+		ArtifactType string `json:"artifactType"`
+	}
+	require.NoError(t, json.Unmarshal(raw, &manifest))
+	return manifest.ArtifactType
+}
+
+func TestPush_Formats(t *testing.T) {
+	host := testRegistry(t, nil)
+
+	opts := anonymous(t)
+	digest, err := Push(host+"/gkm/vector-add:compat", testCacheDir, opts)
+	require.NoError(t, err)
+	img, err := remote.Image(digest)
+	require.NoError(t, err)
+	manifest, err := img.Manifest()
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerManifestSchema2, manifest.MediaType)
+	assert.Empty(t, artifactType(t, img))
+	require.Len(t, manifest.Layers, 1)
+	assert.Equal(t, types.DockerLayer, manifest.Layers[0].MediaType)
+
+	opts.Format = FormatArtifact
+	digest, err = Push(host+"/gkm/vector-add:artifact", testCacheDir, opts)
+	require.NoError(t, err)
+	tagged, err := name.ParseReference(host + "/gkm/vector-add:artifact")
+	require.NoError(t, err)
+	img, err = remote.Image(tagged)
+	require.NoError(t, err)
+	pulledDigest, err := img.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, digest.DigestStr(), pulledDigest.String())
+
+	manifest, err = img.Manifest()
+	require.NoError(t, err)
+	assert.Equal(t, types.OCIManifestSchema1, manifest.MediaType)
+	assert.Equal(t, types.OCIConfigJSON, manifest.Config.MediaType)
+	assert.Equal(t, "application/vnd.gkm.cache.triton.v1", artifactType(t, img))
+	require.Len(t, manifest.Layers, 1)
+	assert.Equal(t, types.MediaType("application/cache.triton.content.layer.v1+triton"), manifest.Layers[0].MediaType)
+
+	cfg, err := img.ConfigFile()
+	require.NoError(t, err)
+	assert.Equal(t, "vector-add", cfg.Config.Labels[imageTitleLabel])
+	assert.NotEmpty(t, cfg.Config.Labels["cache.triton.image/summary"])
+
+	// The artifact layer is the compat tarball, as extractOCIArtifactImg reads it.
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	rc, err := layers[0].Compressed()
+	require.NoError(t, err)
+	defer rc.Close()
+	gz, err := gzip.NewReader(rc)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, header.Name)
+	}
+	assert.Contains(t, names, "io.triton.manifest/manifest.json")
+	assert.Contains(t, names, "io.triton.manifest/integrity.json")
+}
+
+func TestPush_ArtifactType(t *testing.T) {
+	host := testRegistry(t, nil)
+	opts := anonymous(t)
+	opts.Format = FormatArtifact
+	opts.ArtifactType = "application/vnd.example.cache.v1"
+	digest, err := Push(host+"/gkm/vector-add:v1", testCacheDir, opts)
+	require.NoError(t, err)
+	img, err := remote.Image(digest)
+	require.NoError(t, err)
+	assert.Equal(t, "application/vnd.example.cache.v1", artifactType(t, img))
+}
+
+func TestPush_Retries(t *testing.T) {
+	var failures atomic.Int64
+	host := testRegistry(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Fail the first uploads, like an overloaded registry.
+			if r.Method != http.MethodGet && r.Method != http.MethodHead && failures.Add(1) <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	opts := anonymous(t)
+	opts.Retries = -1
+	_, err := Push(host+"/gkm/vector-add:v1", testCacheDir, opts)
+	assert.Error(t, err)
+
+	opts.Retries = 3
+	_, err = Push(host+"/gkm/vector-add:v1", testCacheDir, opts)
+	assert.NoError(t, err)
+}
+
+func TestPush_Auth(t *testing.T) {
+	host := testRegistry(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user, pass, ok := r.BasicAuth(); !ok || user != "gkm" || pass != "secret" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	_, err := Push(host+"/gkm/vector-add:v1", testCacheDir, anonymous(t))
+	assert.Error(t, err)
+
+	keychain, err := registries.KeychainFromConfig([]byte(`{"auths":{"` + host + `":{"auth":"Z2ttOnNlY3JldA=="}}}`))
+	require.NoError(t, err)
+	digest, err := Push(host+"/gkm/vector-add:v1", testCacheDir, PushOptions{Keychain: keychain})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(digest.String(), host+"/gkm/vector-add@sha256:"))
+}
+
+func TestPush_Sign(t *testing.T) {
+	host := testRegistry(t, nil)
+	pass := func(bool) ([]byte, error) { return []byte("test"), nil }
+	keys, err := cosign.GenerateKeyPair(pass)
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "cosign.key")
+	require.NoError(t, os.WriteFile(keyPath, keys.PrivateBytes, 0600))
+
+	opts := anonymous(t)
+	opts.Sign = &signing.Options{KeyRef: keyPath, PassFunc: pass}
+	digest, err := Push(host+"/gkm/vector-add:v1", testCacheDir, opts)
+	require.NoError(t, err)
+
+	verifier, err := sigs.LoadPublicKeyRaw(keys.PublicBytes, crypto.SHA256)
+	require.NoError(t, err)
+	co := &cosign.CheckOpts{SigVerifier: verifier, IgnoreTlog: true}
+	ctx := context.Background()
+	_, _, err = cosign.VerifyImageSignatures(ctx, digest, co)
+	require.NoError(t, err)
+
+	attestations, _, err := cosign.VerifyImageAttestations(ctx, digest, co)
+	require.NoError(t, err)
+	predicates := make(map[string]map[string]json.RawMessage)
+	for _, att := range attestations {
+		payload, err := att.Payload()
+		require.NoError(t, err)
+		var envelope struct {
+			Payload []byte `json:"payload"`
+		}
+		require.NoError(t, json.Unmarshal(payload, &envelope))
+		var statement struct {
+			PredicateType string                     `json:"predicateType"`
+			Predicate     map[string]json.RawMessage `json:"predicate"`
+		}
+		require.NoError(t, json.Unmarshal(envelope.Payload, &statement))
+		predicates[statement.PredicateType] = statement.Predicate
+	}
+	require.Len(t, predicates, 2)
+	assert.Contains(t, predicates[signing.ManifestPredicateType], "triton")
+	assert.Contains(t, predicates[signing.SummaryPredicateType], "triton")
+}
+
+func TestBuildImage_Reproducible(t *testing.T) {
+	for _, format := range []Format{FormatCompat, FormatArtifact} {
+		var digests []v1.Hash
+		for range 2 {
+			img, cleanup, err := BuildImage("quay.io/gkm/vector-add:v1", testCacheDir, BuildOptions{Format: format})
+			require.NoError(t, err)
+			digest, err := img.Digest()
+			require.NoError(t, err)
+			cleanup()
+			digests = append(digests, digest)
+		}
+		assert.Equal(t, digests[0], digests[1], format)
+	}
+}
+
+func TestBuildImage_UnsupportedFormat(t *testing.T) {
+	_, _, err := BuildImage("quay.io/gkm/cache:v1", testCacheDir, BuildOptions{Format: "squashfs"})
+	assert.ErrorContains(t, err, "unsupported image format")
+}
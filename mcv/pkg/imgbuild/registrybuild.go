@@ -0,0 +1,206 @@
+package imgbuild
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/redhat-et/GKM/mcv/pkg/constants"
+	"github.com/redhat-et/GKM/mcv/pkg/signing"
+)
+
+// Format is the layout of the cache images built without a daemon.
+type Format string
+
+const (
+	// FormatCompat is the compat format of docs/spec-compat.md, also built by the Docker and
+	// Buildah builders: a gzip tar layer with a standard layer media type.
+	FormatCompat Format = "compat"
+	// FormatArtifact is the OCI artifact format: a single gzip tar layer with the media type
+	// application/cache.<type>.content.layer.v1+<type>, and an artifactType in the manifest.
+	FormatArtifact Format = "artifact"
+)
+
+// BuildOptions configures BuildImage.
+type BuildOptions struct {
+	// Format of the image. Defaults to FormatCompat.
+	Format Format
+	// ArtifactType of a FormatArtifact image. Defaults to DefaultArtifactType of its cache type.
+	ArtifactType string
+}
+
+// DefaultArtifactType returns the artifactType of FormatArtifact images of cacheType.
+func DefaultArtifactType(cacheType string) string {
+	return fmt.Sprintf("application/vnd.gkm.cache.%s.v1", cacheType)
+}
+
+// ArtifactLayerMediaType returns the media type of the layer of FormatArtifact images of
+// cacheType.
+func ArtifactLayerMediaType(cacheType string) types.MediaType {
+	return types.MediaType(fmt.Sprintf("application/cache.%s.content.layer.v1+%s", cacheType, cacheType))
+}
+
+// BuildImage builds the cache image of cacheDir without a daemon. imageName sets the title
+// label of the image. cleanup removes the temporary files the layer of the image is read from,
+// once the image has been written.
+func BuildImage(imageName, cacheDir string, opts BuildOptions) (img v1.Image, cleanup func(), err error) {
+	img, _, cleanup, err = buildImage(imageName, cacheDir, opts)
+	return img, cleanup, err
+}
+
+// buildImage is BuildImage, also returning the attestations of the cache manifest and summary
+// of the image.
+func buildImage(imageName, cacheDir string, opts BuildOptions) (img v1.Image, attestations []signing.Attestation, cleanup func(), err error) {
+	prep, err := prepareBuildContext("registry", cacheDir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer CleanupDirs(prep.CacheBuildDir, prep.ManifestBuildDir)
+
+	attestations, err = cacheAttestations(prep)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	switch opts.Format {
+	case FormatCompat, "":
+		img, err = schema2ImageFromBuildContext(prep, imageName)
+	case FormatArtifact:
+		img, err = artifactImageFromBuildContext(prep, imageName, opts.ArtifactType)
+	default:
+		err = fmt.Errorf("unsupported image format %q (%s or %s)", opts.Format, FormatCompat, FormatArtifact)
+	}
+	cleanup = func() {
+		if prep.TempLayerFile != "" {
+			os.Remove(prep.TempLayerFile)
+		}
+	}
+	if err != nil {
+		cleanup()
+		return nil, nil, nil, fmt.Errorf("failed to build image: %w", err)
+	}
+	return img, attestations, cleanup, nil
+}
+
+// cacheAttestations returns the attestations of the cache manifest of the build context, and
+// of the summary labels of its caches by cache type.
+func cacheAttestations(prep *buildContext) ([]signing.Attestation, error) {
+	manifest, err := os.ReadFile(prep.ManifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache manifest: %w", err)
+	}
+	summaries := make(map[string]json.RawMessage, len(prep.Caches))
+	for _, c := range prep.Caches {
+		if summary := prep.Labels[fmt.Sprintf("cache.%s.image/summary", c.Name())]; json.Valid([]byte(summary)) {
+			summaries[c.Name()] = json.RawMessage(summary)
+		}
+	}
+	summary, err := json.Marshal(summaries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal cache summary: %w", err)
+	}
+	return []signing.Attestation{
+		{PredicateType: signing.ManifestPredicateType, Predicate: manifest},
+		{PredicateType: signing.SummaryPredicateType, Predicate: summary},
+	}, nil
+}
+
+// artifactImageFromBuildContext builds a FormatArtifact image from the staged MCV build
+// context. The layer holds the same tarball as the compat layer, with the cache media type,
+// so extractOCIArtifactImg reads it.
+func artifactImageFromBuildContext(prep *buildContext, imageName, artifactType string) (v1.Image, error) {
+	cacheType, err := buildCacheType(prep)
+	if err != nil {
+		return nil, err
+	}
+	if artifactType == "" {
+		artifactType = DefaultArtifactType(cacheType)
+	}
+	created, err := buildTimestamp()
+	if err != nil {
+		return nil, err
+	}
+	layer, err := compatLayerFromBuildContext(prep, created)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make(map[string]string, len(prep.Labels)+1)
+	for k, v := range prep.Labels {
+		labels[k] = v
+	}
+	labels[imageTitleLabel] = imageTitleFromName(imageName)
+
+	base := mutate.ConfigMediaType(mutate.MediaType(empty.Image, types.OCIManifestSchema1), types.OCIConfigJSON)
+	img, err := mutate.Append(base, mutate.Addendum{
+		Layer:     layer,
+		MediaType: ArtifactLayerMediaType(cacheType),
+		History: v1.History{
+			Created:   v1.Time{Time: created},
+			CreatedBy: "mcv",
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to append cache layer: %w", err)
+	}
+
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image config: %w", err)
+	}
+	cfg.Created = v1.Time{Time: created}
+	cfg.OS = "linux"
+	cfg.Architecture = runtime.GOARCH
+	cfg.Config.Labels = labels
+
+	img, err = mutate.ConfigFile(img, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update image config: %w", err)
+	}
+	return &artifactTypeImage{Image: img, artifactType: artifactType}, nil
+}
+
+// buildCacheType returns the type of the cache of the build context, the one its tags are of.
+func buildCacheType(prep *buildContext) (string, error) {
+	for _, c := range prep.Caches {
+		if c.Name() == constants.VLLM || c.Name() == constants.Triton {
+			return c.Name(), nil
+		}
+	}
+	return "", fmt.Errorf("no supported cache type found")
+}
+
+// artifactTypeImage sets the artifactType of the manifest of an image, which v1.Manifest does
+// not have.
+type artifactTypeImage struct {
+	v1.Image
+	artifactType string
+}
+
+// artifactManifest is an image manifest with an artifactType.
+type artifactManifest struct {
+	*v1.Manifest
+	ArtifactType string `json:"artifactType,omitempty"`
+}
+
+func (i *artifactTypeImage) RawManifest() ([]byte, error) {
+	m, err := i.Image.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(artifactManifest{Manifest: m, ArtifactType: i.artifactType})
+}
+
+func (i *artifactTypeImage) Digest() (v1.Hash, error) {
+	return partial.Digest(i)
+}
+
+func (i *artifactTypeImage) Size() (int64, error) {
+	return partial.Size(i)
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,6 +20,25 @@ import (
 
 const imageTitleLabel = "org.opencontainers.image.title"
 
+// sourceDateEpochEnv sets the creation time of the images built from a cache directory, as
+// specified by https://reproducible-builds.org/specs/source-date-epoch/.
+const sourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
+// buildTimestamp returns the creation time of the images built from a cache directory, and the
+// modification time of the files of their layer: $SOURCE_DATE_EPOCH if it is set, and the Unix
+// epoch otherwise, so the same cache directory always builds the same image.
+func buildTimestamp() (time.Time, error) {
+	epoch := os.Getenv(sourceDateEpochEnv)
+	if epoch == "" {
+		return time.Unix(0, 0).UTC(), nil
+	}
+	seconds, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s %q: %w", sourceDateEpochEnv, epoch, err)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
 // imageTitleFromName returns the repository component used for
 // org.opencontainers.image.title, matching GenerateDockerfile.
 func imageTitleFromName(imageName string) string {
@@ -30,9 +50,14 @@ func imageTitleFromName(imageName string) string {
 // schema2ImageFromBuildContext builds a Docker Schema 2 image from the staged
 // MCV build context. BuildKit often emits an OCI manifest with Docker layer
 // media types, which breaks docker save (and therefore kind load). Loading a
-// consistent Schema 2 image avoids that hybrid manifest.
+// consistent Schema 2 image avoids that hybrid manifest. The image is reproducible: the
+// same build context and buildTimestamp always give the same digest.
 func schema2ImageFromBuildContext(prep *buildContext, imageName string) (v1.Image, error) {
-	layer, err := compatLayerFromBuildContext(prep)
+	created, err := buildTimestamp()
+	if err != nil {
+		return nil, err
+	}
+	layer, err := compatLayerFromBuildContext(prep, created)
 	if err != nil {
 		return nil, err
 	}
@@ -43,12 +68,11 @@ func schema2ImageFromBuildContext(prep *buildContext, imageName string) (v1.Imag
 	}
 	labels[imageTitleLabel] = imageTitleFromName(imageName)
 
-	now := time.Now().UTC()
 	img, err := mutate.Append(empty.Image, mutate.Addendum{
 		Layer:     layer,
 		MediaType: types.DockerLayer,
 		History: v1.History{
-			Created:   v1.Time{Time: now},
+			Created:   v1.Time{Time: created},
 			CreatedBy: "mcv",
 		},
 	})
@@ -60,7 +84,7 @@ func schema2ImageFromBuildContext(prep *buildContext, imageName string) (v1.Imag
 	if err != nil {
 		return nil, fmt.Errorf("failed to read image config: %w", err)
 	}
-	cfg.Created = v1.Time{Time: now}
+	cfg.Created = v1.Time{Time: created}
 	cfg.OS = "linux"
 	cfg.Architecture = runtime.GOARCH
 	cfg.Config.Labels = labels
@@ -75,14 +99,16 @@ func schema2ImageFromBuildContext(prep *buildContext, imageName string) (v1.Imag
 	return img, nil
 }
 
-func compatLayerFromBuildContext(prep *buildContext) (v1.Layer, error) {
+// compatLayerFromBuildContext writes the compat layer of the build context, with created as the
+// modification time of its files.
+func compatLayerFromBuildContext(prep *buildContext, created time.Time) (v1.Layer, error) {
 	f, err := os.CreateTemp("", "mcv-layer-*.tar")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create temp layer file: %w", err)
 	}
 	tmpPath := f.Name()
 
-	if err := writeCompatLayerTar(f, prep.CacheBuildDir, prep.ManifestBuildDir, prep.CacheTag, prep.ManifestTag); err != nil {
+	if err := writeCompatLayerTar(f, prep.CacheBuildDir, prep.ManifestBuildDir, prep.CacheTag, prep.ManifestTag, created); err != nil {
 		f.Close()
 		os.Remove(tmpPath)
 		return nil, err
@@ -96,20 +122,24 @@ func compatLayerFromBuildContext(prep *buildContext) (v1.Layer, error) {
 	return tarball.LayerFromFile(tmpPath)
 }
 
-func writeCompatLayerTar(w io.Writer, cacheDir, manifestDir, cacheTag, manifestTag string) error {
+// writeCompatLayerTar writes the cache and manifest directories to w under their tags. The
+// entries are in lexical order, with mtime as modification time, root as owner, and 0755 or
+// 0644 as mode, so the tar only depends on the names and contents of the files.
+func writeCompatLayerTar(w io.Writer, cacheDir, manifestDir, cacheTag, manifestTag string, mtime time.Time) error {
 	tw := tar.NewWriter(w)
 	defer tw.Close()
 
-	if err := appendTreeToTar(tw, cacheDir, cacheTag); err != nil {
+	if err := appendTreeToTar(tw, cacheDir, cacheTag, mtime); err != nil {
 		return fmt.Errorf("failed to tar cache directory: %w", err)
 	}
-	if err := appendTreeToTar(tw, manifestDir, manifestTag); err != nil {
+	if err := appendTreeToTar(tw, manifestDir, manifestTag, mtime); err != nil {
 		return fmt.Errorf("failed to tar manifest directory: %w", err)
 	}
 	return nil
 }
 
-func appendTreeToTar(tw *tar.Writer, srcDir, prefix string) error {
+func appendTreeToTar(tw *tar.Writer, srcDir, prefix string, mtime time.Time) error {
+	// filepath.Walk visits the files of each directory in lexical order.
 	return filepath.Walk(srcDir, func(path string, info os.FileInfo, walkErr error) error {
 		if walkErr != nil {
 			return walkErr
@@ -131,6 +161,12 @@ func appendTreeToTar(tw *tar.Writer, srcDir, prefix string) error {
 		if info.IsDir() {
 			header.Name += "/"
 		}
+		header.ModTime = mtime
+		header.AccessTime = time.Time{}
+		header.ChangeTime = time.Time{}
+		header.Uid, header.Gid = 0, 0
+		header.Uname, header.Gname = "", ""
+		header.Mode = tarMode(info)
 
 		if writeErr := tw.WriteHeader(header); writeErr != nil {
 			return writeErr
@@ -150,3 +186,12 @@ func appendTreeToTar(tw *tar.Writer, srcDir, prefix string) error {
 		return err
 	})
 }
+
+// tarMode returns the mode of a file in the compat layer: 0755 for directories and executable
+// files, and 0644 for other files, whatever the umask of the build.
+func tarMode(info os.FileInfo) int64 {
+	if info.IsDir() || info.Mode()&0o111 != 0 {
+		return 0o755
+	}
+	return 0o644
+}
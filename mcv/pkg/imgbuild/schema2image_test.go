@@ -7,10 +7,13 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/redhat-et/GKM/mcv/pkg/cache"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestImageTitleFromName(t *testing.T) {
@@ -81,7 +84,7 @@ func TestCompatLayerContainsExpectedPaths(t *testing.T) {
 		ManifestBuildDir: manifestDir,
 	}
 
-	layer, err := compatLayerFromBuildContext(prep)
+	layer, err := compatLayerFromBuildContext(prep, time.Unix(0, 0))
 	assert.NoError(t, err)
 	if prep.TempLayerFile != "" {
 		t.Cleanup(func() { os.Remove(prep.TempLayerFile) })
@@ -109,3 +112,97 @@ func TestCompatLayerContainsExpectedPaths(t *testing.T) {
 	assert.Contains(t, paths, cacheTag+"/kernel.bin")
 	assert.Contains(t, paths, manifestTag+"/manifest.json")
 }
+
+// reproducibleBuildContext stages a cache and manifest directory whose files have mode and
+// mtime.
+func reproducibleBuildContext(t *testing.T, mode os.FileMode, mtime time.Time) *buildContext {
+	tmpDir := t.TempDir()
+	cacheDir := filepath.Join(tmpDir, "io.triton.cache")
+	manifestDir := filepath.Join(tmpDir, "io.triton.manifest")
+	files := map[string]string{
+		filepath.Join(cacheDir, "a1b2", "kernel.bin"):       "kernels",
+		filepath.Join(cacheDir, "a1b2", "kernel.json"):      `{"hash":"a1b2"}`,
+		filepath.Join(manifestDir, "manifest.json"):         `{}`,
+		filepath.Join(manifestDir, cache.IntegrityFileName): `{}`,
+	}
+	for path, content := range files {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+		assert.NoError(t, os.WriteFile(path, []byte(content), mode))
+		assert.NoError(t, os.Chmod(path, mode))
+		assert.NoError(t, os.Chtimes(path, mtime, mtime))
+	}
+	return &buildContext{
+		Labels:           cache.Labels{"cache.triton.image/entry-count": "1"},
+		CacheTag:         "io.triton.cache",
+		ManifestTag:      "io.triton.manifest",
+		CacheBuildDir:    cacheDir,
+		ManifestBuildDir: manifestDir,
+	}
+}
+
+func buildReproducibleImage(t *testing.T, prep *buildContext) v1.Image {
+	img, err := schema2ImageFromBuildContext(prep, "quay.io/example/cache:latest")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.Remove(prep.TempLayerFile) })
+	return img
+}
+
+func TestSchema2ImageIsReproducible(t *testing.T) {
+	first := buildReproducibleImage(t, reproducibleBuildContext(t, 0o644, time.Now()))
+	second := buildReproducibleImage(t, reproducibleBuildContext(t, 0o664, time.Now().Add(-time.Hour)))
+
+	firstDigest, err := first.Digest()
+	require.NoError(t, err)
+	secondDigest, err := second.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, firstDigest, secondDigest)
+
+	cfg, err := first.ConfigFile()
+	require.NoError(t, err)
+	assert.True(t, cfg.Created.Equal(time.Unix(0, 0)))
+
+	layers, err := first.Layers()
+	require.NoError(t, err)
+	rc, err := layers[0].Uncompressed()
+	require.NoError(t, err)
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, header.Name)
+		assert.True(t, header.ModTime.Equal(time.Unix(0, 0)), header.Name)
+		assert.Zero(t, header.Uid, header.Name)
+		assert.Zero(t, header.Gid, header.Name)
+		if header.Typeflag == tar.TypeDir {
+			assert.Equal(t, int64(0o755), header.Mode, header.Name)
+		} else {
+			assert.Equal(t, int64(0o644), header.Mode, header.Name)
+		}
+	}
+	assert.Equal(t, []string{
+		"io.triton.cache/a1b2/",
+		"io.triton.cache/a1b2/kernel.bin",
+		"io.triton.cache/a1b2/kernel.json",
+		"io.triton.manifest/integrity.json",
+		"io.triton.manifest/manifest.json",
+	}, names)
+}
+
+func TestSchema2ImageSourceDateEpoch(t *testing.T) {
+	t.Setenv(sourceDateEpochEnv, "1700000000")
+	img := buildReproducibleImage(t, reproducibleBuildContext(t, 0o644, time.Now()))
+	cfg, err := img.ConfigFile()
+	require.NoError(t, err)
+	assert.True(t, cfg.Created.Equal(time.Unix(1700000000, 0)))
+	require.Len(t, cfg.History, 1)
+	assert.True(t, cfg.History[0].Created.Equal(time.Unix(1700000000, 0)))
+
+	t.Setenv(sourceDateEpochEnv, "yesterday")
+	_, err = schema2ImageFromBuildContext(reproducibleBuildContext(t, 0o644, time.Now()), "quay.io/example/cache:latest")
+	assert.ErrorContains(t, err, sourceDateEpochEnv)
+}
@@ -5,6 +5,7 @@ import "github.com/redhat-et/GKM/mcv/pkg/cache"
 const DockerfileTemplate = `FROM scratch AS build
 COPY "./{{ .CacheDir }}" "./{{ .CacheDir }}"
 COPY "./{{ .ManifestDir }}/manifest.json" "./{{ .ManifestDir }}/manifest.json"
+COPY "./{{ .ManifestDir }}/integrity.json" "./{{ .ManifestDir }}/integrity.json"
 
 FROM scratch
 LABEL org.opencontainers.image.title={{ .ImageTitle }}
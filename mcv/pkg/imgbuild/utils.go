@@ -98,6 +98,15 @@ func prepareBuildContext(buildType, cacheDir string) (*buildContext, error) {
 		return nil, fmt.Errorf("failed to write manifest: %w", err)
 	}
 
+	integrity, err := cache.BuildIntegrityManifest(cacheBuildDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := cache.WriteIntegrityManifest(filepath.Join(manifestBuildDir, cache.IntegrityFileName), integrity); err != nil {
+		return nil, err
+	}
+	logging.Debugf("integrity manifest lists %d files", len(integrity.Files))
+
 	return &buildContext{
 		Caches:           caches,
 		Labels:           labels,
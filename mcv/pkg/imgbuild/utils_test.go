@@ -37,6 +37,7 @@ func TestGenerateDockerfile(t *testing.T) {
 	// Assert COPY instructions exist
 	assert.Contains(t, dockerfile, "COPY \"./cacheLayer\" \"./cacheLayer\"")
 	assert.Contains(t, dockerfile, "COPY \"./manifestLayer/manifest.json")
+	assert.Contains(t, dockerfile, "COPY \"./manifestLayer/integrity.json")
 }
 
 func countOccurrences(s, substr string) int {
@@ -0,0 +1,77 @@
+// Package localimage reads and writes images in local OCI layouts, OCI archives and Docker
+// archives, so caches can be built, inspected and extracted without a daemon or a registry.
+// Images are referenced like containers-transports(5) does:
+//
+//	oci:<path>[:<reference>]
+//	oci-archive:<path>[:<reference>]
+//	docker-archive:<path>[:<name:tag>]
+//
+// The reference of an OCI layout or archive is the org.opencontainers.image.ref.name
+// annotation of the image in its index. The path may not contain a colon.
+package localimage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// Transports of local images.
+const (
+	OCILayout     = "oci"
+	OCIArchive    = "oci-archive"
+	DockerArchive = "docker-archive"
+)
+
+// refNameAnnotation is the annotation of the images of an OCI index with their reference.
+const refNameAnnotation = "org.opencontainers.image.ref.name"
+
+// Ref is a reference to a local image.
+type Ref struct {
+	// Transport is OCILayout, OCIArchive or DockerArchive.
+	Transport string
+	// Path is the directory of an OCI layout or the file of an archive.
+	Path string
+	// Reference selects the image in the layout or archive. It may be empty if there is a
+	// single image.
+	Reference string
+}
+
+// IsLocal returns true if image is a reference to a local image rather than an image name.
+func IsLocal(image string) bool {
+	transport, _, found := strings.Cut(image, ":")
+	if !found {
+		return false
+	}
+	switch transport {
+	case OCILayout, OCIArchive, DockerArchive:
+		return true
+	}
+	return false
+}
+
+// Parse parses a reference to a local image.
+func Parse(image string) (*Ref, error) {
+	if !IsLocal(image) {
+		return nil, fmt.Errorf("%q is not a local image reference (%s:, %s: or %s:)", image, OCILayout, OCIArchive, DockerArchive)
+	}
+	transport, rest, _ := strings.Cut(image, ":")
+	path, reference, _ := strings.Cut(rest, ":")
+	if path == "" {
+		return nil, fmt.Errorf("%q has no path", image)
+	}
+	if transport == DockerArchive && reference != "" {
+		if _, err := name.NewTag(reference, name.StrictValidation); err != nil {
+			return nil, fmt.Errorf("invalid %s reference %q: %w", DockerArchive, reference, err)
+		}
+	}
+	return &Ref{Transport: transport, Path: path, Reference: reference}, nil
+}
+
+func (r *Ref) String() string {
+	if r.Reference == "" {
+		return r.Transport + ":" + r.Path
+	}
+	return r.Transport + ":" + r.Path + ":" + r.Reference
+}
@@ -0,0 +1,126 @@
+package localimage
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	for image, want := range map[string]Ref{
+		"oci:/tmp/layout":                               {Transport: OCILayout, Path: "/tmp/layout"},
+		"oci:layout:v1":                                 {Transport: OCILayout, Path: "layout", Reference: "v1"},
+		"oci-archive:/tmp/cache.tar:v1":                 {Transport: OCIArchive, Path: "/tmp/cache.tar", Reference: "v1"},
+		"docker-archive:cache.tar":                      {Transport: DockerArchive, Path: "cache.tar"},
+		"docker-archive:cache.tar:quay.io:443/gkm/c:v1": {Transport: DockerArchive, Path: "cache.tar", Reference: "quay.io:443/gkm/c:v1"},
+	} {
+		ref, err := Parse(image)
+		require.NoError(t, err, image)
+		assert.Equal(t, want, *ref, image)
+		assert.Equal(t, image, ref.String())
+	}
+
+	for _, image := range []string{"quay.io/gkm/cache:v1", "oci:", "docker-archive:cache.tar:Invalid Name"} {
+		_, err := Parse(image)
+		assert.Error(t, err, image)
+	}
+	assert.True(t, IsLocal("oci-archive:cache.tar"))
+	assert.False(t, IsLocal("quay.io/gkm/cache:v1"))
+	assert.False(t, IsLocal("localhost:5000/cache"))
+}
+
+func TestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	for _, image := range []string{
+		"oci:" + filepath.Join(dir, "layout"),
+		"oci:" + filepath.Join(dir, "tagged") + ":v1",
+		"oci-archive:" + filepath.Join(dir, "cache.oci.tar"),
+		"oci-archive:" + filepath.Join(dir, "tagged.oci.tar") + ":v1",
+		"docker-archive:" + filepath.Join(dir, "cache.tar"),
+		"docker-archive:" + filepath.Join(dir, "tagged.tar") + ":quay.io/gkm/cache:v1",
+	} {
+		img, err := random.Image(1024, 2)
+		require.NoError(t, err)
+		ref, err := Parse(image)
+		require.NoError(t, err)
+		require.NoError(t, ref.Write(img), image)
+
+		read, err := ref.Image(t.TempDir())
+		require.NoError(t, err, image)
+		assertSameImage(t, img, read)
+	}
+}
+
+func TestOCILayoutReferences(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "layout")
+	v1Img, err := random.Image(512, 1)
+	require.NoError(t, err)
+	v2Img, err := random.Image(512, 1)
+	require.NoError(t, err)
+	for ref, img := range map[string]v1.Image{"oci:" + dir + ":v1": v1Img, "oci:" + dir + ":v2": v2Img} {
+		parsed, err := Parse(ref)
+		require.NoError(t, err)
+		require.NoError(t, parsed.Write(img))
+	}
+
+	// Writing the same reference again replaces the image.
+	replaced, err := random.Image(512, 1)
+	require.NoError(t, err)
+	require.NoError(t, (&Ref{Transport: OCILayout, Path: dir, Reference: "v1"}).Write(replaced))
+
+	read, err := (&Ref{Transport: OCILayout, Path: dir, Reference: "v1"}).Image("")
+	require.NoError(t, err)
+	assertSameImage(t, replaced, read)
+	read, err = (&Ref{Transport: OCILayout, Path: dir, Reference: "v2"}).Image("")
+	require.NoError(t, err)
+	assertSameImage(t, v2Img, read)
+
+	_, err = (&Ref{Transport: OCILayout, Path: dir}).Image("")
+	assert.ErrorContains(t, err, "2 images")
+	_, err = (&Ref{Transport: OCILayout, Path: dir, Reference: "v3"}).Image("")
+	assert.ErrorContains(t, err, "no image")
+}
+
+func TestUnpackArchiveSkipsOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "evil.tar")
+	f, err := os.Create(archive)
+	require.NoError(t, err)
+	tw := tar.NewWriter(f)
+	for _, entry := range []string{"../escape", "blobs/sha256/../../../escape", "index.json"} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: entry, Mode: 0644, Size: 2}))
+		_, err = tw.Write([]byte("{}"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, f.Close())
+
+	out := filepath.Join(dir, "out")
+	require.NoError(t, os.Mkdir(out, 0755))
+	require.NoError(t, unpackArchive(archive, out))
+	assert.NoFileExists(t, filepath.Join(dir, "escape"))
+	assert.FileExists(t, filepath.Join(out, "index.json"))
+}
+
+func assertSameImage(t *testing.T, want, got v1.Image) {
+	t.Helper()
+	wantDigest, err := want.Digest()
+	require.NoError(t, err)
+	gotDigest, err := got.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, wantDigest, gotDigest)
+
+	layers, err := got.Layers()
+	require.NoError(t, err)
+	for _, layer := range layers {
+		rc, err := layer.Compressed()
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+	}
+}
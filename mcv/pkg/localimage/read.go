@@ -0,0 +1,136 @@
+package localimage
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// layoutFile matches the files of an OCI layout.
+var layoutFile = regexp.MustCompile(`^(oci-layout|index\.json|blobs/[a-z0-9]+/[a-f0-9]+)$`)
+
+// Image reads the image of r. An OCI archive is unpacked in a new directory in tmpDir, which
+// must be kept until the image has been read.
+func (r *Ref) Image(tmpDir string) (v1.Image, error) {
+	switch r.Transport {
+	case OCILayout:
+		return readLayout(r.Path, r.Reference)
+	case OCIArchive:
+		if err := os.MkdirAll(tmpDir, 0755); err != nil {
+			return nil, err
+		}
+		dir, err := os.MkdirTemp(tmpDir, "oci-archive-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create directory for %s: %w", r.Path, err)
+		}
+		if err := unpackArchive(r.Path, dir); err != nil {
+			_ = os.RemoveAll(dir)
+			return nil, err
+		}
+		return readLayout(dir, r.Reference)
+	case DockerArchive:
+		var tag *name.Tag
+		if r.Reference != "" {
+			t, err := name.NewTag(r.Reference)
+			if err != nil {
+				return nil, err
+			}
+			tag = &t
+		}
+		img, err := tarball.ImageFromPath(r.Path, tag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", r, err)
+		}
+		return img, nil
+	}
+	return nil, fmt.Errorf("unsupported transport %q", r.Transport)
+}
+
+// readLayout reads the image with reference from the OCI layout in dir, or its only image if
+// reference is empty.
+func readLayout(dir, reference string) (v1.Image, error) {
+	p, err := layout.FromPath(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open OCI layout %s: %w", dir, err)
+	}
+	index, err := p.ImageIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OCI layout %s: %w", dir, err)
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index of OCI layout %s: %w", dir, err)
+	}
+
+	var found []v1.Descriptor
+	for _, desc := range manifest.Manifests {
+		if reference == "" || desc.Annotations[refNameAnnotation] == reference {
+			found = append(found, desc)
+		}
+	}
+	switch {
+	case len(found) == 0 && reference != "":
+		return nil, fmt.Errorf("no image %q in OCI layout %s", reference, dir)
+	case len(found) == 0:
+		return nil, fmt.Errorf("no image in OCI layout %s", dir)
+	case len(found) > 1:
+		return nil, fmt.Errorf("%d images in OCI layout %s, select one with a reference", len(found), dir)
+	}
+	if found[0].MediaType.IsIndex() {
+		return nil, fmt.Errorf("%s in OCI layout %s is an image index, not an image", found[0].Digest, dir)
+	}
+	return index.Image(found[0].Digest)
+}
+
+// unpackArchive unpacks the OCI layout in the OCI archive at path to dir. Only the files of
+// an OCI layout are unpacked.
+func unpackArchive(path, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read OCI archive %s: %w", path, err)
+		}
+		entry := filepath.ToSlash(filepath.Clean(header.Name))
+		if header.Typeflag != tar.TypeReg || !layoutFile.MatchString(entry) {
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(entry))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := writeFile(target, tr); err != nil {
+			return fmt.Errorf("failed to unpack %s from OCI archive %s: %w", entry, path, err)
+		}
+	}
+}
+
+func writeFile(path string, r io.Reader) error {
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,151 @@
+package localimage
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/match"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// Write writes img to r. In an existing OCI layout, the image with the same reference is
+// replaced, or img is added if r has no reference. Archives are replaced.
+func (r *Ref) Write(img v1.Image) error {
+	switch r.Transport {
+	case OCILayout:
+		return writeLayout(r.Path, r.Reference, img)
+	case OCIArchive:
+		dir, err := os.MkdirTemp("", "mcv-oci-archive-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		if err := writeLayout(dir, r.Reference, img); err != nil {
+			return err
+		}
+		return writeAtomic(r.Path, func(w io.Writer) error { return packArchive(dir, w) })
+	case DockerArchive:
+		ref, err := r.dockerReference(img)
+		if err != nil {
+			return err
+		}
+		return writeAtomic(r.Path, func(w io.Writer) error { return tarball.Write(ref, img, w) })
+	}
+	return fmt.Errorf("unsupported transport %q", r.Transport)
+}
+
+// dockerReference returns the tag of the image in a Docker archive, or a digest reference,
+// which leaves the image untagged, if r has no reference.
+func (r *Ref) dockerReference(img v1.Image) (name.Reference, error) {
+	if r.Reference != "" {
+		return name.NewTag(r.Reference)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		return nil, err
+	}
+	return name.NewDigest("untagged@" + digest.String())
+}
+
+func writeLayout(dir, reference string, img v1.Image) error {
+	p, err := layout.FromPath(dir)
+	if err != nil {
+		if p, err = layout.Write(dir, empty.Index); err != nil {
+			return fmt.Errorf("failed to create OCI layout %s: %w", dir, err)
+		}
+	}
+	if reference == "" {
+		err = p.AppendImage(img)
+	} else {
+		err = p.ReplaceImage(img, match.Annotation(refNameAnnotation, reference),
+			layout.WithAnnotations(map[string]string{refNameAnnotation: reference}))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write image to OCI layout %s: %w", dir, err)
+	}
+	return nil
+}
+
+// packArchive writes the OCI layout in dir to w as a tar archive.
+func packArchive(dir string, w io.Writer) error {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	tw := tar.NewWriter(w)
+	for _, file := range files {
+		if err := addFile(tw, filepath.Join(dir, filepath.FromSlash(file)), file); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func addFile(tw *tar.Writer, path, entry string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     entry,
+		Mode:     0644,
+		Size:     info.Size(),
+	}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// writeAtomic writes the file at path with write, replacing it only once it is complete.
+func writeAtomic(path string, write func(io.Writer) error) error {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
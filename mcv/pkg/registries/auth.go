@@ -0,0 +1,113 @@
+package registries
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/google"
+)
+
+// Keychain returns the keychain images are pulled with: the credentials in authFile, if set,
+// then those of the Docker and Podman configuration of the user, then the workload identity of
+// the host for the registries of its cloud.
+func Keychain(authFile string) authn.Keychain {
+	keychains := []authn.Keychain{}
+	if authFile != "" {
+		keychains = append(keychains, authFileKeychain(authFile))
+	}
+	return authn.NewMultiKeychain(append(keychains, authn.DefaultKeychain, google.Keychain)...)
+}
+
+// KeychainFromConfig returns the keychain images are pulled with, like Keychain, with the
+// credentials in the Docker config.json data instead of an auth file.
+func KeychainFromConfig(data []byte) (authn.Keychain, error) {
+	auths, err := ParseAuthConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	return authn.NewMultiKeychain(configKeychain(auths), authn.DefaultKeychain, google.Keychain), nil
+}
+
+// authConfig is a Docker config.json, the format of a Podman auth.json and of the
+// kubernetes.io/dockerconfigjson Secrets.
+type authConfig struct {
+	Auths map[string]authn.AuthConfig `json:"auths"`
+}
+
+// ParseAuthConfig parses the credentials in a Docker config.json. Registries are keyed by
+// host[:port] or by host[:port]/repository, the most specific key matching an image is used.
+func ParseAuthConfig(data []byte) (map[string]authn.AuthConfig, error) {
+	var cfg authConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse registry credentials: %w", err)
+	}
+	auths := make(map[string]authn.AuthConfig, len(cfg.Auths))
+	for key, auth := range cfg.Auths {
+		auths[normalizeAuthKey(key)] = auth
+	}
+	return auths, nil
+}
+
+// authFileKeychain resolves credentials from a Docker config.json. The file is read on each
+// lookup, so credentials updated in place are picked up.
+type authFileKeychain string
+
+func (path authFileKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	data, err := os.ReadFile(string(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return authn.Anonymous, nil
+		}
+		return nil, err
+	}
+	auths, err := ParseAuthConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	return resolveAuth(auths, target), nil
+}
+
+// configKeychain resolves credentials from a parsed Docker config.json.
+type configKeychain map[string]authn.AuthConfig
+
+func (auths configKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	return resolveAuth(auths, target), nil
+}
+
+// resolveAuth returns the credentials of the most specific key of auths matching target.
+func resolveAuth(auths map[string]authn.AuthConfig, target authn.Resource) authn.Authenticator {
+	registry := normalizeAuthKey(target.RegistryStr())
+	path := registry
+	if repo, ok := target.(name.Repository); ok {
+		path = registry + "/" + repo.RepositoryStr()
+	}
+	best := ""
+	for key := range auths {
+		if (key == path || strings.HasPrefix(path, key+"/")) && len(key) > len(best) {
+			best = key
+		}
+	}
+	if best == "" {
+		return authn.Anonymous
+	}
+	return authn.FromConfig(auths[best])
+}
+
+// normalizeAuthKey returns a registry key as host[:port][/repository], with Docker Hub as
+// index.docker.io.
+func normalizeAuthKey(key string) string {
+	key = strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	key = strings.TrimSuffix(strings.TrimSuffix(key, "/"), "/v1")
+	host, rest, _ := strings.Cut(key, "/")
+	if host == "docker.io" || host == "registry-1.docker.io" {
+		host = name.DefaultRegistry
+	}
+	if rest == "" {
+		return host
+	}
+	return host + "/" + rest
+}
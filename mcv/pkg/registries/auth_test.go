@@ -0,0 +1,81 @@
+package registries
+
+import (
+	"encoding/base64"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func authString(user, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(user + ":" + password))
+}
+
+func resolveUser(t *testing.T, kc authn.Keychain, ref string) string {
+	parsed, err := name.ParseReference(ref)
+	require.NoError(t, err)
+	auth, err := kc.Resolve(parsed.Context())
+	require.NoError(t, err)
+	cfg, err := auth.Authorization()
+	require.NoError(t, err)
+	return cfg.Username
+}
+
+func TestKeychainFromConfig(t *testing.T) {
+	kc, err := KeychainFromConfig([]byte(`{"auths": {
+		"https://index.docker.io/v1/": {"auth": "` + authString("hub", "p") + `"},
+		"quay.io": {"username": "quay", "password": "p"},
+		"quay.io/gkm": {"auth": "` + authString("gkm", "p") + `"},
+		"registry.example.com:5000": {"auth": "` + authString("example", "p") + `"}
+	}}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, "hub", resolveUser(t, kc, "busybox"))
+	assert.Equal(t, "quay", resolveUser(t, kc, "quay.io/other/cache:v1"))
+	assert.Equal(t, "gkm", resolveUser(t, kc, "quay.io/gkm/cache:v1"))
+	assert.Equal(t, "quay", resolveUser(t, kc, "quay.io/gkmx/cache:v1"))
+	assert.Equal(t, "example", resolveUser(t, kc, "registry.example.com:5000/gkm/cache:v1"))
+
+	_, err = KeychainFromConfig([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestKeychain_AuthFile(t *testing.T) {
+	handler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "gkm" || password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	host := strings.TrimPrefix(server.URL, "http://")
+	ref, err := name.ParseReference(host + "/gkm/cache:v1")
+	require.NoError(t, err)
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img, remote.WithAuth(&authn.Basic{Username: "gkm", Password: "secret"})))
+
+	authFile := filepath.Join(t.TempDir(), "auth.json")
+	_, err = remote.Get(ref, remote.WithAuthFromKeychain(Keychain(authFile)))
+	assert.Error(t, err, "missing auth file")
+
+	require.NoError(t, os.WriteFile(authFile, []byte(`{"auths": {"`+host+`": {"auth": "`+authString("gkm", "secret")+`"}}}`), 0600))
+	_, err = remote.Get(ref, remote.WithAuthFromKeychain(Keychain(authFile)))
+	assert.NoError(t, err)
+}
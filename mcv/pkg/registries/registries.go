@@ -0,0 +1,260 @@
+// Package registries applies the registries configuration of the host, in the
+// containers-registries.conf(5) format, to the pulls of go-containerregistry: the mirrors and
+// pull-through caches of a registry are tried before the registry itself, insecure registries
+// are reached over plain HTTP or without checking their certificate, blocked registries are
+// refused, and registry certificates are checked against extra CA bundles.
+package registries
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	logging "github.com/sirupsen/logrus"
+	"go.podman.io/image/v5/docker/reference"
+	"go.podman.io/image/v5/pkg/sysregistriesv2"
+	"go.podman.io/image/v5/types"
+)
+
+const (
+	// ConfFileName and CABundleFileName are the files of a registries configuration directory,
+	// as mounted from a ConfigMap.
+	ConfFileName     = "registries.conf"
+	CABundleFileName = "ca-bundle.crt"
+
+	// DefaultCertsDir holds the CA certificates of each registry, as <host[:port]>/*.crt,
+	// like container runtimes do.
+	DefaultCertsDir = "/etc/containers/certs.d"
+)
+
+// Config selects the registries configuration.
+type Config struct {
+	// ConfPath is the registries.conf file. Drop-in files are read from ConfPath + ".d". If
+	// empty, the registries.conf of the host is used. If set and missing, no registry is
+	// configured.
+	ConfPath string
+	// CertsDir holds the CA certificates of each registry. If empty, DefaultCertsDir is used.
+	CertsDir string
+	// CABundle is a PEM file of CA certificates trusted for every registry, in addition to the
+	// system ones. It is ignored if missing.
+	CABundle string
+}
+
+// FromDir returns the configuration of a registries configuration directory, holding
+// ConfFileName and CABundleFileName.
+func FromDir(dir string) Config {
+	return Config{
+		ConfPath: filepath.Join(dir, ConfFileName),
+		CABundle: filepath.Join(dir, CABundleFileName),
+	}
+}
+
+// Source is a location to pull an image from.
+type Source struct {
+	// Ref is the reference of the image at the source.
+	Ref name.Reference
+	// Mirror is true if the source is a mirror of the registry of the image.
+	Mirror bool
+	// Insecure is true if the source is reached over plain HTTP or without checking its
+	// certificate.
+	Insecure bool
+}
+
+// Sources returns the sources to pull ref from, in the order to try them: the mirrors of its
+// registry first, then the registry itself. An error is returned if the registry is blocked.
+func (c Config) Sources(ref name.Reference) ([]Source, error) {
+	primary := []Source{{Ref: ref}}
+	sys, err := c.systemContext()
+	if err != nil {
+		return nil, err
+	}
+	if sys == nil {
+		return primary, nil
+	}
+
+	named, err := reference.ParseNamed(referenceString(ref))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image reference %s: %w", ref, err)
+	}
+	registry, err := sysregistriesv2.FindRegistry(sys, named.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load registries configuration: %w", err)
+	}
+	if registry == nil {
+		return primary, nil
+	}
+	if registry.Blocked {
+		return nil, fmt.Errorf("registry %s is blocked in the registries configuration", reference.Domain(named))
+	}
+
+	pullSources, err := registry.PullSourcesFromReference(named)
+	if err != nil {
+		return nil, err
+	}
+	sources := make([]Source, 0, len(pullSources))
+	for i, pullSource := range pullSources {
+		var opts []name.Option
+		if pullSource.Endpoint.Insecure {
+			opts = append(opts, name.Insecure)
+		}
+		sourceRef, err := name.ParseReference(pullSource.Reference.String(), opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse image reference %s: %w", pullSource.Reference, err)
+		}
+		sources = append(sources, Source{
+			Ref:      sourceRef,
+			Mirror:   i < len(pullSources)-1,
+			Insecure: pullSource.Endpoint.Insecure,
+		})
+	}
+	return sources, nil
+}
+
+// Destination returns the source to push ref to: its registry itself, mirrors are only pulled
+// from. An error is returned if the registry is blocked.
+func (c Config) Destination(ref name.Reference) (Source, error) {
+	sources, err := c.Sources(ref)
+	if err != nil {
+		return Source{}, err
+	}
+	registry := sources[len(sources)-1]
+	if !registry.Insecure {
+		return Source{Ref: ref}, nil
+	}
+	insecureRef, err := name.ParseReference(ref.String(), name.Insecure)
+	if err != nil {
+		return Source{}, err
+	}
+	return Source{Ref: insecureRef, Insecure: true}, nil
+}
+
+// Options returns the remote options to reach src: a transport trusting the CA certificates
+// of its registry, or skipping the certificate check if src is insecure.
+func (c Config) Options(src Source) ([]remote.Option, error) {
+	pool, err := c.certPool(src.Ref.Context().RegistryStr())
+	if err != nil {
+		return nil, err
+	}
+	if pool == nil && !src.Insecure {
+		return nil, nil
+	}
+	transport := remote.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		RootCAs:            pool,
+		InsecureSkipVerify: src.Insecure, //nolint:gosec // insecure registries are configured explicitly
+	}
+	return []remote.Option{remote.WithTransport(transport)}, nil
+}
+
+// Try calls fn with the reference and remote options of each source of ref in turn, until one
+// succeeds, and returns its result and source along with the options used. opts are added to
+// the options of every source. The error of the last source is returned if they all fail.
+func Try[T any](c Config, ref name.Reference, opts []remote.Option,
+	fn func(name.Reference, ...remote.Option) (T, error)) (T, Source, []remote.Option, error) {
+	var zero T
+	sources, err := c.Sources(ref)
+	if err != nil {
+		return zero, Source{}, nil, err
+	}
+	for _, src := range sources {
+		srcOpts, err := c.Options(src)
+		if err != nil {
+			return zero, Source{}, nil, err
+		}
+		srcOpts = append(append([]remote.Option{}, opts...), srcOpts...)
+		result, err := fn(src.Ref, srcOpts...)
+		if err == nil {
+			if src.Mirror {
+				logging.Debugf("Image %s pulled from mirror %s", ref, src.Ref.Context().RegistryStr())
+			}
+			return result, src, srcOpts, nil
+		}
+		if !src.Mirror {
+			return zero, src, srcOpts, err
+		}
+		logging.Debugf("Failed to pull image %s from mirror %s: %v", ref, src.Ref.Context().RegistryStr(), err)
+	}
+	return zero, Source{}, nil, errors.New("no source to pull from")
+}
+
+// systemContext returns the context selecting the registries.conf of c, or nil if an explicit
+// one is missing.
+func (c Config) systemContext() (*types.SystemContext, error) {
+	if c.ConfPath == "" {
+		return &types.SystemContext{}, nil
+	}
+	if _, err := os.Stat(c.ConfPath); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	sys := &types.SystemContext{
+		SystemRegistriesConfPath:    c.ConfPath,
+		SystemRegistriesConfDirPath: c.ConfPath + ".d",
+	}
+	// The file may have changed since it was last read, as a mounted ConfigMap does.
+	if _, err := sysregistriesv2.TryUpdatingCache(sys); err != nil {
+		return nil, fmt.Errorf("failed to load registries configuration: %w", err)
+	}
+	return sys, nil
+}
+
+// certPool returns the system CA certificates together with CABundle and the certificates of
+// host in CertsDir, or nil if there are no extra certificates.
+func (c Config) certPool(host string) (*x509.CertPool, error) {
+	var files []string
+	if c.CABundle != "" {
+		if _, err := os.Stat(c.CABundle); err == nil {
+			files = append(files, c.CABundle)
+		}
+	}
+	certsDir := c.CertsDir
+	if certsDir == "" {
+		certsDir = DefaultCertsDir
+	}
+	hostCerts, _ := filepath.Glob(filepath.Join(certsDir, host, "*.crt"))
+	files = append(files, hostCerts...)
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	for _, file := range files {
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificates: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no CA certificate found in %s", file)
+		}
+	}
+	return pool, nil
+}
+
+// referenceString returns ref in the form of the registries configuration, with Docker Hub
+// as docker.io.
+func referenceString(ref name.Reference) string {
+	registry := ref.Context().RegistryStr()
+	if registry == name.DefaultRegistry {
+		registry = "docker.io"
+	}
+	s := registry + "/" + ref.Context().RepositoryStr()
+	switch r := ref.(type) {
+	case name.Digest:
+		s += "@" + r.DigestStr()
+	case name.Tag:
+		s += ":" + r.TagStr()
+	}
+	return s
+}
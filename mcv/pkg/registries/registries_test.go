@@ -0,0 +1,288 @@
+package registries
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRegistry is an in-process registry counting the requests it receives.
+type testRegistry struct {
+	server   *httptest.Server
+	host     string
+	requests atomic.Int64
+}
+
+func newTestRegistry(t *testing.T, useTLS bool) *testRegistry {
+	r := &testRegistry{}
+	handler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.requests.Add(1)
+		handler.ServeHTTP(w, req)
+	})
+	if useTLS {
+		r.server = httptest.NewTLSServer(h)
+	} else {
+		r.server = httptest.NewServer(h)
+	}
+	t.Cleanup(r.server.Close)
+	r.host = strings.TrimPrefix(strings.TrimPrefix(r.server.URL, "http://"), "https://")
+	return r
+}
+
+// push writes img to repo in the registry and returns its digest.
+func (r *testRegistry) push(t *testing.T, repo string, img v1.Image) v1.Hash {
+	ref, err := name.ParseReference(r.host + "/" + repo)
+	require.NoError(t, err)
+	opts := []remote.Option{}
+	if r.server.TLS != nil {
+		opts = append(opts, remote.WithTransport(r.server.Client().Transport))
+	}
+	require.NoError(t, remote.Write(ref, img, opts...))
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	r.requests.Store(0)
+	return digest
+}
+
+// writeConf writes a registries.conf and returns the configuration using it.
+func writeConf(t *testing.T, conf string) Config {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ConfFileName), []byte(conf), 0644))
+	c := FromDir(dir)
+	c.CertsDir = filepath.Join(dir, "certs.d")
+	return c
+}
+
+func sourceRefs(t *testing.T, c Config, ref string) []string {
+	parsed, err := name.ParseReference(ref)
+	require.NoError(t, err)
+	sources, err := c.Sources(parsed)
+	require.NoError(t, err)
+	var refs []string
+	for _, src := range sources {
+		refs = append(refs, src.Ref.String())
+	}
+	return refs
+}
+
+func TestSources_NoConfiguration(t *testing.T) {
+	c := FromDir(t.TempDir())
+	assert.Equal(t, []string{"quay.io/gkm/cache:v1"}, sourceRefs(t, c, "quay.io/gkm/cache:v1"))
+}
+
+func TestSources_MirrorsAndPullThroughCaches(t *testing.T) {
+	c := writeConf(t, `
+[[registry]]
+prefix = "quay.io/gkm"
+location = "quay.io/gkm"
+
+[[registry.mirror]]
+location = "cache.example.com/quay/gkm"
+
+[[registry.mirror]]
+location = "mirror.example.com:5000/gkm"
+insecure = true
+pull-from-mirror = "digest-only"
+
+[[registry]]
+location = "docker.io"
+
+[[registry.mirror]]
+location = "cache.example.com/docker"
+`)
+
+	assert.Equal(t, []string{
+		"cache.example.com/quay/gkm/cache:v1",
+		"quay.io/gkm/cache:v1",
+	}, sourceRefs(t, c, "quay.io/gkm/cache:v1"))
+
+	digest := "sha256:" + strings.Repeat("a", 64)
+	assert.Equal(t, []string{
+		"cache.example.com/quay/gkm/cache@" + digest,
+		"mirror.example.com:5000/gkm/cache@" + digest,
+		"quay.io/gkm/cache@" + digest,
+	}, sourceRefs(t, c, "quay.io/gkm/cache@"+digest))
+
+	assert.Equal(t, []string{
+		"cache.example.com/docker/library/busybox:latest",
+		"docker.io/library/busybox:latest",
+	}, sourceRefs(t, c, "busybox"))
+
+	// Other registries are pulled from directly.
+	assert.Equal(t, []string{"ghcr.io/gkm/cache:v1"}, sourceRefs(t, c, "ghcr.io/gkm/cache:v1"))
+	assert.Equal(t, []string{"quay.io/other/cache:v1"}, sourceRefs(t, c, "quay.io/other/cache:v1"))
+
+	ref, err := name.ParseReference("quay.io/gkm/cache@" + digest)
+	require.NoError(t, err)
+	sources, err := c.Sources(ref)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, true, false}, []bool{sources[0].Mirror, sources[1].Mirror, sources[2].Mirror})
+	assert.Equal(t, []bool{false, true, false}, []bool{sources[0].Insecure, sources[1].Insecure, sources[2].Insecure})
+	assert.Equal(t, "http", sources[1].Ref.Context().Scheme())
+}
+
+func TestSources_Blocked(t *testing.T) {
+	c := writeConf(t, `
+[[registry]]
+location = "blocked.example.com"
+blocked = true
+`)
+	ref, err := name.ParseReference("blocked.example.com/gkm/cache:v1")
+	require.NoError(t, err)
+	_, err = c.Sources(ref)
+	assert.ErrorContains(t, err, "blocked")
+}
+
+func TestDestination(t *testing.T) {
+	c := writeConf(t, `
+[[registry]]
+location = "quay.io"
+
+[[registry.mirror]]
+location = "cache.example.com/quay"
+
+[[registry]]
+location = "registry.local:5000"
+insecure = true
+
+[[registry]]
+location = "blocked.example.com"
+blocked = true
+`)
+	for ref, want := range map[string]Source{
+		"quay.io/gkm/cache:v1":             {},
+		"registry.local:5000/gkm/cache:v1": {Insecure: true},
+	} {
+		parsed, err := name.ParseReference(ref)
+		require.NoError(t, err)
+		dst, err := c.Destination(parsed)
+		require.NoError(t, err)
+		assert.Equal(t, ref, dst.Ref.String())
+		assert.Equal(t, want.Insecure, dst.Insecure, ref)
+		assert.False(t, dst.Mirror)
+	}
+
+	blocked, err := name.ParseReference("blocked.example.com/gkm/cache:v1")
+	require.NoError(t, err)
+	_, err = c.Destination(blocked)
+	assert.ErrorContains(t, err, "blocked")
+}
+
+func TestTry_PullsFromMirror(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	primary := newTestRegistry(t, false)
+	mirror := newTestRegistry(t, false)
+	digest := primary.push(t, "gkm/cache:v1", img)
+	mirror.push(t, "gkm/cache:v1", img)
+	c := writeConf(t, fmt.Sprintf(`
+[[registry]]
+location = %q
+
+[[registry.mirror]]
+location = %q
+insecure = true
+`, primary.host, mirror.host))
+
+	ref, err := name.ParseReference(primary.host + "/gkm/cache:v1")
+	require.NoError(t, err)
+	pulled, src, _, err := Try(c, ref, nil, remote.Image)
+	require.NoError(t, err)
+	assert.True(t, src.Mirror)
+	pulledDigest, err := pulled.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, digest, pulledDigest)
+	assert.Positive(t, mirror.requests.Load())
+	assert.Zero(t, primary.requests.Load())
+}
+
+func TestTry_FallsBackToRegistry(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	primary := newTestRegistry(t, false)
+	empty := newTestRegistry(t, false)
+	down := newTestRegistry(t, false)
+	down.server.Close()
+	digest := primary.push(t, "gkm/cache:v1", img)
+	c := writeConf(t, fmt.Sprintf(`
+[[registry]]
+location = %q
+
+[[registry.mirror]]
+location = %q
+
+[[registry.mirror]]
+location = %q
+`, primary.host, down.host, empty.host))
+
+	ref, err := name.ParseReference(primary.host + "/gkm/cache:v1")
+	require.NoError(t, err)
+	desc, src, _, err := Try(c, ref, nil, remote.Get)
+	require.NoError(t, err)
+	assert.False(t, src.Mirror)
+	assert.Equal(t, digest, desc.Digest)
+	assert.Positive(t, empty.requests.Load())
+	assert.Positive(t, primary.requests.Load())
+}
+
+func TestTry_CABundle(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	reg := newTestRegistry(t, true)
+	reg.push(t, "gkm/cache:v1", img)
+	ref, err := name.ParseReference(reg.host + "/gkm/cache:v1")
+	require.NoError(t, err)
+	bundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: reg.server.Certificate().Raw})
+
+	t.Run("untrusted", func(t *testing.T) {
+		c := FromDir(t.TempDir())
+		c.CertsDir = t.TempDir()
+		_, _, _, err := Try(c, ref, nil, remote.Get)
+		assert.Error(t, err)
+	})
+
+	t.Run("ca bundle", func(t *testing.T) {
+		c := FromDir(t.TempDir())
+		c.CertsDir = t.TempDir()
+		require.NoError(t, os.WriteFile(c.CABundle, bundle, 0644))
+		_, _, _, err := Try(c, ref, nil, remote.Get)
+		assert.NoError(t, err)
+	})
+
+	t.Run("certs.d", func(t *testing.T) {
+		c := FromDir(t.TempDir())
+		c.CertsDir = t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(c.CertsDir, reg.host), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(c.CertsDir, reg.host, "ca.crt"), bundle, 0644))
+		_, _, _, err := Try(c, ref, nil, remote.Get)
+		assert.NoError(t, err)
+	})
+
+	t.Run("insecure", func(t *testing.T) {
+		c := writeConf(t, fmt.Sprintf(`
+[[registry]]
+location = %q
+insecure = true
+`, reg.host))
+		_, src, _, err := Try(c, ref, nil, remote.Get)
+		require.NoError(t, err)
+		assert.True(t, src.Insecure)
+	})
+}
@@ -0,0 +1,139 @@
+// Package signing signs cache images and attaches signed attestations to them with Sigstore
+// Cosign, so the GKM operator can verify them before extracting.
+package signing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sigstore/cosign/v3/cmd/cosign/cli/attest"
+	"github.com/sigstore/cosign/v3/cmd/cosign/cli/generate"
+	"github.com/sigstore/cosign/v3/cmd/cosign/cli/options"
+	"github.com/sigstore/cosign/v3/cmd/cosign/cli/sign"
+	"github.com/sigstore/cosign/v3/pkg/cosign"
+	logging "github.com/sirupsen/logrus"
+)
+
+const (
+	// ManifestPredicateType is the predicate type of the attestation of the cache manifest, the
+	// io.triton.manifest/manifest.json of the image.
+	ManifestPredicateType = "https://github.com/redhat-et/GKM/attestation/cache-manifest/v1"
+	// SummaryPredicateType is the predicate type of the attestation of the cache summary, the
+	// cache.<type>.image/summary labels of the image by cache type.
+	SummaryPredicateType = "https://github.com/redhat-et/GKM/attestation/cache-summary/v1"
+)
+
+// Options configures Sign.
+type Options struct {
+	// KeyRef is the private key to sign with: a cosign key file, or a KMS URI. Keyless signing
+	// with a Fulcio certificate is used if it is empty.
+	KeyRef string
+	// PassFunc reads the password of KeyRef. Defaults to $COSIGN_PASSWORD, or a prompt.
+	PassFunc cosign.PassFunc
+	// IDToken is the OIDC identity token of keyless signing, or the path of a file holding it.
+	// If it is empty, the token is read from $SIGSTORE_ID_TOKEN or a provider of the
+	// environment (GitHub Actions, SPIFFE, ...), and then from an interactive OAuth flow.
+	IDToken string
+	// FulcioURL defaults to the public Sigstore instance.
+	FulcioURL string
+	// RekorURL defaults to the public Sigstore instance.
+	RekorURL string
+	// TlogUpload uploads the signatures to the Rekor transparency log. Keyless signatures are
+	// only verified by the GKM operator if they are in the log.
+	TlogUpload bool
+	// SkipConfirmation does not prompt before uploading to the transparency log.
+	SkipConfirmation bool
+	// Timeout of the signing and of each attestation. Defaults to 3 minutes.
+	Timeout time.Duration
+}
+
+// Attestation is a predicate attested for an image.
+type Attestation struct {
+	PredicateType string
+	Predicate     []byte
+}
+
+// Sign signs the image of digest and attaches the signed attestations to it, using
+// remoteOpts to write the signatures and attestations to its registry.
+func Sign(ctx context.Context, digest name.Digest, attestations []Attestation, opts Options, remoteOpts []remote.Option) error {
+	ko := opts.keyOpts()
+	regOpts := options.RegistryOptions{
+		AllowHTTPRegistry:  digest.Context().Scheme() == "http",
+		RegistryClientOpts: remoteOpts,
+	}
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = options.DefaultTimeout
+	}
+
+	logging.Infof("Signing %s", digest)
+	err := sign.SignCmd(ctx, &options.RootOptions{Timeout: timeout}, ko, options.SignOptions{
+		Upload:           true,
+		TlogUpload:       opts.TlogUpload,
+		SkipConfirmation: opts.SkipConfirmation,
+		Registry:         regOpts,
+	}, []string{digest.String()})
+	if err != nil {
+		return fmt.Errorf("failed to sign %s: %w", digest, err)
+	}
+
+	if len(attestations) == 0 {
+		return nil
+	}
+	predicateDir, err := os.MkdirTemp("", "mcv-attest-")
+	if err != nil {
+		return fmt.Errorf("failed to create predicate directory: %w", err)
+	}
+	defer os.RemoveAll(predicateDir)
+
+	for i, a := range attestations {
+		predicatePath := filepath.Join(predicateDir, fmt.Sprintf("predicate-%d.json", i))
+		if err := os.WriteFile(predicatePath, a.Predicate, 0600); err != nil {
+			return fmt.Errorf("failed to write predicate: %w", err)
+		}
+		logging.Infof("Attesting %s for %s", a.PredicateType, digest)
+		cmd := &attest.AttestCommand{
+			KeyOpts:         ko,
+			RegistryOptions: regOpts,
+			PredicatePath:   predicatePath,
+			PredicateType:   a.PredicateType,
+			Replace:         true,
+			Timeout:         timeout,
+			TlogUpload:      opts.TlogUpload,
+			RekorEntryType:  "dsse",
+		}
+		if err := cmd.Exec(ctx, digest.String()); err != nil {
+			return fmt.Errorf("failed to attest %s for %s: %w", a.PredicateType, digest, err)
+		}
+	}
+	return nil
+}
+
+// keyOpts returns the cosign key options of opts.
+func (o Options) keyOpts() options.KeyOpts {
+	ko := options.KeyOpts{
+		KeyRef:           o.KeyRef,
+		PassFunc:         o.PassFunc,
+		IDToken:          o.IDToken,
+		FulcioURL:        o.FulcioURL,
+		RekorURL:         o.RekorURL,
+		OIDCIssuer:       options.DefaultOIDCIssuerURL,
+		OIDCClientID:     "sigstore",
+		SkipConfirmation: o.SkipConfirmation,
+	}
+	if ko.PassFunc == nil {
+		ko.PassFunc = generate.GetPass
+	}
+	if ko.FulcioURL == "" {
+		ko.FulcioURL = options.DefaultFulcioURL
+	}
+	if ko.RekorURL == "" {
+		ko.RekorURL = options.DefaultRekorURL
+	}
+	return ko
+}
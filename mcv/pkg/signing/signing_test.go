@@ -0,0 +1,121 @@
+package signing
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sigstore/cosign/v3/pkg/cosign"
+	sigs "github.com/sigstore/cosign/v3/pkg/signature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testPassword = []byte("test-password")
+
+func testPass(bool) ([]byte, error) {
+	return testPassword, nil
+}
+
+// testKey writes a cosign key pair to a temporary directory, and returns the path of the
+// private key and the public key.
+func testKey(t *testing.T) (string, []byte) {
+	keys, err := cosign.GenerateKeyPair(testPass)
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "cosign.key")
+	require.NoError(t, os.WriteFile(keyPath, keys.PrivateBytes, 0600))
+	return keyPath, keys.PublicBytes
+}
+
+// testImage pushes a random image to an in-process registry and returns its digest.
+func testImage(t *testing.T) name.Digest {
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+	ref, err := name.ParseReference(strings.TrimPrefix(server.URL, "http://") + "/gkm/cache:v1")
+	require.NoError(t, err)
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	return ref.Context().Digest(digest.String())
+}
+
+// checkOpts verifies signatures of publicKey, without a transparency log.
+func checkOpts(t *testing.T, publicKey []byte) *cosign.CheckOpts {
+	verifier, err := sigs.LoadPublicKeyRaw(publicKey, crypto.SHA256)
+	require.NoError(t, err)
+	return &cosign.CheckOpts{SigVerifier: verifier, IgnoreTlog: true}
+}
+
+func TestSign_Key(t *testing.T) {
+	digest := testImage(t)
+	keyPath, publicKey := testKey(t)
+	attestations := []Attestation{
+		{PredicateType: ManifestPredicateType, Predicate: []byte(`{"triton":[]}`)},
+		{PredicateType: SummaryPredicateType, Predicate: []byte(`{"triton":{"targets":[]}}`)},
+	}
+	opts := Options{KeyRef: keyPath, PassFunc: testPass}
+	require.NoError(t, Sign(context.Background(), digest, attestations, opts, nil))
+
+	ctx := context.Background()
+	signatures, _, err := cosign.VerifyImageSignatures(ctx, digest, checkOpts(t, publicKey))
+	require.NoError(t, err)
+	assert.Len(t, signatures, 1)
+
+	verified, _, err := cosign.VerifyImageAttestations(ctx, digest, checkOpts(t, publicKey))
+	require.NoError(t, err)
+	predicates := make(map[string]string)
+	for _, att := range verified {
+		payload, err := att.Payload()
+		require.NoError(t, err)
+		var envelope struct {
+			Payload string `json:"payload"`
+		}
+		require.NoError(t, json.Unmarshal(payload, &envelope))
+		statement, err := base64.StdEncoding.DecodeString(envelope.Payload)
+		require.NoError(t, err)
+		var parsed struct {
+			PredicateType string          `json:"predicateType"`
+			Subject       []any           `json:"subject"`
+			Predicate     json.RawMessage `json:"predicate"`
+		}
+		require.NoError(t, json.Unmarshal(statement, &parsed))
+		assert.Len(t, parsed.Subject, 1)
+		predicates[parsed.PredicateType] = string(parsed.Predicate)
+	}
+	assert.Equal(t, map[string]string{
+		ManifestPredicateType: `{"triton":[]}`,
+		SummaryPredicateType:  `{"triton":{"targets":[]}}`,
+	}, predicates)
+
+	// Signing again replaces the attestations of the same predicate types.
+	require.NoError(t, Sign(context.Background(), digest, attestations, opts, nil))
+	verified, _, err = cosign.VerifyImageAttestations(ctx, digest, checkOpts(t, publicKey))
+	require.NoError(t, err)
+	assert.Len(t, verified, 2)
+
+	// The signatures do not verify with another key.
+	_, otherKey := testKey(t)
+	_, _, err = cosign.VerifyImageSignatures(ctx, digest, checkOpts(t, otherKey))
+	assert.Error(t, err)
+}
+
+func TestSign_WrongPassword(t *testing.T) {
+	digest := testImage(t)
+	keyPath, _ := testKey(t)
+	opts := Options{KeyRef: keyPath, PassFunc: func(bool) ([]byte, error) { return []byte("wrong"), nil }}
+	assert.Error(t, Sign(context.Background(), digest, nil, opts, nil))
+}
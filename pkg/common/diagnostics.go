@@ -0,0 +1,100 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	gkmv1alpha1 "github.com/redhat-et/GKM/api/v1alpha1"
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+// FailureSummary returns the first line of a failure message, which is the error, without the
+// Pod details and log tail that follow it, trimmed to maxLength bytes. It is only cut between
+// runes, so a trimmed summary is still valid UTF-8, which the API server requires.
+func FailureSummary(message string, maxLength int) string {
+	summary, _, _ := strings.Cut(message, "\n")
+	if len(summary) > maxLength {
+		cut := max(maxLength-len("..."), 0)
+		for cut > 0 && !utf8.RuneStart(summary[cut]) {
+			cut--
+		}
+		summary = summary[:cut] + "..."
+	}
+	return summary
+}
+
+// GetNodeFailures returns a NodeFailure for each PVC Status of the Cache Status of a Node that
+// is in the Error or UnloadError state.
+func GetNodeFailures(nodeName string, cacheStatus *gkmv1alpha1.CacheStatus) []gkmv1alpha1.NodeFailure {
+	var failures []gkmv1alpha1.NodeFailure
+	for namespace, pvcStatus := range cacheStatus.PvcStatus {
+		condition := gkmv1alpha1.GetLatestConditionType(pvcStatus.Conditions)
+		if condition.Type != string(gkmv1alpha1.GkmCondError) &&
+			condition.Type != string(gkmv1alpha1.GkmCondUnloadError) {
+			continue
+		}
+		failures = append(failures, gkmv1alpha1.NodeFailure{
+			NodeName:           nodeName,
+			Namespace:          namespace,
+			Reason:             condition.Reason,
+			Message:            FailureSummary(condition.Message, utils.NodeFailureMaxMessage),
+			RetryCount:         pvcStatus.RetryCount,
+			LastTransitionTime: condition.LastTransitionTime,
+		})
+	}
+	return failures
+}
+
+// SummarizeNodeFailures counts the failures by reason and returns the top failures to report
+// in the GKMCache or ClusterGKMCache Status: most retried first, then most recent first, up to
+// utils.NodeFailureMaxCount.
+func SummarizeNodeFailures(failures []gkmv1alpha1.NodeFailure) (map[string]int, []gkmv1alpha1.NodeFailure) {
+	if len(failures) == 0 {
+		return nil, nil
+	}
+
+	reasons := make(map[string]int)
+	for _, failure := range failures {
+		reasons[failure.Reason]++
+	}
+
+	sort.SliceStable(failures, func(i, j int) bool {
+		if failures[i].RetryCount != failures[j].RetryCount {
+			return failures[i].RetryCount > failures[j].RetryCount
+		}
+		if !failures[i].LastTransitionTime.Equal(&failures[j].LastTransitionTime) {
+			return failures[j].LastTransitionTime.Before(&failures[i].LastTransitionTime)
+		}
+		if failures[i].NodeName != failures[j].NodeName {
+			return failures[i].NodeName < failures[j].NodeName
+		}
+		return failures[i].Namespace < failures[j].Namespace
+	})
+	if len(failures) > utils.NodeFailureMaxCount {
+		failures = failures[:utils.NodeFailureMaxCount]
+	}
+	return reasons, failures
+}
+
+// NodeFailuresMessage returns the message for the Error condition of a GKMCache or
+// ClusterGKMCache, naming the Nodes that failed and why. For example:
+// "Extraction failed on 3 Nodes: node-a (NetworkError), node-b (AuthFailed), ..."
+func NodeFailuresMessage(errorCnt int, failures []gkmv1alpha1.NodeFailure) string {
+	nodes := make([]string, 0, len(failures))
+	for _, failure := range failures {
+		nodes = append(nodes, fmt.Sprintf("%s (%s)", failure.NodeName, failure.Reason))
+	}
+	message := fmt.Sprintf("Extraction failed on %d Node", errorCnt)
+	if errorCnt != 1 {
+		message += "s"
+	}
+	if len(nodes) != 0 {
+		message = fmt.Sprintf("%s: %s", message, strings.Join(nodes, ", "))
+		if errorCnt > len(nodes) {
+			message += ", ..."
+		}
+	}
+	return message
+}
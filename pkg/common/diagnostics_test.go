@@ -0,0 +1,99 @@
+package common
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	gkmv1alpha1 "github.com/redhat-et/GKM/api/v1alpha1"
+	"github.com/redhat-et/GKM/pkg/extract"
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+func TestNodeFailures(t *testing.T) {
+	t.Run("Test failures of a Cache Status on a Node", func(t *testing.T) {
+		cacheStatus := &gkmv1alpha1.CacheStatus{PvcStatus: map[string]gkmv1alpha1.PvcStatus{}}
+
+		failed := gkmv1alpha1.PvcStatus{RetryCount: 2}
+		SetExtractFailure(&failed, extract.FailureAuth,
+			"AuthFailed: "+strings.Repeat("x", 1000)+"\nPod extract-job-abcde-12345 terminated: Error (exit code 10)")
+		cacheStatus.PvcStatus["ns1"] = failed
+
+		extracted := gkmv1alpha1.PvcStatus{}
+		gkmv1alpha1.SetPvcStatusConditions(&extracted, gkmv1alpha1.GkmCondExtracted.Condition())
+		cacheStatus.PvcStatus["ns2"] = extracted
+
+		t.Logf("TEST: GetNodeFailures() - Should only return the PVC Status in Error")
+		failures := GetNodeFailures("node-a", cacheStatus)
+		require.Len(t, failures, 1)
+		require.Equal(t, "node-a", failures[0].NodeName)
+		require.Equal(t, "ns1", failures[0].Namespace)
+		require.Equal(t, string(extract.FailureAuth), failures[0].Reason)
+		require.Equal(t, int32(2), failures[0].RetryCount)
+		require.Len(t, failures[0].Message, utils.NodeFailureMaxMessage)
+		require.NotContains(t, failures[0].Message, "\n")
+	})
+
+	t.Run("Test summary of a failure message with multi-byte characters", func(t *testing.T) {
+		message := "AuthFailed: " + strings.Repeat("é", 10)
+
+		// "é" is 2 bytes, so a cut at byte 9 falls in the middle of the fifth "é".
+		t.Logf("TEST: FailureSummary() cutting in a rune - Should cut before the rune")
+		summary := FailureSummary(strings.Repeat("é", 10), 12)
+		require.True(t, utf8.ValidString(summary))
+		require.Equal(t, "éééé...", summary)
+
+		t.Logf("TEST: FailureSummary() of a message with multi-byte characters - Should be valid UTF-8")
+		for maxLength := 0; maxLength <= len(message); maxLength++ {
+			summary := FailureSummary(message, maxLength)
+			require.True(t, utf8.ValidString(summary), "maxLength %d", maxLength)
+			require.LessOrEqual(t, len(summary), max(maxLength, len("...")))
+		}
+	})
+
+	t.Run("Test summary of failures across Nodes", func(t *testing.T) {
+		now := time.Now()
+		failure := func(nodeName, reason string, retryCount int32, age time.Duration) gkmv1alpha1.NodeFailure {
+			return gkmv1alpha1.NodeFailure{
+				NodeName:           nodeName,
+				Reason:             reason,
+				RetryCount:         retryCount,
+				LastTransitionTime: metav1.NewTime(now.Add(-age)),
+			}
+		}
+
+		t.Logf("TEST: SummarizeNodeFailures() without failures - Should return nil")
+		reasons, top := SummarizeNodeFailures(nil)
+		require.Nil(t, reasons)
+		require.Nil(t, top)
+
+		t.Logf("TEST: SummarizeNodeFailures() - Should count reasons and order by retries, then most recent")
+		failures := []gkmv1alpha1.NodeFailure{
+			failure("node-a", "NetworkError", 1, time.Minute),
+			failure("node-b", "AuthFailed", 0, time.Second),
+			failure("node-c", "NetworkError", 3, time.Hour),
+			failure("node-d", "NetworkError", 1, time.Second),
+			failure("node-e", "AuthFailed", 0, time.Hour),
+			failure("node-f", "DiskFull", 0, time.Minute),
+		}
+		reasons, top = SummarizeNodeFailures(failures)
+		require.Equal(t, map[string]int{"NetworkError": 3, "AuthFailed": 2, "DiskFull": 1}, reasons)
+		require.Len(t, top, utils.NodeFailureMaxCount)
+		nodes := []string{}
+		for _, f := range top {
+			nodes = append(nodes, f.NodeName)
+		}
+		require.Equal(t, []string{"node-c", "node-d", "node-a", "node-b", "node-f"}, nodes)
+
+		t.Logf("TEST: NodeFailuresMessage() - Should name the Nodes and reasons")
+		require.Equal(t,
+			"Extraction failed on 6 Nodes: node-c (NetworkError), node-d (NetworkError), "+
+				"node-a (NetworkError), node-b (AuthFailed), node-f (DiskFull), ...",
+			NodeFailuresMessage(6, top))
+		require.Equal(t, "Extraction failed on 1 Node: node-c (NetworkError)", NodeFailuresMessage(1, top[:1]))
+	})
+}
@@ -3,6 +3,9 @@ package common
 import (
 	"context"
 	"fmt"
+	"os"
+	"path"
+	"path/filepath"
 	"strings"
 
 	"github.com/go-logr/logr"
@@ -14,6 +17,7 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -22,11 +26,12 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	gkmv1alpha1 "github.com/redhat-et/GKM/api/v1alpha1"
+	"github.com/redhat-et/GKM/mcv/pkg/registries"
 	"github.com/redhat-et/GKM/pkg/utils"
 )
 
 // Common Predicate function for both GKMCache, GKMCacheNode, GKMCacheNode and ClusterCacheNode. Only reconcile
-// if a pod event if it is mounting a PVC and is change phase (state)
+// if a pod event if it is mounting a PVC or an Image Volume and is change phase (state)
 func PodPredicate(nodeName string) predicate.Funcs {
 	return predicate.Funcs{
 		CreateFunc: func(e event.CreateEvent) bool {
@@ -40,8 +45,8 @@ func PodPredicate(nodeName string) predicate.Funcs {
 			oldPod := e.ObjectOld.(*corev1.Pod)
 			newPod := e.ObjectNew.(*corev1.Pod)
 
-			oldUsing := hasPVC(oldPod) && isActive(oldPod)
-			newUsing := hasPVC(newPod) && isActive(newPod)
+			oldUsing := hasCacheVolume(oldPod) && isActive(oldPod)
+			newUsing := hasCacheVolume(newPod) && isActive(newPod)
 
 			if nodeName != "" && newPod.Spec.NodeName != nodeName {
 				logger.V(1).Info("Update: NodeName Skip",
@@ -79,11 +84,17 @@ func PodPredicate(nodeName string) predicate.Funcs {
 				nodeMatch = true
 			}
 
-			return nodeMatch && hasPVC(pod)
+			return nodeMatch && hasCacheVolume(pod)
 		},
 	}
 }
 
+// hasCacheVolume returns true if the pod mounts a volume that may be a GPU Kernel Cache,
+// either a PVC or an Image Volume.
+func hasCacheVolume(pod *corev1.Pod) bool {
+	return hasPVC(pod) || hasImageVolume(pod)
+}
+
 func hasPVC(pod *corev1.Pod) bool {
 	for _, vol := range pod.Spec.Volumes {
 		if vol.PersistentVolumeClaim != nil {
@@ -93,6 +104,15 @@ func hasPVC(pod *corev1.Pod) bool {
 	return false
 }
 
+func hasImageVolume(pod *corev1.Pod) bool {
+	for _, vol := range pod.Spec.Volumes {
+		if vol.Image != nil {
+			return true
+		}
+	}
+	return false
+}
+
 func isActive(pod *corev1.Pod) bool {
 	// Even though Pending could be considered Active, the Pod is created in Pending
 	// phase, so was not getting a transition. So mark Pending as inactive then when
@@ -201,7 +221,8 @@ func ManagePvcStatusDelete(
 	return updated, updateReason, pvcInUse, pvcDeleting, err
 }
 
-// CreatePv calls KubeAPI Server to create a PersistentVolume
+// CreatePv calls KubeAPI Server to create a PersistentVolume. The PV is a hostPath PV on the
+// directory of resolvedDigest in the host cache directory, of type hostPathType.
 func CreatePv(
 	ctx context.Context,
 	client client.Client,
@@ -216,6 +237,7 @@ func CreatePv(
 	storageClass string,
 	capacity string,
 	resolvedDigest string,
+	hostPathType corev1.HostPathType,
 	log logr.Logger,
 ) error {
 	trimDigest := strings.TrimPrefix(resolvedDigest, utils.DigestPrefix)
@@ -240,8 +262,9 @@ func CreatePv(
 			VolumeMode:                    ptr.To(corev1.PersistentVolumeFilesystem),
 			PersistentVolumeSource: corev1.PersistentVolumeSource{
 				HostPath: &corev1.HostPathVolumeSource{
-					Path: "/kernel-caches",
-					Type: ptr.To(corev1.HostPathDirectoryOrCreate),
+					// Each digest has its own directory so caches can be evicted one at a time.
+					Path: path.Join(utils.HostCacheDir, utils.CacheDirName(resolvedDigest)),
+					Type: ptr.To(hostPathType),
 				},
 			},
 		},
@@ -525,7 +548,8 @@ func DeletePv(
 	return updated, updateReason, nil
 }
 
-// CreatePvc calls KubeAPI Server to create a PersistentVolumeClaim
+// CreatePvc calls KubeAPI Server to create a PersistentVolumeClaim. If snapshotName is
+// provided, the PVC is populated from that VolumeSnapshot.
 func CreatePvc(
 	ctx context.Context,
 	client client.Client,
@@ -541,6 +565,7 @@ func CreatePvc(
 	storageClass string,
 	capacity string,
 	resolvedDigest string,
+	snapshotName string,
 	log logr.Logger,
 ) error {
 	trimDigest := strings.TrimPrefix(resolvedDigest, utils.DigestPrefix)
@@ -577,6 +602,11 @@ func CreatePvc(
 		pvc.Spec.VolumeName = pvName
 	}
 
+	// If populating from a VolumeSnapshot, the contents already exist so no Job is needed.
+	if snapshotName != "" {
+		pvc.Spec.DataSource = SnapshotDataSource(snapshotName)
+	}
+
 	// StorageClass must match PV, or PVC won't bind.
 	// Empty string prevents Kubernetes from auto-filling default StorageClass.
 	if storageClass != "" {
@@ -776,6 +806,57 @@ func GetPvcUsedByList(
 	return podUseCnt
 }
 
+// GetImageVolumeUsedByList walks the Pods in the Namespace and tries to determine which
+// Pods are using the given digest as an Image Volume.
+func GetImageVolumeUsedByList(
+	ctx context.Context,
+	objClient client.Client,
+	nodeName string,
+	podNamespace string,
+	resolvedDigest string,
+	log logr.Logger,
+) int {
+	podUseCnt := 0
+
+	if resolvedDigest != "" {
+		// List all Pods in the same namespace
+		var podList corev1.PodList
+		filters := []client.ListOption{client.InNamespace(podNamespace)}
+		if nodeName != "" {
+			filters = append(filters, client.MatchingFields{"spec.nodeName": nodeName})
+		}
+		if err := objClient.List(ctx, &podList,
+			filters...,
+		); err != nil {
+			log.Info("Unable to retrieve Pod List to check Image Volume usage",
+				"Pod Namespace", podNamespace,
+				"Digest", resolvedDigest,
+				"err", err,
+			)
+			return podUseCnt
+		}
+		for _, pod := range podList.Items {
+			for _, vol := range pod.Spec.Volumes {
+				if pod.Status.Phase != corev1.PodSucceeded &&
+					pod.Status.Phase != corev1.PodFailed {
+					if vol.Image != nil &&
+						strings.HasSuffix(vol.Image.Reference, "@"+resolvedDigest) {
+						log.V(1).Info("Image Volume used by Pod",
+							"Pod Namespace", podNamespace,
+							"Digest", resolvedDigest,
+							"Pod", pod.Name,
+							"nodeName", nodeName,
+						)
+						podUseCnt++
+					}
+				}
+			}
+		}
+	}
+
+	return podUseCnt
+}
+
 // DeletePvc tries to delete a PVC.
 func DeletePvc(
 	ctx context.Context,
@@ -926,7 +1007,14 @@ func DeletePvc(
 }
 
 // LaunchJob launches a Kubernetes Job that is responsible for extracting the GPU Kernel
-// Cache into a PVC.
+// Cache into a PVC. If verifyOnly is set, the PVC is mounted read-only and the Job only
+// verifies that the previously extracted GPU Kernel Cache can be read. The layers of the
+// image are fetched from the layer servers in layerPeers first, if any and registryAuthSecret
+// is not set. The Job pulls the image
+// with the registries configuration of the cluster, passed in its environment since it may not
+// run in the GKM Namespace. If registryAuthSecret is set, the Job is given the registry
+// credentials in that Secret of jobNamespace, the copy of the image pull Secrets of the Cache
+// made by the Operator.
 func LaunchJob(
 	ctx context.Context,
 	client client.Client,
@@ -940,12 +1028,15 @@ func LaunchJob(
 	noGpu bool,
 	kindCluster bool,
 	extractImage string,
+	verifyOnly bool,
+	layerPeers []string,
+	registryAuthSecret string,
 	pvcStatus *gkmv1alpha1.PvcStatus,
 	podTemplate *gkmv1alpha1.PodTemplate,
 	log logr.Logger,
 	jobLogLevel string,
 ) error {
-	log.Info("Creating download job", "jobName", jobName, "pvcName", pvcStatus.PvcName)
+	log.Info("Creating download job", "jobName", jobName, "pvcName", pvcStatus.PvcName, "verifyOnly", verifyOnly)
 
 	var jobTTLSecondsAfterFinished int32 = utils.JobTTLSeconds
 	var fsGroup int64 = utils.JobFSGroup
@@ -994,12 +1085,21 @@ func LaunchJob(
 		{Name: utils.JobExtractEnvNoGpu, Value: noGpuString},
 		{Name: utils.JobExtractEnvGoLog, Value: jobLogLevel},
 	}
+	if verifyOnly {
+		container.Env = append(container.Env, corev1.EnvVar{Name: utils.JobExtractEnvVerifyOnly, Value: "true"})
+	}
+	// Layer peers serve layers to anyone, so they never hold the layers of images pulled with
+	// registry credentials.
+	if len(layerPeers) != 0 && registryAuthSecret == "" {
+		container.Env = append(container.Env, corev1.EnvVar{Name: utils.JobExtractEnvLayerPeers, Value: strings.Join(layerPeers, ",")})
+	}
+	container.Env = append(container.Env, registriesEnv(utils.RegistriesConfigDir, log)...)
 
 	container.VolumeMounts = []corev1.VolumeMount{
 		{
 			MountPath: utils.MountPath,
 			Name:      utils.JobExtractPvcSourceMountName,
-			ReadOnly:  false,
+			ReadOnly:  verifyOnly,
 		},
 	}
 
@@ -1015,6 +1115,9 @@ func LaunchJob(
 		},
 		Spec: batchv1.JobSpec{
 			TTLSecondsAfterFinished: &jobTTLSecondsAfterFinished,
+			// The Agent retries failed extractions based on the failure class reported
+			// by gkm-extract, so the Job itself does not retry.
+			BackoffLimit: ptr.To(int32(0)),
 			Template: corev1.PodTemplateSpec{
 				Spec: corev1.PodSpec{
 					Containers:    []corev1.Container{*container},
@@ -1025,6 +1128,7 @@ func LaunchJob(
 							VolumeSource: corev1.VolumeSource{
 								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
 									ClaimName: pvcStatus.PvcName,
+									ReadOnly:  verifyOnly,
 								},
 							},
 						},
@@ -1087,8 +1191,8 @@ func LaunchJob(
 
 	// For KIND Clusters, currently identified by kindCluster, Kubelet can't change the ownership
 	// of the directory of a Volume Mount. So an InitContainer is added to the job the manage
-	// the ownership.
-	if kindCluster {
+	// the ownership. Not needed when verifying, the volume is mounted read-only.
+	if kindCluster && !verifyOnly {
 		var rootUser int64 = 0
 
 		commandString :=
@@ -1123,6 +1227,10 @@ func LaunchJob(
 		return err
 	}
 
+	if registryAuthSecret != "" {
+		addRegistryAuthVolume(&job.Spec.Template.Spec, registryAuthSecret)
+	}
+
 	if err := client.Create(ctx, job); err != nil {
 		log.Error(err, "Failed to create job.",
 			"Job namespace", jobNamespace,
@@ -1132,11 +1240,40 @@ func LaunchJob(
 	}
 	log.Info("Created job",
 		"Job namespace", jobNamespace,
-		"Job name", jobName,
+		"Job name", job.Name,
 	)
+
 	return nil
 }
 
+// addRegistryAuthVolume mounts the registry credentials Secret secretName in the extract
+// container of podSpec, and points gkm-extract at it.
+func addRegistryAuthVolume(podSpec *corev1.PodSpec, secretName string) {
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: utils.JobExtractAuthMountName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName:  secretName,
+				DefaultMode: ptr.To(int32(0440)),
+			},
+		},
+	})
+	for i := range podSpec.Containers {
+		if podSpec.Containers[i].Name != utils.JobExtractName {
+			continue
+		}
+		podSpec.Containers[i].VolumeMounts = append(podSpec.Containers[i].VolumeMounts, corev1.VolumeMount{
+			Name:      utils.JobExtractAuthMountName,
+			MountPath: utils.JobExtractAuthMountPath,
+			ReadOnly:  true,
+		})
+		podSpec.Containers[i].Env = append(podSpec.Containers[i].Env, corev1.EnvVar{
+			Name:  utils.JobExtractEnvRegistryAuthFile,
+			Value: filepath.Join(utils.JobExtractAuthMountPath, utils.JobExtractAuthFileName),
+		})
+	}
+}
+
 // GetLatestJob calls KubeAPI Server to retrieve the list of Jobs that match the labels for a
 // given Cache and Digest.
 func GetLatestJob(
@@ -1183,6 +1320,121 @@ func GetLatestJob(
 	return latestJob, err
 }
 
+// JobTermination describes how the Pod of a completed Job ended.
+type JobTermination struct {
+	PodName string
+
+	// ExitCode, Reason and Message are from the extract container, if it terminated.
+	Terminated bool
+	ExitCode   int32
+	Reason     string
+	Message    string
+
+	// PodReason and PodMessage are set when the Pod itself failed, for example when it was
+	// evicted from the Node.
+	PodReason  string
+	PodMessage string
+}
+
+// Summary returns a one line description of how the Pod ended, for example
+// "Pod extract-job-abcde-12345 terminated: OOMKilled (exit code 137)".
+func (t *JobTermination) Summary() string {
+	summary := fmt.Sprintf("Pod %s", t.PodName)
+	if t.PodReason != "" {
+		summary = fmt.Sprintf("%s failed: %s", summary, t.PodReason)
+		if t.PodMessage != "" {
+			summary = fmt.Sprintf("%s: %s", summary, t.PodMessage)
+		}
+	}
+	if t.Terminated {
+		reason := t.Reason
+		if reason == "" {
+			reason = "Completed"
+		}
+		summary = fmt.Sprintf("%s terminated: %s (exit code %d)", summary, reason, t.ExitCode)
+	}
+	return summary
+}
+
+// GetJobTermination calls KubeAPI Server to retrieve the Pods of a completed Job and returns
+// how the most recent one ended. Returns nil if no Pod of the Job has terminated, for example
+// if the Pod was already removed.
+func GetJobTermination(
+	ctx context.Context,
+	objClient client.Client,
+	job *batchv1.Job,
+	log logr.Logger,
+) (*JobTermination, error) {
+	podList := &corev1.PodList{}
+	if err := objClient.List(
+		ctx,
+		podList,
+		client.InNamespace(job.Namespace),
+		client.MatchingLabels{batchv1.JobNameLabel: job.Name},
+	); err != nil {
+		return nil, err
+	}
+
+	// Job does not retry, but if multiple Pods exist, use the most recent one.
+	var latest *JobTermination
+	var latestTime metav1.Time
+	for _, pod := range podList.Items {
+		termination := &JobTermination{
+			PodName:    pod.Name,
+			PodReason:  pod.Status.Reason,
+			PodMessage: strings.TrimSpace(pod.Status.Message),
+		}
+		finishedAt := pod.CreationTimestamp
+		for _, containerStatus := range pod.Status.ContainerStatuses {
+			if containerStatus.Name != utils.JobExtractName || containerStatus.State.Terminated == nil {
+				continue
+			}
+			terminated := containerStatus.State.Terminated
+			termination.Terminated = true
+			termination.ExitCode = terminated.ExitCode
+			termination.Reason = terminated.Reason
+			termination.Message = strings.TrimSpace(terminated.Message)
+			finishedAt = terminated.FinishedAt
+		}
+		if !termination.Terminated && termination.PodReason == "" {
+			continue
+		}
+		if latest == nil || finishedAt.After(latestTime.Time) {
+			latest = termination
+			latestTime = finishedAt
+		}
+	}
+	if latest == nil {
+		log.Info("No terminated Pod found for Job", "Job Namespace", job.Namespace, "Job Name", job.Name)
+	}
+	return latest, nil
+}
+
+// GetJobLogTail calls KubeAPI Server to retrieve the last lines of the extract container log
+// of a Job Pod, so the reason for a failure is kept after the Job is removed. Returns "" if the
+// log is not available.
+func GetJobLogTail(
+	ctx context.Context,
+	kubeClient kubernetes.Interface,
+	podNamespace string,
+	podName string,
+	log logr.Logger,
+) string {
+	if kubeClient == nil || podName == "" {
+		return ""
+	}
+	data, err := kubeClient.CoreV1().Pods(podNamespace).GetLogs(podName, &corev1.PodLogOptions{
+		Container:  utils.JobExtractName,
+		TailLines:  ptr.To(int64(utils.JobLogTailLines)),
+		LimitBytes: ptr.To(int64(utils.JobLogTailMaxBytes)),
+	}).DoRaw(ctx)
+	if err != nil {
+		log.Info("Unable to get Job Pod log", "Pod Namespace", podNamespace, "Pod Name", podName, "err", err)
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
 // DeleteJob launches a Kubernetes Job that is responsible for extracting the GPU Kernel
 // Cache into a PVC.
 func DeleteJob(
@@ -1304,3 +1556,23 @@ func DeleteJob(
 
 	return updated, updateReason, nil
 }
+
+// registriesEnv returns the environment passing the registries configuration in dir to an
+// extract Job. Files missing from dir are not passed.
+func registriesEnv(dir string, log logr.Logger) []corev1.EnvVar {
+	var env []corev1.EnvVar
+	for _, file := range []struct{ name, envName string }{
+		{registries.ConfFileName, utils.JobExtractEnvRegistriesConf},
+		{registries.CABundleFileName, utils.JobExtractEnvRegistryCABundle},
+	} {
+		content, err := os.ReadFile(filepath.Join(dir, file.name))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Error(err, "unable to read registries configuration", "file", file.name)
+			}
+			continue
+		}
+		env = append(env, corev1.EnvVar{Name: file.envName, Value: string(content)})
+	}
+	return env
+}
@@ -0,0 +1,100 @@
+package common
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	gkmv1alpha1 "github.com/redhat-et/GKM/api/v1alpha1"
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+func TestLaunchJob(t *testing.T) {
+	// Setup logging before anything else so code can log errors.
+	logf.SetLogger(zap.New(zap.UseDevMode(true), zap.WriteTo(os.Stderr)))
+	log := logf.Log.WithName("launchjob-test")
+	ctx := context.Background()
+
+	owner := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns", UID: "owner-uid"},
+	}
+	digest := "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	launch := func(objClient client.Client, registryAuthSecret string) error {
+		return LaunchJob(ctx, objClient, clientgoscheme.Scheme, owner, "ns", "pvc-a-job-download-", "node-a",
+			"quay.io/gkm/cache:v1", digest, true, false, utils.JobExtractImage, false, []string{"http://10.0.0.2:8095"}, registryAuthSecret,
+			&gkmv1alpha1.PvcStatus{PvcName: "pvc-a"}, nil, log, "info")
+	}
+	extractContainer := func(job *batchv1.Job) corev1.Container {
+		for _, container := range job.Spec.Template.Spec.Containers {
+			if container.Name == utils.JobExtractName {
+				return container
+			}
+		}
+		t.Fatalf("job %s has no extract container", job.Name)
+		return corev1.Container{}
+	}
+
+	t.Run("Test Job without registry credentials", func(t *testing.T) {
+		objClient := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()
+
+		t.Logf("TEST: LaunchJob() without registryAuthSecret - Should not mount a Secret")
+		require.NoError(t, launch(objClient, ""))
+		jobs := &batchv1.JobList{}
+		require.NoError(t, objClient.List(ctx, jobs, client.InNamespace("ns")))
+		require.Len(t, jobs.Items, 1)
+		for _, env := range extractContainer(&jobs.Items[0]).Env {
+			require.NotEqual(t, utils.JobExtractEnvRegistryAuthFile, env.Name)
+		}
+		require.Contains(t, extractContainer(&jobs.Items[0]).Env,
+			corev1.EnvVar{Name: utils.JobExtractEnvLayerPeers, Value: "http://10.0.0.2:8095"})
+		for _, volume := range jobs.Items[0].Spec.Template.Spec.Volumes {
+			require.NotEqual(t, utils.JobExtractAuthMountName, volume.Name)
+		}
+	})
+
+	t.Run("Test Job with registry credentials", func(t *testing.T) {
+		objClient := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()
+		registryAuthSecret := utils.RegistryAuthSecretName("cache-uid")
+
+		t.Logf("TEST: LaunchJob() with registryAuthSecret - Should mount the Secret")
+		require.NoError(t, launch(objClient, registryAuthSecret))
+		jobs := &batchv1.JobList{}
+		require.NoError(t, objClient.List(ctx, jobs, client.InNamespace("ns")))
+		require.Len(t, jobs.Items, 1)
+		job := &jobs.Items[0]
+
+		var secretName string
+		for _, volume := range job.Spec.Template.Spec.Volumes {
+			if volume.Name == utils.JobExtractAuthMountName {
+				require.NotNil(t, volume.Secret)
+				secretName = volume.Secret.SecretName
+			}
+		}
+		require.Equal(t, registryAuthSecret, secretName)
+		container := extractContainer(job)
+		require.Contains(t, container.Env, corev1.EnvVar{
+			Name:  utils.JobExtractEnvRegistryAuthFile,
+			Value: utils.JobExtractAuthMountPath + "/" + utils.JobExtractAuthFileName,
+		})
+		require.Contains(t, container.VolumeMounts, corev1.VolumeMount{
+			Name:      utils.JobExtractAuthMountName,
+			MountPath: utils.JobExtractAuthMountPath,
+			ReadOnly:  true,
+		})
+
+		t.Logf("TEST: LaunchJob() with registryAuthSecret - Should not fetch layers from layer peers")
+		for _, env := range container.Env {
+			require.NotEqual(t, utils.JobExtractEnvLayerPeers, env.Name)
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+// The cluster wide limit on simultaneous registry pulls is implemented with a fixed pool of
+// Lease objects, one per slot. An Agent holds a slot for the duration of an extraction by
+// setting itself as the holder of a free Lease and renewing it. A Lease is free if it has no
+// holder or the holder has stopped renewing it, for example because the Agent was restarted.
+
+// PullLeaseName returns the name of the Lease for the given registry pull slot.
+func PullLeaseName(slot int) string {
+	return fmt.Sprintf("%s-%d", utils.PullLeasePrefix, slot)
+}
+
+// AcquirePullLease calls KubeAPI Server to hold one of the maxPulls registry pull slots for
+// holder. If holder already holds a slot, the Lease is renewed. Returns false if all the
+// slots are held.
+func AcquirePullLease(
+	ctx context.Context,
+	objClient client.Client,
+	leaseNamespace string,
+	maxPulls int,
+	holder string,
+	log logr.Logger,
+) (bool, error) {
+	now := metav1.NewMicroTime(time.Now())
+	leases := make([]*coordinationv1.Lease, maxPulls)
+
+	// First pass, renew the slot if already held and remember the rest.
+	for slot := 0; slot < maxPulls; slot++ {
+		lease := &coordinationv1.Lease{}
+		err := objClient.Get(ctx, types.NamespacedName{Namespace: leaseNamespace, Name: PullLeaseName(slot)}, lease)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return false, err
+		}
+		leases[slot] = lease
+
+		if ptr.Deref(lease.Spec.HolderIdentity, "") == holder {
+			// Only write the renewal once a third of the duration has passed.
+			if lease.Spec.RenewTime != nil &&
+				now.Sub(lease.Spec.RenewTime.Time) < utils.PullLeaseDuration/3 {
+				return true, nil
+			}
+			lease.Spec.RenewTime = &now
+			if err := objClient.Update(ctx, lease); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+	}
+
+	// Second pass, take the first free slot. A Conflict or AlreadyExists means another Agent
+	// took the slot first, so move on to the next one.
+	for slot := 0; slot < maxPulls; slot++ {
+		lease := leases[slot]
+		if lease == nil {
+			lease = &coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      PullLeaseName(slot),
+					Namespace: leaseNamespace,
+				},
+			}
+			setPullLeaseHolder(lease, holder, now)
+			if err := objClient.Create(ctx, lease); err != nil {
+				if apierrors.IsAlreadyExists(err) {
+					continue
+				}
+				return false, err
+			}
+		} else {
+			if !pullLeaseFree(lease, now) {
+				continue
+			}
+			setPullLeaseHolder(lease, holder, now)
+			if err := objClient.Update(ctx, lease); err != nil {
+				if apierrors.IsConflict(err) {
+					continue
+				}
+				return false, err
+			}
+		}
+
+		log.Info("Acquired registry pull slot", "Lease", lease.Name, "holder", holder)
+		return true, nil
+	}
+
+	log.V(1).Info("No registry pull slot available", "maxPulls", maxPulls, "holder", holder)
+	return false, nil
+}
+
+// ReleasePullLease calls KubeAPI Server to free the registry pull slot held by holder, if any.
+func ReleasePullLease(
+	ctx context.Context,
+	objClient client.Client,
+	leaseNamespace string,
+	maxPulls int,
+	holder string,
+	log logr.Logger,
+) error {
+	for slot := 0; slot < maxPulls; slot++ {
+		lease := &coordinationv1.Lease{}
+		err := objClient.Get(ctx, types.NamespacedName{Namespace: leaseNamespace, Name: PullLeaseName(slot)}, lease)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		if ptr.Deref(lease.Spec.HolderIdentity, "") != holder {
+			continue
+		}
+
+		lease.Spec.HolderIdentity = nil
+		lease.Spec.AcquireTime = nil
+		lease.Spec.RenewTime = nil
+		if err := objClient.Update(ctx, lease); err != nil {
+			return err
+		}
+		log.Info("Released registry pull slot", "Lease", lease.Name, "holder", holder)
+		return nil
+	}
+	return nil
+}
+
+func pullLeaseFree(lease *coordinationv1.Lease, now metav1.MicroTime) bool {
+	if ptr.Deref(lease.Spec.HolderIdentity, "") == "" || lease.Spec.RenewTime == nil {
+		return true
+	}
+	duration := time.Duration(ptr.Deref(lease.Spec.LeaseDurationSeconds, 0)) * time.Second
+	return now.Sub(lease.Spec.RenewTime.Time) > duration
+}
+
+func setPullLeaseHolder(lease *coordinationv1.Lease, holder string, now metav1.MicroTime) {
+	lease.Spec.HolderIdentity = ptr.To(holder)
+	lease.Spec.LeaseDurationSeconds = ptr.To(int32(utils.PullLeaseDuration.Seconds()))
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+}
@@ -0,0 +1,84 @@
+package common
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+func TestPullLease(t *testing.T) {
+	// Setup logging before anything else so code can log errors.
+	logf.SetLogger(zap.New(zap.UseDevMode(true), zap.WriteTo(os.Stderr)))
+	log := logf.Log.WithName("lease-test")
+	ctx := context.Background()
+
+	t.Run("Test registry pull slots", func(t *testing.T) {
+		objClient := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()
+
+		t.Logf("TEST: AcquirePullLease() with free slots - Should create a Lease per holder")
+		acquired, err := AcquirePullLease(ctx, objClient, utils.GKMDefaultNamespace, 2, "node-a/pvc-a", log)
+		require.NoError(t, err)
+		require.True(t, acquired)
+		acquired, err = AcquirePullLease(ctx, objClient, utils.GKMDefaultNamespace, 2, "node-b/pvc-b", log)
+		require.NoError(t, err)
+		require.True(t, acquired)
+
+		t.Logf("TEST: AcquirePullLease() with all slots held - Should not acquire")
+		acquired, err = AcquirePullLease(ctx, objClient, utils.GKMDefaultNamespace, 2, "node-c/pvc-c", log)
+		require.NoError(t, err)
+		require.False(t, acquired)
+
+		t.Logf("TEST: AcquirePullLease() by a holder - Should keep its slot")
+		acquired, err = AcquirePullLease(ctx, objClient, utils.GKMDefaultNamespace, 2, "node-a/pvc-a", log)
+		require.NoError(t, err)
+		require.True(t, acquired)
+
+		t.Logf("TEST: ReleasePullLease() - Should free the slot for the next holder")
+		require.NoError(t, ReleasePullLease(ctx, objClient, utils.GKMDefaultNamespace, 2, "node-a/pvc-a", log))
+		lease := &coordinationv1.Lease{}
+		require.NoError(t, objClient.Get(ctx,
+			types.NamespacedName{Namespace: utils.GKMDefaultNamespace, Name: PullLeaseName(0)}, lease))
+		require.Nil(t, lease.Spec.HolderIdentity)
+		acquired, err = AcquirePullLease(ctx, objClient, utils.GKMDefaultNamespace, 2, "node-c/pvc-c", log)
+		require.NoError(t, err)
+		require.True(t, acquired)
+
+		t.Logf("TEST: ReleasePullLease() of an unknown holder - Should be a no-op")
+		require.NoError(t, ReleasePullLease(ctx, objClient, utils.GKMDefaultNamespace, 2, "node-d/pvc-d", log))
+	})
+
+	t.Run("Test expired registry pull slot", func(t *testing.T) {
+		expired := metav1.NewMicroTime(time.Now().Add(-2 * utils.PullLeaseDuration))
+		lease := &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: PullLeaseName(0), Namespace: utils.GKMDefaultNamespace},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       ptr.To("node-a/pvc-a"),
+				LeaseDurationSeconds: ptr.To(int32(utils.PullLeaseDuration.Seconds())),
+				AcquireTime:          &expired,
+				RenewTime:            &expired,
+			},
+		}
+		objClient := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(lease).Build()
+
+		t.Logf("TEST: AcquirePullLease() with a Lease no longer renewed - Should take over the slot")
+		acquired, err := AcquirePullLease(ctx, objClient, utils.GKMDefaultNamespace, 1, "node-b/pvc-b", log)
+		require.NoError(t, err)
+		require.True(t, acquired)
+		require.NoError(t, objClient.Get(ctx,
+			types.NamespacedName{Namespace: utils.GKMDefaultNamespace, Name: PullLeaseName(0)}, lease))
+		require.Equal(t, "node-b/pvc-b", ptr.Deref(lease.Spec.HolderIdentity, ""))
+	})
+}
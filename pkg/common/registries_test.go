@@ -0,0 +1,37 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+func TestRegistriesEnv(t *testing.T) {
+	t.Run("Test registries configuration passed to the extract Job", func(t *testing.T) {
+		dir := t.TempDir()
+
+		t.Logf("TEST: registriesEnv() without a registries configuration - Should return no environment")
+		require.Empty(t, registriesEnv(dir, logr.Discard()))
+
+		t.Logf("TEST: registriesEnv() with a registries.conf - Should pass its content")
+		conf := "[[registry]]\nlocation = \"quay.io\"\n"
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "registries.conf"), []byte(conf), 0644))
+		require.Equal(t, []corev1.EnvVar{
+			{Name: utils.JobExtractEnvRegistriesConf, Value: conf},
+		}, registriesEnv(dir, logr.Discard()))
+
+		t.Logf("TEST: registriesEnv() with a registries.conf and CA bundle - Should pass both")
+		caBundle := "-----BEGIN CERTIFICATE-----\n"
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "ca-bundle.crt"), []byte(caBundle), 0644))
+		require.Equal(t, []corev1.EnvVar{
+			{Name: utils.JobExtractEnvRegistriesConf, Value: conf},
+			{Name: utils.JobExtractEnvRegistryCABundle, Value: caBundle},
+		}, registriesEnv(dir, logr.Discard()))
+	})
+}
@@ -0,0 +1,157 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	gkmv1alpha1 "github.com/redhat-et/GKM/api/v1alpha1"
+	"github.com/redhat-et/GKM/pkg/extract"
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+// ExtractRetryDelay returns how long to wait before the next retry of a failed extraction,
+// given the number of retries already made. The delay doubles on each retry, up to
+// utils.ExtractRetryMaxDelay.
+func ExtractRetryDelay(retryCount int32) time.Duration {
+	delay := utils.ExtractRetryBaseDelay
+	for i := int32(0); i < retryCount; i++ {
+		delay *= 2
+		if delay >= utils.ExtractRetryMaxDelay {
+			return utils.ExtractRetryMaxDelay
+		}
+	}
+	return delay
+}
+
+// GetJobFailureReason calls KubeAPI Server to determine why a Job failed, from the exit code
+// and termination message of gkm-extract. The first line of the returned message is the error,
+// followed by how the Pod terminated and the tail of its log, so the reason for the failure is
+// kept after the Job is removed. kubeClient is used to read the log and may be nil. If the Pod
+// is not found, the failure is returned as extract.FailureUnknown.
+func GetJobFailureReason(
+	ctx context.Context,
+	objClient client.Client,
+	kubeClient kubernetes.Interface,
+	job *batchv1.Job,
+	log logr.Logger,
+) (extract.FailureReason, string) {
+	reason := extract.FailureUnknown
+
+	termination, err := GetJobTermination(ctx, objClient, job, log)
+	if err != nil {
+		log.Info("Unable to get failed Job Pods", "Job Namespace", job.Namespace, "Job Name", job.Name, "err", err)
+	}
+	if termination == nil {
+		// Pod was removed or never ran, so all that is left is the Job condition.
+		message := fmt.Sprintf("Job %s failed", job.Name)
+		for _, condition := range job.Status.Conditions {
+			if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+				message = fmt.Sprintf("%s: %s: %s", message, condition.Reason, condition.Message)
+			}
+		}
+		return reason, message
+	}
+
+	message := string(reason)
+	logTail := ""
+	if termination.Terminated {
+		reason = extract.FailureReasonFromExitCode(termination.ExitCode)
+		message = string(reason)
+		if result, ok := extract.ParseResult(termination.Message); ok {
+			if result.Error != "" {
+				message = fmt.Sprintf("%s: %s", reason, result.Error)
+			}
+			logTail = GetJobLogTail(ctx, kubeClient, job.Namespace, termination.PodName, log)
+		} else {
+			// gkm-extract exited before writing the Result, so Kubernetes already used the
+			// tail of the log as the termination message.
+			logTail = termination.Message
+		}
+	}
+
+	message = fmt.Sprintf("%s\n%s", message, termination.Summary())
+	if logTail != "" {
+		message = fmt.Sprintf("%s\nLog tail:\n%s", message, logTail)
+	}
+	return reason, message
+}
+
+// GetJobResult calls KubeAPI Server to retrieve the Result written by gkm-extract to the
+// termination message of a successful Job. Returns false if the Result is not available, for
+// example if the Pod was already removed.
+func GetJobResult(
+	ctx context.Context,
+	objClient client.Client,
+	job *batchv1.Job,
+	log logr.Logger,
+) (*extract.Result, bool) {
+	termination, err := GetJobTermination(ctx, objClient, job, log)
+	if err != nil {
+		log.Info("Unable to get Job Pods", "Job Namespace", job.Namespace, "Job Name", job.Name, "err", err)
+		return nil, false
+	}
+	if termination == nil || !termination.Terminated || termination.ExitCode != 0 {
+		return nil, false
+	}
+	result, ok := extract.ParseResult(termination.Message)
+	if !ok {
+		log.Info("Job did not report a result", "Job Namespace", job.Namespace, "Job Name", job.Name)
+	}
+	return result, ok
+}
+
+// SetExtractFailure sets the Error condition on the PVC Status, with the failure class as the
+// Reason. If the failure is transient and the retry limit has not been reached, NextRetryTime
+// is set to when the extraction should be retried.
+func SetExtractFailure(pvcStatus *gkmv1alpha1.PvcStatus, reason extract.FailureReason, message string) {
+	condition := gkmv1alpha1.GkmCondError.Condition()
+	condition.Reason = string(reason)
+	if message != "" {
+		condition.Message = message
+	}
+
+	pvcStatus.NextRetryTime = nil
+	if reason.Transient() && pvcStatus.RetryCount < utils.ExtractRetryLimit {
+		delay := ExtractRetryDelay(pvcStatus.RetryCount)
+		nextRetryTime := metav1.NewTime(time.Now().Add(delay))
+		pvcStatus.NextRetryTime = &nextRetryTime
+		// Keep the retry on the first line, ahead of any Pod details and log tail.
+		summary, details, _ := strings.Cut(condition.Message, "\n")
+		condition.Message = fmt.Sprintf("%s (retry %d of %d in %s)",
+			summary, pvcStatus.RetryCount+1, utils.ExtractRetryLimit, delay)
+		if details != "" {
+			condition.Message = fmt.Sprintf("%s\n%s", condition.Message, details)
+		}
+	}
+
+	gkmv1alpha1.SetPvcStatusConditions(pvcStatus, condition)
+}
+
+// ExtractRetryPending returns true if the PVC Status is waiting to retry a failed extraction,
+// along with how long until the retry is due, which is 0 or less if due now.
+func ExtractRetryPending(pvcStatus *gkmv1alpha1.PvcStatus) (bool, time.Duration) {
+	if !gkmv1alpha1.GkmCondError.IsConditionSet(pvcStatus.Conditions) || pvcStatus.NextRetryTime == nil {
+		return false, 0
+	}
+	return true, time.Until(pvcStatus.NextRetryTime.Time)
+}
+
+// RetryExtract moves the PVC Status from Error back to Pending so the extraction is launched
+// again. Any failed Job must be deleted by the caller first.
+func RetryExtract(pvcStatus *gkmv1alpha1.PvcStatus) {
+	pvcStatus.RetryCount++
+	pvcStatus.NextRetryTime = nil
+
+	condition := gkmv1alpha1.GkmCondPending.Condition()
+	condition.Message = fmt.Sprintf("Retrying extraction, attempt %d of %d", pvcStatus.RetryCount, utils.ExtractRetryLimit)
+	gkmv1alpha1.SetPvcStatusConditions(pvcStatus, condition)
+}
@@ -0,0 +1,166 @@
+package common
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	gkmv1alpha1 "github.com/redhat-et/GKM/api/v1alpha1"
+	"github.com/redhat-et/GKM/pkg/extract"
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+func TestExtractRetry(t *testing.T) {
+	// Setup logging before anything else so code can log errors.
+	logf.SetLogger(zap.New(zap.UseDevMode(true), zap.WriteTo(os.Stderr)))
+	log := logf.Log.WithName("retry-test")
+	ctx := context.Background()
+
+	t.Run("Test extraction retry backoff", func(t *testing.T) {
+		t.Logf("TEST: ExtractRetryDelay() - Should double and stop at the cap")
+		require.Equal(t, utils.ExtractRetryBaseDelay, ExtractRetryDelay(0))
+		require.Equal(t, 2*utils.ExtractRetryBaseDelay, ExtractRetryDelay(1))
+		require.Equal(t, 4*utils.ExtractRetryBaseDelay, ExtractRetryDelay(2))
+		require.Equal(t, utils.ExtractRetryMaxDelay, ExtractRetryDelay(20))
+	})
+
+	t.Run("Test extraction failure and retry of PVC Status", func(t *testing.T) {
+		pvcStatus := &gkmv1alpha1.PvcStatus{}
+
+		t.Logf("TEST: SetExtractFailure() with a permanent failure - Should not schedule a retry")
+		SetExtractFailure(pvcStatus, extract.FailureNotFound, "ImageNotFound: manifest unknown")
+		condition := meta.FindStatusCondition(pvcStatus.Conditions, string(gkmv1alpha1.GkmCondError))
+		require.NotNil(t, condition)
+		require.Equal(t, string(extract.FailureNotFound), condition.Reason)
+		require.Equal(t, "ImageNotFound: manifest unknown", condition.Message)
+		retryPending, _ := ExtractRetryPending(pvcStatus)
+		require.False(t, retryPending)
+
+		t.Logf("TEST: SetExtractFailure() with a transient failure - Should schedule a retry")
+		SetExtractFailure(pvcStatus, extract.FailureNetwork, "NetworkError: i/o timeout")
+		retryPending, remaining := ExtractRetryPending(pvcStatus)
+		require.True(t, retryPending)
+		require.Greater(t, remaining, time.Duration(0))
+		condition = meta.FindStatusCondition(pvcStatus.Conditions, string(gkmv1alpha1.GkmCondError))
+		require.Contains(t, condition.Message, "retry 1 of")
+
+		t.Logf("TEST: RetryExtract() - Should move back to Pending and count the retry")
+		RetryExtract(pvcStatus)
+		require.True(t, gkmv1alpha1.GkmCondPending.IsConditionSet(pvcStatus.Conditions))
+		require.Equal(t, int32(1), pvcStatus.RetryCount)
+		require.Nil(t, pvcStatus.NextRetryTime)
+
+		t.Logf("TEST: SetExtractFailure() at the retry limit - Should not schedule a retry")
+		pvcStatus.RetryCount = utils.ExtractRetryLimit
+		SetExtractFailure(pvcStatus, extract.FailureNetwork, "NetworkError: i/o timeout")
+		retryPending, _ = ExtractRetryPending(pvcStatus)
+		require.False(t, retryPending)
+	})
+
+	t.Run("Test Job termination message", func(t *testing.T) {
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "extract-job-abcde", Namespace: "gkm-test"},
+			Status: batchv1.JobStatus{
+				Conditions: []batchv1.JobCondition{{
+					Type:    batchv1.JobFailed,
+					Status:  corev1.ConditionTrue,
+					Reason:  "BackoffLimitExceeded",
+					Message: "Job has reached the specified backoff limit",
+				}},
+			},
+		}
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "extract-job-abcde-12345",
+				Namespace: "gkm-test",
+				Labels:    map[string]string{batchv1.JobNameLabel: job.Name},
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name: utils.JobExtractName,
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+						ExitCode: int32(extract.FailureAuth.ExitCode()),
+						Reason:   "Error",
+						Message:  "AuthFailed: UNAUTHORIZED\n",
+					}},
+				}},
+			},
+		}
+
+		kubeClient := kubefake.NewSimpleClientset()
+
+		t.Logf("TEST: GetJobFailureReason() without Pods - Should return FailureUnknown with the Job condition")
+		objClient := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()
+		reason, message := GetJobFailureReason(ctx, objClient, kubeClient, job, log)
+		require.Equal(t, extract.FailureUnknown, reason)
+		require.Equal(t, "Job extract-job-abcde failed: BackoffLimitExceeded: Job has reached the specified backoff limit", message)
+
+		t.Logf("TEST: GetJobFailureReason() with a terminated Pod - Should map the exit code and keep the log tail")
+		objClient = fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(pod).Build()
+		reason, message = GetJobFailureReason(ctx, objClient, kubeClient, job, log)
+		require.Equal(t, extract.FailureAuth, reason)
+		require.Equal(t, "AuthFailed\n"+
+			"Pod extract-job-abcde-12345 terminated: Error (exit code 10)\n"+
+			"Log tail:\nAuthFailed: UNAUTHORIZED", message)
+		require.Equal(t, "AuthFailed", FailureSummary(message, utils.NodeFailureMaxMessage))
+
+		t.Logf("TEST: GetJobFailureReason() with a Result - Should use the error from the Result and read the log")
+		pod.Status.ContainerStatuses[0].State.Terminated.Message =
+			`{"reason":"AuthFailed","error":"failed to fetch image: UNAUTHORIZED"}`
+		objClient = fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(pod).Build()
+		reason, message = GetJobFailureReason(ctx, objClient, kubeClient, job, log)
+		require.Equal(t, extract.FailureAuth, reason)
+		require.Equal(t, "AuthFailed: failed to fetch image: UNAUTHORIZED\n"+
+			"Pod extract-job-abcde-12345 terminated: Error (exit code 10)\n"+
+			"Log tail:\nfake logs", message)
+
+		t.Logf("TEST: GetJobFailureReason() without a Clientset - Should skip the log tail")
+		_, message = GetJobFailureReason(ctx, objClient, nil, job, log)
+		require.NotContains(t, message, "Log tail")
+
+		t.Logf("TEST: SetExtractFailure() with a log tail - Should keep the retry on the first line")
+		pvcStatus := &gkmv1alpha1.PvcStatus{}
+		SetExtractFailure(pvcStatus, extract.FailureNetwork, message)
+		condition := meta.FindStatusCondition(pvcStatus.Conditions, string(gkmv1alpha1.GkmCondError))
+		require.Contains(t, FailureSummary(condition.Message, len(condition.Message)), "(retry 1 of")
+		require.Contains(t, condition.Message, "\nPod extract-job-abcde-12345 terminated")
+
+		t.Logf("TEST: GetJobFailureReason() with an evicted Pod - Should report the Pod reason")
+		evicted := pod.DeepCopy()
+		evicted.Status.Reason = "Evicted"
+		evicted.Status.Message = "The node was low on resource: ephemeral-storage."
+		evicted.Status.ContainerStatuses = nil
+		objClient = fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(evicted).Build()
+		reason, message = GetJobFailureReason(ctx, objClient, kubeClient, job, log)
+		require.Equal(t, extract.FailureUnknown, reason)
+		require.Equal(t, "ExtractFailed\n"+
+			"Pod extract-job-abcde-12345 failed: Evicted: The node was low on resource: ephemeral-storage.", message)
+
+		t.Logf("TEST: GetJobResult() of a failed Job - Should return false")
+		_, found := GetJobResult(ctx, objClient, job, log)
+		require.False(t, found)
+
+		t.Logf("TEST: GetJobResult() of a successful Job - Should return the Result")
+		pod.Status.ContainerStatuses[0].State.Terminated.ExitCode = 0
+		pod.Status.ContainerStatuses[0].State.Terminated.Message =
+			`{"matchedIds":[0],"unmatchedIds":[1],"bytesExtracted":2048,"fileCount":4,"durationMs":900}`
+		objClient = fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(pod).Build()
+		result, found := GetJobResult(ctx, objClient, job, log)
+		require.True(t, found)
+		require.Equal(t, []int{0}, result.MatchedIds)
+		require.Equal(t, int64(2048), result.BytesExtracted)
+		require.Equal(t, int64(4), result.FileCount)
+	})
+}
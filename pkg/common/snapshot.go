@@ -0,0 +1,455 @@
+package common
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+// copyContentNamePrefixLength keeps the copied VolumeSnapshotContent names within the 253
+// characters of an object name.
+const copyContentNamePrefixLength = 200
+
+// snapshotNameDigestLength is the number of characters of the digest added to a VolumeSnapshot
+// name, so a snapshot taken of another digest of the cache is never reused.
+const snapshotNameDigestLength = 12
+
+// The VolumeSnapshot CRDs are installed by the CSI external-snapshotter, which is optional
+// in a cluster. So the objects are managed as unstructured objects and a missing CRD is
+// treated the same as a StorageClass that does not support snapshots.
+var (
+	VolumeSnapshotGVK = schema.GroupVersionKind{
+		Group:   utils.SnapshotGroup,
+		Version: utils.SnapshotVersion,
+		Kind:    "VolumeSnapshot",
+	}
+	VolumeSnapshotContentGVK = schema.GroupVersionKind{
+		Group:   utils.SnapshotGroup,
+		Version: utils.SnapshotVersion,
+		Kind:    "VolumeSnapshotContent",
+	}
+	VolumeSnapshotClassListGVK = schema.GroupVersionKind{
+		Group:   utils.SnapshotGroup,
+		Version: utils.SnapshotVersion,
+		Kind:    "VolumeSnapshotClassList",
+	}
+)
+
+// GetVolumeSnapshotClass determines if the given StorageClass supports snapshots. If it does,
+// the name of the VolumeSnapshotClass with the same driver as the StorageClass provisioner is
+// returned. If storageClassName is empty, the default StorageClass is used. An empty string
+// is returned if snapshots are not supported.
+func GetVolumeSnapshotClass(
+	ctx context.Context,
+	objClient client.Client,
+	storageClassName string,
+	log logr.Logger,
+) (string, error) {
+	var storageClass *storagev1.StorageClass
+
+	if storageClassName != "" {
+		storageClass = &storagev1.StorageClass{}
+		if err := objClient.Get(ctx, types.NamespacedName{Name: storageClassName}, storageClass); err != nil {
+			if apierrors.IsNotFound(err) {
+				return "", nil
+			}
+			return "", err
+		}
+	} else {
+		scList := &storagev1.StorageClassList{}
+		if err := objClient.List(ctx, scList); err != nil {
+			return "", err
+		}
+		for i, sc := range scList.Items {
+			if sc.Annotations[utils.StorageClassAnnotationDefault] == "true" {
+				storageClass = &scList.Items[i]
+				break
+			}
+		}
+		if storageClass == nil {
+			log.Info("No default StorageClass, snapshots not supported")
+			return "", nil
+		}
+	}
+
+	classList := &unstructured.UnstructuredList{}
+	classList.SetGroupVersionKind(VolumeSnapshotClassListGVK)
+	if err := objClient.List(ctx, classList); err != nil {
+		if meta.IsNoMatchError(err) || apierrors.IsNotFound(err) {
+			log.Info("VolumeSnapshot CRDs not installed, snapshots not supported")
+			return "", nil
+		}
+		return "", err
+	}
+
+	snapshotClass := ""
+	for _, class := range classList.Items {
+		driver, _, _ := unstructured.NestedString(class.Object, "driver")
+		if driver != storageClass.Provisioner {
+			continue
+		}
+		if class.GetAnnotations()[utils.SnapshotClassAnnotationDefault] == "true" {
+			snapshotClass = class.GetName()
+			break
+		}
+		if snapshotClass == "" {
+			snapshotClass = class.GetName()
+		}
+	}
+
+	log.Info("VolumeSnapshotClass for StorageClass",
+		"StorageClass", storageClass.Name,
+		"Provisioner", storageClass.Provisioner,
+		"VolumeSnapshotClass", snapshotClass,
+	)
+	return snapshotClass, nil
+}
+
+// VolumeSnapshotName returns the name of the VolumeSnapshot of the GKMCache or ClusterGKMCache
+// gkmCacheName extracted from resolvedDigest.
+func VolumeSnapshotName(gkmCacheName, resolvedDigest string) string {
+	trimDigest := strings.TrimPrefix(resolvedDigest, utils.DigestPrefix)
+	if len(trimDigest) > snapshotNameDigestLength {
+		trimDigest = trimDigest[:snapshotNameDigestLength]
+	}
+	prefix := gkmCacheName
+	if len(prefix) > copyContentNamePrefixLength {
+		prefix = strings.TrimRight(prefix[:copyContentNamePrefixLength], "-.")
+	}
+	return prefix + "-" + trimDigest
+}
+
+// CreateVolumeSnapshot calls KubeAPI Server to create a VolumeSnapshot of the given PVC. If a
+// VolumeSnapshot with the same name exists, it is reused when it was taken of the same PVC and
+// digest. Otherwise it is deleted and false is returned, so it is taken again once gone.
+func CreateVolumeSnapshot(
+	ctx context.Context,
+	objClient client.Client,
+	scheme *runtime.Scheme,
+	ownerObj metav1.Object,
+	gkmCacheNamespace string,
+	gkmCacheName string,
+	snapshotName string,
+	snapshotNamespace string,
+	snapshotClass string,
+	pvcName string,
+	resolvedDigest string,
+	log logr.Logger,
+) (bool, error) {
+	snapshot := newVolumeSnapshot(gkmCacheNamespace, gkmCacheName, snapshotName, snapshotNamespace, resolvedDigest)
+	snapshot.Object["spec"] = map[string]interface{}{
+		"volumeSnapshotClassName": snapshotClass,
+		"source": map[string]interface{}{
+			"persistentVolumeClaimName": pvcName,
+		},
+	}
+
+	if err := controllerutil.SetControllerReference(ownerObj, snapshot, scheme); err != nil {
+		log.Error(err, "Failed to set controller reference on VolumeSnapshot",
+			"Snapshot Namespace", snapshotNamespace,
+			"Snapshot Name", snapshotName,
+		)
+		return false, err
+	}
+
+	if err := objClient.Create(ctx, snapshot); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			log.Error(err, "Failed to create VolumeSnapshot.",
+				"namespace", gkmCacheNamespace,
+				"name", gkmCacheName,
+				"Snapshot Namespace", snapshotNamespace,
+				"Snapshot Name", snapshotName,
+				"PVC", pvcName,
+			)
+			return false, err
+		}
+		// Created by an earlier attempt, make sure it was taken of the same PVC and digest.
+		existing := &unstructured.Unstructured{}
+		existing.SetGroupVersionKind(VolumeSnapshotGVK)
+		if err := objClient.Get(ctx, types.NamespacedName{Namespace: snapshotNamespace, Name: snapshotName}, existing); err != nil {
+			return false, err
+		}
+		sourcePvc, _, _ := unstructured.NestedString(existing.Object, "spec", "source", "persistentVolumeClaimName")
+		if sourcePvc != pvcName || !snapshotDigestMatches(existing, resolvedDigest) {
+			log.Info("VolumeSnapshot exists for another PVC or digest, deleting",
+				"namespace", gkmCacheNamespace,
+				"name", gkmCacheName,
+				"Snapshot Namespace", snapshotNamespace,
+				"Snapshot Name", snapshotName,
+				"PVC", sourcePvc,
+				"digest", existing.GetLabels()[utils.SnapshotLabelDigest],
+			)
+			return false, DeleteVolumeSnapshot(ctx, objClient, snapshotNamespace, snapshotName, log)
+		}
+		return true, nil
+	}
+	log.Info("Created VolumeSnapshot",
+		"namespace", gkmCacheNamespace,
+		"name", gkmCacheName,
+		"Snapshot Namespace", snapshotNamespace,
+		"Snapshot Name", snapshotName,
+		"PVC", pvcName,
+	)
+	return true, nil
+}
+
+// DeleteVolumeSnapshot calls KubeAPI Server to delete a VolumeSnapshot. A VolumeSnapshot that
+// does not exist is not an error.
+func DeleteVolumeSnapshot(
+	ctx context.Context,
+	objClient client.Client,
+	snapshotNamespace string,
+	snapshotName string,
+	log logr.Logger,
+) error {
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(VolumeSnapshotGVK)
+	snapshot.SetNamespace(snapshotNamespace)
+	snapshot.SetName(snapshotName)
+	if err := objClient.Delete(ctx, snapshot); err != nil && !apierrors.IsNotFound(err) {
+		log.Error(err, "Failed to delete VolumeSnapshot.",
+			"Snapshot Namespace", snapshotNamespace,
+			"Snapshot Name", snapshotName,
+		)
+		return err
+	}
+	log.Info("Deleted VolumeSnapshot",
+		"Snapshot Namespace", snapshotNamespace,
+		"Snapshot Name", snapshotName,
+	)
+	return nil
+}
+
+// IsVolumeSnapshotReady returns true once the VolumeSnapshot can be used to populate a PVC.
+func IsVolumeSnapshotReady(
+	ctx context.Context,
+	objClient client.Client,
+	snapshotNamespace string,
+	snapshotName string,
+) (bool, error) {
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(VolumeSnapshotGVK)
+	if err := objClient.Get(ctx, types.NamespacedName{Namespace: snapshotNamespace, Name: snapshotName}, snapshot); err != nil {
+		return false, err
+	}
+	ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse")
+	return ready, nil
+}
+
+// CopyVolumeSnapshot makes the VolumeSnapshot taken of the seed PVC available in another
+// Namespace. A PVC can only be populated from a VolumeSnapshot in its own Namespace, so a
+// pre-provisioned VolumeSnapshotContent referencing the same snapshot handle is created,
+// along with a VolumeSnapshot in the target Namespace bound to it. Returns false if the
+// seed VolumeSnapshot is not ready yet, or if a VolumeSnapshot of another digest had to be
+// deleted from the target Namespace first.
+func CopyVolumeSnapshot(
+	ctx context.Context,
+	objClient client.Client,
+	scheme *runtime.Scheme,
+	ownerObj metav1.Object,
+	gkmCacheNamespace string,
+	gkmCacheName string,
+	seedNamespace string,
+	seedSnapshotName string,
+	snapshotName string,
+	snapshotNamespace string,
+	resolvedDigest string,
+	log logr.Logger,
+) (bool, error) {
+	seed := &unstructured.Unstructured{}
+	seed.SetGroupVersionKind(VolumeSnapshotGVK)
+	if err := objClient.Get(ctx, types.NamespacedName{Namespace: seedNamespace, Name: seedSnapshotName}, seed); err != nil {
+		return false, err
+	}
+
+	if !snapshotDigestMatches(seed, resolvedDigest) {
+		return false, fmt.Errorf("seed VolumeSnapshot %s/%s was not taken of digest %s",
+			seedNamespace, seedSnapshotName, resolvedDigest)
+	}
+	ready, _, _ := unstructured.NestedBool(seed.Object, "status", "readyToUse")
+	contentName, _, _ := unstructured.NestedString(seed.Object, "status", "boundVolumeSnapshotContentName")
+	if !ready || contentName == "" {
+		log.Info("Seed VolumeSnapshot not ready",
+			"Snapshot Namespace", seedNamespace,
+			"Snapshot Name", seedSnapshotName,
+		)
+		return false, nil
+	}
+
+	seedContent := &unstructured.Unstructured{}
+	seedContent.SetGroupVersionKind(VolumeSnapshotContentGVK)
+	if err := objClient.Get(ctx, types.NamespacedName{Name: contentName}, seedContent); err != nil {
+		return false, err
+	}
+	snapshotHandle, _, _ := unstructured.NestedString(seedContent.Object, "status", "snapshotHandle")
+	driver, _, _ := unstructured.NestedString(seedContent.Object, "spec", "driver")
+	snapshotClass, _, _ := unstructured.NestedString(seedContent.Object, "spec", "volumeSnapshotClassName")
+	if snapshotHandle == "" {
+		return false, fmt.Errorf("VolumeSnapshotContent %s has no snapshot handle", contentName)
+	}
+
+	// VolumeSnapshotContent is cluster scoped, so the name is derived from the target
+	// VolumeSnapshot and the seed content, so a retried copy finds the objects it already
+	// created. The content is only a reference to the seed snapshot, so Retain so deleting it
+	// does not delete the seed.
+	copyContentName := copyVolumeSnapshotContentName(snapshotNamespace, snapshotName, seedContent.GetUID())
+	content := &unstructured.Unstructured{}
+	content.SetGroupVersionKind(VolumeSnapshotContentGVK)
+	content.SetName(copyContentName)
+	content.SetLabels(snapshotLabels(gkmCacheNamespace, gkmCacheName, resolvedDigest))
+	content.Object["spec"] = map[string]interface{}{
+		"deletionPolicy":          "Retain",
+		"driver":                  driver,
+		"volumeSnapshotClassName": snapshotClass,
+		"source": map[string]interface{}{
+			"snapshotHandle": snapshotHandle,
+		},
+		"volumeSnapshotRef": map[string]interface{}{
+			"name":      snapshotName,
+			"namespace": snapshotNamespace,
+		},
+	}
+	if err := controllerutil.SetControllerReference(ownerObj, content, scheme); err != nil {
+		return false, err
+	}
+	if err := objClient.Create(ctx, content); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			log.Error(err, "Failed to create VolumeSnapshotContent.",
+				"namespace", gkmCacheNamespace,
+				"name", gkmCacheName,
+				"Content Name", copyContentName,
+			)
+			return false, err
+		}
+		// Created by an earlier attempt, make sure it references the same snapshot.
+		existing := &unstructured.Unstructured{}
+		existing.SetGroupVersionKind(VolumeSnapshotContentGVK)
+		if err := objClient.Get(ctx, types.NamespacedName{Name: copyContentName}, existing); err != nil {
+			return false, err
+		}
+		handle, _, _ := unstructured.NestedString(existing.Object, "spec", "source", "snapshotHandle")
+		refNamespace, _, _ := unstructured.NestedString(existing.Object, "spec", "volumeSnapshotRef", "namespace")
+		refName, _, _ := unstructured.NestedString(existing.Object, "spec", "volumeSnapshotRef", "name")
+		if handle != snapshotHandle || refNamespace != snapshotNamespace || refName != snapshotName {
+			return false, fmt.Errorf("VolumeSnapshotContent %s exists for another snapshot", copyContentName)
+		}
+	}
+
+	snapshot := newVolumeSnapshot(gkmCacheNamespace, gkmCacheName, snapshotName, snapshotNamespace, resolvedDigest)
+	snapshot.Object["spec"] = map[string]interface{}{
+		"volumeSnapshotClassName": snapshotClass,
+		"source": map[string]interface{}{
+			"volumeSnapshotContentName": copyContentName,
+		},
+	}
+	if err := controllerutil.SetControllerReference(ownerObj, snapshot, scheme); err != nil {
+		return false, err
+	}
+	if err := objClient.Create(ctx, snapshot); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			log.Error(err, "Failed to create VolumeSnapshot.",
+				"namespace", gkmCacheNamespace,
+				"name", gkmCacheName,
+				"Snapshot Namespace", snapshotNamespace,
+				"Snapshot Name", snapshotName,
+			)
+			return false, err
+		}
+		// Created by an earlier attempt, make sure it is bound to the copied content.
+		existing := &unstructured.Unstructured{}
+		existing.SetGroupVersionKind(VolumeSnapshotGVK)
+		if err := objClient.Get(ctx, types.NamespacedName{Namespace: snapshotNamespace, Name: snapshotName}, existing); err != nil {
+			return false, err
+		}
+		if !snapshotDigestMatches(existing, resolvedDigest) {
+			log.Info("VolumeSnapshot exists for another digest, deleting",
+				"namespace", gkmCacheNamespace,
+				"name", gkmCacheName,
+				"Snapshot Namespace", snapshotNamespace,
+				"Snapshot Name", snapshotName,
+				"digest", existing.GetLabels()[utils.SnapshotLabelDigest],
+			)
+			return false, DeleteVolumeSnapshot(ctx, objClient, snapshotNamespace, snapshotName, log)
+		}
+		sourceContent, _, _ := unstructured.NestedString(existing.Object, "spec", "source", "volumeSnapshotContentName")
+		boundContent, _, _ := unstructured.NestedString(existing.Object, "status", "boundVolumeSnapshotContentName")
+		if sourceContent != copyContentName || (boundContent != "" && boundContent != copyContentName) {
+			return false, fmt.Errorf("VolumeSnapshot %s/%s exists and is not bound to VolumeSnapshotContent %s",
+				snapshotNamespace, snapshotName, copyContentName)
+		}
+	}
+
+	log.Info("Copied VolumeSnapshot",
+		"namespace", gkmCacheNamespace,
+		"name", gkmCacheName,
+		"Seed Namespace", seedNamespace,
+		"Snapshot Namespace", snapshotNamespace,
+		"Snapshot Name", snapshotName,
+		"Content Name", copyContentName,
+	)
+	return true, nil
+}
+
+// copyVolumeSnapshotContentName returns the name of the VolumeSnapshotContent copying the seed
+// content with seedContentUID to the VolumeSnapshot snapshotNamespace/snapshotName.
+func copyVolumeSnapshotContentName(snapshotNamespace, snapshotName string, seedContentUID types.UID) string {
+	sum := sha256.Sum256([]byte(snapshotNamespace + "/" + snapshotName + "/" + string(seedContentUID)))
+	prefix := snapshotNamespace + "-" + snapshotName
+	if len(prefix) > copyContentNamePrefixLength {
+		prefix = strings.TrimRight(prefix[:copyContentNamePrefixLength], "-.")
+	}
+	return prefix + "-" + hex.EncodeToString(sum[:8])
+}
+
+// SnapshotDataSource returns the DataSource used to populate a PVC from a VolumeSnapshot.
+func SnapshotDataSource(snapshotName string) *corev1.TypedLocalObjectReference {
+	apiGroup := utils.SnapshotGroup
+	return &corev1.TypedLocalObjectReference{
+		APIGroup: &apiGroup,
+		Kind:     VolumeSnapshotGVK.Kind,
+		Name:     snapshotName,
+	}
+}
+
+func newVolumeSnapshot(
+	gkmCacheNamespace, gkmCacheName, snapshotName, snapshotNamespace, resolvedDigest string,
+) *unstructured.Unstructured {
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(VolumeSnapshotGVK)
+	snapshot.SetName(snapshotName)
+	snapshot.SetNamespace(snapshotNamespace)
+	snapshot.SetLabels(snapshotLabels(gkmCacheNamespace, gkmCacheName, resolvedDigest))
+	return snapshot
+}
+
+func snapshotLabels(gkmCacheNamespace, gkmCacheName, resolvedDigest string) map[string]string {
+	trimDigest := strings.TrimPrefix(resolvedDigest, utils.DigestPrefix)
+	return map[string]string{
+		utils.SnapshotLabelCache:          gkmCacheName,
+		utils.SnapshotLabelCacheNamespace: gkmCacheNamespace,
+		utils.SnapshotLabelDigest:         trimDigest[:utils.MaxLabelValueLength],
+	}
+}
+
+// snapshotDigestMatches returns true if the VolumeSnapshot is labeled with resolvedDigest.
+func snapshotDigestMatches(snapshot *unstructured.Unstructured, resolvedDigest string) bool {
+	trimDigest := strings.TrimPrefix(resolvedDigest, utils.DigestPrefix)
+	return snapshot.GetLabels()[utils.SnapshotLabelDigest] == trimDigest[:utils.MaxLabelValueLength]
+}
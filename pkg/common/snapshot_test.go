@@ -0,0 +1,315 @@
+package common
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+const (
+	testDigest      = "sha256:bf6f7ea60274882031ad81434aa9c9ac0e4ff280cd1513db239dbbd705b6511c"
+	testDriver      = "hostpath.csi.k8s.io"
+	testCacheName   = "vector-add"
+	testSeedNs      = "seed-ns"
+	testWorkloadNs  = "workload-ns"
+	testSnapshotCls = "csi-hostpath-snapclass"
+)
+
+// snapshotScheme registers the VolumeSnapshot kinds as unstructured objects, the same way
+// they are used by the helpers, so the CRDs are not needed by the fake client.
+func snapshotScheme(t *testing.T) *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+
+	for _, kind := range []string{"VolumeSnapshot", "VolumeSnapshotContent", "VolumeSnapshotClass"} {
+		gvk := schema.GroupVersionKind{Group: utils.SnapshotGroup, Version: utils.SnapshotVersion, Kind: kind}
+		scheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+		gvk.Kind += "List"
+		scheme.AddKnownTypeWithName(gvk, &unstructured.UnstructuredList{})
+	}
+	return scheme
+}
+
+func newSnapshotClass(name, driver string, isDefault bool) *unstructured.Unstructured {
+	class := &unstructured.Unstructured{}
+	class.SetGroupVersionKind(schema.GroupVersionKind{
+		Group: utils.SnapshotGroup, Version: utils.SnapshotVersion, Kind: "VolumeSnapshotClass",
+	})
+	class.SetName(name)
+	if isDefault {
+		class.SetAnnotations(map[string]string{utils.SnapshotClassAnnotationDefault: "true"})
+	}
+	class.Object["driver"] = driver
+	class.Object["deletionPolicy"] = "Delete"
+	return class
+}
+
+func newStorageClass(name, provisioner string, isDefault bool) *storagev1.StorageClass {
+	sc := &storagev1.StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: name},
+		Provisioner: provisioner,
+	}
+	if isDefault {
+		sc.Annotations = map[string]string{utils.StorageClassAnnotationDefault: "true"}
+	}
+	return sc
+}
+
+func TestGetVolumeSnapshotClass(t *testing.T) {
+	// Setup logging before anything else so code can log errors.
+	logf.SetLogger(zap.New(zap.UseDevMode(true), zap.WriteTo(os.Stderr)))
+	log := logf.Log.WithName("snapshot-test")
+	ctx := context.Background()
+	scheme := snapshotScheme(t)
+
+	objs := []client.Object{
+		newStorageClass("csi-hostpath-sc", testDriver, true),
+		newStorageClass("local-path", "rancher.io/local-path", false),
+		newSnapshotClass("other-snapclass", "other.csi.k8s.io", true),
+		newSnapshotClass("csi-hostpath-snapclass-2", testDriver, false),
+		newSnapshotClass(testSnapshotCls, testDriver, true),
+	}
+	objClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+
+	t.Run("Test VolumeSnapshotClass lookup", func(t *testing.T) {
+		t.Logf("TEST: GetVolumeSnapshotClass() with StorageClass name - Should return default class for driver")
+		class, err := GetVolumeSnapshotClass(ctx, objClient, "csi-hostpath-sc", log)
+		require.NoError(t, err)
+		require.Equal(t, testSnapshotCls, class)
+
+		t.Logf("TEST: GetVolumeSnapshotClass() with empty name - Should use default StorageClass")
+		class, err = GetVolumeSnapshotClass(ctx, objClient, "", log)
+		require.NoError(t, err)
+		require.Equal(t, testSnapshotCls, class)
+
+		t.Logf("TEST: GetVolumeSnapshotClass() with provisioner without snapshots - Should return empty string")
+		class, err = GetVolumeSnapshotClass(ctx, objClient, "local-path", log)
+		require.NoError(t, err)
+		require.Equal(t, "", class)
+
+		t.Logf("TEST: GetVolumeSnapshotClass() with unknown StorageClass - Should return empty string")
+		class, err = GetVolumeSnapshotClass(ctx, objClient, "does-not-exist", log)
+		require.NoError(t, err)
+		require.Equal(t, "", class)
+	})
+}
+
+func TestCopyVolumeSnapshot(t *testing.T) {
+	// Setup logging before anything else so code can log errors.
+	logf.SetLogger(zap.New(zap.UseDevMode(true), zap.WriteTo(os.Stderr)))
+	log := logf.Log.WithName("snapshot-test")
+	ctx := context.Background()
+	scheme := snapshotScheme(t)
+
+	// The owner is a ClusterGKMCache in the Operator, so use any cluster scoped object with
+	// a registered type.
+	owner := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: testCacheName, UID: "1234"},
+	}
+	objClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(owner).Build()
+
+	t.Run("Test copying VolumeSnapshot to another Namespace", func(t *testing.T) {
+		t.Logf("TEST: CreateVolumeSnapshot() of seed PVC - Should Succeed")
+		created, err := CreateVolumeSnapshot(ctx, objClient, scheme, owner,
+			"", testCacheName, testCacheName, testSeedNs, testSnapshotCls, testCacheName, testDigest, log)
+		require.NoError(t, err)
+		require.True(t, created)
+
+		seed := &unstructured.Unstructured{}
+		seed.SetGroupVersionKind(VolumeSnapshotGVK)
+		err = objClient.Get(ctx, types.NamespacedName{Namespace: testSeedNs, Name: testCacheName}, seed)
+		require.NoError(t, err)
+		pvcName, _, _ := unstructured.NestedString(seed.Object, "spec", "source", "persistentVolumeClaimName")
+		require.Equal(t, testCacheName, pvcName)
+		require.Equal(t, testCacheName, seed.GetLabels()[utils.SnapshotLabelCache])
+
+		t.Logf("TEST: CopyVolumeSnapshot() before seed is ready - Should return false")
+		copied, err := CopyVolumeSnapshot(ctx, objClient, scheme, owner,
+			"", testCacheName, testSeedNs, testCacheName, testCacheName, testWorkloadNs, testDigest, log)
+		require.NoError(t, err)
+		require.False(t, copied)
+
+		// Simulate the CSI snapshotter binding the seed VolumeSnapshot.
+		seedContent := &unstructured.Unstructured{}
+		seedContent.SetGroupVersionKind(VolumeSnapshotContentGVK)
+		seedContent.SetName("snapcontent-seed")
+		seedContent.SetUID("5678")
+		seedContent.Object["spec"] = map[string]interface{}{
+			"driver":                  testDriver,
+			"volumeSnapshotClassName": testSnapshotCls,
+		}
+		seedContent.Object["status"] = map[string]interface{}{
+			"snapshotHandle": "handle-1234",
+		}
+		require.NoError(t, objClient.Create(ctx, seedContent))
+		seed.Object["status"] = map[string]interface{}{
+			"readyToUse":                     true,
+			"boundVolumeSnapshotContentName": "snapcontent-seed",
+		}
+		require.NoError(t, objClient.Update(ctx, seed))
+
+		t.Logf("TEST: CopyVolumeSnapshot() after seed is ready - Should return true")
+		copied, err = CopyVolumeSnapshot(ctx, objClient, scheme, owner,
+			"", testCacheName, testSeedNs, testCacheName, testCacheName, testWorkloadNs, testDigest, log)
+		require.NoError(t, err)
+		require.True(t, copied)
+
+		snapshot := &unstructured.Unstructured{}
+		snapshot.SetGroupVersionKind(VolumeSnapshotGVK)
+		err = objClient.Get(ctx, types.NamespacedName{Namespace: testWorkloadNs, Name: testCacheName}, snapshot)
+		require.NoError(t, err)
+		contentName, _, _ := unstructured.NestedString(snapshot.Object, "spec", "source", "volumeSnapshotContentName")
+		require.NotEmpty(t, contentName)
+
+		content := &unstructured.Unstructured{}
+		content.SetGroupVersionKind(VolumeSnapshotContentGVK)
+		err = objClient.Get(ctx, types.NamespacedName{Name: contentName}, content)
+		require.NoError(t, err)
+		handle, _, _ := unstructured.NestedString(content.Object, "spec", "source", "snapshotHandle")
+		require.Equal(t, "handle-1234", handle)
+		policy, _, _ := unstructured.NestedString(content.Object, "spec", "deletionPolicy")
+		require.Equal(t, "Retain", policy)
+		refNs, _, _ := unstructured.NestedString(content.Object, "spec", "volumeSnapshotRef", "namespace")
+		require.Equal(t, testWorkloadNs, refNs)
+
+		t.Logf("TEST: CopyVolumeSnapshot() again, as after a failed status update - Should reuse the objects")
+		copied, err = CopyVolumeSnapshot(ctx, objClient, scheme, owner,
+			"", testCacheName, testSeedNs, testCacheName, testCacheName, testWorkloadNs, testDigest, log)
+		require.NoError(t, err)
+		require.True(t, copied)
+		contents := &unstructured.UnstructuredList{}
+		contents.SetGroupVersionKind(VolumeSnapshotContentGVK)
+		contents.SetKind("VolumeSnapshotContentList")
+		require.NoError(t, objClient.List(ctx, contents))
+		require.Len(t, contents.Items, 2)
+
+		t.Logf("TEST: CopyVolumeSnapshot() with a VolumeSnapshot bound to other content - Should Fail")
+		other := newVolumeSnapshot("", testCacheName, testCacheName, "other-ns", testDigest)
+		other.Object["spec"] = map[string]interface{}{
+			"source": map[string]interface{}{"volumeSnapshotContentName": "other-content"},
+		}
+		require.NoError(t, objClient.Create(ctx, other))
+		_, err = CopyVolumeSnapshot(ctx, objClient, scheme, owner,
+			"", testCacheName, testSeedNs, testCacheName, testCacheName, "other-ns", testDigest, log)
+		require.Error(t, err)
+
+		t.Logf("TEST: IsVolumeSnapshotReady() of the copied VolumeSnapshot before it is bound - Should return false")
+		ready, err := IsVolumeSnapshotReady(ctx, objClient, testWorkloadNs, testCacheName)
+		require.NoError(t, err)
+		require.False(t, ready)
+
+		snapshot.Object["status"] = map[string]interface{}{"readyToUse": true}
+		require.NoError(t, objClient.Update(ctx, snapshot))
+		t.Logf("TEST: IsVolumeSnapshotReady() of the copied VolumeSnapshot once bound - Should return true")
+		ready, err = IsVolumeSnapshotReady(ctx, objClient, testWorkloadNs, testCacheName)
+		require.NoError(t, err)
+		require.True(t, ready)
+
+		t.Logf("TEST: SnapshotDataSource() - Should reference VolumeSnapshot")
+		dataSource := SnapshotDataSource(testCacheName)
+		require.Equal(t, utils.SnapshotGroup, *dataSource.APIGroup)
+		require.Equal(t, "VolumeSnapshot", dataSource.Kind)
+		require.Equal(t, testCacheName, dataSource.Name)
+	})
+}
+
+func TestVolumeSnapshotDigestChange(t *testing.T) {
+	// Setup logging before anything else so code can log errors.
+	logf.SetLogger(zap.New(zap.UseDevMode(true), zap.WriteTo(os.Stderr)))
+	log := logf.Log.WithName("snapshot-test")
+	ctx := context.Background()
+	scheme := snapshotScheme(t)
+
+	newDigest := "sha256:0e2ac2d4b6a1c1e0cf0c1bd94d2d2ae45b0b0e8a5e2c7a4f3d8c1ea4b9c06b12"
+	owner := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: testCacheName, UID: "1234"},
+	}
+	objClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(owner).Build()
+
+	t.Run("Test VolumeSnapshot name", func(t *testing.T) {
+		t.Logf("TEST: VolumeSnapshotName() - Should differ per digest")
+		require.Equal(t, testCacheName+"-bf6f7ea60274", VolumeSnapshotName(testCacheName, testDigest))
+		require.NotEqual(t, VolumeSnapshotName(testCacheName, testDigest), VolumeSnapshotName(testCacheName, newDigest))
+	})
+
+	t.Run("Test existing VolumeSnapshot of another digest", func(t *testing.T) {
+		t.Logf("TEST: CreateVolumeSnapshot() - Should Succeed")
+		created, err := CreateVolumeSnapshot(ctx, objClient, scheme, owner,
+			"", testCacheName, testCacheName, testSeedNs, testSnapshotCls, testCacheName, testDigest, log)
+		require.NoError(t, err)
+		require.True(t, created)
+
+		t.Logf("TEST: CreateVolumeSnapshot() again with the same digest - Should reuse the VolumeSnapshot")
+		created, err = CreateVolumeSnapshot(ctx, objClient, scheme, owner,
+			"", testCacheName, testCacheName, testSeedNs, testSnapshotCls, testCacheName, testDigest, log)
+		require.NoError(t, err)
+		require.True(t, created)
+
+		t.Logf("TEST: CreateVolumeSnapshot() with another digest - Should delete the VolumeSnapshot and return false")
+		created, err = CreateVolumeSnapshot(ctx, objClient, scheme, owner,
+			"", testCacheName, testCacheName, testSeedNs, testSnapshotCls, testCacheName, newDigest, log)
+		require.NoError(t, err)
+		require.False(t, created)
+		snapshot := &unstructured.Unstructured{}
+		snapshot.SetGroupVersionKind(VolumeSnapshotGVK)
+		err = objClient.Get(ctx, types.NamespacedName{Namespace: testSeedNs, Name: testCacheName}, snapshot)
+		require.True(t, apierrors.IsNotFound(err))
+
+		t.Logf("TEST: CreateVolumeSnapshot() once deleted - Should take it of the new digest")
+		created, err = CreateVolumeSnapshot(ctx, objClient, scheme, owner,
+			"", testCacheName, testCacheName, testSeedNs, testSnapshotCls, testCacheName, newDigest, log)
+		require.NoError(t, err)
+		require.True(t, created)
+		require.NoError(t, objClient.Get(ctx, types.NamespacedName{Namespace: testSeedNs, Name: testCacheName}, snapshot))
+		require.True(t, snapshotDigestMatches(snapshot, newDigest))
+
+		t.Logf("TEST: CopyVolumeSnapshot() of a seed of another digest - Should Fail")
+		_, err = CopyVolumeSnapshot(ctx, objClient, scheme, owner,
+			"", testCacheName, testSeedNs, testCacheName, testCacheName, testWorkloadNs, testDigest, log)
+		require.Error(t, err)
+
+		t.Logf("TEST: CopyVolumeSnapshot() over a copy of another digest - Should delete the copy and return false")
+		stale := newVolumeSnapshot("", testCacheName, testCacheName, testWorkloadNs, testDigest)
+		require.NoError(t, objClient.Create(ctx, stale))
+		snapshot.Object["status"] = map[string]interface{}{
+			"readyToUse":                     true,
+			"boundVolumeSnapshotContentName": "snapcontent-seed",
+		}
+		require.NoError(t, objClient.Update(ctx, snapshot))
+		seedContent := &unstructured.Unstructured{}
+		seedContent.SetGroupVersionKind(VolumeSnapshotContentGVK)
+		seedContent.SetName("snapcontent-seed")
+		seedContent.Object["spec"] = map[string]interface{}{"driver": testDriver}
+		seedContent.Object["status"] = map[string]interface{}{"snapshotHandle": "handle-5678"}
+		require.NoError(t, objClient.Create(ctx, seedContent))
+		copied, err := CopyVolumeSnapshot(ctx, objClient, scheme, owner,
+			"", testCacheName, testSeedNs, testCacheName, testCacheName, testWorkloadNs, newDigest, log)
+		require.NoError(t, err)
+		require.False(t, copied)
+		err = objClient.Get(ctx, types.NamespacedName{Namespace: testWorkloadNs, Name: testCacheName}, stale)
+		require.True(t, apierrors.IsNotFound(err))
+
+		t.Logf("TEST: CopyVolumeSnapshot() once the copy is deleted - Should return true")
+		copied, err = CopyVolumeSnapshot(ctx, objClient, scheme, owner,
+			"", testCacheName, testSeedNs, testCacheName, testCacheName, testWorkloadNs, newDigest, log)
+		require.NoError(t, err)
+		require.True(t, copied)
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	gcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/redhat-et/GKM/mcv/pkg/registries"
 	"github.com/sigstore/cosign/v3/pkg/cosign"
 	ociremote "github.com/sigstore/cosign/v3/pkg/oci/remote"
 	rekorclient "github.com/sigstore/rekor/pkg/generated/client"
@@ -35,17 +36,31 @@ func init() {
 // 1. New bundle format (cosign v3 with --new-bundle-format)
 // 2. Legacy .sig tag format (cosign v2)
 // 3. OCI 1.1 Referrers API (experimental)
+// The registry is reached with its CA certificates and insecure setting in registriesCfg, and
+// the credentials in keychain. The signatures are stored with the image in its registry, so
+// the mirrors are not used.
 // Returns the verified digest and nil error on success.
-func VerifyImageSignature(ctx context.Context, imageRef string) (string, error) {
+func VerifyImageSignature(ctx context.Context, imageRef string, registriesCfg registries.Config, keychain authn.Keychain) (string, error) {
 	ref, err := name.ParseReference(imageRef)
 	if err != nil {
 		return "", fmt.Errorf("parse image reference: %w", err)
 	}
 
+	sources, err := registriesCfg.Sources(ref)
+	if err != nil {
+		return "", err
+	}
+	registry := sources[len(sources)-1]
+	ref = registry.Ref
+	remoteOpts, err := registriesCfg.Options(registry)
+	if err != nil {
+		return "", err
+	}
+
 	regOpts := []ociremote.Option{
-		ociremote.WithRemoteOptions(
-			gcrremote.WithAuthFromKeychain(authn.DefaultKeychain),
-		),
+		ociremote.WithRemoteOptions(append([]gcrremote.Option{
+			gcrremote.WithAuthFromKeychain(keychain),
+		}, remoteOpts...)...),
 	}
 
 	rc := rekorclient.NewHTTPClientWithConfig(nil,
@@ -3,6 +3,8 @@ package cosign
 import (
 	"context"
 	"testing"
+
+	"github.com/redhat-et/GKM/mcv/pkg/registries"
 )
 
 func TestVerifyImageSignature(t *testing.T) {
@@ -35,7 +37,7 @@ func TestVerifyImageSignature(t *testing.T) {
 			ctx, cancel := context.WithTimeout(context.Background(), DefaultVerificationTimeout)
 			defer cancel()
 
-			digest, err := VerifyImageSignature(ctx, tt.imageRef)
+			digest, err := VerifyImageSignature(ctx, tt.imageRef, registries.Config{}, registries.Keychain(""))
 			if (err != nil) != tt.wantError {
 				t.Logf("Full error details: %+v", err)
 				t.Errorf("VerifyImageSignature() error = %v, wantError %v", err, tt.wantError)
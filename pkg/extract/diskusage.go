@@ -0,0 +1,54 @@
+package extract
+
+import (
+	"io/fs"
+	"path/filepath"
+	"syscall"
+)
+
+// DiskUsage returns the number of bytes the files and directories under dir use on disk, as
+// allocated by the filesystem rather than their apparent size. Files hard linked more than once
+// under dir are only counted once.
+func DiskUsage(dir string) (int64, error) {
+	type inode struct {
+		dev uint64
+		ino uint64
+	}
+	seen := make(map[inode]bool)
+
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			size += info.Size()
+			return nil
+		}
+		if stat.Nlink > 1 && !d.IsDir() {
+			key := inode{dev: uint64(stat.Dev), ino: stat.Ino}
+			if seen[key] {
+				return nil
+			}
+			seen[key] = true
+		}
+		size += stat.Blocks * 512
+		return nil
+	})
+	return size, err
+}
+
+// FilesystemUsage returns the size of the filesystem holding path, and the number of bytes
+// still available on it to unprivileged users, in bytes.
+func FilesystemUsage(path string) (capacity, available int64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+	return int64(stat.Blocks) * stat.Bsize, int64(stat.Bavail) * stat.Bsize, nil
+}
@@ -0,0 +1,41 @@
+package extract
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskUsage(t *testing.T) {
+	t.Run("Test disk usage of a cache directory", func(t *testing.T) {
+		cacheDir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(cacheDir, "abc"), 0755))
+		kernel := filepath.Join(cacheDir, "abc", "kernel.hsaco")
+		require.NoError(t, os.WriteFile(kernel, make([]byte, 64<<10), 0644))
+
+		t.Logf("TEST: DiskUsage() - Should count the blocks of the files and directories")
+		used, err := DiskUsage(cacheDir)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, used, int64(64<<10))
+
+		t.Logf("TEST: DiskUsage() with a hard link - Should count the linked file once")
+		require.NoError(t, os.Link(kernel, filepath.Join(cacheDir, "abc", "kernel-link.hsaco")))
+		linked, err := DiskUsage(cacheDir)
+		require.NoError(t, err)
+		require.Less(t, linked, used+int64(64<<10))
+
+		t.Logf("TEST: DiskUsage() of a missing directory - Should return an error")
+		_, err = DiskUsage(filepath.Join(cacheDir, "missing"))
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("Test filesystem usage", func(t *testing.T) {
+		t.Logf("TEST: FilesystemUsage() - Should report the capacity and free space")
+		capacity, available, err := FilesystemUsage(t.TempDir())
+		require.NoError(t, err)
+		require.Positive(t, capacity)
+		require.LessOrEqual(t, available, capacity)
+	})
+}
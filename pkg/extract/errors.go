@@ -0,0 +1,200 @@
+package extract
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	mcvCache "github.com/redhat-et/GKM/mcv/pkg/cache"
+)
+
+// FailureReason is the class of an extraction failure. It is used as the exit code of
+// gkm-extract, and as the Reason of the Error condition on the PVC Status.
+type FailureReason string
+
+const (
+	// FailureUnknown is any failure that does not fit one of the other classes.
+	FailureUnknown FailureReason = "ExtractFailed"
+
+	// FailureAuth indicates the registry rejected the credentials, or no credentials
+	// were provided for a private image.
+	FailureAuth FailureReason = "AuthFailed"
+
+	// FailureNotFound indicates the image or one of its layers does not exist in the
+	// registry.
+	FailureNotFound FailureReason = "ImageNotFound"
+
+	// FailureNetwork indicates the registry could not be reached, or returned an error
+	// that is expected to go away, like rate limiting or a server error.
+	FailureNetwork FailureReason = "NetworkError"
+
+	// FailureIncompatibleGPU indicates the GPU Kernel Cache was not built for any of the
+	// GPUs on the Node.
+	FailureIncompatibleGPU FailureReason = "IncompatibleGPU"
+
+	// FailureSizeMismatch indicates the number of bytes extracted does not match the size
+	// recorded in the OCI Image labels.
+	FailureSizeMismatch FailureReason = "SizeMismatch"
+
+	// FailureDiskFull indicates the Node ran out of space while extracting.
+	FailureDiskFull FailureReason = "DiskFull"
+
+	// FailureIntegrity indicates the extracted files do not match the integrity manifest in
+	// the OCI Image.
+	FailureIntegrity FailureReason = "IntegrityMismatch"
+
+	// FailureUnsafeImage indicates a layer of the OCI Image was rejected, because an entry
+	// would be written outside of the cache directory, is a device or FIFO, or exceeds the
+	// extraction limits.
+	FailureUnsafeImage FailureReason = "UnsafeImage"
+)
+
+// Exit codes of gkm-extract for each FailureReason. 1 is left for unclassified failures,
+// which includes failures before extraction starts, like missing environment variables.
+var failureExitCodes = map[FailureReason]int{
+	FailureUnknown:         1,
+	FailureAuth:            10,
+	FailureNotFound:        11,
+	FailureNetwork:         12,
+	FailureIncompatibleGPU: 13,
+	FailureSizeMismatch:    14,
+	FailureDiskFull:        15,
+	FailureIntegrity:       16,
+	FailureUnsafeImage:     17,
+}
+
+// ExitCode returns the gkm-extract exit code for the FailureReason.
+func (r FailureReason) ExitCode() int {
+	if code, ok := failureExitCodes[r]; ok {
+		return code
+	}
+	return failureExitCodes[FailureUnknown]
+}
+
+// Transient returns true if retrying the extraction may succeed without any change to the
+// GKMCache or ClusterGKMCache. Failures that need a change by the user, like fixing the
+// image name or credentials, are permanent.
+func (r FailureReason) Transient() bool {
+	switch r {
+	case FailureNetwork, FailureDiskFull, FailureUnknown:
+		return true
+	default:
+		return false
+	}
+}
+
+// FailureReasonFromExitCode maps a gkm-extract exit code back to a FailureReason.
+func FailureReasonFromExitCode(exitCode int32) FailureReason {
+	for reason, code := range failureExitCodes {
+		if int32(code) == exitCode {
+			return reason
+		}
+	}
+	return FailureUnknown
+}
+
+// ClassifyError determines the FailureReason of an error returned by ExtractCache. MCV
+// does not always wrap the underlying error, so when the error chain does not identify
+// the failure, the error message is matched instead.
+func ClassifyError(err error) FailureReason {
+	if err == nil {
+		return ""
+	}
+
+	if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EDQUOT) {
+		return FailureDiskFull
+	}
+
+	var integrityErr *IntegrityError
+	if errors.As(err, &integrityErr) {
+		return FailureIntegrity
+	}
+
+	if errors.Is(err, mcvCache.ErrExceedsSizeLabel) {
+		return FailureSizeMismatch
+	}
+	var archiveErr *mcvCache.ArchiveError
+	if errors.As(err, &archiveErr) {
+		return FailureUnsafeImage
+	}
+
+	var transportErr *transport.Error
+	if errors.As(err, &transportErr) {
+		switch transportErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return FailureAuth
+		case http.StatusNotFound:
+			return FailureNotFound
+		case http.StatusTooManyRequests:
+			return FailureNetwork
+		}
+		for _, diag := range transportErr.Errors {
+			switch diag.Code {
+			case transport.UnauthorizedErrorCode, transport.DeniedErrorCode:
+				return FailureAuth
+			case transport.ManifestUnknownErrorCode, transport.NameUnknownErrorCode,
+				transport.BlobUnknownErrorCode:
+				return FailureNotFound
+			case transport.TooManyRequestsErrorCode, transport.UnavailableErrorCode:
+				return FailureNetwork
+			}
+		}
+		if transportErr.StatusCode >= http.StatusInternalServerError {
+			return FailureNetwork
+		}
+	}
+
+	var netErr net.Error
+	var urlErr *url.Error
+	if errors.As(err, &netErr) || errors.As(err, &urlErr) {
+		return FailureNetwork
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, class := range failureMessages {
+		for _, substr := range class.substrings {
+			if strings.Contains(msg, substr) {
+				return class.reason
+			}
+		}
+	}
+	return FailureUnknown
+}
+
+// failureMessages are checked in order. The size checks come before not found, because a
+// missing size label is reported as "not found".
+var failureMessages = []struct {
+	reason     FailureReason
+	substrings []string
+}{
+	{FailureDiskFull, []string{"no space left on device", "disk quota exceeded"}},
+	{FailureSizeMismatch, []string{
+		"cache size mismatch",
+		"no cache bytes extracted",
+		"cache size label",
+		"larger than its cache-size-bytes label",
+	}},
+	{FailureIntegrity, []string{"integrity check failed"}},
+	{FailureUnsafeImage, []string{"rejected archive entry"}},
+	{FailureIncompatibleGPU, []string{
+		"no compatible gpu",
+		"incompatibility detected",
+		"does not match any available gpu",
+	}},
+	{FailureAuth, []string{"unauthorized", "authentication required", "denied", "403 forbidden"}},
+	{FailureNotFound, []string{"manifest unknown", "name unknown", "blob unknown", "404 not found"}},
+	{FailureNetwork, []string{
+		"connection refused",
+		"connection reset",
+		"no such host",
+		"i/o timeout",
+		"tls handshake timeout",
+		"too many requests",
+		"service unavailable",
+		"unexpected eof",
+	}},
+}
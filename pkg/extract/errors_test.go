@@ -0,0 +1,142 @@
+package extract
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/stretchr/testify/require"
+
+	mcvCache "github.com/redhat-et/GKM/mcv/pkg/cache"
+)
+
+func TestClassifyError(t *testing.T) {
+	t.Run("Test extraction failure classification", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			err    error
+			reason FailureReason
+		}{
+			{
+				name:   "nil error",
+				err:    nil,
+				reason: "",
+			},
+			{
+				name: "disk full while writing",
+				err: fmt.Errorf("could not extract triton Kernel Cache: %w",
+					&fs.PathError{Op: "write", Path: "/kernel-caches/x", Err: syscall.ENOSPC}),
+				reason: FailureDiskFull,
+			},
+			{
+				name:   "registry unauthorized",
+				err:    fmt.Errorf("failed to fetch image: %w", &transport.Error{StatusCode: http.StatusUnauthorized}),
+				reason: FailureAuth,
+			},
+			{
+				name: "registry manifest unknown",
+				err: fmt.Errorf("failed to fetch image: %w", &transport.Error{
+					StatusCode: http.StatusNotFound,
+					Errors:     []transport.Diagnostic{{Code: transport.ManifestUnknownErrorCode}},
+				}),
+				reason: FailureNotFound,
+			},
+			{
+				name:   "registry server error",
+				err:    fmt.Errorf("failed to fetch image: %w", &transport.Error{StatusCode: http.StatusBadGateway}),
+				reason: FailureNetwork,
+			},
+			{
+				name:   "dial error",
+				err:    fmt.Errorf("failed to fetch image: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}),
+				reason: FailureNetwork,
+			},
+			{
+				name:   "unwrapped layer fetch error",
+				err:    errors.New("could not get layer content: GET https://quay.io/v2/x/blobs/sha256:1: i/o timeout"),
+				reason: FailureNetwork,
+			},
+			{
+				name:   "unwrapped auth error",
+				err:    errors.New("could not fetch layers: GET https://quay.io/v2/x: UNAUTHORIZED: access to the requested resource is not authorized"),
+				reason: FailureAuth,
+			},
+			{
+				name:   "no compatible GPU",
+				err:    errors.New("preflight check failed: no compatible GPU found from summary preflight check"),
+				reason: FailureIncompatibleGPU,
+			},
+			{
+				name:   "size mismatch",
+				err:    errors.New("cache size mismatch: expected 100 bytes, extracted 90 bytes (diff: -10)"),
+				reason: FailureSizeMismatch,
+			},
+			{
+				name:   "missing size label",
+				err:    errors.New("cache size label cache.triton.image/cache-size-bytes not found"),
+				reason: FailureSizeMismatch,
+			},
+			{
+				name:   "integrity mismatch in MCV",
+				err:    errors.New("integrity check failed: 1 file(s) do not match the integrity manifest: abc/kernel.json (modified)"),
+				reason: FailureIntegrity,
+			},
+			{
+				name:   "integrity mismatch in GKM",
+				err:    &IntegrityError{},
+				reason: FailureIntegrity,
+			},
+			{
+				name:   "path traversal in a layer",
+				err:    fmt.Errorf("could not extract triton Kernel Cache: %w", &mcvCache.ArchiveError{Name: "io.triton.cache/../x", Err: mcvCache.ErrPathTraversal}),
+				reason: FailureUnsafeImage,
+			},
+			{
+				name:   "unwrapped path traversal in a layer",
+				err:    errors.New(`could not extract triton Kernel Cache: rejected archive entry "io.triton.cache/../x": path escapes the extraction directory`),
+				reason: FailureUnsafeImage,
+			},
+			{
+				name: "cache larger than its label",
+				err: &mcvCache.ArchiveError{Name: "io.triton.cache/abc/kernel.hsaco",
+					Err: fmt.Errorf("%w (100 bytes)", mcvCache.ErrExceedsSizeLabel)},
+				reason: FailureSizeMismatch,
+			},
+			{
+				name:   "unknown",
+				err:    errors.New("image has no labels"),
+				reason: FailureUnknown,
+			},
+		}
+
+		for _, tc := range tests {
+			t.Logf("TEST: ClassifyError() %s - Should return %q", tc.name, tc.reason)
+			require.Equal(t, tc.reason, ClassifyError(tc.err))
+		}
+	})
+
+	t.Run("Test extraction failure exit codes", func(t *testing.T) {
+		t.Logf("TEST: FailureReasonFromExitCode(ExitCode()) - Should round trip every reason")
+		for reason := range failureExitCodes {
+			require.Equal(t, reason, FailureReasonFromExitCode(int32(reason.ExitCode())))
+		}
+
+		t.Logf("TEST: FailureReasonFromExitCode() of an unknown code - Should return FailureUnknown")
+		require.Equal(t, FailureUnknown, FailureReasonFromExitCode(137))
+
+		t.Logf("TEST: Transient() - Should only retry failures that may go away")
+		require.True(t, FailureNetwork.Transient())
+		require.True(t, FailureDiskFull.Transient())
+		require.False(t, FailureAuth.Transient())
+		require.False(t, FailureNotFound.Transient())
+		require.False(t, FailureIncompatibleGPU.Transient())
+		require.False(t, FailureSizeMismatch.Transient())
+		require.False(t, FailureIntegrity.Transient())
+		require.False(t, FailureUnsafeImage.Transient())
+	})
+}
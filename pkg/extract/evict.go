@@ -0,0 +1,85 @@
+package extract
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/go-logr/logr"
+)
+
+// ErrCacheInUse is returned by EvictCache when the cache was found in use after it was fenced,
+// and was put back in place, and by ExtractCache when a cache in use can not be replaced at once.
+var ErrCacheInUse = errors.New("cache in use")
+
+// EvictCache removes the GPU Kernel Cache extracted from imageURL in cacheDir, to free disk
+// space on the Node, and returns the number of bytes freed. Nothing is done if cacheDir holds
+// an extraction of a different image or no extraction at all. If an extraction into cacheDir is
+// running, ErrExtractInProgress is returned.
+//
+// cacheDir backs the hostPath PVs of the cache, which require the directory to exist, so it is
+// first renamed beside itself. From then on a pod that starts mounting one of the PVs waits
+// until the next ExtractCache puts a complete extraction back in place. inUse, if set, is then
+// called to check no pod started using the cache before the rename; if one did, cacheDir is
+// renamed back and ErrCacheInUse is returned. Otherwise the renamed directory is removed.
+func EvictCache(cacheDir, imageURL string, inUse func() bool, log logr.Logger) (int64, error) {
+	cacheDir = filepath.Clean(cacheDir)
+	if _, err := os.Stat(cacheDir); errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+
+	lf, err := lockCacheDir(cacheDir, syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = lf.Close() }()
+
+	data, err := os.ReadFile(filepath.Join(cacheDir, InitFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if strings.TrimSpace(string(data)) != imageURL {
+		log.Info("cache extracted from a different image, not evicted",
+			"existing", strings.TrimSpace(string(data)), "imageURL", imageURL)
+		return 0, nil
+	}
+
+	size, _ := DirectorySize(cacheDir)
+
+	// The trash directory is named like those of swapEntries, so if the eviction is interrupted
+	// it is removed as a leftover by the next extraction.
+	trashDir, err := os.MkdirTemp(filepath.Dir(cacheDir), TrashDirPrefix+filepath.Base(cacheDir)+"-")
+	if err != nil {
+		return 0, err
+	}
+	// Only the unique name is kept, a directory cannot be renamed onto an existing one.
+	if err := os.Remove(trashDir); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(cacheDir, trashDir); err != nil {
+		return 0, fmt.Errorf("unable to fence %s: %w", cacheDir, err)
+	}
+	if err := syncPath(filepath.Dir(cacheDir)); err != nil {
+		log.Info("unable to sync parent of cache directory", "err", err)
+	}
+
+	if inUse != nil && inUse() {
+		if err := os.Rename(trashDir, cacheDir); err != nil {
+			return 0, fmt.Errorf("unable to restore %s: %w", cacheDir, err)
+		}
+		log.Info("cache used while evicted, restored", "imageURL", imageURL, "cacheDir", cacheDir)
+		return 0, ErrCacheInUse
+	}
+
+	if err := os.RemoveAll(trashDir); err != nil {
+		log.Info("unable to remove evicted cache", "dir", trashDir, "err", err)
+	}
+	log.Info("Cache Evicted", "imageURL", imageURL, "cacheDir", cacheDir, "bytes", size)
+	return size, nil
+}
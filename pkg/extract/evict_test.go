@@ -0,0 +1,148 @@
+package extract
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvictCache(t *testing.T) {
+	saved := mcvExtract
+	defer func() { mcvExtract = saved }()
+
+	files := map[string]string{"abc/kernel.json": "a1", "abc/kernel.hsaco": "binary"}
+
+	t.Run("Test eviction of an extracted cache", func(t *testing.T) {
+		cacheDir := t.TempDir()
+		mcvExtract = fakeExtract(files, nil)
+		_, err := ExtractCache(cacheDir, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+
+		t.Logf("TEST: EvictCache() of another image - Should leave the cache extracted")
+		freed, err := EvictCache(cacheDir, testImageURL2, nil, logr.Discard())
+		require.NoError(t, err)
+		require.Zero(t, freed)
+		require.Equal(t, files, readTree(t, cacheDir))
+
+		t.Logf("TEST: EvictCache() while an extraction is running - Should return ErrExtractInProgress")
+		lf, err := lockCacheDir(cacheDir, syscall.LOCK_EX)
+		require.NoError(t, err)
+		_, err = EvictCache(cacheDir, testImageURL, nil, logr.Discard())
+		require.ErrorIs(t, err, ErrExtractInProgress)
+		require.NoError(t, lf.Close())
+
+		t.Logf("TEST: EvictCache() - Should remove the cache and its directory")
+		freed, err = EvictCache(cacheDir, testImageURL, nil, logr.Discard())
+		require.NoError(t, err)
+		require.Greater(t, freed, int64(len("a1")+len("binary")))
+		_, err = os.Stat(cacheDir)
+		require.True(t, os.IsNotExist(err))
+		entries, err := os.ReadDir(filepath.Dir(cacheDir))
+		require.NoError(t, err)
+		require.Empty(t, entries)
+
+		t.Logf("TEST: EvictCache() of an evicted cache - Should be a no-op")
+		freed, err = EvictCache(cacheDir, testImageURL, nil, logr.Discard())
+		require.NoError(t, err)
+		require.Zero(t, freed)
+
+		t.Logf("TEST: ExtractCache() after EvictCache() - Should extract the cache again")
+		_, err = ExtractCache(cacheDir, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+		require.Equal(t, files, readTree(t, cacheDir))
+	})
+
+	t.Run("Test eviction of a cache used while it is fenced", func(t *testing.T) {
+		cacheDir := filepath.Join(t.TempDir(), "cache")
+		mcvExtract = fakeExtract(files, nil)
+		_, err := ExtractCache(cacheDir, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+
+		t.Logf("TEST: EvictCache() - Should fence the directory before checking usage")
+		var fenced bool
+		inUse := func() bool {
+			_, err := os.Stat(cacheDir)
+			fenced = os.IsNotExist(err)
+			return true
+		}
+		freed, err := EvictCache(cacheDir, testImageURL, inUse, logr.Discard())
+		require.ErrorIs(t, err, ErrCacheInUse)
+		require.Zero(t, freed)
+		require.True(t, fenced)
+
+		t.Logf("TEST: EvictCache() of a used cache - Should put the cache back in place")
+		require.Equal(t, files, readTree(t, cacheDir))
+		entries, err := os.ReadDir(filepath.Dir(cacheDir))
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+	})
+
+	t.Run("Test extraction of an evicted cache", func(t *testing.T) {
+		parent := t.TempDir()
+		cacheDir := filepath.Join(parent, "cache")
+		running := filepath.Join(parent, StagingDirPrefix+"cache-running")
+		require.NoError(t, os.Mkdir(running, 0755))
+		lf, err := lockCacheDir(running, syscall.LOCK_EX)
+		require.NoError(t, err)
+		defer func() { _ = lf.Close() }()
+		require.NoError(t, os.Mkdir(filepath.Join(parent, TrashDirPrefix+"cache-1"), 0755))
+
+		t.Logf("TEST: ExtractCache() - Should not create the directory before the cache is extracted")
+		var created bool
+		mcvExtract = func(imageURL, dir, reuseDir string, enableGPU bool) ([]int, []int, error) {
+			_, err := os.Stat(cacheDir)
+			created = err == nil
+			return fakeExtract(files, nil)(imageURL, dir, reuseDir, enableGPU)
+		}
+		_, err = ExtractCache(cacheDir, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+		require.False(t, created)
+		require.Equal(t, files, readTree(t, cacheDir))
+
+		t.Logf("TEST: ExtractCache() - Should remove leftovers but keep a locked staging directory")
+		entries, err := os.ReadDir(parent)
+		require.NoError(t, err)
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		require.ElementsMatch(t, []string{"cache", StagingDirPrefix + "cache-running"}, names)
+	})
+
+	t.Run("Test extraction into a directory created meanwhile", func(t *testing.T) {
+		parent := t.TempDir()
+		cacheDir := filepath.Join(parent, "cache")
+		other := map[string]string{"abc/kernel.json": "old"}
+
+		t.Logf("TEST: ExtractCache() - Should replace the cache extracted meanwhile")
+		mcvExtract = func(imageURL, dir, reuseDir string, enableGPU bool) ([]int, []int, error) {
+			saved := mcvExtract
+			mcvExtract = fakeExtract(other, nil)
+			_, err := ExtractCache(cacheDir, testImageURL2, true, nil, logr.Discard())
+			mcvExtract = saved
+			require.NoError(t, err)
+			return fakeExtract(files, nil)(imageURL, dir, reuseDir, enableGPU)
+		}
+		_, err := ExtractCache(cacheDir, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+		require.Equal(t, files, readTree(t, cacheDir))
+		entries, err := os.ReadDir(parent)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+	})
+
+	t.Run("Test eviction of a missing directory", func(t *testing.T) {
+		cacheDir := filepath.Join(t.TempDir(), "missing")
+
+		t.Logf("TEST: EvictCache() - Should be a no-op and not create the directory")
+		freed, err := EvictCache(cacheDir, testImageURL, nil, logr.Discard())
+		require.NoError(t, err)
+		require.Zero(t, freed)
+		_, err = os.Stat(cacheDir)
+		require.True(t, os.IsNotExist(err))
+	})
+}
@@ -0,0 +1,560 @@
+// Package extract contains the logic to extract a GPU Kernel Cache from an OCI
+// Image into a directory on the node, and to verify a previously extracted cache.
+// It is used by the gkm-extract Job and by the GKM Agent when the Agent is
+// configured to extract in-process.
+package extract
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+	mcvClient "github.com/redhat-et/GKM/mcv/pkg/client"
+	"github.com/redhat-et/GKM/mcv/pkg/registries"
+)
+
+const (
+	// InitFileName is written to the root of the cache directory after a successful
+	// extraction and contains the image URL that was extracted.
+	InitFileName = ".initialized"
+
+	// LockFileName is used to serialize extractions into the same cache directory.
+	LockFileName = ".extract.lock"
+
+	// LayerCacheDirName is the cache of the image layers MCV pulls, in the root of the host
+	// cache directory, when extracting in the GKM Agent.
+	LayerCacheDirName = ".layers"
+)
+
+// MCV keeps the extraction directory, GPU settings and its temporary build
+// directories in package level state, so only one extraction can be run
+// through MCV at a time within a process.
+var mcvMutex sync.Mutex
+
+// configMutex guards the settings below, shared by the extractions and preflight checks of the
+// process. Each call copies them, and passes them to MCV as options of the call, so a preflight
+// check does not wait for an extraction.
+var configMutex sync.RWMutex
+
+// The cache of image layers MCV keeps, so an image is not pulled again for the next extraction.
+// An empty directory is the MCV default, a negative size disables it. Set with SetLayerCache.
+var (
+	layerCacheDir      string
+	layerCacheMaxBytes int64
+)
+
+// SetLayerCache sets the directory and size of the cache of image layers used by the
+// extractions of this process. A maxBytes of 0 is the MCV default, negative disables the cache.
+func SetLayerCache(dir string, maxBytes int64) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	layerCacheDir = dir
+	layerCacheMaxBytes = maxBytes
+}
+
+// layerPeers returns the layer servers of other Nodes that may hold the layers of the image
+// with the digest. Set with SetLayerPeers.
+var layerPeers func(digest string) []string
+
+// SetLayerPeers sets the function returning the base URLs of the layer servers of other Nodes
+// that may hold the layers of the image with a digest. MCV fetches the layers missing from its
+// layer cache from them first, checking their digest, and from the registry otherwise.
+func SetLayerPeers(peers func(digest string) []string) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	layerPeers = peers
+}
+
+// registriesConfig is the registries configuration images are pulled with. Set with
+// SetRegistries.
+var registriesConfig registries.Config
+
+// SetRegistries sets the registries configuration the extractions of this process pull images
+// with: the registry mirrors, insecure and blocked registries, and CA certificates. The zero
+// Config uses the registries.conf of the host.
+func SetRegistries(cfg registries.Config) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	registriesConfig = cfg
+}
+
+// criSocket is the socket of the container runtime of the Node images are read from. Set with
+// SetCRISocket.
+var criSocket string
+
+// SetCRISocket sets the socket of the container runtime of the Node, so the images it has
+// already pulled are read from its content store instead of being pulled again. An empty
+// socket is the MCV default, "none" disables it.
+func SetCRISocket(socket string) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	criSocket = socket
+}
+
+// registryAuth returns the registry credentials to pull an image with. Set with
+// SetRegistryAuth.
+var registryAuth func(imageURL string) []byte
+
+// SetRegistryAuth sets the function returning the registry credentials to pull an image with,
+// as a Docker config.json, or nil to use the default credentials of the process only.
+func SetRegistryAuth(auth func(imageURL string) []byte) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	registryAuth = auth
+}
+
+// writeAuthFile writes the registry credentials in auth to a temporary file only readable by
+// the process, for MCV to read. It returns the path of the file, empty if auth is nil, and a
+// function removing the file.
+func writeAuthFile(auth []byte) (string, func(), error) {
+	if auth == nil {
+		return "", func() {}, nil
+	}
+	file, err := os.CreateTemp("", "gkm-auth-*.json")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to write registry credentials: %w", err)
+	}
+	remove := func() { _ = os.Remove(file.Name()) }
+	_, err = file.Write(auth)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		remove()
+		return "", nil, fmt.Errorf("failed to write registry credentials: %w", err)
+	}
+	return file.Name(), remove, nil
+}
+
+// sharedLayers returns the layer cache size and layer peers of a pull with the registry
+// credentials in auth. The layer cache and the layer peers serve an image by digest to anyone,
+// the layer cache also to the other Nodes through the layer server, so an image pulled with
+// credentials is neither read from them nor added to the layer cache. Only the registry
+// decides who can pull a private image.
+func sharedLayers(auth []byte, cacheBytes int64, peers []string) (int64, []string) {
+	if auth != nil {
+		return -1, nil
+	}
+	return cacheBytes, peers
+}
+
+// fetchOptions returns the MCV options to fetch imageURL with the settings of the process and
+// the registry credentials in auth, and a function removing the credentials file written for
+// MCV.
+func fetchOptions(imageURL string, auth []byte, peers []string) (mcvClient.Options, func(), error) {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	authFile, removeAuthFile, err := writeAuthFile(auth)
+	if err != nil {
+		return mcvClient.Options{}, nil, err
+	}
+	layerCacheBytes, peers := sharedLayers(auth, layerCacheMaxBytes, peers)
+	return mcvClient.Options{
+		ImageName: imageURL,
+
+		LayerCacheDir:      layerCacheDir,
+		LayerCacheMaxBytes: layerCacheBytes,
+		LayerPeers:         peers,
+		CRISocket:          criSocket,
+
+		RegistriesConf:   registriesConfig.ConfPath,
+		RegistryCertsDir: registriesConfig.CertsDir,
+		RegistryCABundle: registriesConfig.CABundle,
+		RegistryAuthFile: authFile,
+	}, removeAuthFile, nil
+}
+
+// PreflightCheck returns the GPUs of the Node compatible and incompatible with the GPU Kernel
+// Cache in imageURL, from its labels. The image is pulled with the registries configuration and
+// layer cache of the extractions, and the registry credentials in registryAuth, a Docker
+// config.json, in addition to the default ones. Images pulled with registryAuth skip the layer
+// cache, see sharedLayers. It does not wait for the extractions running in the process.
+func PreflightCheck(imageURL string, registryAuth []byte) ([]int, []int, error) {
+	opts, removeAuthFile, err := fetchOptions(imageURL, registryAuth, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer removeAuthFile()
+	return mcvClient.PreflightCheckImage(opts)
+}
+
+// mcvExtract extracts imageURL into dir through MCV, reusing the unchanged files of the earlier
+// extraction in reuseDir if it is set. Replaced in tests.
+var mcvExtract = func(imageURL, dir, reuseDir string, enableGPU bool) ([]int, []int, error) {
+	configMutex.RLock()
+	peersFn, authFn := layerPeers, registryAuth
+	configMutex.RUnlock()
+	var peers []string
+	if peersFn != nil {
+		peers = peersFn(digestFromImageURL(imageURL))
+	}
+	var auth []byte
+	if authFn != nil {
+		auth = authFn(imageURL)
+	}
+	opts, removeAuthFile, err := fetchOptions(imageURL, auth, peers)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer removeAuthFile()
+	opts.CacheDir = dir
+	opts.EnableGPU = &enableGPU
+	opts.LogLevel = "info"
+	opts.IntegrityFile = filepath.Join(dir, IntegrityFileName)
+	opts.ReuseDir = reuseDir
+
+	mcvMutex.Lock()
+	defer mcvMutex.Unlock()
+	return mcvClient.ExtractCache(opts)
+}
+
+// ExtractCache extracts the GPU Kernel Cache in imageURL into cacheDir. If cacheDir
+// already contains an extraction of imageURL, nothing is done and the Result of that
+// extraction is returned. On success, the Result holds the list of compatible and
+// incompatible GPU Ids reported by MCV and the size of the extracted cache.
+//
+// The cache is extracted into a staging directory beside cacheDir and synced to storage
+// before the two are exchanged, so cacheDir never holds a partial extraction. If cacheDir
+// contains an extraction of a different image, it stays in place until the new one is
+// complete. Leftovers of an interrupted extraction are removed on the next call. See
+// createStagingDir for a cacheDir that is a mount point, and extractNewDir for a cacheDir that
+// does not exist.
+//
+// When the cache of an earlier digest of the same image is on the Node, either in cacheDir or,
+// for a per-digest cacheDir, in another per-digest directory, the files that did not change are
+// hard linked from it instead of being written again. The Result reports the bytes reused.
+//
+// inUse, if set, reports whether pods use the cache in cacheDir. It is called before replacing
+// an earlier extraction, see swapIntoPlace. Without it, the earlier extraction is replaced
+// whether used or not.
+//
+// MCV keeps the state of an extraction in package level variables, so the download and
+// extraction through MCV, the bulk of the call, run one at a time in a process. Concurrent
+// calls, for different cacheDirs, wait for each other.
+func ExtractCache(cacheDir, imageURL string, noGpu bool, inUse func() bool, log logr.Logger) (*Result, error) {
+	log.Info("extracting cache", "imageURL", imageURL, "cacheDir", cacheDir, "noGpu", noGpu)
+	start := time.Now()
+
+	cacheDir = filepath.Clean(cacheDir)
+	if _, err := os.Stat(cacheDir); errors.Is(err, fs.ErrNotExist) {
+		return extractNewDir(cacheDir, imageURL, noGpu, inUse, start, log)
+	}
+
+	if err := os.Chown(cacheDir, 1000, 1000); err != nil {
+		log.Info("unable to chown", "err", err)
+	}
+
+	/*
+		if err := os.Chmod(cacheDir, 0755); err != nil {
+			log.Info("unable to chmod", "err", err)
+		}
+	*/
+
+	// Acquire an exclusive file lock for this cacheDir to prevent concurrent
+	// extractions from multiple controller instances launching parallel Jobs.
+	// flock releases automatically when the file descriptor is closed.
+	lf, err := lockCacheDir(cacheDir, syscall.LOCK_EX)
+	if err != nil {
+		log.Error(err, "unable to acquire extract lock", "cacheDir", cacheDir)
+		return nil, err
+	}
+	defer func() { _ = lf.Close() }()
+
+	// With the lock held, nothing else is extracting into cacheDir, so any staging
+	// directory is from an extraction that was interrupted.
+	if err := cleanupStaging(cacheDir, log); err != nil {
+		log.Error(err, "unable to clean up interrupted extraction", "cacheDir", cacheDir)
+		return nil, err
+	}
+
+	// Only one initialization should occur per image URL.
+	// The init file stores the image URL used for extraction so that a different
+	// image triggers re-extraction rather than silently reusing stale cache.
+	initFile := filepath.Join(cacheDir, InitFileName)
+	if data, err := os.ReadFile(initFile); err == nil {
+		if strings.TrimSpace(string(data)) == imageURL {
+			log.Info("init file already exists", "imageURL", imageURL, "cacheDir", cacheDir, "noGpu", noGpu)
+			result, err := readResult(cacheDir)
+			if err != nil {
+				// Extracted before results were saved, so only the size can be reported.
+				log.Info("unable to read result file", "err", err)
+				result = &Result{ImageDigest: digestFromImageURL(imageURL)}
+				result.BytesExtracted, result.FileCount, _ = cacheStats(cacheDir)
+			}
+			return result, nil
+		}
+		log.Info("image URL changed, re-extracting",
+			"existing", strings.TrimSpace(string(data)), "new", imageURL)
+	}
+
+	stagingDir, sibling, err := createStagingDir(cacheDir, log)
+	if err != nil {
+		log.Error(err, "unable to create staging directory", "cacheDir", cacheDir)
+		return nil, err
+	}
+
+	reuseDir, reuseLock := previousExtraction(cacheDir, imageURL, log)
+	if reuseLock != nil {
+		defer func() { _ = reuseLock.Close() }()
+	}
+	if reuseDir != "" {
+		log.Info("reusing unchanged files of earlier extraction", "reuseDir", reuseDir)
+	}
+
+	result, err := extractToStaging(stagingDir, imageURL, reuseDir, noGpu, start, log)
+	if err == nil {
+		err = swapIntoPlace(cacheDir, stagingDir, sibling, inUse, log)
+		if err != nil {
+			log.Error(err, "unable to swap extracted cache into place", "cacheDir", cacheDir)
+		}
+	}
+	if err != nil {
+		if rmErr := os.RemoveAll(stagingDir); rmErr != nil {
+			log.Info("unable to remove staging directory", "err", rmErr)
+		}
+		return nil, err
+	}
+	log.Info("init file created")
+
+	log.Info("Cache Extracted",
+		"matchedIds", result.MatchedIds,
+		"unmatchedIds", result.UnmatchedIds,
+		"bytes", result.BytesExtracted,
+		"files", result.FileCount,
+		"bytesReused", result.BytesReused,
+		"duration", result.Duration())
+
+	return result, nil
+}
+
+// extractNewDir extracts imageURL into cacheDir, which does not exist, like a per-digest
+// directory that was never extracted or was evicted. The hostPath PVs of cacheDir require the
+// directory to exist, so pods that mount them wait until the complete extraction is renamed to
+// cacheDir. The staging directory is locked until then, so it is not taken for a leftover.
+func extractNewDir(cacheDir, imageURL string, noGpu bool, inUse func() bool, start time.Time, log logr.Logger) (*Result, error) {
+	parent := filepath.Dir(cacheDir)
+	if err := os.MkdirAll(parent, os.ModePerm); err != nil {
+		log.Error(err, "unable to make cache directory", "cacheDir", parent)
+		return nil, err
+	}
+	if err := cleanupSiblings(cacheDir, log); err != nil {
+		log.Error(err, "unable to clean up interrupted extraction", "cacheDir", cacheDir)
+		return nil, err
+	}
+
+	stagingDir, err := os.MkdirTemp(parent, StagingDirPrefix+filepath.Base(cacheDir)+"-")
+	if err != nil {
+		log.Error(err, "unable to create staging directory", "cacheDir", cacheDir)
+		return nil, err
+	}
+	if err := os.Chmod(stagingDir, 0755); err != nil {
+		log.Info("unable to chmod staging directory", "err", err)
+	}
+	if err := os.Chown(stagingDir, 1000, 1000); err != nil {
+		log.Info("unable to chown", "err", err)
+	}
+	lf, err := lockCacheDir(stagingDir, syscall.LOCK_EX)
+	if err != nil {
+		_ = os.RemoveAll(stagingDir)
+		log.Error(err, "unable to acquire extract lock", "cacheDir", stagingDir)
+		return nil, err
+	}
+	defer func() { _ = lf.Close() }()
+
+	reuseDir, reuseLock := previousExtraction(cacheDir, imageURL, log)
+	if reuseLock != nil {
+		defer func() { _ = reuseLock.Close() }()
+	}
+	if reuseDir != "" {
+		log.Info("reusing unchanged files of earlier extraction", "reuseDir", reuseDir)
+	}
+
+	result, err := extractToStaging(stagingDir, imageURL, reuseDir, noGpu, start, log)
+	if err == nil {
+		err = renameIntoPlace(cacheDir, stagingDir, imageURL, lf, inUse, log)
+		if err != nil {
+			log.Error(err, "unable to move extracted cache into place", "cacheDir", cacheDir)
+		}
+	}
+	if err != nil {
+		if rmErr := os.RemoveAll(stagingDir); rmErr != nil {
+			log.Info("unable to remove staging directory", "err", rmErr)
+		}
+		return nil, err
+	}
+
+	log.Info("Cache Extracted",
+		"matchedIds", result.MatchedIds,
+		"unmatchedIds", result.UnmatchedIds,
+		"bytes", result.BytesExtracted,
+		"files", result.FileCount,
+		"bytesReused", result.BytesReused,
+		"duration", result.Duration())
+
+	return result, nil
+}
+
+// renameIntoPlace renames stagingDir, locked through lf, to cacheDir. If cacheDir was created
+// since extractNewDir started, by another extraction of the same digest, the lock on cacheDir is
+// taken instead and the extraction in stagingDir replaces it, unless it is of imageURL already.
+func renameIntoPlace(cacheDir, stagingDir, imageURL string, lf *os.File, inUse func() bool, log logr.Logger) error {
+	err := os.Rename(stagingDir, cacheDir)
+	if err == nil {
+		if err := syncPath(filepath.Dir(cacheDir)); err != nil {
+			log.Info("unable to sync parent of cache directory", "err", err)
+		}
+		return nil
+	} else if !errors.Is(err, syscall.EEXIST) && !errors.Is(err, syscall.ENOTEMPTY) {
+		return err
+	}
+
+	clf, err := lockCacheDir(cacheDir, syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = clf.Close() }()
+	_ = lf.Close()
+
+	if url, _, ok := readInitFile(cacheDir); ok && url == imageURL {
+		log.Info("cache extracted meanwhile", "imageURL", imageURL, "cacheDir", cacheDir)
+		return os.RemoveAll(stagingDir)
+	}
+	return swapIntoPlace(cacheDir, stagingDir, true, inUse, log)
+}
+
+// extractToStaging extracts imageURL into stagingDir, adds the Result and init files, and
+// syncs it all to storage so it is ready to be swapped into place. Unchanged files of the
+// earlier extraction in reuseDir, if set, are reused.
+func extractToStaging(stagingDir, imageURL, reuseDir string, noGpu bool, start time.Time, log logr.Logger) (*Result, error) {
+	// For testing, like in a KIND Cluster, a real GPU may not be available.
+	enableGPU := !noGpu
+	matchedIds, unmatchedIds, err := mcvExtract(imageURL, stagingDir, reuseDir, enableGPU)
+	if err != nil {
+		log.Error(err, "unable to extract cache", "imageURL", imageURL, "stagingDir", stagingDir, "enableGPU", enableGPU)
+		return nil, err
+	}
+	if err := checkUnlisted(stagingDir, log); err != nil {
+		log.Error(err, "extracted cache does not match the integrity manifest", "imageURL", imageURL)
+		return nil, err
+	}
+
+	result := &Result{
+		ImageDigest:  digestFromImageURL(imageURL),
+		MatchedIds:   matchedIds,
+		UnmatchedIds: unmatchedIds,
+	}
+	if result.BytesExtracted, result.FileCount, err = cacheStats(stagingDir); err != nil {
+		log.Info("unable to size extracted cache", "err", err)
+	}
+	if reuseDir != "" {
+		if result.BytesReused, result.FilesReused, err = reusedStats(stagingDir, reuseDir); err != nil {
+			log.Info("unable to size reused files", "err", err)
+		}
+	}
+	result.DurationMs = time.Since(start).Milliseconds()
+	if err := writeResult(stagingDir, result); err != nil {
+		log.Info("unable to write result file", "err", err)
+	}
+	if err := os.WriteFile(filepath.Join(stagingDir, InitFileName), []byte(imageURL+"\n"), 0644); err != nil {
+		log.Error(err, "unable to create init file", "stagingDir", stagingDir)
+		return nil, err
+	}
+
+	if err := syncTree(stagingDir); err != nil {
+		log.Error(err, "unable to sync extracted cache", "stagingDir", stagingDir)
+		return nil, err
+	}
+	return result, nil
+}
+
+// VerifyCache makes sure the cache in cacheDir was fully extracted from imageURL and that
+// every file in it can be read. Nothing is written to cacheDir, which is mounted read-only.
+func VerifyCache(cacheDir, imageURL string, log logr.Logger) error {
+	log.Info("verifying cache", "imageURL", imageURL, "cacheDir", cacheDir)
+
+	initFile := filepath.Join(cacheDir, InitFileName)
+	data, err := os.ReadFile(initFile)
+	if err != nil {
+		log.Error(err, "unable to read init file", "initFile", initFile)
+		return err
+	}
+	if strings.TrimSpace(string(data)) != imageURL {
+		err := fmt.Errorf("cache extracted from %q, expected %q", strings.TrimSpace(string(data)), imageURL)
+		log.Error(err, "image URL mismatch", "cacheDir", cacheDir)
+		return err
+	}
+
+	// Images with an integrity manifest are verified file by file, which also reads every file.
+	issues, fileCnt, err := verifyIntegrity(cacheDir)
+	if err == nil {
+		if len(issues) > 0 {
+			err = &IntegrityError{Issues: issues}
+			log.Error(err, "extracted cache is corrupted", "cacheDir", cacheDir)
+			return err
+		}
+		log.Info("Cache Verified", "imageURL", imageURL, "files", fileCnt)
+		return nil
+	} else if !errors.Is(err, ErrNoIntegrityManifest) {
+		log.Error(err, "unable to verify extracted cache", "cacheDir", cacheDir)
+		return err
+	}
+
+	fileCnt = 0
+	err = filepath.WalkDir(cacheDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && filepath.Dir(path) == filepath.Clean(cacheDir) && isStagingEntry(d.Name()) {
+			return fs.SkipDir
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		if _, err := io.Copy(io.Discard, f); err != nil {
+			return fmt.Errorf("unable to read %s: %w", path, err)
+		}
+		fileCnt++
+		return nil
+	})
+	if err != nil {
+		log.Error(err, "unable to read extracted cache", "cacheDir", cacheDir)
+		return err
+	}
+
+	log.Info("Cache Verified", "imageURL", imageURL, "files", fileCnt)
+	return nil
+}
+
+// DirectorySize returns the number of bytes in all the regular files under dir.
+func DirectorySize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,54 @@
+package extract
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchOptions(t *testing.T) {
+	SetLayerCache("/var/cache/layers", 1024)
+	defer SetLayerCache("", 0)
+	peers := []string{"http://10.0.0.2:8095"}
+
+	t.Run("Test fetch options while an extraction runs", func(t *testing.T) {
+		mcvMutex.Lock()
+		defer mcvMutex.Unlock()
+
+		t.Logf("TEST: fetchOptions() - Should not wait for the extraction")
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			opts, removeAuthFile, err := fetchOptions(testImageURL, nil, peers)
+			require.NoError(t, err)
+			defer removeAuthFile()
+			require.Equal(t, "/var/cache/layers", opts.LayerCacheDir)
+			require.Equal(t, int64(1024), opts.LayerCacheMaxBytes)
+			require.Equal(t, peers, opts.LayerPeers)
+			require.Empty(t, opts.RegistryAuthFile)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("fetchOptions() waited for the extraction")
+		}
+	})
+
+	t.Run("Test fetch options of a private image", func(t *testing.T) {
+		t.Logf("TEST: fetchOptions() with credentials - Should skip the layer cache and peers")
+		opts, removeAuthFile, err := fetchOptions(testImageURL, []byte(`{"auths":{}}`), peers)
+		require.NoError(t, err)
+		require.Equal(t, int64(-1), opts.LayerCacheMaxBytes)
+		require.Empty(t, opts.LayerPeers)
+		data, err := os.ReadFile(opts.RegistryAuthFile)
+		require.NoError(t, err)
+		require.Equal(t, `{"auths":{}}`, string(data))
+
+		t.Logf("TEST: remove function - Should remove the credentials file")
+		removeAuthFile()
+		_, err = os.Stat(opts.RegistryAuthFile)
+		require.True(t, os.IsNotExist(err))
+	})
+}
@@ -0,0 +1,200 @@
+package extract
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/go-logr/logr"
+	mcvCache "github.com/redhat-et/GKM/mcv/pkg/cache"
+)
+
+// IntegrityFileName is written to the root of the cache directory by MCV during extraction
+// and contains the size and SHA-256 digest of every file in the OCI Image, so the extracted
+// cache can be scrubbed later. Images built before the integrity manifest was added to
+// "mcv create" do not have one.
+const IntegrityFileName = ".integrity.json"
+
+var (
+	// ErrNoIntegrityManifest is returned when the cache was extracted from an OCI Image
+	// without an integrity manifest, so it cannot be scrubbed.
+	ErrNoIntegrityManifest = errors.New("cache has no integrity manifest")
+
+	// ErrNotExtracted is returned when the cache directory does not hold an extraction.
+	ErrNotExtracted = errors.New("cache has not been extracted")
+
+	// ErrExtractInProgress is returned instead of waiting when an extraction into the cache
+	// directory is running.
+	ErrExtractInProgress = errors.New("extraction in progress")
+)
+
+// IntegrityError is returned when the files in the cache directory do not match the
+// integrity manifest of the OCI Image they were extracted from.
+type IntegrityError struct {
+	Issues []mcvCache.IntegrityIssue
+}
+
+func (e *IntegrityError) Error() string {
+	return "integrity check failed: " + mcvCache.IntegrityIssuesMessage(e.Issues)
+}
+
+// ScrubReport is the outcome of scrubbing a cache directory.
+type ScrubReport struct {
+	// ImageURL is the OCI Image the cache was extracted from.
+	ImageURL string
+
+	// FileCount is the number of files in the integrity manifest.
+	FileCount int
+
+	// Issues lists the files that were modified, truncated, removed or added since the
+	// cache was extracted. Empty if the cache is intact.
+	Issues []mcvCache.IntegrityIssue
+}
+
+// ScrubCache verifies every file in cacheDir against the integrity manifest saved when the
+// cache was extracted, and reports the files that no longer match. It does not wait for an
+// extraction into cacheDir to complete, ErrExtractInProgress is returned instead.
+func ScrubCache(cacheDir string, log logr.Logger) (*ScrubReport, error) {
+	if _, err := os.Stat(filepath.Join(cacheDir, InitFileName)); errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotExtracted
+	}
+	lf, err := lockCacheDir(cacheDir, syscall.LOCK_SH|syscall.LOCK_NB)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = lf.Close() }()
+
+	data, err := os.ReadFile(filepath.Join(cacheDir, InitFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotExtracted
+	} else if err != nil {
+		return nil, err
+	}
+
+	report := &ScrubReport{ImageURL: strings.TrimSpace(string(data))}
+	report.Issues, report.FileCount, err = verifyIntegrity(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	log.V(1).Info("Cache Scrubbed", "imageURL", report.ImageURL, "files", report.FileCount, "issues", len(report.Issues))
+	return report, nil
+}
+
+// InvalidateCache marks the extraction of imageURL in cacheDir as incomplete, so the next call
+// to ExtractCache extracts it again. The extracted files stay in place until the new extraction
+// is swapped in. Nothing is done if cacheDir holds the extraction of another image.
+func InvalidateCache(cacheDir, imageURL string, log logr.Logger) error {
+	lf, err := lockCacheDir(cacheDir, syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = lf.Close() }()
+
+	initFile := filepath.Join(cacheDir, InitFileName)
+	data, err := os.ReadFile(initFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(data)) != imageURL {
+		log.Info("cache extracted from a different image, not invalidated",
+			"existing", strings.TrimSpace(string(data)), "imageURL", imageURL)
+		return nil
+	}
+
+	if err := os.Remove(initFile); err != nil {
+		return err
+	}
+	log.Info("Cache Invalidated", "imageURL", imageURL, "cacheDir", cacheDir)
+	return syncPath(cacheDir)
+}
+
+// verifyIntegrity checks the files in dir against the integrity manifest in dir. Files written
+// by GKM in the root of dir are not part of the cache and are ignored.
+func verifyIntegrity(dir string) ([]mcvCache.IntegrityIssue, int, error) {
+	manifest, err := mcvCache.ReadIntegrityManifest(filepath.Join(dir, IntegrityFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, 0, ErrNoIntegrityManifest
+	} else if err != nil {
+		return nil, 0, err
+	}
+
+	issues, err := manifest.Verify(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+	added, err := manifest.Unlisted(dir, []string{"."}, isGkmEntry)
+	if err != nil {
+		return nil, 0, err
+	}
+	issues = append(issues, added...)
+	sort.Slice(issues, func(i, j int) bool { return issues[i].Path < issues[j].Path })
+	return issues, len(manifest.Files), nil
+}
+
+// checkUnlisted makes sure an extraction only wrote the files listed in the integrity manifest.
+// MCV verifies the listed files while extracting, but cannot tell which other files in its
+// extraction directory are from the image.
+func checkUnlisted(dir string, log logr.Logger) error {
+	manifest, err := mcvCache.ReadIntegrityManifest(filepath.Join(dir, IntegrityFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Info("image has no integrity manifest, extracted files cannot be scrubbed")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	added, err := manifest.Unlisted(dir, []string{"."}, isGkmEntry)
+	if err != nil {
+		return err
+	}
+	if len(added) > 0 {
+		return &IntegrityError{Issues: added}
+	}
+	return nil
+}
+
+// isGkmEntry returns true for the files and directories GKM writes in the root of the cache
+// directory, given their path relative to it.
+func isGkmEntry(rel string) bool {
+	return !strings.Contains(rel, "/") && (isMetadataFile(rel) || isStagingEntry(rel))
+}
+
+// lockCacheDir takes the extract lock of cacheDir. The lock is released when the returned file
+// is closed. With LOCK_NB, ErrExtractInProgress is returned if the lock is held. An extraction
+// can replace cacheDir, and its lock file, while the lock is waited for, so the lock is taken
+// again until it is on the lock file in cacheDir.
+func lockCacheDir(cacheDir string, how int) (*os.File, error) {
+	lockPath := filepath.Join(cacheDir, LockFileName)
+	for {
+		lf, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+		if err := syscall.Flock(int(lf.Fd()), how); err != nil {
+			_ = lf.Close()
+			if errors.Is(err, syscall.EWOULDBLOCK) {
+				return nil, ErrExtractInProgress
+			}
+			return nil, fmt.Errorf("unable to acquire extract lock %s: %w", lockPath, err)
+		}
+		locked, err := lf.Stat()
+		if err != nil {
+			_ = lf.Close()
+			return nil, err
+		}
+		current, err := os.Stat(lockPath)
+		if err == nil && os.SameFile(locked, current) {
+			return lf, nil
+		}
+		_ = lf.Close()
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package extract
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+
+	mcvCache "github.com/redhat-et/GKM/mcv/pkg/cache"
+)
+
+// fakeExtractWithIntegrity returns an mcvExtract that writes files into the extraction
+// directory, along with an integrity manifest listing the files in listed.
+func fakeExtractWithIntegrity(files map[string]string, listed map[string]string) func(string, string, string, bool) ([]int, []int, error) {
+	return func(imageURL, dir, reuseDir string, enableGPU bool) ([]int, []int, error) {
+		manifestRoot, err := os.MkdirTemp("", "integrity-")
+		if err != nil {
+			return nil, nil, err
+		}
+		defer func() { _ = os.RemoveAll(manifestRoot) }()
+		if _, _, err := fakeExtract(listed, nil)(imageURL, manifestRoot, "", enableGPU); err != nil {
+			return nil, nil, err
+		}
+		manifest, err := mcvCache.BuildIntegrityManifest(manifestRoot)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := mcvCache.WriteIntegrityManifest(filepath.Join(dir, IntegrityFileName), manifest); err != nil {
+			return nil, nil, err
+		}
+		return fakeExtract(files, nil)(imageURL, dir, reuseDir, enableGPU)
+	}
+}
+
+func TestIntegrity(t *testing.T) {
+	saved := mcvExtract
+	defer func() { mcvExtract = saved }()
+
+	files := map[string]string{"abc/kernel.json": "a1", "abc/kernel.hsaco": "binary"}
+
+	t.Run("Test scrub of an extracted cache", func(t *testing.T) {
+		cacheDir := t.TempDir()
+		mcvExtract = fakeExtractWithIntegrity(files, files)
+		_, err := ExtractCache(cacheDir, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+
+		t.Logf("TEST: ScrubCache() of an intact cache - Should report no issues")
+		report, err := ScrubCache(cacheDir, logr.Discard())
+		require.NoError(t, err)
+		require.Equal(t, testImageURL, report.ImageURL)
+		require.Equal(t, 2, report.FileCount)
+		require.Empty(t, report.Issues)
+		require.NoError(t, VerifyCache(cacheDir, testImageURL, logr.Discard()))
+
+		t.Logf("TEST: ScrubCache() of a corrupted cache - Should report the modified, truncated and added files")
+		require.NoError(t, os.WriteFile(filepath.Join(cacheDir, "abc", "kernel.json"), []byte("a2"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(cacheDir, "abc", "kernel.hsaco"), []byte("bin"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(cacheDir, "abc", "extra"), []byte("x"), 0644))
+		report, err = ScrubCache(cacheDir, logr.Discard())
+		require.NoError(t, err)
+		require.Equal(t, []mcvCache.IntegrityIssue{
+			{Path: "abc/extra", Kind: mcvCache.IntegrityAdded},
+			{Path: "abc/kernel.hsaco", Kind: mcvCache.IntegrityTruncated},
+			{Path: "abc/kernel.json", Kind: mcvCache.IntegrityModified},
+		}, report.Issues)
+
+		t.Logf("TEST: VerifyCache() of a corrupted cache - Should return an IntegrityError")
+		err = VerifyCache(cacheDir, testImageURL, logr.Discard())
+		var integrityErr *IntegrityError
+		require.True(t, errors.As(err, &integrityErr))
+		require.Len(t, integrityErr.Issues, 3)
+
+		t.Logf("TEST: InvalidateCache() of another image - Should leave the cache extracted")
+		require.NoError(t, InvalidateCache(cacheDir, testImageURL2, logr.Discard()))
+		_, err = os.Stat(filepath.Join(cacheDir, InitFileName))
+		require.NoError(t, err)
+
+		t.Logf("TEST: ExtractCache() after InvalidateCache() - Should restore the cache")
+		require.NoError(t, InvalidateCache(cacheDir, testImageURL, logr.Discard()))
+		_, err = ScrubCache(cacheDir, logr.Discard())
+		require.ErrorIs(t, err, ErrNotExtracted)
+		_, err = ExtractCache(cacheDir, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+		require.Equal(t, files, readTree(t, cacheDir))
+		report, err = ScrubCache(cacheDir, logr.Discard())
+		require.NoError(t, err)
+		require.Empty(t, report.Issues)
+	})
+
+	t.Run("Test extraction of files not in the integrity manifest", func(t *testing.T) {
+		cacheDir := t.TempDir()
+		mcvExtract = fakeExtractWithIntegrity(files, map[string]string{"abc/kernel.json": "a1"})
+
+		t.Logf("TEST: ExtractCache() - Should fail with an IntegrityError and leave nothing extracted")
+		_, err := ExtractCache(cacheDir, testImageURL, true, nil, logr.Discard())
+		require.Error(t, err)
+		require.Equal(t, FailureIntegrity, ClassifyError(err))
+		require.Empty(t, readTree(t, cacheDir))
+	})
+
+	t.Run("Test scrub of a cache without an integrity manifest", func(t *testing.T) {
+		cacheDir := t.TempDir()
+
+		t.Logf("TEST: ScrubCache() of an empty directory - Should return ErrNotExtracted")
+		_, err := ScrubCache(cacheDir, logr.Discard())
+		require.ErrorIs(t, err, ErrNotExtracted)
+
+		t.Logf("TEST: ScrubCache() of an image without integrity manifest - Should return ErrNoIntegrityManifest")
+		mcvExtract = fakeExtract(files, nil)
+		_, err = ExtractCache(cacheDir, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+		_, err = ScrubCache(cacheDir, logr.Discard())
+		require.ErrorIs(t, err, ErrNoIntegrityManifest)
+		require.NoError(t, VerifyCache(cacheDir, testImageURL, logr.Discard()))
+	})
+}
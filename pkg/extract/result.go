@@ -0,0 +1,156 @@
+package extract
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ResultFileName is written to the root of the cache directory after a successful extraction
+// and contains the Result, so a later extraction of the same image into the directory, which
+// is skipped, can still report it.
+const ResultFileName = ".result.json"
+
+// Result is the outcome of an extraction. gkm-extract writes it as JSON to its termination
+// message, which is how the GKM Agent learns the GPU compatibility and size of the extracted
+// cache without pulling the image again.
+type Result struct {
+	// ImageDigest is the digest of the OCI Image that was extracted.
+	ImageDigest string `json:"imageDigest,omitempty"`
+
+	// MatchedIds and UnmatchedIds are the GPU Ids reported by MCV.
+	MatchedIds   []int `json:"matchedIds,omitempty"`
+	UnmatchedIds []int `json:"unmatchedIds,omitempty"`
+
+	// BytesExtracted and FileCount describe the extracted cache.
+	BytesExtracted int64 `json:"bytesExtracted,omitempty"`
+	FileCount      int64 `json:"fileCount,omitempty"`
+
+	// BytesReused and FilesReused describe the files of the cache that were unchanged from an
+	// earlier extraction on the Node, and were hard linked from it instead of written again.
+	BytesReused int64 `json:"bytesReused,omitempty"`
+	FilesReused int64 `json:"filesReused,omitempty"`
+
+	// DurationMs is how long the extraction took, in milliseconds.
+	DurationMs int64 `json:"durationMs,omitempty"`
+
+	// Reason and Error are only set when the extraction failed.
+	Reason FailureReason `json:"reason,omitempty"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// Duration returns how long the extraction took.
+func (r *Result) Duration() time.Duration {
+	return time.Duration(r.DurationMs) * time.Millisecond
+}
+
+// FailureResult returns the Result for a failed extraction.
+func FailureResult(imageURL string, err error, duration time.Duration) *Result {
+	return &Result{
+		ImageDigest: digestFromImageURL(imageURL),
+		DurationMs:  duration.Milliseconds(),
+		Reason:      ClassifyError(err),
+		Error:       err.Error(),
+	}
+}
+
+// Marshal returns the Result as JSON, trimmed to fit in maxLength bytes. Only the error
+// message is long enough to need trimming.
+func (r *Result) Marshal(maxLength int) ([]byte, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	if over := len(data) - maxLength; over > 0 && r.Error != "" {
+		trimmed := *r
+		trimmed.Error = r.Error[:max(len(r.Error)-over-len("..."), 0)] + "..."
+		return json.Marshal(&trimmed)
+	}
+	return data, nil
+}
+
+// ParseResult parses a Result from a termination message. Returns false if the message is
+// not a Result, for example the tail of the log when gkm-extract exited before writing it.
+func ParseResult(message string) (*Result, bool) {
+	message = strings.TrimSpace(message)
+	if !strings.HasPrefix(message, "{") {
+		return nil, false
+	}
+	result := &Result{}
+	if err := json.Unmarshal([]byte(message), result); err != nil {
+		return nil, false
+	}
+	return result, true
+}
+
+// writeResult saves the Result in the cache directory.
+func writeResult(cacheDir string, result *Result) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(cacheDir, ResultFileName), data, 0644)
+}
+
+// readResult loads the Result saved in the cache directory, if any.
+func readResult(cacheDir string) (*Result, error) {
+	data, err := os.ReadFile(filepath.Join(cacheDir, ResultFileName))
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{}
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, fmt.Errorf("invalid result file: %w", err)
+	}
+	return result, nil
+}
+
+// cacheStats returns the number of bytes and regular files under cacheDir, not counting the
+// files GKM keeps in the root of the cache directory or any staging directories.
+func cacheStats(cacheDir string) (int64, int64, error) {
+	var bytes, files int64
+	err := filepath.WalkDir(cacheDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		inRoot := filepath.Dir(path) == filepath.Clean(cacheDir)
+		if d.IsDir() && inRoot && isStagingEntry(d.Name()) {
+			return fs.SkipDir
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if inRoot && isMetadataFile(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		bytes += info.Size()
+		files++
+		return nil
+	})
+	return bytes, files, err
+}
+
+func isMetadataFile(name string) bool {
+	switch name {
+	case InitFileName, InitFileName + ".tmp", LockFileName, ResultFileName, IntegrityFileName, DedupFileName:
+		return true
+	}
+	return false
+}
+
+// digestFromImageURL returns the digest in an image URL of the form repo@sha256:..., or ""
+// if the URL is not pinned to a digest.
+func digestFromImageURL(imageURL string) string {
+	if i := strings.LastIndex(imageURL, "@"); i >= 0 {
+		return imageURL[i+1:]
+	}
+	return ""
+}
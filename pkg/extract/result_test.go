@@ -0,0 +1,78 @@
+package extract
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+)
+
+const testImageURL = "quay.io/gkm/cache-examples@sha256:bf6f7ea60274882031ad81434aa9c9ac0e4ff280cd1513db239dbbd705b6511c"
+
+func TestResult(t *testing.T) {
+	t.Run("Test extraction result encoding", func(t *testing.T) {
+		t.Logf("TEST: ParseResult() of Marshal() - Should round trip")
+		result := &Result{
+			ImageDigest:    digestFromImageURL(testImageURL),
+			MatchedIds:     []int{0, 1},
+			UnmatchedIds:   []int{2},
+			BytesExtracted: 4096,
+			FileCount:      3,
+			DurationMs:     1500,
+		}
+		data, err := result.Marshal(4096)
+		require.NoError(t, err)
+		parsed, ok := ParseResult(string(data))
+		require.True(t, ok)
+		require.Equal(t, result, parsed)
+		require.Equal(t, 1500*time.Millisecond, parsed.Duration())
+		require.True(t, strings.HasPrefix(parsed.ImageDigest, "sha256:"))
+
+		t.Logf("TEST: Marshal() of a long error - Should fit in the termination message")
+		failed := FailureResult(testImageURL, errors.New(strings.Repeat("x", 8192)), time.Second)
+		require.Equal(t, FailureUnknown, failed.Reason)
+		data, err = failed.Marshal(4096)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(data), 4096)
+		parsed, ok = ParseResult(string(data))
+		require.True(t, ok)
+		require.True(t, strings.HasSuffix(parsed.Error, "..."))
+
+		t.Logf("TEST: ParseResult() of a log tail - Should return false")
+		_, ok = ParseResult("unable to extract cache: image not found")
+		require.False(t, ok)
+	})
+
+	t.Run("Test extraction result of an already extracted cache", func(t *testing.T) {
+		cacheDir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(cacheDir, "triton", "abc"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(cacheDir, "triton", "abc", "kernel.hsaco"), make([]byte, 100), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(cacheDir, "triton", "abc", "kernel.json"), make([]byte, 20), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(cacheDir, InitFileName), []byte(testImageURL+"\n"), 0644))
+
+		t.Logf("TEST: cacheStats() - Should not count the GKM files")
+		bytes, files, err := cacheStats(cacheDir)
+		require.NoError(t, err)
+		require.Equal(t, int64(120), bytes)
+		require.Equal(t, int64(2), files)
+
+		t.Logf("TEST: ExtractCache() without a result file - Should report the size")
+		result, err := ExtractCache(cacheDir, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+		require.Equal(t, int64(120), result.BytesExtracted)
+		require.Equal(t, int64(2), result.FileCount)
+		require.Nil(t, result.MatchedIds)
+
+		t.Logf("TEST: ExtractCache() with a result file - Should report the saved result")
+		saved := &Result{ImageDigest: digestFromImageURL(testImageURL), MatchedIds: []int{0}, BytesExtracted: 120, FileCount: 2}
+		require.NoError(t, writeResult(cacheDir, saved))
+		result, err = ExtractCache(cacheDir, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+		require.Equal(t, saved, result)
+	})
+}
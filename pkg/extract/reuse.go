@@ -0,0 +1,131 @@
+package extract
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+// previousExtraction returns the directory of an earlier extraction of another digest of the
+// image repository of imageURL, whose unchanged files the extraction of imageURL into cacheDir
+// can reuse. If cacheDir holds such an extraction, as when the image changes in place, it is
+// used. Otherwise, if cacheDir is the per-digest directory of imageURL, the most recent such
+// extraction in the other per-digest directories is used, and the returned Closer holds a shared
+// lock on it so it is not evicted or extracted into while it is read. It returns "" if there is
+// no earlier extraction to reuse. The caller holds the lock on cacheDir.
+func previousExtraction(cacheDir, imageURL string, log logr.Logger) (string, io.Closer) {
+	repository := imageRepository(imageURL)
+
+	if url, _, ok := readInitFile(cacheDir); ok {
+		if imageRepository(url) == repository {
+			return cacheDir, nil
+		}
+		return "", nil
+	}
+
+	digest := digestFromImageURL(imageURL)
+	if digest == "" || filepath.Base(cacheDir) != utils.CacheDirName(digest) {
+		return "", nil
+	}
+	parent := filepath.Dir(cacheDir)
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		return "", nil
+	}
+
+	var latest string
+	var latestTime time.Time
+	for _, entry := range entries {
+		dir := filepath.Join(parent, entry.Name())
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || dir == filepath.Clean(cacheDir) {
+			continue
+		}
+		url, modTime, ok := readInitFile(dir)
+		if !ok || url == imageURL || imageRepository(url) != repository {
+			continue
+		}
+		if latest == "" || modTime.After(latestTime) {
+			latest, latestTime = dir, modTime
+		}
+	}
+	if latest == "" {
+		return "", nil
+	}
+
+	lf, err := lockCacheDir(latest, syscall.LOCK_SH|syscall.LOCK_NB)
+	if err != nil {
+		log.Info("earlier extraction is busy, not reused", "dir", latest, "err", err)
+		return "", nil
+	}
+	// Evicted before the lock was acquired.
+	if _, _, ok := readInitFile(latest); !ok {
+		_ = lf.Close()
+		return "", nil
+	}
+	return latest, lf
+}
+
+// readInitFile returns the image URL in the init file of cacheDir and when it was written, and
+// false if cacheDir holds no extraction.
+func readInitFile(cacheDir string) (string, time.Time, bool) {
+	initFile := filepath.Join(cacheDir, InitFileName)
+	info, err := os.Stat(initFile)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	data, err := os.ReadFile(initFile)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return strings.TrimSpace(string(data)), info.ModTime(), true
+}
+
+// imageRepository returns imageURL without its digest or tag.
+func imageRepository(imageURL string) string {
+	if i := strings.LastIndex(imageURL, "@"); i >= 0 {
+		imageURL = imageURL[:i]
+	}
+	if i := strings.LastIndex(imageURL, ":"); i > strings.LastIndex(imageURL, "/") {
+		imageURL = imageURL[:i]
+	}
+	return imageURL
+}
+
+// reusedStats returns the number of bytes and regular files in the extraction in stagingDir
+// that are hard linked to the same file in the earlier extraction in reuseDir.
+func reusedStats(stagingDir, reuseDir string) (int64, int64, error) {
+	var bytes, files int64
+	err := filepath.WalkDir(stagingDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		inRoot := filepath.Dir(path) == filepath.Clean(stagingDir)
+		if !d.Type().IsRegular() || (inRoot && isMetadataFile(d.Name())) {
+			return nil
+		}
+		rel, err := filepath.Rel(stagingDir, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		prevInfo, err := os.Lstat(filepath.Join(reuseDir, rel))
+		if err != nil || !os.SameFile(info, prevInfo) {
+			return nil
+		}
+		bytes += info.Size()
+		files++
+		return nil
+	})
+	return bytes, files, err
+}
@@ -0,0 +1,118 @@
+package extract
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+// fakeReuseExtract returns an mcvExtract that writes files into the extraction directory, and
+// hard links the files that are unchanged in reuseDir, like MCV does.
+func fakeReuseExtract(files map[string]string) func(string, string, string, bool) ([]int, []int, error) {
+	return func(imageURL, dir, reuseDir string, enableGPU bool) ([]int, []int, error) {
+		for name, content := range files {
+			path := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return nil, nil, err
+			}
+			if reuseDir != "" {
+				prev := filepath.Join(reuseDir, name)
+				if data, err := os.ReadFile(prev); err == nil && string(data) == content {
+					if err := os.Link(prev, path); err != nil {
+						return nil, nil, err
+					}
+					continue
+				}
+			}
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				return nil, nil, err
+			}
+		}
+		return []int{0}, nil, nil
+	}
+}
+
+func TestIncrementalExtract(t *testing.T) {
+	saved := mcvExtract
+	defer func() { mcvExtract = saved }()
+
+	t.Run("Test extraction of a new digest next to an earlier one", func(t *testing.T) {
+		hostDir := t.TempDir()
+		prevDir := filepath.Join(hostDir, utils.CacheDirName(digestFromImageURL(testImageURL)))
+		cacheDir := filepath.Join(hostDir, utils.CacheDirName(digestFromImageURL(testImageURL2)))
+		mcvExtract = fakeReuseExtract(map[string]string{"abc/kernel.hsaco": "binary", "abc/kernel.json": "a1"})
+		_, err := ExtractCache(prevDir, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+
+		t.Logf("TEST: ExtractCache() of a new digest - Should link the unchanged files from the earlier digest")
+		mcvExtract = fakeReuseExtract(map[string]string{"abc/kernel.hsaco": "binary", "abc/kernel.json": "a2"})
+		result, err := ExtractCache(cacheDir, testImageURL2, true, nil, logr.Discard())
+		require.NoError(t, err)
+		require.Equal(t, int64(len("binary")), result.BytesReused)
+		require.Equal(t, int64(1), result.FilesReused)
+		require.Equal(t, map[string]string{"abc/kernel.hsaco": "binary", "abc/kernel.json": "a2"}, readTree(t, cacheDir))
+		require.Equal(t, map[string]string{"abc/kernel.hsaco": "binary", "abc/kernel.json": "a1"}, readTree(t, prevDir))
+
+		t.Logf("TEST: ExtractCache() after the earlier digest is evicted - Should keep the linked files")
+		_, err = EvictCache(prevDir, testImageURL, nil, logr.Discard())
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"abc/kernel.hsaco": "binary", "abc/kernel.json": "a2"}, readTree(t, cacheDir))
+	})
+
+	t.Run("Test extraction of a new image in place", func(t *testing.T) {
+		cacheDir := t.TempDir()
+		mcvExtract = fakeReuseExtract(map[string]string{"abc/kernel.hsaco": "binary", "abc/kernel.json": "a1"})
+		_, err := ExtractCache(cacheDir, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+
+		t.Logf("TEST: ExtractCache() of a new image in the same directory - Should link the unchanged files")
+		mcvExtract = fakeReuseExtract(map[string]string{"abc/kernel.hsaco": "binary", "abc/kernel.json": "a2"})
+		result, err := ExtractCache(cacheDir, testImageURL2, true, nil, logr.Discard())
+		require.NoError(t, err)
+		require.Equal(t, int64(len("binary")), result.BytesReused)
+		require.Equal(t, map[string]string{"abc/kernel.hsaco": "binary", "abc/kernel.json": "a2"}, readTree(t, cacheDir))
+	})
+
+	t.Run("Test selection of the earlier extraction", func(t *testing.T) {
+		hostDir := t.TempDir()
+		otherURL := "quay.io/gkm/other-cache@sha256:0e2ac2d4b6a1a1e5bb0e5e2b6d2bb38e4cc1b1f9e4bb6f4d1a4b1d1e0c2a7f3e"
+		otherDir := filepath.Join(hostDir, utils.CacheDirName(digestFromImageURL(otherURL)))
+		cacheDir := filepath.Join(hostDir, utils.CacheDirName(digestFromImageURL(testImageURL2)))
+		mcvExtract = fakeReuseExtract(map[string]string{"abc/kernel.json": "a1"})
+		_, err := ExtractCache(otherDir, otherURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+
+		t.Logf("TEST: previousExtraction() with only another image repository - Should not reuse it")
+		reuseDir, lock := previousExtraction(cacheDir, testImageURL2, logr.Discard())
+		require.Empty(t, reuseDir)
+		require.Nil(t, lock)
+
+		t.Logf("TEST: previousExtraction() of a directory that is not per digest - Should not look at its siblings")
+		prevDir := filepath.Join(hostDir, utils.CacheDirName(digestFromImageURL(testImageURL)))
+		_, err = ExtractCache(prevDir, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+		reuseDir, _ = previousExtraction(filepath.Join(hostDir, "legacy"), testImageURL2, logr.Discard())
+		require.Empty(t, reuseDir)
+
+		t.Logf("TEST: previousExtraction() with an earlier digest - Should lock and return it")
+		reuseDir, lock = previousExtraction(cacheDir, testImageURL2, logr.Discard())
+		require.Equal(t, prevDir, reuseDir)
+		require.NotNil(t, lock)
+		_, err = EvictCache(prevDir, testImageURL, nil, logr.Discard())
+		require.ErrorIs(t, err, ErrExtractInProgress)
+		require.NoError(t, lock.Close())
+	})
+
+	t.Run("Test image repository", func(t *testing.T) {
+		t.Logf("TEST: imageRepository() - Should strip the digest and tag")
+		require.Equal(t, "quay.io/gkm/cache-examples", imageRepository(testImageURL))
+		require.Equal(t, "quay.io/gkm/cache-examples", imageRepository("quay.io/gkm/cache-examples:v1"))
+		require.Equal(t, "localhost:5000/cache", imageRepository("localhost:5000/cache:v1@sha256:abc"))
+		require.Equal(t, "localhost:5000/cache", imageRepository("localhost:5000/cache"))
+	})
+}
@@ -0,0 +1,411 @@
+package extract
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/go-logr/logr"
+	"github.com/moby/sys/mountinfo"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// StagingDirPrefix names the directories a cache is extracted into before it is swapped
+	// into place. Staging directories are created beside the cache directory, or in it when it
+	// is a mount point, so the swap is a rename within one filesystem.
+	StagingDirPrefix = ".staging-"
+
+	// TrashDirPrefix names the directories that hold replaced content until it is removed.
+	TrashDirPrefix = ".trash-"
+
+	// ReplacedDirPrefix names the directories beside a cache directory that hold a replaced
+	// extraction still used by pods, until RemoveReplaced finds it unused.
+	ReplacedDirPrefix = ".replaced-"
+)
+
+// isMountPoint reports whether a directory is a mount point. Replaced in tests.
+var isMountPoint = mountinfo.Mounted
+
+// renameExchange atomically exchanges two paths. Replaced in tests.
+var renameExchange = func(oldPath, newPath string) error {
+	return unix.Renameat2(unix.AT_FDCWD, oldPath, unix.AT_FDCWD, newPath, unix.RENAME_EXCHANGE)
+}
+
+// isStagingEntry returns true for the directories and files an interrupted extraction can
+// leave in the root of the cache directory.
+func isStagingEntry(name string) bool {
+	return strings.HasPrefix(name, StagingDirPrefix) ||
+		strings.HasPrefix(name, TrashDirPrefix) ||
+		name == InitFileName+".tmp"
+}
+
+// isSiblingStagingEntry returns true for the directories an interrupted extraction into
+// cacheDir can leave beside it.
+func isSiblingStagingEntry(cacheDir, name string) bool {
+	base := filepath.Base(cacheDir) + "-"
+	return strings.HasPrefix(name, StagingDirPrefix+base) || strings.HasPrefix(name, TrashDirPrefix+base)
+}
+
+// cleanupStaging removes what an interrupted extraction left in the root of cacheDir and
+// beside it. The caller must hold the extract lock.
+func cleanupStaging(cacheDir string, log logr.Logger) error {
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !isStagingEntry(entry.Name()) {
+			continue
+		}
+		log.Info("removing leftover from interrupted extraction", "name", entry.Name())
+		if err := os.RemoveAll(filepath.Join(cacheDir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return cleanupSiblings(cacheDir, log)
+}
+
+// cleanupSiblings removes the staging and trash directories an interrupted extraction or
+// eviction left beside cacheDir. A directory whose extract lock is held belongs to an
+// extraction of a missing cacheDir, or an eviction, that is still running, and is kept.
+func cleanupSiblings(cacheDir string, log logr.Logger) error {
+	parent := filepath.Dir(filepath.Clean(cacheDir))
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		// Only staging directories beside cacheDir are looked for there, so the parent of a
+		// mount point that cannot be read holds none.
+		log.Info("unable to read parent of cache directory", "parent", parent, "err", err)
+		return nil
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !isSiblingStagingEntry(cacheDir, entry.Name()) {
+			continue
+		}
+		dir := filepath.Join(parent, entry.Name())
+		lf, err := lockCacheDir(dir, syscall.LOCK_EX|syscall.LOCK_NB)
+		if errors.Is(err, ErrExtractInProgress) || errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		log.Info("removing leftover from interrupted extraction", "name", entry.Name())
+		err = os.RemoveAll(dir)
+		_ = lf.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createStagingDir creates the directory to extract the cache of cacheDir into, with the owner
+// and permissions of cacheDir, and returns true if it is beside cacheDir. When cacheDir is a
+// plain directory, like the per-digest directories that back the hostPath PVs, the staging
+// directory is a hidden sibling, so pods never see it and the extraction replaces cacheDir in
+// one rename. A mount point, like the PVC mounted by the extract Job, cannot be renamed and has
+// nothing beside it on the same filesystem, so the staging directory is created in it.
+func createStagingDir(cacheDir string, log logr.Logger) (string, bool, error) {
+	cacheDir = filepath.Clean(cacheDir)
+	mounted, err := isMountPoint(cacheDir)
+	if err != nil {
+		log.Info("unable to tell if cache directory is a mount point", "cacheDir", cacheDir, "err", err)
+		mounted = true
+	}
+
+	var stagingDir string
+	if mounted {
+		stagingDir, err = os.MkdirTemp(cacheDir, StagingDirPrefix)
+	} else {
+		stagingDir, err = os.MkdirTemp(filepath.Dir(cacheDir), StagingDirPrefix+filepath.Base(cacheDir)+"-")
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	if info, err := os.Stat(cacheDir); err == nil {
+		if err := os.Chmod(stagingDir, info.Mode().Perm()); err != nil {
+			log.Info("unable to chmod staging directory", "err", err)
+		}
+		if st, ok := info.Sys().(*syscall.Stat_t); ok && !mounted {
+			if err := os.Chown(stagingDir, int(st.Uid), int(st.Gid)); err != nil {
+				log.Info("unable to chown staging directory", "err", err)
+			}
+		}
+	}
+	return stagingDir, !mounted, nil
+}
+
+// syncTree flushes every file and directory under dir to storage, so that content swapped
+// into place survives a crash of the Node.
+func syncTree(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+		return syncPath(path)
+	})
+}
+
+func syncPath(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("unable to sync %s: %w", path, err)
+	}
+	return nil
+}
+
+// swapIntoPlace replaces the content of cacheDir with the extraction in stagingDir, and removes
+// stagingDir, which holds the replaced content afterwards. If stagingDir is beside cacheDir, the
+// two directories are exchanged in one rename, so pods that start mounting cacheDir see either
+// the previous extraction or the new one. Pods already running keep the directory they mounted,
+// so if inUse reports the cache in use, the previous extraction is kept beside cacheDir until
+// RemoveReplaced finds it unused. Filesystems that cannot exchange directories, and staging
+// directories in cacheDir, fall back to swapEntries, which fails with ErrCacheInUse instead.
+func swapIntoPlace(cacheDir, stagingDir string, sibling bool, inUse func() bool, log logr.Logger) error {
+	if sibling {
+		err := exchangeDir(cacheDir, stagingDir, inUse, log)
+		if !errors.Is(err, errExchangeUnsupported) {
+			return err
+		}
+		log.Info("filesystem cannot exchange directories, swapping entries", "cacheDir", cacheDir)
+	}
+	return swapEntries(cacheDir, stagingDir, inUse, log)
+}
+
+// errExchangeUnsupported is returned by exchangeDir if the filesystem cannot exchange
+// directories.
+var errExchangeUnsupported = errors.New("exchange not supported")
+
+// exchangeDir exchanges cacheDir with stagingDir beside it, and removes stagingDir afterwards,
+// unless inUse reports the cache in use. It is then renamed to a replaced directory instead.
+func exchangeDir(cacheDir, stagingDir string, inUse func() bool, log logr.Logger) error {
+	// The extract lock of the new extraction is held across the exchange, so cacheDir is
+	// locked by this extraction the whole time. Extractions waiting on the lock of the replaced
+	// directory take the new one once they get it, see lockCacheDir.
+	lf, err := lockCacheDir(stagingDir, syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = lf.Close() }()
+
+	err = renameExchange(stagingDir, cacheDir)
+	if isExchangeUnsupported(err) {
+		_ = lf.Close()
+		if rmErr := os.Remove(filepath.Join(stagingDir, LockFileName)); rmErr != nil {
+			return rmErr
+		}
+		return errExchangeUnsupported
+	} else if err != nil {
+		return fmt.Errorf("unable to exchange %s: %w", cacheDir, err)
+	}
+
+	// The new extraction is in place, so failing to sync the rename or remove the old content is
+	// not an error. Anything left is removed by the next extraction.
+	if err := syncPath(filepath.Dir(cacheDir)); err != nil {
+		log.Info("unable to sync parent of cache directory", "err", err)
+	}
+	if inUse != nil && inUse() {
+		// Pods still read the replaced content through the directory they mounted.
+		if replacedDir, err := keepReplaced(cacheDir, stagingDir); err != nil {
+			log.Info("unable to keep replaced content", "dir", stagingDir, "err", err)
+		} else {
+			log.Info("replaced content in use, kept until unused", "dir", replacedDir)
+			return nil
+		}
+	}
+	if err := os.RemoveAll(stagingDir); err != nil {
+		log.Info("unable to remove replaced content", "dir", stagingDir, "err", err)
+	}
+	return nil
+}
+
+// keepReplaced renames dir, which holds the extraction replaced in cacheDir, to a replaced
+// directory beside cacheDir and returns it.
+func keepReplaced(cacheDir, dir string) (string, error) {
+	replacedDir, err := os.MkdirTemp(filepath.Dir(cacheDir), ReplacedDirPrefix+filepath.Base(cacheDir)+"-")
+	if err != nil {
+		return "", err
+	}
+	// Only the unique name is kept, a directory cannot be renamed onto an existing one.
+	if err := os.Remove(replacedDir); err != nil {
+		return "", err
+	}
+	if err := os.Rename(dir, replacedDir); err != nil {
+		return "", err
+	}
+	return replacedDir, nil
+}
+
+// RemoveReplaced removes the extractions replaced in cacheDir while they were in use, once
+// inUse reports the cache is no longer used. inUse is only called if there is one.
+func RemoveReplaced(cacheDir string, inUse func() bool, log logr.Logger) error {
+	cacheDir = filepath.Clean(cacheDir)
+	replaced, err := filepath.Glob(filepath.Join(filepath.Dir(cacheDir),
+		ReplacedDirPrefix+filepath.Base(cacheDir)+"-*"))
+	if err != nil || len(replaced) == 0 {
+		return err
+	}
+	if inUse != nil && inUse() {
+		return nil
+	}
+	for _, dir := range replaced {
+		log.Info("removing replaced content no longer in use", "dir", dir)
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// swapEntries replaces the content of cacheDir with the content of stagingDir one entry at a
+// time. The init file is moved out first and moved from stagingDir last, so cacheDir is only
+// marked as initialized once every entry is from the new extraction. Each entry that exists in
+// both is exchanged in one rename, so it is never missing from cacheDir. Entries only in
+// cacheDir are moved out. If a rename fails, the entries already swapped are restored, so
+// cacheDir is left with the previous extraction.
+//
+// Pods that start while the entries are being swapped could see a mix of both extractions, and
+// pods already running would see their files replaced, so if inUse reports the cache in use
+// nothing is swapped and ErrCacheInUse is returned.
+func swapEntries(cacheDir, stagingDir string, inUse func() bool, log logr.Logger) (err error) {
+	if inUse != nil && inUse() {
+		log.Info("cache in use, not replaced", "cacheDir", cacheDir)
+		return ErrCacheInUse
+	}
+
+	trashDir := filepath.Join(filepath.Dir(stagingDir),
+		TrashDirPrefix+strings.TrimPrefix(filepath.Base(stagingDir), StagingDirPrefix))
+	if err := os.Mkdir(trashDir, 0700); err != nil {
+		return err
+	}
+
+	// Undone in reverse order if the swap fails.
+	var undo []func() error
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(undo) - 1; i >= 0; i-- {
+			if undoErr := undo[i](); undoErr != nil {
+				log.Error(undoErr, "unable to restore previous extraction", "cacheDir", cacheDir)
+				err = errors.Join(err, undoErr)
+				return
+			}
+		}
+		_ = syncPath(cacheDir)
+		_ = os.RemoveAll(trashDir)
+	}()
+
+	initFile := filepath.Join(cacheDir, InitFileName)
+	trashedInit := filepath.Join(trashDir, InitFileName)
+	if err := os.Rename(initFile, trashedInit); err == nil {
+		undo = append(undo, func() error { return os.Rename(trashedInit, initFile) })
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := syncPath(cacheDir); err != nil {
+		return err
+	}
+
+	staged, err := os.ReadDir(stagingDir)
+	if err != nil {
+		return err
+	}
+	stagedNames := make(map[string]bool, len(staged))
+	for _, entry := range staged {
+		stagedNames[entry.Name()] = true
+		if entry.Name() == InitFileName || entry.Name() == LockFileName {
+			continue
+		}
+		restore, err := swapEntry(
+			filepath.Join(stagingDir, entry.Name()),
+			filepath.Join(cacheDir, entry.Name()),
+			filepath.Join(trashDir, entry.Name()),
+		)
+		if err != nil {
+			return err
+		}
+		undo = append(undo, restore)
+	}
+
+	// Move out what the previous extraction had that the new one does not.
+	current, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range current {
+		name := entry.Name()
+		if stagedNames[name] || name == LockFileName || isStagingEntry(name) {
+			continue
+		}
+		live, trash := filepath.Join(cacheDir, name), filepath.Join(trashDir, name)
+		if err := os.Rename(live, trash); err != nil {
+			return err
+		}
+		undo = append(undo, func() error { return os.Rename(trash, live) })
+	}
+
+	if err := os.Rename(filepath.Join(stagingDir, InitFileName), initFile); err != nil {
+		return err
+	}
+	if err := syncPath(cacheDir); err != nil {
+		log.Info("unable to sync cache directory", "err", err)
+	}
+
+	// The new extraction is in place, so failing to remove the old content is not an error.
+	// Anything left is removed by the next extraction.
+	for _, dir := range []string{stagingDir, trashDir} {
+		if err := os.RemoveAll(dir); err != nil {
+			log.Info("unable to remove replaced content", "dir", dir, "err", err)
+		}
+	}
+	return nil
+}
+
+// swapEntry moves staged to live, and returns a function that moves it back. If live exists,
+// the two are exchanged so live is never missing, and the replaced entry ends up at staged.
+// Filesystems that cannot exchange fall back to moving live to trash first.
+func swapEntry(staged, live, trash string) (func() error, error) {
+	if _, err := os.Lstat(live); errors.Is(err, fs.ErrNotExist) {
+		if err := os.Rename(staged, live); err != nil {
+			return nil, err
+		}
+		return func() error { return os.Rename(live, staged) }, nil
+	}
+	err := renameExchange(staged, live)
+	if err == nil {
+		return func() error { return renameExchange(staged, live) }, nil
+	}
+	if !isExchangeUnsupported(err) {
+		return nil, fmt.Errorf("unable to exchange %s: %w", live, err)
+	}
+	if err := os.Rename(live, trash); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(staged, live); err != nil {
+		return nil, errors.Join(err, os.Rename(trash, live))
+	}
+	return func() error {
+		if err := os.Rename(live, staged); err != nil {
+			return err
+		}
+		return os.Rename(trash, live)
+	}, nil
+}
+
+// isExchangeUnsupported returns true if err is from a filesystem that cannot exchange.
+func isExchangeUnsupported(err error) bool {
+	return errors.Is(err, unix.EINVAL) || errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.ENOTSUP)
+}
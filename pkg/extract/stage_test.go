@@ -0,0 +1,332 @@
+package extract
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+)
+
+const testImageURL2 = "quay.io/gkm/cache-examples@sha256:0e2ac2d4b6a1a1e5bb0e5e2b6d2bb38e4cc1b1f9e4bb6f4d1a4b1d1e0c2a7f3d"
+
+// fakeExtract returns an mcvExtract that writes files into the extraction directory.
+func fakeExtract(files map[string]string, err error) func(string, string, string, bool) ([]int, []int, error) {
+	return func(imageURL, dir, reuseDir string, enableGPU bool) ([]int, []int, error) {
+		for name, content := range files {
+			path := filepath.Join(dir, name)
+			if mkErr := os.MkdirAll(filepath.Dir(path), 0755); mkErr != nil {
+				return nil, nil, mkErr
+			}
+			if wrErr := os.WriteFile(path, []byte(content), 0644); wrErr != nil {
+				return nil, nil, wrErr
+			}
+		}
+		return []int{0}, nil, err
+	}
+}
+
+// readTree returns the content of the extracted files under dir, by relative path.
+func readTree(t *testing.T, dir string) map[string]string {
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		require.NoError(t, err)
+		if !d.Type().IsRegular() || (filepath.Dir(path) == dir && isMetadataFile(d.Name())) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		rel, _ := filepath.Rel(dir, path)
+		files[rel] = string(data)
+		return nil
+	})
+	require.NoError(t, err)
+	return files
+}
+
+func TestStagedExtract(t *testing.T) {
+	saved := mcvExtract
+	defer func() { mcvExtract = saved }()
+
+	t.Run("Test staged extraction into an empty directory", func(t *testing.T) {
+		cacheDir := t.TempDir()
+		mcvExtract = fakeExtract(map[string]string{"abc/kernel.json": "a1", "io.triton.manifest/manifest.json": "m1"}, nil)
+
+		t.Logf("TEST: ExtractCache() - Should swap the extraction into place and remove the staging directory")
+		result, err := ExtractCache(cacheDir, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+		require.Equal(t, int64(2), result.FileCount)
+		require.Equal(t, map[string]string{"abc/kernel.json": "a1", "io.triton.manifest/manifest.json": "m1"}, readTree(t, cacheDir))
+		data, err := os.ReadFile(filepath.Join(cacheDir, InitFileName))
+		require.NoError(t, err)
+		require.Equal(t, testImageURL, strings.TrimSpace(string(data)))
+		entries, err := os.ReadDir(cacheDir)
+		require.NoError(t, err)
+		for _, entry := range entries {
+			require.False(t, isStagingEntry(entry.Name()), entry.Name())
+		}
+	})
+
+	t.Run("Test staged extraction of a new image", func(t *testing.T) {
+		cacheDir := t.TempDir()
+		mcvExtract = fakeExtract(map[string]string{"abc/kernel.json": "a1", "old/kernel.json": "o1"}, nil)
+		_, err := ExtractCache(cacheDir, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+
+		t.Logf("TEST: ExtractCache() with a failed extraction - Should leave the previous extraction in place")
+		mcvExtract = fakeExtract(map[string]string{"abc/kernel.json": "partial"}, errors.New("i/o timeout"))
+		_, err = ExtractCache(cacheDir, testImageURL2, true, nil, logr.Discard())
+		require.Error(t, err)
+		require.Equal(t, map[string]string{"abc/kernel.json": "a1", "old/kernel.json": "o1"}, readTree(t, cacheDir))
+		data, err := os.ReadFile(filepath.Join(cacheDir, InitFileName))
+		require.NoError(t, err)
+		require.Equal(t, testImageURL, strings.TrimSpace(string(data)))
+
+		t.Logf("TEST: ExtractCache() with a new image - Should replace every entry of the previous extraction")
+		mcvExtract = fakeExtract(map[string]string{"abc/kernel.json": "a2", "new/kernel.json": "n2"}, nil)
+		_, err = ExtractCache(cacheDir, testImageURL2, true, nil, logr.Discard())
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"abc/kernel.json": "a2", "new/kernel.json": "n2"}, readTree(t, cacheDir))
+		data, err = os.ReadFile(filepath.Join(cacheDir, InitFileName))
+		require.NoError(t, err)
+		require.Equal(t, testImageURL2, strings.TrimSpace(string(data)))
+	})
+
+	t.Run("Test recovery from an interrupted extraction", func(t *testing.T) {
+		cacheDir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(cacheDir, StagingDirPrefix+"123", "abc"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(cacheDir, StagingDirPrefix+"123", "abc", "kernel.json"), []byte("x"), 0644))
+		require.NoError(t, os.MkdirAll(filepath.Join(cacheDir, TrashDirPrefix+"456"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(cacheDir, InitFileName+".tmp"), []byte(testImageURL), 0644))
+
+		t.Logf("TEST: ExtractCache() - Should remove the leftovers and extract")
+		mcvExtract = fakeExtract(map[string]string{"abc/kernel.json": "a1"}, nil)
+		_, err := ExtractCache(cacheDir, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+		for _, name := range []string{StagingDirPrefix + "123", TrashDirPrefix + "456", InitFileName + ".tmp"} {
+			_, err := os.Stat(filepath.Join(cacheDir, name))
+			require.True(t, os.IsNotExist(err), name)
+		}
+		require.Equal(t, map[string]string{"abc/kernel.json": "a1"}, readTree(t, cacheDir))
+	})
+
+	t.Run("Test staged extraction beside a per-digest directory", func(t *testing.T) {
+		parent := t.TempDir()
+		cacheDir := filepath.Join(parent, "0e2ac2d4")
+		mcvExtract = fakeExtract(map[string]string{"abc/kernel.json": "a1"}, nil)
+		_, err := ExtractCache(cacheDir, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+		before, err := os.Stat(cacheDir)
+		require.NoError(t, err)
+
+		t.Logf("TEST: ExtractCache() with a new image - Should stage beside cacheDir and exchange the directories")
+		var staged []string
+		mcvExtract = func(imageURL, dir, reuseDir string, enableGPU bool) ([]int, []int, error) {
+			staged = append(staged, dir)
+			return fakeExtract(map[string]string{"new/kernel.json": "n2"}, nil)(imageURL, dir, reuseDir, enableGPU)
+		}
+		_, err = ExtractCache(cacheDir, testImageURL2, true, nil, logr.Discard())
+		require.NoError(t, err)
+		require.Len(t, staged, 1)
+		require.Equal(t, parent, filepath.Dir(staged[0]))
+		require.True(t, strings.HasPrefix(filepath.Base(staged[0]), StagingDirPrefix+"0e2ac2d4-"))
+		after, err := os.Stat(cacheDir)
+		require.NoError(t, err)
+		require.False(t, os.SameFile(before, after))
+		require.Equal(t, map[string]string{"new/kernel.json": "n2"}, readTree(t, cacheDir))
+		entries, err := os.ReadDir(parent)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+
+		t.Logf("TEST: lockCacheDir() - Should lock the lock file of the new directory")
+		lf, err := lockCacheDir(cacheDir, syscall.LOCK_EX|syscall.LOCK_NB)
+		require.NoError(t, err)
+		_, err = lockCacheDir(cacheDir, syscall.LOCK_EX|syscall.LOCK_NB)
+		require.ErrorIs(t, err, ErrExtractInProgress)
+		require.NoError(t, lf.Close())
+
+		t.Logf("TEST: ExtractCache() after an interrupted extraction - Should remove the leftovers beside cacheDir")
+		require.NoError(t, os.MkdirAll(filepath.Join(parent, StagingDirPrefix+"0e2ac2d4-123", "abc"), 0755))
+		require.NoError(t, os.MkdirAll(filepath.Join(parent, TrashDirPrefix+"0e2ac2d4-456"), 0755))
+		require.NoError(t, os.MkdirAll(filepath.Join(parent, StagingDirPrefix+"ffffffff-789"), 0755))
+		mcvExtract = fakeExtract(map[string]string{"abc/kernel.json": "a3"}, nil)
+		_, err = ExtractCache(cacheDir, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+		entries, err = os.ReadDir(parent)
+		require.NoError(t, err)
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		require.ElementsMatch(t, []string{"0e2ac2d4", StagingDirPrefix + "ffffffff-789"}, names)
+	})
+
+	t.Run("Test staged extraction into a mount point", func(t *testing.T) {
+		savedMountPoint := isMountPoint
+		defer func() { isMountPoint = savedMountPoint }()
+		isMountPoint = func(string) (bool, error) { return true, nil }
+
+		cacheDir := t.TempDir()
+		mcvExtract = fakeExtract(map[string]string{"abc/kernel.json": "a1", "old/kernel.json": "o1"}, nil)
+		_, err := ExtractCache(cacheDir, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+		before, err := os.Stat(cacheDir)
+		require.NoError(t, err)
+
+		t.Logf("TEST: ExtractCache() with a new image - Should stage in cacheDir and swap the entries")
+		var staged []string
+		mcvExtract = func(imageURL, dir, reuseDir string, enableGPU bool) ([]int, []int, error) {
+			staged = append(staged, dir)
+			return fakeExtract(map[string]string{"abc/kernel.json": "a2", "new/kernel.json": "n2"}, nil)(imageURL, dir, reuseDir, enableGPU)
+		}
+		_, err = ExtractCache(cacheDir, testImageURL2, true, nil, logr.Discard())
+		require.NoError(t, err)
+		require.Len(t, staged, 1)
+		require.Equal(t, cacheDir, filepath.Dir(staged[0]))
+		after, err := os.Stat(cacheDir)
+		require.NoError(t, err)
+		require.True(t, os.SameFile(before, after))
+		require.Equal(t, map[string]string{"abc/kernel.json": "a2", "new/kernel.json": "n2"}, readTree(t, cacheDir))
+	})
+
+	t.Run("Test replaced extraction kept while in use", func(t *testing.T) {
+		parent := t.TempDir()
+		cacheDir := filepath.Join(parent, "0e2ac2d4")
+		mcvExtract = fakeExtract(map[string]string{"abc/kernel.json": "a1"}, nil)
+		_, err := ExtractCache(cacheDir, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+
+		t.Logf("TEST: ExtractCache() of a cache in use - Should exchange the directories and keep the replaced one")
+		inUse := true
+		mcvExtract = fakeExtract(map[string]string{"new/kernel.json": "n2"}, nil)
+		_, err = ExtractCache(cacheDir, testImageURL2, true, func() bool { return inUse }, logr.Discard())
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"new/kernel.json": "n2"}, readTree(t, cacheDir))
+		replaced, err := filepath.Glob(filepath.Join(parent, ReplacedDirPrefix+"0e2ac2d4-*"))
+		require.NoError(t, err)
+		require.Len(t, replaced, 1)
+		require.Equal(t, map[string]string{"abc/kernel.json": "a1"}, readTree(t, replaced[0]))
+
+		t.Logf("TEST: ExtractCache() after an interrupted extraction - Should not remove the replaced directory")
+		mcvExtract = fakeExtract(map[string]string{"abc/kernel.json": "a3"}, nil)
+		_, err = ExtractCache(cacheDir, testImageURL, true, func() bool { return inUse }, logr.Discard())
+		require.NoError(t, err)
+		_, err = os.Stat(replaced[0])
+		require.NoError(t, err)
+
+		t.Logf("TEST: RemoveReplaced() while in use - Should keep the replaced directories")
+		require.NoError(t, RemoveReplaced(cacheDir, func() bool { return inUse }, logr.Discard()))
+		replaced, err = filepath.Glob(filepath.Join(parent, ReplacedDirPrefix+"0e2ac2d4-*"))
+		require.NoError(t, err)
+		require.Len(t, replaced, 2)
+
+		t.Logf("TEST: RemoveReplaced() once unused - Should remove the replaced directories")
+		inUse = false
+		require.NoError(t, RemoveReplaced(cacheDir, func() bool { return inUse }, logr.Discard()))
+		entries, err := os.ReadDir(parent)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.Equal(t, map[string]string{"abc/kernel.json": "a3"}, readTree(t, cacheDir))
+
+		t.Logf("TEST: RemoveReplaced() without replaced directories - Should not check if the cache is in use")
+		require.NoError(t, RemoveReplaced(cacheDir, func() bool {
+			require.Fail(t, "inUse called")
+			return true
+		}, logr.Discard()))
+	})
+
+	t.Run("Test mount point in use not swapped", func(t *testing.T) {
+		savedMountPoint := isMountPoint
+		defer func() { isMountPoint = savedMountPoint }()
+		isMountPoint = func(string) (bool, error) { return true, nil }
+
+		cacheDir := t.TempDir()
+		mcvExtract = fakeExtract(map[string]string{"abc/kernel.json": "a1", "old/kernel.json": "o1"}, nil)
+		_, err := ExtractCache(cacheDir, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+
+		t.Logf("TEST: ExtractCache() of a mount point in use - Should fail and leave the previous extraction in place")
+		mcvExtract = fakeExtract(map[string]string{"abc/kernel.json": "a2", "new/kernel.json": "n2"}, nil)
+		_, err = ExtractCache(cacheDir, testImageURL2, true, func() bool { return true }, logr.Discard())
+		require.ErrorIs(t, err, ErrCacheInUse)
+		require.Equal(t, map[string]string{"abc/kernel.json": "a1", "old/kernel.json": "o1"}, readTree(t, cacheDir))
+		entries, err := os.ReadDir(cacheDir)
+		require.NoError(t, err)
+		for _, entry := range entries {
+			require.False(t, isStagingEntry(entry.Name()), entry.Name())
+		}
+
+		t.Logf("TEST: ExtractCache() of a mount point no longer in use - Should swap the entries")
+		_, err = ExtractCache(cacheDir, testImageURL2, true, func() bool { return false }, logr.Discard())
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"abc/kernel.json": "a2", "new/kernel.json": "n2"}, readTree(t, cacheDir))
+	})
+
+	t.Run("Test rollback of a failed swap", func(t *testing.T) {
+		savedMountPoint, savedExchange := isMountPoint, renameExchange
+		defer func() { isMountPoint, renameExchange = savedMountPoint, savedExchange }()
+		isMountPoint = func(string) (bool, error) { return true, nil }
+
+		cacheDir := t.TempDir()
+		mcvExtract = fakeExtract(map[string]string{"a/kernel.json": "a1", "b/kernel.json": "b1", "old/kernel.json": "o1"}, nil)
+		_, err := ExtractCache(cacheDir, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+
+		t.Logf("TEST: ExtractCache() with a failed exchange - Should restore the entries already swapped")
+		exchanges := 0
+		renameExchange = func(oldPath, newPath string) error {
+			exchanges++
+			if exchanges == 2 {
+				return syscall.EIO
+			}
+			return savedExchange(oldPath, newPath)
+		}
+		mcvExtract = fakeExtract(map[string]string{"a/kernel.json": "a2", "b/kernel.json": "b2", "new/kernel.json": "n2"}, nil)
+		_, err = ExtractCache(cacheDir, testImageURL2, true, nil, logr.Discard())
+		require.ErrorIs(t, err, syscall.EIO)
+		require.Equal(t, map[string]string{"a/kernel.json": "a1", "b/kernel.json": "b1", "old/kernel.json": "o1"}, readTree(t, cacheDir))
+		data, err := os.ReadFile(filepath.Join(cacheDir, InitFileName))
+		require.NoError(t, err)
+		require.Equal(t, testImageURL, strings.TrimSpace(string(data)))
+		entries, err := os.ReadDir(cacheDir)
+		require.NoError(t, err)
+		for _, entry := range entries {
+			require.False(t, isStagingEntry(entry.Name()), entry.Name())
+		}
+	})
+
+	t.Run("Test swap of entries", func(t *testing.T) {
+		dir := t.TempDir()
+		staged := filepath.Join(dir, "staged")
+		live := filepath.Join(dir, "live")
+		trash := filepath.Join(dir, "trash")
+		require.NoError(t, os.WriteFile(staged, []byte("new"), 0644))
+		require.NoError(t, os.WriteFile(live, []byte("old"), 0644))
+
+		t.Logf("TEST: swapEntry() with an existing entry - Should exchange the two")
+		restore, err := swapEntry(staged, live, trash)
+		require.NoError(t, err)
+		data, err := os.ReadFile(live)
+		require.NoError(t, err)
+		require.Equal(t, "new", string(data))
+
+		t.Logf("TEST: swapEntry() restore - Should put the replaced entry back")
+		require.NoError(t, restore())
+		data, err = os.ReadFile(live)
+		require.NoError(t, err)
+		require.Equal(t, "old", string(data))
+
+		t.Logf("TEST: swapEntry() with a new entry - Should move it into place")
+		require.NoError(t, os.WriteFile(staged, []byte("newer"), 0644))
+		require.NoError(t, os.Remove(live))
+		_, err = swapEntry(staged, live, trash)
+		require.NoError(t, err)
+		data, err = os.ReadFile(live)
+		require.NoError(t, err)
+		require.Equal(t, "newer", string(data))
+	})
+}
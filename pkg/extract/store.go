@@ -0,0 +1,214 @@
+package extract
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/go-logr/logr"
+	mcvCache "github.com/redhat-et/GKM/mcv/pkg/cache"
+)
+
+const (
+	// StoreDirName is the content store in the root of the host cache directory. It holds one
+	// hard link to each distinct cache file on the Node, named after its SHA-256 digest, so the
+	// identical files of different caches can share their content.
+	StoreDirName = ".store"
+
+	// DedupFileName is written to the root of the cache directory once its files are linked
+	// to the content store, so they are not looked at again.
+	DedupFileName = ".deduplicated"
+)
+
+// DedupStats describes the files of a cache that were linked to the content store.
+type DedupStats struct {
+	// Files and Bytes are the files of the cache that were replaced by a link to an identical
+	// file already in the content store, and the bytes they no longer use.
+	Files int64
+	Bytes int64
+}
+
+// StoreStats describes the content store of a Node.
+type StoreStats struct {
+	// Files and Bytes are the distinct files in the content store and their size.
+	Files int64
+	Bytes int64
+
+	// SavedBytes is the disk space the caches would use on top of Bytes, without sharing.
+	SavedBytes int64
+
+	// PrunedFiles and PrunedBytes are the files removed from the content store because no
+	// cache uses them anymore.
+	PrunedFiles int64
+	PrunedBytes int64
+}
+
+// DedupCache links the files of the cache extracted in cacheDir to the content store in storeDir.
+// A file identical to one already in the store, with the same SHA-256 digest and mode, is replaced
+// by a hard link to it. Other files are added to the store, after checking their content still
+// matches the integrity manifest. Only caches with an integrity manifest are deduplicated, and
+// each cache is only deduplicated once. It does not wait for an extraction into cacheDir to
+// complete, ErrExtractInProgress is returned instead.
+//
+// The store holds no count of its own, the number of hard links to a file is its reference count.
+// Removing a cache drops its links, and PruneStore removes the files only the store still links.
+func DedupCache(cacheDir, storeDir string, log logr.Logger) (*DedupStats, error) {
+	if _, err := os.Stat(filepath.Join(cacheDir, InitFileName)); errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotExtracted
+	}
+	lf, err := lockCacheDir(cacheDir, syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = lf.Close() }()
+
+	stats := &DedupStats{}
+	if _, err := os.Stat(filepath.Join(cacheDir, InitFileName)); errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotExtracted
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, DedupFileName)); err == nil {
+		return stats, nil
+	}
+	manifest, err := mcvCache.ReadIntegrityManifest(filepath.Join(cacheDir, IntegrityFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNoIntegrityManifest
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Files are replaced through a link in the root of cacheDir, which scrubbing ignores.
+	tmpPath := filepath.Join(cacheDir, StagingDirPrefix+"dedup")
+	_ = os.Remove(tmpPath)
+	for rel, entry := range manifest.Files {
+		linked, err := dedupFile(filepath.Join(cacheDir, filepath.FromSlash(rel)), tmpPath, storeDir, entry)
+		if err != nil {
+			// The file stays as it is, it only does not share its content.
+			log.Info("unable to deduplicate file", "cacheDir", cacheDir, "file", rel, "err", err)
+			continue
+		}
+		if linked {
+			stats.Files++
+			stats.Bytes += entry.Size
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(cacheDir, DedupFileName), nil, 0644); err != nil {
+		return nil, err
+	}
+	log.Info("Cache Deduplicated", "cacheDir", cacheDir, "files", stats.Files, "bytes", stats.Bytes)
+	return stats, nil
+}
+
+// dedupFile links the cache file at path to the content store, and returns true if it was
+// replaced, through tmpPath, by a link to an identical file already in the store.
+func dedupFile(path, tmpPath, storeDir string, entry mcvCache.IntegrityEntry) (bool, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false, err
+	}
+	if !info.Mode().IsRegular() || info.Size() != entry.Size || len(entry.SHA256) < 2 {
+		return false, nil
+	}
+
+	// Links share the mode, so the mode is part of the name.
+	storePath := filepath.Join(storeDir, entry.SHA256[:2], fmt.Sprintf("%s-%o", entry.SHA256, info.Mode().Perm()))
+	storeInfo, err := os.Lstat(storePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Only content that matches the manifest enters the store, since every cache linking
+		// to it would share a corruption.
+		digest, err := fileSHA256(path)
+		if err != nil {
+			return false, err
+		}
+		if digest != entry.SHA256 {
+			return false, fmt.Errorf("content does not match the integrity manifest")
+		}
+		if err := os.MkdirAll(filepath.Dir(storePath), 0755); err != nil {
+			return false, err
+		}
+		if err := os.Link(path, storePath); err != nil && !errors.Is(err, fs.ErrExist) {
+			return false, err
+		}
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if os.SameFile(info, storeInfo) || storeInfo.Size() != entry.Size {
+		return false, nil
+	}
+
+	// Replace the file in one step, so the cache never misses it.
+	if err := os.Link(storePath, tmpPath); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return false, err
+	}
+	return true, nil
+}
+
+// PruneStore removes the files of the content store in storeDir that no cache links to anymore,
+// and returns the statistics of the files that are left.
+func PruneStore(storeDir string, log logr.Logger) (*StoreStats, error) {
+	stats := &StoreStats{}
+	err := filepath.WalkDir(storeDir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil
+		}
+		if stat.Nlink <= 1 {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			stats.PrunedFiles++
+			stats.PrunedBytes += info.Size()
+			return nil
+		}
+		stats.Files++
+		stats.Bytes += info.Size()
+		// One link is the store itself, and one cache would hold the content anyway.
+		stats.SavedBytes += info.Size() * int64(stat.Nlink-2)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stats.PrunedFiles > 0 {
+		log.Info("Content Store Pruned", "files", stats.PrunedFiles, "bytes", stats.PrunedBytes)
+	}
+	return stats, nil
+}
+
+// fileSHA256 returns the hex encoded SHA-256 digest of the file at path.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,120 @@
+package extract
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redhat-et/GKM/pkg/utils"
+)
+
+func TestContentStore(t *testing.T) {
+	saved := mcvExtract
+	defer func() { mcvExtract = saved }()
+
+	sameFile := func(t *testing.T, path1, path2 string) bool {
+		info1, err := os.Stat(path1)
+		require.NoError(t, err)
+		info2, err := os.Stat(path2)
+		require.NoError(t, err)
+		return os.SameFile(info1, info2)
+	}
+
+	t.Run("Test deduplication of two caches", func(t *testing.T) {
+		hostDir := t.TempDir()
+		storeDir := filepath.Join(hostDir, StoreDirName)
+		cacheDir1 := filepath.Join(hostDir, utils.CacheDirName(digestFromImageURL(testImageURL)))
+		cacheDir2 := filepath.Join(hostDir, utils.CacheDirName(digestFromImageURL(testImageURL2)))
+		files1 := map[string]string{"abc/kernel.hsaco": "binary", "abc/kernel.json": "a1"}
+		files2 := map[string]string{"abc/kernel.hsaco": "binary", "abc/kernel.json": "a2"}
+		mcvExtract = fakeExtractWithIntegrity(files1, files1)
+		_, err := ExtractCache(cacheDir1, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+		mcvExtract = fakeExtractWithIntegrity(files2, files2)
+		_, err = ExtractCache(cacheDir2, testImageURL2, true, nil, logr.Discard())
+		require.NoError(t, err)
+
+		t.Logf("TEST: DedupCache() of the first cache - Should add its files to the store")
+		stats, err := DedupCache(cacheDir1, storeDir, logr.Discard())
+		require.NoError(t, err)
+		require.Equal(t, &DedupStats{}, stats)
+		storeStats, err := PruneStore(storeDir, logr.Discard())
+		require.NoError(t, err)
+		require.Equal(t, &StoreStats{Files: 2, Bytes: int64(len("binary") + len("a1"))}, storeStats)
+
+		t.Logf("TEST: DedupCache() of the second cache - Should link the identical file")
+		stats, err = DedupCache(cacheDir2, storeDir, logr.Discard())
+		require.NoError(t, err)
+		require.Equal(t, &DedupStats{Files: 1, Bytes: int64(len("binary"))}, stats)
+		require.True(t, sameFile(t, filepath.Join(cacheDir1, "abc", "kernel.hsaco"), filepath.Join(cacheDir2, "abc", "kernel.hsaco")))
+		require.False(t, sameFile(t, filepath.Join(cacheDir1, "abc", "kernel.json"), filepath.Join(cacheDir2, "abc", "kernel.json")))
+		require.Equal(t, files2, readTree(t, cacheDir2))
+		storeStats, err = PruneStore(storeDir, logr.Discard())
+		require.NoError(t, err)
+		require.Equal(t, int64(3), storeStats.Files)
+		require.Equal(t, int64(len("binary")), storeStats.SavedBytes)
+
+		t.Logf("TEST: ScrubCache() of a deduplicated cache - Should report no issues")
+		report, err := ScrubCache(cacheDir2, logr.Discard())
+		require.NoError(t, err)
+		require.Empty(t, report.Issues)
+
+		t.Logf("TEST: DedupCache() of a deduplicated cache - Should not look at its files again")
+		stats, err = DedupCache(cacheDir2, storeDir, logr.Discard())
+		require.NoError(t, err)
+		require.Equal(t, &DedupStats{}, stats)
+
+		t.Logf("TEST: PruneStore() after a cache is evicted - Should remove the files no cache uses")
+		_, err = EvictCache(cacheDir1, testImageURL, nil, logr.Discard())
+		require.NoError(t, err)
+		storeStats, err = PruneStore(storeDir, logr.Discard())
+		require.NoError(t, err)
+		require.Equal(t, int64(1), storeStats.PrunedFiles)
+		require.Equal(t, int64(len("a1")), storeStats.PrunedBytes)
+		require.Equal(t, int64(2), storeStats.Files)
+		require.Zero(t, storeStats.SavedBytes)
+		require.Equal(t, files2, readTree(t, cacheDir2))
+	})
+
+	t.Run("Test deduplication of a cache that does not match its manifest", func(t *testing.T) {
+		hostDir := t.TempDir()
+		storeDir := filepath.Join(hostDir, StoreDirName)
+		cacheDir := filepath.Join(hostDir, utils.CacheDirName(digestFromImageURL(testImageURL)))
+		files := map[string]string{"abc/kernel.hsaco": "binary"}
+		mcvExtract = fakeExtractWithIntegrity(files, files)
+		_, err := ExtractCache(cacheDir, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(cacheDir, "abc", "kernel.hsaco"), []byte("binarx"), 0644))
+
+		t.Logf("TEST: DedupCache() of a corrupted file - Should not add it to the store")
+		_, err = DedupCache(cacheDir, storeDir, logr.Discard())
+		require.NoError(t, err)
+		storeStats, err := PruneStore(storeDir, logr.Discard())
+		require.NoError(t, err)
+		require.Zero(t, storeStats.Files)
+	})
+
+	t.Run("Test deduplication without an integrity manifest", func(t *testing.T) {
+		hostDir := t.TempDir()
+		cacheDir := filepath.Join(hostDir, "cache")
+		mcvExtract = fakeExtract(map[string]string{"abc/kernel.hsaco": "binary"}, nil)
+
+		t.Logf("TEST: DedupCache() before extraction - Should return ErrNotExtracted")
+		_, err := DedupCache(cacheDir, filepath.Join(hostDir, StoreDirName), logr.Discard())
+		require.ErrorIs(t, err, ErrNotExtracted)
+
+		t.Logf("TEST: DedupCache() of a cache without a manifest - Should return ErrNoIntegrityManifest")
+		_, err = ExtractCache(cacheDir, testImageURL, true, nil, logr.Discard())
+		require.NoError(t, err)
+		_, err = DedupCache(cacheDir, filepath.Join(hostDir, StoreDirName), logr.Discard())
+		require.ErrorIs(t, err, ErrNoIntegrityManifest)
+
+		t.Logf("TEST: PruneStore() of a missing store - Should report an empty store")
+		storeStats, err := PruneStore(filepath.Join(hostDir, StoreDirName), logr.Discard())
+		require.NoError(t, err)
+		require.Equal(t, &StoreStats{}, storeStats)
+	})
+}
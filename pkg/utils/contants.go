@@ -41,26 +41,112 @@ const (
 	PvcLabelDigest         = "digest"
 	PvcLabelPvName         = "pv-name"
 
+	// VolumeSnapshot Labels
+	SnapshotLabelCache          = "cache-name"
+	SnapshotLabelCacheNamespace = "cache-namespace"
+	SnapshotLabelDigest         = "digest"
+
+	// VolumeSnapshot API, installed by the CSI external-snapshotter
+	SnapshotGroup                  = "snapshot.storage.k8s.io"
+	SnapshotVersion                = "v1"
+	SnapshotClassAnnotationDefault = "snapshot.storage.kubernetes.io/is-default-class"
+	StorageClassAnnotationDefault  = "storageclass.kubernetes.io/is-default-class"
+
+	// Copies of the image pull Secrets of a Cache, made by the Operator in the GKM Namespace
+	// and the Workload Namespaces, named "<RegistryAuthSecretPrefix>-<Cache UID>"
+	RegistryAuthSecretPrefix        = "gkm-registry-auth"
+	RegistryAuthLabelCache          = "cache-name"
+	RegistryAuthLabelCacheNamespace = "cache-namespace"
+
 	// OCI Image Label
 	ImageLabelCacheSizeBytesSubstring = "cache-size-bytes"
 
 	// Job to Extract Cache
-	JobExtractName               = "gkm-kernel-cache-extract"
-	JobExtractImage              = "quay.io/gkm/gkm-extract:latest"
-	JobInitImage                 = "quay.io/fedora/fedora-minimal"
-	JobExtractEnvCacheDir        = "GKM_CACHE_DIR"
-	JobExtractEnvImageUrl        = "GKM_IMAGE_URL"
-	JobExtractEnvNoGpu           = "NO_GPU"
-	JobExtractEnvGoLog           = "GO_LOG"
-	JobExtractPvcSourceMountName = "gkm-pvc-source"
-	JobExtractLabelPvc           = "pvc"
-	JobExtractLabelDigest        = "digest"
-	JobExtractLabelNode          = "node"
-	JobTTLSeconds                = 3600 // One hour. Can be overwritten by the value in the configmap
-	JobFSGroup                   = 1000
-	MaxLabelValueLength          = 60 // Labels can only be 63 characters
-	DigestPrefix                 = "sha256:"
-	MountPath                    = "/kernel-caches"
+	JobExtractName                 = "gkm-kernel-cache-extract"
+	JobExtractImage                = "quay.io/gkm/gkm-extract:latest"
+	JobInitImage                   = "quay.io/fedora/fedora-minimal"
+	JobExtractEnvCacheDir          = "GKM_CACHE_DIR"
+	JobExtractEnvImageUrl          = "GKM_IMAGE_URL"
+	JobExtractEnvNoGpu             = "NO_GPU"
+	JobExtractEnvGoLog             = "GO_LOG"
+	JobExtractEnvVerifyOnly        = "GKM_VERIFY_ONLY"
+	JobExtractEnvLayerPeers        = "GKM_LAYER_PEERS"
+	JobExtractEnvRegistriesConf    = "GKM_REGISTRIES_CONF"
+	JobExtractEnvRegistryCABundle  = "GKM_REGISTRY_CA_BUNDLE"
+	JobExtractEnvRegistryAuthFile  = "GKM_REGISTRY_AUTH_FILE"
+	JobExtractAuthMountName        = "gkm-registry-auth"
+	JobExtractAuthMountPath        = "/etc/gkm/auth"
+	JobExtractAuthFileName         = "config.json"
+	JobExtractPvcSourceMountName   = "gkm-pvc-source"
+	JobExtractLabelPvc             = "pvc"
+	JobExtractLabelDigest          = "digest"
+	JobExtractLabelNode            = "node"
+	JobTerminationMessagePath      = "/dev/termination-log"
+	JobTerminationMessageMaxLength = 4096 // Kubernetes truncates longer termination messages
+	JobTTLSeconds                  = 3600 // One hour. Can be overwritten by the value in the configmap
+	JobFSGroup                     = 1000
+	MaxLabelValueLength            = 60 // Labels can only be 63 characters
+	DigestPrefix                   = "sha256:"
+	MountPath                      = "/kernel-caches"
+	HostCacheDir                   = "/kernel-caches" // Each digest is extracted in a sub-directory, see CacheDirName()
+
+	// In-agent extraction. The host cache directory, which backs the hostPath PVs, is
+	// mounted in the Agent at AgentCacheDir.
+	ExtractModeJob        = "job"
+	ExtractModeAgent      = "agent"
+	ExtractWorkersDefault = 2
+	AgentCacheDir         = "/mnt/kernel-caches"
+
+	// Cluster wide limit on simultaneous registry pulls. Each pull slot is a Lease named
+	// "<PullLeasePrefix>-<slot>" in the GKM Namespace. 0 means no limit.
+	PullLeasePrefix        = "gkm-registry-pull"
+	PullLeaseDuration      = 60 * time.Second
+	ExtractMaxPullsDefault = 0
+
+	// Retry of extractions that failed with a transient error. The delay doubles on each
+	// attempt, up to ExtractRetryMaxDelay.
+	ExtractRetryLimit     = 5
+	ExtractRetryBaseDelay = 10 * time.Second
+	ExtractRetryMaxDelay  = 5 * time.Minute
+
+	// Diagnostics of failed extractions. The tail of the Job Pod log is added to the Error
+	// condition, and the GKMCache or ClusterGKMCache lists the most recent Node failures.
+	JobLogTailLines       = 20
+	JobLogTailMaxBytes    = 2048
+	EventMessageMaxLength = 1024 // Kubernetes truncates longer Event messages
+	NodeFailureMaxCount   = 5
+	NodeFailureMaxMessage = 256
+
+	// Periodic verification of the extracted caches on the Node against the integrity
+	// manifest of the OCI Image. 0 disables scrubbing.
+	ScrubIntervalDefault = 6 * time.Hour
+
+	// Eviction of unused caches from the Node, when the caches on the Node use more than the
+	// configured budget or the Node reports DiskPressure. A budget of 0 is no budget, and an
+	// interval of 0 disables eviction.
+	CacheBudgetDefault   = "0"
+	EvictIntervalDefault = 1 * time.Minute
+
+	// Periodic measurement of the disk usage of the caches on the Node, reported in the
+	// GKMCacheNode and ClusterGKMCacheNode Status. 0 disables reporting.
+	DiskUsageIntervalDefault = 5 * time.Minute
+
+	// Size of the cache of image layers kept on the Node by in-agent extraction. 0 disables it.
+	LayerCacheSizeDefault = "10Gi"
+
+	// Port of the layer server of the GKM Agent, serving the layers in its layer cache to the
+	// extractions on the other Nodes. 0 disables the layer server and fetching from peers.
+	LayerPeerPortDefault = 0
+
+	// Registries configuration of the cluster, from the optional gkm-registries ConfigMap
+	// mounted in the Operator and the Agent at RegistriesConfigDir: the registry mirrors,
+	// insecure and blocked registries in the registries.conf format, and a CA bundle trusted
+	// for every registry. The extract Jobs receive its contents in their environment.
+	RegistriesConfigDir = "/etc/gkm/registries"
+
+	// Warning Event recorded before a GKMCache or ClusterGKMCache with a TTL expires. For short
+	// TTLs, the warning is recorded halfway through the TTL instead.
+	CacheExpiryWarning = 1 * time.Hour
 
 	// Kyverno Annotations
 	KyvernoVerifyImagesAnnotation = "kyverno.io/verify-images"
@@ -84,14 +170,24 @@ const (
 	GkmCacheNodeFinalizerSubstring = "/finalizer"
 
 	// ConfigMap Indexes
-	ConfigMapIndexOperatorLogLevel = "gkm.operator.log.level"
-	ConfigMapIndexAgentImage       = "gkm.agent.image"
-	ConfigMapIndexAgentLogLevel    = "gkm.agent.log.level"
-	ConfigMapIndexExtractImage     = "gkm.extract.image"
-	ConfigMapIndexExtractLogLevel  = "gkm.extract.log.level"
-	ConfigMapIndexNoGpu            = "gkm.nogpu"
-	ConfigMapIndexKindCluster      = "gkm.kindcluster"
-	ConfigMapIndexKyvernoEnabled   = "gkm.kyverno.enabled"
+	ConfigMapIndexOperatorLogLevel  = "gkm.operator.log.level"
+	ConfigMapIndexAgentImage        = "gkm.agent.image"
+	ConfigMapIndexAgentLogLevel     = "gkm.agent.log.level"
+	ConfigMapIndexExtractImage      = "gkm.extract.image"
+	ConfigMapIndexExtractLogLevel   = "gkm.extract.log.level"
+	ConfigMapIndexExtractMode       = "gkm.extract.mode"
+	ConfigMapIndexExtractWorkers    = "gkm.extract.workers"
+	ConfigMapIndexExtractMaxPulls   = "gkm.extract.max.registry.pulls"
+	ConfigMapIndexScrubInterval     = "gkm.scrub.interval"
+	ConfigMapIndexCacheBudget       = "gkm.cache.budget"
+	ConfigMapIndexEvictInterval     = "gkm.evict.interval"
+	ConfigMapIndexDiskUsageInterval = "gkm.disk.usage.interval"
+	ConfigMapIndexCacheDedup        = "gkm.cache.dedup"
+	ConfigMapIndexLayerCacheSize    = "gkm.layer.cache.size"
+	ConfigMapIndexLayerPeerPort     = "gkm.layer.peer.port"
+	ConfigMapIndexNoGpu             = "gkm.nogpu"
+	ConfigMapIndexKindCluster       = "gkm.kindcluster"
+	ConfigMapIndexKyvernoEnabled    = "gkm.kyverno.enabled"
 
 	// Duration for Kubernetes to Retry a failed request
 	RetryOperatorConfigMapFailure = 5 * time.Second
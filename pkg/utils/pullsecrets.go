@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RegistryAuth reads the image pull Secrets names in namespace and returns the registry
+// credentials they hold, merged into a single Docker config.json. Secrets of type
+// kubernetes.io/dockerconfigjson and kubernetes.io/dockercfg are supported. When two Secrets
+// hold credentials for the same registry, the first one is used. Returns nil if names is
+// empty.
+func RegistryAuth(ctx context.Context, c client.Reader, namespace string, names []string) ([]byte, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	auths := map[string]json.RawMessage{}
+	for _, secretName := range names {
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: secretName}, secret); err != nil {
+			return nil, fmt.Errorf("unable to get image pull secret %s/%s: %w", namespace, secretName, err)
+		}
+
+		secretAuths := map[string]json.RawMessage{}
+		if data, ok := secret.Data[corev1.DockerConfigJsonKey]; ok {
+			var config struct {
+				Auths map[string]json.RawMessage `json:"auths"`
+			}
+			if err := json.Unmarshal(data, &config); err != nil {
+				return nil, fmt.Errorf("invalid image pull secret %s/%s: %w", namespace, secretName, err)
+			}
+			secretAuths = config.Auths
+		} else if data, ok := secret.Data[corev1.DockerConfigKey]; ok {
+			if err := json.Unmarshal(data, &secretAuths); err != nil {
+				return nil, fmt.Errorf("invalid image pull secret %s/%s: %w", namespace, secretName, err)
+			}
+		} else {
+			return nil, fmt.Errorf("image pull secret %s/%s has no %s or %s key",
+				namespace, secretName, corev1.DockerConfigJsonKey, corev1.DockerConfigKey)
+		}
+
+		for registry, auth := range secretAuths {
+			if _, exists := auths[registry]; !exists {
+				auths[registry] = auth
+			}
+		}
+	}
+
+	return json.Marshal(map[string]any{"auths": auths})
+}
+
+// RegistryAuthSecretName returns the name of the Secret holding the copy of the registry
+// credentials of the Cache with uid, made by the Operator.
+func RegistryAuthSecretName(uid types.UID) string {
+	return RegistryAuthSecretPrefix + "-" + string(uid)
+}
+
+// CopiedRegistryAuth returns the registry credentials of the Cache with uid, as a Docker
+// config.json, from the copy the Operator makes of its image pull Secrets in the GKM
+// Namespace.
+func CopiedRegistryAuth(ctx context.Context, c client.Reader, uid types.UID) ([]byte, error) {
+	secret := &corev1.Secret{}
+	secretName := RegistryAuthSecretName(uid)
+	if err := c.Get(ctx, types.NamespacedName{Namespace: GKMDefaultNamespace, Name: secretName}, secret); err != nil {
+		return nil, fmt.Errorf("unable to get registry credentials %s/%s: %w", GKMDefaultNamespace, secretName, err)
+	}
+	registryAuth, ok := secret.Data[JobExtractAuthFileName]
+	if !ok {
+		return nil, fmt.Errorf("registry credentials %s/%s have no %s key",
+			GKMDefaultNamespace, secretName, JobExtractAuthFileName)
+	}
+	return registryAuth, nil
+}
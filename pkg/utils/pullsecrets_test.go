@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRegistryAuth(t *testing.T) {
+	t.Run("Test merging image pull secrets", func(t *testing.T) {
+		objClient := fake.NewClientBuilder().WithObjects(
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "quay", Namespace: "ns1"},
+				Type:       corev1.SecretTypeDockerConfigJson,
+				Data: map[string][]byte{
+					corev1.DockerConfigJsonKey: []byte(`{"auths":{"quay.io":{"auth":"cXVheTpw"}}}`),
+				},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "legacy", Namespace: "ns1"},
+				Type:       corev1.SecretTypeDockercfg,
+				Data: map[string][]byte{
+					corev1.DockerConfigKey: []byte(`{"quay.io":{"auth":"b3RoZXI6cA=="},"ghcr.io":{"auth":"Z2hjcjpw"}}`),
+				},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "opaque", Namespace: "ns1"},
+				Data:       map[string][]byte{"password": []byte("p")},
+			},
+		).Build()
+		ctx := context.Background()
+
+		t.Logf("TEST: RegistryAuth() without Secrets - Should return no credentials")
+		auth, err := RegistryAuth(ctx, objClient, "ns1", nil)
+		require.NoError(t, err)
+		require.Nil(t, auth)
+
+		t.Logf("TEST: RegistryAuth() with two Secrets - Should merge them, the first one winning")
+		auth, err = RegistryAuth(ctx, objClient, "ns1", []string{"quay", "legacy"})
+		require.NoError(t, err)
+		var config struct {
+			Auths map[string]map[string]string `json:"auths"`
+		}
+		require.NoError(t, json.Unmarshal(auth, &config))
+		require.Equal(t, map[string]map[string]string{
+			"quay.io": {"auth": "cXVheTpw"},
+			"ghcr.io": {"auth": "Z2hjcjpw"},
+		}, config.Auths)
+
+		t.Logf("TEST: RegistryAuth() with a missing Secret - Should fail")
+		_, err = RegistryAuth(ctx, objClient, "ns2", []string{"quay"})
+		require.Error(t, err)
+
+		t.Logf("TEST: RegistryAuth() with a Secret that is not an image pull secret - Should fail")
+		_, err = RegistryAuth(ctx, objClient, "ns1", []string{"opaque"})
+		require.Error(t, err)
+	})
+}
+
+func TestCopiedRegistryAuth(t *testing.T) {
+	t.Run("Test reading the copy of the registry credentials", func(t *testing.T) {
+		registryAuth := []byte(`{"auths":{"quay.io":{"auth":"cXVheTpw"}}}`)
+		objClient := fake.NewClientBuilder().WithObjects(
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: RegistryAuthSecretName("1234"), Namespace: GKMDefaultNamespace},
+				Data:       map[string][]byte{JobExtractAuthFileName: registryAuth},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: RegistryAuthSecretName("5678"), Namespace: "ns1"},
+				Data:       map[string][]byte{JobExtractAuthFileName: registryAuth},
+			},
+		).Build()
+		ctx := context.Background()
+
+		t.Logf("TEST: CopiedRegistryAuth() of a copied Cache - Should return its credentials")
+		auth, err := CopiedRegistryAuth(ctx, objClient, "1234")
+		require.NoError(t, err)
+		require.Equal(t, registryAuth, auth)
+
+		t.Logf("TEST: CopiedRegistryAuth() of a Cache copied outside the GKM Namespace - Should fail")
+		_, err = CopiedRegistryAuth(ctx, objClient, "5678")
+		require.Error(t, err)
+	})
+}
@@ -79,3 +79,10 @@ func GenerateUniqueName(name string) string {
 	uuid := uuid.New().String()
 	return fmt.Sprintf("%s-%s", name, uuid[:8])
 }
+
+// CacheDirName returns the name of the directory, under the host cache directory, that the
+// GPU Kernel Cache with the given resolved digest is extracted into. Each digest has its own
+// directory so caches can be removed from the Node one at a time.
+func CacheDirName(resolvedDigest string) string {
+	return strings.TrimPrefix(resolvedDigest, DigestPrefix)
+}
@@ -43,3 +43,13 @@ func TestReplaceUrlTag(t *testing.T) {
 		require.Equal(t, updateUrl, "quay.io/gkm/cache-examples:vector-add-cache-rocm@sha256:newdigest")
 	})
 }
+
+func TestCacheDirName(t *testing.T) {
+	t.Run("Test host cache directory name of a digest", func(t *testing.T) {
+		t.Logf("TEST: CacheDirName() of a sha256 digest - Should drop the algorithm prefix")
+		require.Equal(t, "bf6f7ea60274", CacheDirName("sha256:bf6f7ea60274"))
+
+		t.Logf("TEST: CacheDirName() of a bare digest - Should return it unchanged")
+		require.Equal(t, "bf6f7ea60274", CacheDirName("bf6f7ea60274"))
+	})
+}